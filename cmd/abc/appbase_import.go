@@ -7,12 +7,16 @@ import (
 	"fmt"
 	"io/ioutil"
 	"os"
+	"regexp"
 	"strconv"
 	"strings"
 	"time"
 
 	"github.com/appbaseio/abc/appbase/app"
 	"github.com/appbaseio/abc/appbase/common"
+	"github.com/appbaseio/abc/importer/client"
+	"github.com/appbaseio/abc/importer/function/mapping"
+	"github.com/appbaseio/abc/importer/message/ops"
 	"github.com/appbaseio/abc/imports/adaptor"
 	"github.com/appbaseio/abc/log"
 	"github.com/joho/godotenv"
@@ -31,15 +35,40 @@ var srcParamMap = map[string]string{
 	"sac_path":         "sacPath",
 	// "timeout":          "timeout",
 	"transform_file": "_transform_",
+	"mapping_file":   "_mapping_",
 	"log_dir":        "log_dir",
+	// elasticsearch source
+	"src_api_key":              "api_key",
+	"src_bearer_token":         "bearer_token",
+	"src_cacert":               "cacerts",
+	"src_client_cert":          "client_cert",
+	"src_client_key":           "client_key",
+	"src_insecure_skip_verify": "insecure_skip_verify",
+	"src_query_file":           "query_file",
+	"src_source_fields":        "source_fields",
+	"src_slices":               "slices",
+	"src_copy_metadata":        "copy_metadata",
 }
 
 var destParamMap = map[string]string{
-	"dest_uri":      "uri",
-	"dest_type":     "_name_",
-	"tail":          "tail",
-	"request_size":  "request_size",
-	"bulk_requests": "bulk_requests",
+	"dest_uri":             "uri",
+	"dest_type":            "_name_",
+	"tail":                 "tail",
+	"request_size":         "request_size",
+	"bulk_requests":        "bulk_requests",
+	"bulk_workers":         "bulk_workers",
+	"dead_letter_file":     "dead_letter_file",
+	"max_failures":         "max_failures",
+	"alias":                "alias",
+	"delete_old_indices":   "delete_old_indices",
+	"api_key":              "api_key",
+	"bearer_token":         "bearer_token",
+	"cacert":               "cacerts",
+	"client_cert":          "client_cert",
+	"client_key":           "client_key",
+	"insecure_skip_verify": "insecure_skip_verify",
+	"gzip":                 "gzip",
+	"max_idle_conns":       "max_idle_conns",
 }
 
 const basicUsage string = `abc import --src_type={SourceDatabase} --src_uri={SourceURI} [-t|--tail] [Cluster URL|App Name]`
@@ -64,17 +93,44 @@ func runImport(args []string) error {
 	ssl := flagset.Bool("ssl", false, "Enable SSL connection to the source.")
 	requestSize := flagset.Int64("request_size", 2<<19, "Http request size in bytes, specifically for bulk requests to ES.")
 	bulkRequests := flagset.Int("bulk_requests", 1000, "Number of bulk requests to send during a network request to ES.")
+	bulkWorkers := flagset.Int("bulk_workers", 1, "Number of bulk requests sent to ES at the same time.")
+	deadLetterFile := flagset.String("dead_letter_file", "", "JSON lines file receiving the documents that failed to be indexed.")
+	maxFailures := flagset.Int("max_failures", 0, "Number of documents allowed to fail before the import aborts, -1 for no limit.")
+	gzip := flagset.Bool("gzip", false, "Gzip the bulk requests sent to ES.")
+	maxIdleConns := flagset.Int("max_idle_conns", 0, "Number of idle connections kept open to each ES node, 2 by default, set it to at least bulk_workers.")
+	alias := flagset.Bool("alias", false, "Import into a new index and atomically move the destination index, as an alias, to it once done.")
+	deleteOldIndices := flagset.Bool("delete_old_indices", false, "With --alias, delete the indices the alias pointed to before.")
 
 	logDir := flagset.String("log_dir", "", "used for storing commit logs")
 
 	transformFile := flagset.String("transform_file", "", "transform file to use")
 
 	verify := flagset.Bool("verify", false, "verify the source and destination connections")
+	printMapping := flagset.Bool("print-mapping", false, "print the mapping generated from the schema of the source tables [mysql, postgres, mssql], or inferred from the first documents of other sources, and exit")
+	sampleSize := flagset.Int("sample_size", mapping.DefaultSampleSize, "number of documents the mapping printed by --print-mapping is inferred from")
+	mappingFile := flagset.String("mapping_file", "", "JSON file holding the mapping of the destination index, like the one printed by --print-mapping")
 
 	srcUsername := flagset.String("src_username", "", "source username")
 	srcPassword := flagset.String("src_password", "", "source password")
 	srcRealm := flagset.String("src_realm", "", "source realm")
 
+	apiKey := flagset.String("api_key", "", "API key, as id:api_key or base64 encoded, of the destination cluster.")
+	bearerToken := flagset.String("bearer_token", "", "Bearer token of the destination cluster.")
+	caCert := flagset.String("cacert", "", "Comma separated CA certificate files the destination cluster certificate is verified with.")
+	clientCert := flagset.String("client_cert", "", "Client certificate file presented to the destination cluster.")
+	clientKey := flagset.String("client_key", "", "Key file of the client certificate presented to the destination cluster.")
+	insecureSkipVerify := flagset.Bool("insecure_skip_verify", false, "Do not verify the certificate of the destination cluster.")
+	srcAPIKey := flagset.String("src_api_key", "", "[elasticsearch] API key, as id:api_key or base64 encoded, of the source cluster")
+	srcBearerToken := flagset.String("src_bearer_token", "", "[elasticsearch] bearer token of the source cluster")
+	srcCACert := flagset.String("src_cacert", "", "[elasticsearch] comma separated CA certificate files the source cluster certificate is verified with")
+	srcClientCert := flagset.String("src_client_cert", "", "[elasticsearch] client certificate file presented to the source cluster")
+	srcClientKey := flagset.String("src_client_key", "", "[elasticsearch] key file of the client certificate presented to the source cluster")
+	srcQueryFile := flagset.String("src_query_file", "", "[elasticsearch] file holding the query DSL filtering the documents read")
+	srcSourceFields := flagset.String("src_source_fields", "", "[elasticsearch] comma separated _source fields of the documents read")
+	srcSlices := flagset.Int("src_slices", 1, "[elasticsearch] number of slices of the index read in parallel")
+	srcCopyMetadata := flagset.Bool("src_copy_metadata", false, "[elasticsearch] create the destination index with the mappings, settings and aliases of the source index")
+	srcInsecureSkipVerify := flagset.Bool("src_insecure_skip_verify", false, "[elasticsearch] do not verify the certificate of the source cluster")
+
 	// use external config
 	config := flagset.String("config", "", "Path to external config file, if specified, only that is used")
 
@@ -110,11 +166,28 @@ func runImport(args []string) error {
 		"sacPath":          *sacPath,
 		"ssl":              *ssl,
 		"_transform_":      *transformFile,
+		"_mapping_":        *mappingFile,
 		"log_dir":          *logDir,
 		"username":         *srcUsername,
 		"password":         *srcPassword,
 		"realm":            *srcRealm,
 	}
+	if *srcType == "elasticsearch" {
+		srcConfig["api_key"] = *srcAPIKey
+		srcConfig["bearer_token"] = *srcBearerToken
+		srcConfig["cacerts"] = commaList(*srcCACert)
+		srcConfig["client_cert"] = *srcClientCert
+		srcConfig["client_key"] = *srcClientKey
+		srcConfig["insecure_skip_verify"] = *srcInsecureSkipVerify
+		srcConfig["query_file"] = *srcQueryFile
+		srcConfig["source_fields"] = commaList(*srcSourceFields)
+		srcConfig["slices"] = *srcSlices
+		srcConfig["copy_metadata"] = *srcCopyMetadata
+	}
+
+	if *printMapping {
+		return printSourceMapping(srcConfig, *sampleSize)
+	}
 
 	// use command line params
 	args = flagset.Args()
@@ -131,11 +204,24 @@ func runImport(args []string) error {
 
 	// create destination config
 	var destConfig = map[string]interface{}{
-		"uri":           destURL,
-		"_name_":        "elasticsearch",
-		"request_size":  *requestSize,
-		"bulk_requests": *bulkRequests,
-		"tail":          *tail,
+		"uri":                  destURL,
+		"_name_":               "elasticsearch",
+		"request_size":         *requestSize,
+		"bulk_requests":        *bulkRequests,
+		"bulk_workers":         *bulkWorkers,
+		"dead_letter_file":     *deadLetterFile,
+		"max_failures":         *maxFailures,
+		"gzip":                 *gzip,
+		"max_idle_conns":       *maxIdleConns,
+		"alias":                *alias,
+		"delete_old_indices":   *deleteOldIndices,
+		"tail":                 *tail,
+		"api_key":              *apiKey,
+		"bearer_token":         *bearerToken,
+		"cacerts":              commaList(*caCert),
+		"client_cert":          *clientCert,
+		"client_key":           *clientKey,
+		"insecure_skip_verify": *insecureSkipVerify,
 	}
 
 	// write config file
@@ -177,6 +263,23 @@ func execBuilder(file string, isTest bool) error {
 
 // writeConfigFile writes config information in a pipeline file
 func writeConfigFile(srcConfig map[string]interface{}, destConfig map[string]interface{}) (string, map[string]adaptor.Adaptor, error) {
+	// mapping of the destination index, set by the transform file when there is one
+	var mappingCall string
+	if srcConfig["_mapping_"] != nil && srcConfig["_mapping_"] != "" {
+		if srcConfig["_transform_"] != "" {
+			return "", nil, fmt.Errorf("mapping_file is not used with a transform file, set the mapping with Mapping() in it")
+		}
+		dat, err := ioutil.ReadFile(srcConfig["_mapping_"].(string))
+		if err != nil {
+			return "", nil, err
+		}
+		var m map[string]interface{}
+		if err := json.Unmarshal(dat, &m); err != nil {
+			return "", nil, fmt.Errorf("invalid mapping in %s, %s", srcConfig["_mapping_"], err)
+		}
+		b, _ := json.Marshal(m)
+		mappingCall = fmt.Sprintf(".Mapping(%s)", b)
+	}
 	fname := "pipeline_" + strconv.FormatInt(time.Now().UnixNano(), 10) + ".js"
 
 	if _, err := os.Stat(fname); err == nil {
@@ -253,15 +356,15 @@ func writeConfigFile(srcConfig map[string]interface{}, destConfig map[string]int
 
 		// set Config({log_dir})
 		if srcConfig["log_dir"] != "" {
-			confStr := fmt.Sprintf(`t.Config({"log_dir":"%s"}).Source("source", source, "/%s/").Save("sink", sink, "/.*/")`, srcConfig["log_dir"], srcConfig["srcRegex"])
+			confStr := fmt.Sprintf(`t.Config({"log_dir":"%s"}).Source("source", source, "/%s/")%s.Save("sink", sink, "/.*/")`, srcConfig["log_dir"], srcConfig["srcRegex"], mappingCall)
 
 			fmt.Println(confStr)
 
 			appFileHandle.WriteString(confStr)
 		} else {
 			appFileHandle.WriteString(
-				fmt.Sprintf(`t.Source("source", source, "/%s/").Save("sink", sink, "/.*/")`,
-					srcConfig["srcRegex"]),
+				fmt.Sprintf(`t.Source("source", source, "/%s/")%s.Save("sink", sink, "/.*/")`,
+					srcConfig["srcRegex"], mappingCall),
 			)
 		}
 	}
@@ -285,6 +388,7 @@ func genPipelineFromEnv(filename string) (string, map[string]adaptor.Adaptor, er
 	src := map[string]interface{}{
 		"srcRegex":    ".*", // custom param defaults
 		"_transform_": "",
+		"_mapping_":   "",
 	}
 	for k, v := range srcParamMap {
 		if val, ok := config[k]; ok {
@@ -297,6 +401,15 @@ func genPipelineFromEnv(filename string) (string, map[string]adaptor.Adaptor, er
 					src[v] = false
 				}
 			}
+			if k == "src_cacert" || k == "src_source_fields" {
+				src[v] = commaList(val)
+			}
+			if k == "src_slices" {
+				src[v], _ = strconv.Atoi(val)
+			}
+			if k == "src_insecure_skip_verify" || k == "src_copy_metadata" {
+				src[v] = val == "true"
+			}
 			// ssl should be boolean
 			if k == "ssl" {
 				if val == "true" {
@@ -319,6 +432,16 @@ func genPipelineFromEnv(filename string) (string, map[string]adaptor.Adaptor, er
 					dest[v] = false
 				}
 			}
+			// alias and delete_old_indices should be boolean
+			if k == "alias" || k == "delete_old_indices" {
+				dest[v] = val == "true"
+			}
+			if k == "cacert" {
+				dest[v] = commaList(val)
+			}
+			if k == "insecure_skip_verify" || k == "gzip" {
+				dest[v] = val == "true"
+			}
 		}
 	}
 	// generate file
@@ -330,6 +453,14 @@ func genPipelineFromEnv(filename string) (string, map[string]adaptor.Adaptor, er
 	return file, configuredAdaptors, nil
 }
 
+// commaList returns the values of a comma separated flag.
+func commaList(list string) []string {
+	if list == "" {
+		return nil
+	}
+	return strings.Split(list, ",")
+}
+
 func verifyConnections(adaptors map[string]adaptor.Adaptor) error {
 	for _, ad := range adaptors {
 		err := ad.Verify()
@@ -340,6 +471,80 @@ func verifyConnections(adaptors map[string]adaptor.Adaptor) error {
 	return nil
 }
 
+// printSourceMapping prints a mapping of the destination index, generated from the schema of the
+// tables of a SQL source or inferred from the first sampleSize documents of other sources.
+func printSourceMapping(srcConfig map[string]interface{}, sampleSize int) error {
+	var config = make(map[string]interface{})
+	for k, v := range srcConfig {
+		config[k] = v
+	}
+	// the tables are described, or the documents sampled, by the reader copying them
+	config["tail"] = false
+	ad, err := adaptor.GetAdaptor(srcConfig["_name_"].(string), config)
+	if err != nil {
+		return err
+	}
+	reader, err := ad.Reader()
+	if err != nil {
+		return err
+	}
+	filter, err := regexp.Compile(srcConfig["srcRegex"].(string))
+	if err != nil {
+		return err
+	}
+	c, err := ad.Client()
+	if err != nil {
+		return err
+	}
+	if closer, ok := c.(client.Closer); ok {
+		defer closer.Close()
+	}
+	s, err := c.Connect()
+	if err != nil {
+		return err
+	}
+	var m map[string]interface{}
+	if describer, ok := reader.(mapping.Describer); ok {
+		schemas, err := describer.Describe(s, filter.MatchString)
+		if err != nil {
+			return err
+		}
+		m = mapping.FromSchema(schemas...)
+	} else if m, err = sampleMapping(reader, s, filter.MatchString, sampleSize); err != nil {
+		return err
+	}
+	b, err := json.MarshalIndent(m, "", "  ")
+	if err != nil {
+		return err
+	}
+	fmt.Println(string(b))
+	return nil
+}
+
+// sampleMapping infers a mapping from the first sampleSize documents read from a source.
+func sampleMapping(reader client.Reader, s client.Session, filterFn client.NsFilterFunc, sampleSize int) (map[string]interface{}, error) {
+	done := make(chan struct{})
+	defer close(done)
+	msgs, err := reader.Read(map[string]client.MessageSet{}, filterFn)(s, done)
+	if err != nil {
+		return nil, err
+	}
+	inferrer := mapping.NewInferrer()
+	n := 0
+	for n < sampleSize {
+		ms, ok := <-msgs
+		if !ok {
+			break
+		}
+		if ms.Msg.OP() == ops.Insert {
+			inferrer.Add(ms.Msg.Data())
+			n++
+		}
+	}
+	log.Infof("mapping inferred from %d documents", n)
+	return inferrer.Mapping(), nil
+}
+
 func verifyConnectionsWithoutDestination(srcConfig map[string]interface{}) error {
 	var config = make(map[string]interface{})
 	for k, v := range srcConfig {
@@ -94,6 +94,10 @@ type Node struct {
 	vm     *goja.Runtime
 	parent *pipeline.Node
 	config *config
+	// sink is the adaptor of a sink node
+	sink adaptor.Adaptor
+	// mappings are set on the sinks saved from the node
+	mappings []indexMapping
 }
 
 // Transformer encapsulates a pipeline.Transform and tracks the Source node.
@@ -102,6 +106,13 @@ type Transformer struct {
 	source     *pipeline.Node
 	transforms []*pipeline.Transform
 	config     *config
+	mappings   []indexMapping
+}
+
+// indexMapping is the mapping of the indices of a sink matching pattern.
+type indexMapping struct {
+	pattern string
+	mapping map[string]interface{}
 }
 
 // Adaptor wraps the underlyig adaptor.Adaptor to be exposed in the JS.
@@ -131,7 +142,11 @@ func (t *Transporter) run() error {
 			close(cancel)
 		})
 	}
-	return g.Run()
+	if err := g.Run(); err != nil {
+		return err
+	}
+	// the writers are completed once the pipeline stopped
+	return p.Err
 }
 
 func interrupt(cancel <-chan struct{}) error {
@@ -188,24 +203,66 @@ func (t *Transporter) Config(call goja.FunctionCall) goja.Value {
 	return t.vm.ToValue(t)
 }
 
-// Mapping .. set mapping
+// Mapping sets the mapping of the indices of the sink saved next, see mappingArgs for its
+// arguments.
 func (t *Transformer) Mapping(call goja.FunctionCall) goja.Value {
-	if cfg, ok := call.Argument(0).Export().(map[string]interface{}); ok {
-		mapping.CurrentMapping = cfg
-		mapping.IsMappingSet = true
-	}
+	t.mappings = append(t.mappings, mappingArgs(call.Arguments))
 	return t.vm.ToValue(t)
 }
 
-// Mapping ..
+// Mapping sets the mapping of the indices of the sink node, or of the sinks saved from a source
+// node. See mappingArgs for its arguments.
 func (n *Node) Mapping(call goja.FunctionCall) goja.Value {
-	if cfg, ok := call.Argument(0).Export().(map[string]interface{}); ok {
-		mapping.CurrentMapping = cfg
-		mapping.IsMappingSet = true
+	m := mappingArgs(call.Arguments)
+	if n.sink == nil {
+		n.mappings = append(n.mappings, m)
+		return n.vm.ToValue(n)
+	}
+	mapper, ok := n.sink.(mapping.Mapper)
+	if !ok {
+		panic(fmt.Sprintf("%s does not accept a mapping", n.parent.Type))
+	}
+	if err := mapper.AddMapping(m.pattern, m.mapping); err != nil {
+		panic(err)
 	}
 	return n.vm.ToValue(n)
 }
 
+// mappingArgs returns the index pattern and the mapping of the arguments of Mapping, either
+// ("pattern", mapping) or (mapping) for the indices no pattern matches.
+func mappingArgs(args []goja.Value) indexMapping {
+	var m indexMapping
+	if len(args) > 1 {
+		pattern, ok := args[0].Export().(string)
+		if !ok {
+			panic("the index pattern of a mapping must be a string")
+		}
+		m.pattern = pattern
+		args = args[1:]
+	}
+	if len(args) > 0 {
+		m.mapping, _ = args[0].Export().(map[string]interface{})
+	}
+	if m.mapping == nil {
+		panic("Mapping requires a mapping object")
+	}
+	return m
+}
+
+// setMappings sets the mappings on the adaptor of a sink, they are ignored by the adaptors not
+// writing to indices.
+func setMappings(a adaptor.Adaptor, mappings []indexMapping) {
+	mapper, ok := a.(mapping.Mapper)
+	if !ok {
+		return
+	}
+	for _, m := range mappings {
+		if err := mapper.AddMapping(m.pattern, m.mapping); err != nil {
+			panic(err)
+		}
+	}
+}
+
 func (t *Transporter) Source(call goja.FunctionCall) goja.Value {
 	name, out, namespace := exportArgs(call.Arguments)
 	a := out.(Adaptor)
@@ -227,7 +284,7 @@ func (t *Transporter) Source(call goja.FunctionCall) goja.Value {
 		panic(err)
 	}
 	t.sourceNode = n
-	return t.vm.ToValue(&Node{t.vm, n, t.config})
+	return t.vm.ToValue(&Node{vm: t.vm, parent: n, config: t.config})
 }
 
 func (n *Node) Transform(call goja.FunctionCall) goja.Value {
@@ -241,6 +298,7 @@ func (n *Node) Transform(call goja.FunctionCall) goja.Value {
 		source:     n.parent,
 		transforms: make([]*pipeline.Transform, 0),
 		config:     n.config,
+		mappings:   append([]indexMapping(nil), n.mappings...),
 	}
 	tf.transforms = append(tf.transforms, &pipeline.Transform{Name: name, Fn: f.(function.Function), NsFilter: compiledNs})
 	return n.vm.ToValue(tf)
@@ -278,7 +336,8 @@ func (n *Node) Save(call goja.FunctionCall) goja.Value {
 	if err != nil {
 		panic(err)
 	}
-	return n.vm.ToValue(&Node{n.vm, child, n.config})
+	setMappings(a.a, n.mappings)
+	return n.vm.ToValue(&Node{vm: n.vm, parent: child, config: n.config, sink: a.a})
 }
 
 func (tf *Transformer) Save(call goja.FunctionCall) goja.Value {
@@ -303,7 +362,8 @@ func (tf *Transformer) Save(call goja.FunctionCall) goja.Value {
 	if err != nil {
 		panic(err)
 	}
-	return tf.vm.ToValue(&Node{tf.vm, child, tf.config})
+	setMappings(a.a, tf.mappings)
+	return tf.vm.ToValue(&Node{vm: tf.vm, parent: child, config: tf.config, sink: a.a})
 }
 
 // arguments can be any of the following forms:
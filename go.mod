@@ -42,6 +42,7 @@ require (
 	github.com/smartystreets/go-aws-auth v0.0.0-20180515143844-0c1422d1fdb9
 	github.com/streadway/amqp v1.0.0
 	google.golang.org/api v0.56.0
+	google.golang.org/grpc v1.40.0
 	gopkg.in/AlecAivazis/survey.v1 v1.8.8
 	gopkg.in/fatih/pool.v2 v2.0.0 // indirect
 	gopkg.in/gorethink/gorethink.v3 v3.0.5
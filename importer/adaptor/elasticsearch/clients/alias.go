@@ -0,0 +1,139 @@
+package clients
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"sort"
+	"time"
+
+	"github.com/appbaseio/abc/log"
+	"github.com/olivere/elastic/v7"
+)
+
+// aliasTimeFormat is the suffix of the indices imported behind an alias.
+const aliasTimeFormat = "20060102150405"
+
+// AliasIndex returns the timestamped index an import behind alias writes to.
+func AliasIndex(alias string, t time.Time) string {
+	return fmt.Sprintf("%s-%s", alias, t.UTC().Format(aliasTimeFormat))
+}
+
+// AliasSwap points an alias to the index an import wrote to once it completed, the indices
+// the alias pointed to before are deleted when deleteOld is set.
+type AliasSwap struct {
+	client    *elastic.Client
+	alias     string
+	index     string
+	deleteOld bool
+	logger    log.Logger
+}
+
+// NewAliasSwap returns an AliasSwap moving alias to index.
+func NewAliasSwap(esClient *elastic.Client, alias, index string, deleteOld bool, logger log.Logger) *AliasSwap {
+	return &AliasSwap{client: esClient, alias: alias, index: index, deleteOld: deleteOld, logger: logger}
+}
+
+// Alias returns the alias moved, empty for a nil AliasSwap.
+func (a *AliasSwap) Alias() string {
+	if a == nil {
+		return ""
+	}
+	return a.alias
+}
+
+// Check makes sure the alias can be swapped before importing, an index already named like the
+// alias can only be replaced when the old indices are deleted.
+func (a *AliasSwap) Check(ctx context.Context) error {
+	concrete, err := a.concreteIndex(ctx)
+	if err != nil {
+		return err
+	}
+	if concrete && !a.deleteOld {
+		return fmt.Errorf("index %s exists, it can only be replaced by an alias when the old index is deleted", a.alias)
+	}
+	return nil
+}
+
+// Swap atomically moves the alias to the imported index. When nothing was written to it, the
+// index is created with mapping, the mapping the writer would have created it with.
+func (a *AliasSwap) Swap(ctx context.Context, mapping map[string]interface{}) error {
+	exists, err := a.client.IndexExists(a.index).Do(ctx)
+	if err != nil {
+		return err
+	}
+	if !exists {
+		create := a.client.CreateIndex(a.index)
+		if mapping != nil {
+			create = create.BodyJson(map[string]interface{}{"mappings": mapping})
+		}
+		if _, err := create.Do(ctx); err != nil {
+			return fmt.Errorf("unable to create index %s, %s", a.index, err)
+		}
+	}
+	// make the imported documents searchable before the alias points to them
+	if _, err := a.client.Refresh(a.index).Do(ctx); err != nil {
+		return fmt.Errorf("unable to refresh index %s, %s", a.index, err)
+	}
+
+	concrete, err := a.concreteIndex(ctx)
+	if err != nil {
+		return err
+	}
+	old, err := a.aliasedIndices(ctx)
+	if err != nil {
+		return err
+	}
+
+	actions := []elastic.AliasAction{elastic.NewAliasAddAction(a.alias).Index(a.index)}
+	for _, index := range old {
+		actions = append(actions, elastic.NewAliasRemoveAction(a.alias).Index(index))
+	}
+	if concrete {
+		actions = append(actions, elastic.NewAliasRemoveIndexAction(a.alias))
+	}
+	if _, err := a.client.Alias().Action(actions...).Do(ctx); err != nil {
+		return fmt.Errorf("unable to move alias %s to %s, %s", a.alias, a.index, err)
+	}
+	a.logger.With("alias", a.alias).With("index", a.index).Infoln("alias moved to the imported index")
+
+	if !a.deleteOld || len(old) == 0 {
+		return nil
+	}
+	if _, err := a.client.DeleteIndex(old...).Do(ctx); err != nil {
+		return fmt.Errorf("unable to delete old indices %v, %s", old, err)
+	}
+	a.logger.With("alias", a.alias).Infof("deleted old indices %v", old)
+	return nil
+}
+
+// concreteIndex returns whether an index, and not an alias, is named like the alias.
+func (a *AliasSwap) concreteIndex(ctx context.Context) (bool, error) {
+	exists, err := a.client.IndexExists(a.alias).Do(ctx)
+	if err != nil || !exists {
+		return false, err
+	}
+	old, err := a.aliasedIndices(ctx)
+	if err != nil {
+		return false, err
+	}
+	return len(old) == 0, nil
+}
+
+// aliasedIndices returns the indices the alias points to, other than the imported one.
+func (a *AliasSwap) aliasedIndices(ctx context.Context) ([]string, error) {
+	res, err := a.client.Aliases().Alias(a.alias).Do(ctx)
+	if elastic.IsStatusCode(err, http.StatusNotFound) {
+		return nil, nil
+	} else if err != nil {
+		return nil, fmt.Errorf("unable to get the indices of alias %s, %s", a.alias, err)
+	}
+	var indices []string
+	for _, index := range res.IndicesByAlias(a.alias) {
+		if index != a.index {
+			indices = append(indices, index)
+		}
+	}
+	sort.Strings(indices)
+	return indices, nil
+}
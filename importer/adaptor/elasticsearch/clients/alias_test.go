@@ -0,0 +1,181 @@
+package clients
+
+import (
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/appbaseio/abc/log"
+	"github.com/olivere/elastic/v7"
+)
+
+// aliasServer fakes the index and alias APIs of a cluster holding indices, aliases maps the
+// aliases to their indices.
+type aliasServer struct {
+	sync.Mutex
+	indices map[string]bool
+	aliases map[string][]string
+	actions []string
+	// created holds the body of the indices created
+	created map[string]string
+}
+
+func (s *aliasServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s.Lock()
+	defer s.Unlock()
+	path := strings.Trim(r.URL.Path, "/")
+	switch {
+	case r.Method == http.MethodGet && strings.HasPrefix(path, "_alias/"):
+		alias := strings.TrimPrefix(path, "_alias/")
+		if len(s.aliases[alias]) == 0 {
+			w.WriteHeader(http.StatusNotFound)
+			json.NewEncoder(w).Encode(map[string]interface{}{"error": "alias [" + alias + "] missing", "status": 404})
+			return
+		}
+		res := map[string]interface{}{}
+		for _, index := range s.aliases[alias] {
+			res[index] = map[string]interface{}{"aliases": map[string]interface{}{alias: map[string]interface{}{}}}
+		}
+		json.NewEncoder(w).Encode(res)
+	case r.Method == http.MethodPost && path == "_aliases":
+		b, _ := ioutil.ReadAll(r.Body)
+		s.actions = append(s.actions, string(b))
+		w.Write([]byte(`{"acknowledged":true}`))
+	case r.Method == http.MethodPost && strings.HasSuffix(path, "/_refresh"):
+		w.Write([]byte(`{"_shards":{"total":1,"successful":1,"failed":0}}`))
+	case r.Method == http.MethodHead:
+		_, alias := s.aliases[path]
+		if !s.indices[path] && !alias {
+			w.WriteHeader(http.StatusNotFound)
+		}
+	case r.Method == http.MethodPut:
+		s.indices[path] = true
+		if s.created != nil {
+			b, _ := ioutil.ReadAll(r.Body)
+			s.created[path] = string(b)
+		}
+		w.Write([]byte(`{"acknowledged":true,"index":"` + path + `"}`))
+	case r.Method == http.MethodDelete:
+		s.actions = append(s.actions, "delete "+path)
+		w.Write([]byte(`{"acknowledged":true}`))
+	default:
+		w.WriteHeader(http.StatusBadRequest)
+	}
+}
+
+var aliasSwapTests = []struct {
+	name      string
+	indices   []string
+	aliases   map[string][]string
+	deleteOld bool
+	checkErr  bool
+	actions   []string
+}{
+	{
+		"new alias",
+		nil,
+		nil,
+		false,
+		false,
+		[]string{`{"actions":[{"add":{"alias":"app","index":"app-20200102030405"}}]}`},
+	},
+	{
+		"move alias",
+		[]string{"app-1", "app-20200102030405"},
+		map[string][]string{"app": {"app-1"}},
+		false,
+		false,
+		[]string{`{"actions":[{"add":{"alias":"app","index":"app-20200102030405"}},{"remove":{"alias":"app","index":"app-1"}}]}`},
+	},
+	{
+		"move alias and delete old indices",
+		[]string{"app-1", "app-2"},
+		map[string][]string{"app": {"app-2", "app-1"}},
+		true,
+		false,
+		[]string{
+			`{"actions":[{"add":{"alias":"app","index":"app-20200102030405"}},{"remove":{"alias":"app","index":"app-1"}},{"remove":{"alias":"app","index":"app-2"}}]}`,
+			"delete app-1,app-2",
+		},
+	},
+	{
+		"replace index",
+		[]string{"app"},
+		nil,
+		true,
+		false,
+		[]string{`{"actions":[{"add":{"alias":"app","index":"app-20200102030405"}},{"remove_index":{"index":"app"}}]}`},
+	},
+	{
+		"index without deleting",
+		[]string{"app"},
+		nil,
+		false,
+		true,
+		nil,
+	},
+}
+
+func TestAliasSwap(t *testing.T) {
+	index := AliasIndex("app", time.Date(2020, 1, 2, 3, 4, 5, 0, time.UTC))
+	if index != "app-20200102030405" {
+		t.Fatalf("wrong alias index, got %s", index)
+	}
+	for _, at := range aliasSwapTests {
+		s := &aliasServer{indices: make(map[string]bool), aliases: at.aliases}
+		for _, i := range at.indices {
+			s.indices[i] = true
+		}
+		ts := httptest.NewServer(s)
+		esClient, err := elastic.NewClient(elastic.SetURL(ts.URL), elastic.SetSniff(false), elastic.SetHealthcheck(false))
+		if err != nil {
+			t.Fatalf("unable to create client, %s", err)
+		}
+
+		a := NewAliasSwap(esClient, "app", index, at.deleteOld, log.With("test", at.name))
+		err = a.Check(context.Background())
+		if (err != nil) != at.checkErr {
+			t.Errorf("[%s] wrong Check error, got %v", at.name, err)
+		}
+		if err == nil {
+			if err := a.Swap(context.Background(), nil); err != nil {
+				t.Errorf("[%s] unexpected Swap error, %s", at.name, err)
+			}
+			if !s.indices[index] {
+				t.Errorf("[%s] imported index not created", at.name)
+			}
+		}
+		if !reflect.DeepEqual(s.actions, at.actions) {
+			t.Errorf("[%s] wrong actions\nexpected: %v\ngot: %v", at.name, at.actions, s.actions)
+		}
+		ts.Close()
+	}
+}
+
+func TestAliasSwapEmptyCopy(t *testing.T) {
+	s := &aliasServer{indices: make(map[string]bool), created: make(map[string]string)}
+	ts := httptest.NewServer(s)
+	defer ts.Close()
+	esClient, err := elastic.NewClient(elastic.SetURL(ts.URL), elastic.SetSniff(false), elastic.SetHealthcheck(false))
+	if err != nil {
+		t.Fatalf("unable to create client, %s", err)
+	}
+
+	// nothing was written, the index is created with the mapping of the writer
+	a := NewAliasSwap(esClient, "app", "app-1", false, log.With("test", "empty copy"))
+	mapping := map[string]interface{}{"properties": map[string]interface{}{"name": map[string]interface{}{"type": "keyword"}}}
+	if err := a.Swap(context.Background(), mapping); err != nil {
+		t.Fatalf("unexpected Swap error, %s", err)
+	}
+	expected := `{"mappings":{"properties":{"name":{"type":"keyword"}}}}`
+	if body := strings.TrimSpace(s.created["app-1"]); body != expected {
+		t.Errorf("wrong index body, expected %s, got %s", expected, body)
+	}
+}
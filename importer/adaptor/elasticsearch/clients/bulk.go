@@ -0,0 +1,352 @@
+package clients
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/appbaseio/abc/log"
+	"github.com/olivere/elastic/v7"
+)
+
+const (
+	// DefaultBulkRetries is the number of times the items rejected with a retryable status are sent again.
+	DefaultBulkRetries = 5
+)
+
+var (
+	// ErrTooManyFailures is returned once more documents failed to be indexed than allowed by max_failures.
+	ErrTooManyFailures = errors.New("too many documents failed to be indexed")
+
+	retryBackoff = elastic.NewExponentialBackoff(100*time.Millisecond, 30*time.Second)
+)
+
+// Item is a bulk request along with the document and the confirms channel of the message it was created from.
+type Item struct {
+	Request  elastic.BulkableRequest
+	Action   string
+	Index    string
+	ID       string
+	Doc      map[string]interface{}
+	Confirms chan struct{}
+
+	size int64
+}
+
+// Failure describes an item that could not be indexed, it is what gets written to the dead letter output.
+type Failure struct {
+	Index    string                 `json:"index"`
+	ID       string                 `json:"id,omitempty"`
+	Action   string                 `json:"action"`
+	Status   int                    `json:"status"`
+	Error    *elastic.ErrorDetails  `json:"error,omitempty"`
+	Document map[string]interface{} `json:"document,omitempty"`
+	Time     time.Time              `json:"time"`
+}
+
+// DeadLetter receives the documents that failed to be indexed.
+type DeadLetter interface {
+	Write([]*Failure) error
+	Close() error
+}
+
+// Committer sends bulk requests, retrying the items rejected with a retryable status and handing
+// the items that failed for good to the dead letter output.
+type Committer struct {
+	client      *elastic.Client
+	index       string
+	retries     int
+	maxFailures int
+	deadLetter  DeadLetter
+	logger      log.Logger
+	// versioned ignores the conflicts of documents older than the indexed ones
+	versioned bool
+
+	sync.Mutex
+	failed map[string]int
+	total  int
+}
+
+// NewCommitter returns a Committer sending to the default index of the client options, the dead
+// letter output is created from the options as well.
+func NewCommitter(esClient *elastic.Client, opts *ClientOptions, logger log.Logger) (*Committer, error) {
+	c := &Committer{
+		client:      esClient,
+		index:       opts.Index,
+		retries:     opts.BulkRetries,
+		maxFailures: opts.MaxFailures,
+		logger:      logger,
+		versioned:   opts.Request.Versioned(),
+		failed:      make(map[string]int),
+	}
+	switch {
+	case opts.DeadLetterFile != "":
+		f, err := os.OpenFile(opts.DeadLetterFile, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0644)
+		if err != nil {
+			return nil, err
+		}
+		c.deadLetter = &fileDeadLetter{f: f}
+	case opts.DeadLetterIndex != "":
+		c.deadLetter = newIndexDeadLetter(esClient, opts.DeadLetterIndex, logger)
+	}
+	return c, nil
+}
+
+// Commit sends the items, the confirms channel of an item is closed once it is indexed or, if
+// it failed, once it is written to the dead letter output. ErrTooManyFailures is returned when
+// more than max_failures documents failed.
+func (c *Committer) Commit(ctx context.Context, items []*Item) error {
+	pending := items
+	for attempt := 1; ; attempt++ {
+		bs := c.client.Bulk().Index(c.index)
+		for _, item := range pending {
+			bs.Add(item.Request)
+		}
+		res, err := bs.Do(ctx)
+		if err != nil {
+			if attempt <= c.retries && retryableError(err) {
+				c.logger.Errorf("bulk request failed, retrying, %s", err)
+				if !wait(ctx, attempt) {
+					return ctx.Err()
+				}
+				continue
+			}
+			return err
+		}
+
+		var (
+			retry    []*Item
+			failures []*Failure
+			failed   []*Item
+		)
+		for i, result := range res.Items {
+			if i >= len(pending) {
+				break
+			}
+			item := pending[i]
+			for _, r := range result {
+				switch {
+				case succeeded(item.Action, r), c.versioned && r.Status == http.StatusConflict:
+					if item.Confirms != nil {
+						close(item.Confirms)
+					}
+				case retryableStatus(r.Status) && attempt <= c.retries:
+					retry = append(retry, item)
+				default:
+					failed = append(failed, item)
+					failures = append(failures, newFailure(item, r))
+				}
+			}
+		}
+		if len(failures) > 0 {
+			if err := c.fail(failures); err != nil {
+				return err
+			}
+			for _, item := range failed {
+				if item.Confirms != nil {
+					close(item.Confirms)
+				}
+			}
+		}
+		if len(retry) == 0 {
+			return nil
+		}
+		c.logger.Infof("retrying %d rejected document(s)", len(retry))
+		if !wait(ctx, attempt) {
+			return ctx.Err()
+		}
+		pending = retry
+	}
+}
+
+// RequestSize returns the number of bytes a request adds to the body of a bulk.
+func RequestSize(r elastic.BulkableRequest) (int64, error) {
+	lines, err := r.Source()
+	if err != nil {
+		return 0, err
+	}
+	var size int64
+	for _, line := range lines {
+		size += int64(len(line)) + 1
+	}
+	return size, nil
+}
+
+// fail records the failures and writes them to the dead letter output.
+func (c *Committer) fail(failures []*Failure) error {
+	c.Lock()
+	for _, f := range failures {
+		c.failed[f.Index]++
+		c.total++
+		reason := ""
+		if f.Error != nil {
+			reason = fmt.Sprintf("%s: %s", f.Error.Type, f.Error.Reason)
+		}
+		c.logger.Errorf("failed to %s document %s in %s, status %d, %s", f.Action, f.ID, f.Index, f.Status, reason)
+	}
+	total := c.total
+	c.Unlock()
+
+	if c.deadLetter != nil {
+		if err := c.deadLetter.Write(failures); err != nil {
+			return fmt.Errorf("unable to write to the dead letter output, %s", err)
+		}
+	}
+	if c.maxFailures >= 0 && total > c.maxFailures {
+		return ErrTooManyFailures
+	}
+	return nil
+}
+
+// Summary returns the number of documents that failed to be indexed per index.
+func (c *Committer) Summary() map[string]int {
+	c.Lock()
+	defer c.Unlock()
+	summary := make(map[string]int, len(c.failed))
+	for index, n := range c.failed {
+		summary[index] = n
+	}
+	return summary
+}
+
+// Close prints the failed documents summary and closes the dead letter output.
+func (c *Committer) Close() {
+	summary := c.Summary()
+	if len(summary) > 0 {
+		indices := make([]string, 0, len(summary))
+		for index := range summary {
+			indices = append(indices, index)
+		}
+		sort.Strings(indices)
+		fmt.Println("documents that failed to be indexed:")
+		for _, index := range indices {
+			fmt.Printf("  %s: %d\n", index, summary[index])
+		}
+	}
+	if c.deadLetter != nil {
+		if err := c.deadLetter.Close(); err != nil {
+			c.logger.Errorf("unable to close the dead letter output, %s", err)
+		}
+	}
+}
+
+func newFailure(item *Item, r *elastic.BulkResponseItem) *Failure {
+	index := r.Index
+	if index == "" {
+		index = item.Index
+	}
+	return &Failure{
+		Index:    index,
+		ID:       item.ID,
+		Action:   item.Action,
+		Status:   r.Status,
+		Error:    r.Error,
+		Document: item.Doc,
+		Time:     time.Now().UTC(),
+	}
+}
+
+// succeeded checks the result of an item, deleting a missing document is not a failure.
+func succeeded(action string, r *elastic.BulkResponseItem) bool {
+	if r.Error == nil && r.Status >= 200 && r.Status < 300 {
+		return true
+	}
+	return action == "delete" && r.Status == http.StatusNotFound && r.Error == nil
+}
+
+func retryableStatus(status int) bool {
+	return status == http.StatusTooManyRequests || status == http.StatusServiceUnavailable
+}
+
+func retryableError(err error) bool {
+	return elastic.IsConnErr(err) || elastic.IsTimeout(err) ||
+		elastic.IsStatusCode(err, http.StatusTooManyRequests) || elastic.IsStatusCode(err, http.StatusServiceUnavailable)
+}
+
+// wait sleeps for the backoff of an attempt, false is returned if ctx is done first.
+func wait(ctx context.Context, attempt int) bool {
+	d, _ := retryBackoff.Next(attempt)
+	select {
+	case <-time.After(d):
+		return true
+	case <-ctx.Done():
+		return false
+	}
+}
+
+// fileDeadLetter appends the failures to a file as JSON lines.
+type fileDeadLetter struct {
+	sync.Mutex
+	f *os.File
+}
+
+func (d *fileDeadLetter) Write(failures []*Failure) error {
+	d.Lock()
+	defer d.Unlock()
+	enc := json.NewEncoder(d.f)
+	for _, f := range failures {
+		if err := enc.Encode(f); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (d *fileDeadLetter) Close() error {
+	return d.f.Close()
+}
+
+// indexDeadLetter indexes the failures, the documents are kept in _source without being indexed
+// so that they can not conflict with each other.
+type indexDeadLetter struct {
+	client  *elastic.Client
+	index   string
+	logger  log.Logger
+	created sync.Once
+}
+
+func newIndexDeadLetter(esClient *elastic.Client, index string, logger log.Logger) *indexDeadLetter {
+	return &indexDeadLetter{client: esClient, index: index, logger: logger}
+}
+
+func (d *indexDeadLetter) Write(failures []*Failure) error {
+	d.created.Do(func() {
+		_, err := d.client.CreateIndex(d.index).BodyJson(map[string]interface{}{
+			"mappings": map[string]interface{}{
+				"dynamic": false,
+				"properties": map[string]interface{}{
+					"index":  map[string]interface{}{"type": "keyword"},
+					"id":     map[string]interface{}{"type": "keyword"},
+					"action": map[string]interface{}{"type": "keyword"},
+					"status": map[string]interface{}{"type": "integer"},
+					"time":   map[string]interface{}{"type": "date"},
+				},
+			},
+		}).Do(context.Background())
+		if err != nil && !elastic.IsStatusCode(err, http.StatusBadRequest) {
+			d.logger.Errorf("unable to create dead letter index %s, %s", d.index, err)
+		}
+	})
+	bs := d.client.Bulk().Index(d.index)
+	for _, f := range failures {
+		bs.Add(elastic.NewBulkIndexRequest().Doc(f))
+	}
+	res, err := bs.Do(context.Background())
+	if err != nil {
+		return err
+	}
+	if failed := res.Failed(); len(failed) > 0 {
+		return fmt.Errorf("%d failure(s) not indexed in %s, status %d", len(failed), d.index, failed[0].Status)
+	}
+	return nil
+}
+
+func (d *indexDeadLetter) Close() error {
+	return nil
+}
@@ -0,0 +1,180 @@
+package clients
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/appbaseio/abc/log"
+	"github.com/olivere/elastic/v7"
+)
+
+// bulkServer answers _bulk requests with the status returned by respond for every document _id.
+func bulkServer(respond func(id string, attempt int) (int, string)) *httptest.Server {
+	var (
+		mu       sync.Mutex
+		attempts = make(map[string]int)
+	)
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var items []map[string]interface{}
+		scanner := bufio.NewScanner(r.Body)
+		for scanner.Scan() {
+			var action map[string]map[string]interface{}
+			if err := json.Unmarshal(scanner.Bytes(), &action); err != nil {
+				continue
+			}
+			for name, meta := range action {
+				id, _ := meta["_id"].(string)
+				if name != "delete" {
+					scanner.Scan()
+				}
+				mu.Lock()
+				attempts[id]++
+				status, errType := respond(id, attempts[id])
+				mu.Unlock()
+				result := map[string]interface{}{"_index": "test", "_id": id, "status": status}
+				if errType != "" {
+					result["error"] = map[string]interface{}{"type": errType, "reason": "failed " + id}
+				}
+				items = append(items, map[string]interface{}{name: result})
+			}
+		}
+		json.NewEncoder(w).Encode(map[string]interface{}{"took": 1, "errors": true, "items": items})
+	}))
+}
+
+func newTestCommitter(t *testing.T, url string, opts *ClientOptions) *Committer {
+	esClient, err := elastic.NewClient(elastic.SetURL(url), elastic.SetSniff(false), elastic.SetHealthcheck(false))
+	if err != nil {
+		t.Fatalf("unable to create client, %s", err)
+	}
+	opts.Index = "test"
+	c, err := NewCommitter(esClient, opts, log.With("test", t.Name()))
+	if err != nil {
+		t.Fatalf("unable to create committer, %s", err)
+	}
+	return c
+}
+
+func testItems(ids ...string) []*Item {
+	var items []*Item
+	for _, id := range ids {
+		doc := map[string]interface{}{"name": id}
+		items = append(items, &Item{
+			Request:  elastic.NewBulkIndexRequest().Id(id).Doc(doc),
+			Action:   "index",
+			ID:       id,
+			Doc:      doc,
+			Confirms: make(chan struct{}),
+		})
+	}
+	return items
+}
+
+func confirmed(item *Item) bool {
+	select {
+	case <-item.Confirms:
+		return true
+	default:
+		return false
+	}
+}
+
+func TestCommit(t *testing.T) {
+	ts := bulkServer(func(id string, attempt int) (int, string) {
+		switch {
+		case id == "rejected" && attempt == 1:
+			return http.StatusTooManyRequests, "es_rejected_execution_exception"
+		case id == "conflict":
+			return http.StatusBadRequest, "mapper_parsing_exception"
+		}
+		return http.StatusCreated, ""
+	})
+	defer ts.Close()
+
+	path := filepath.Join(t.TempDir(), "failed.jsonl")
+	c := newTestCommitter(t, ts.URL, &ClientOptions{BulkRetries: 2, MaxFailures: 1, DeadLetterFile: path})
+	items := testItems("ok", "rejected", "conflict")
+	if err := c.Commit(context.Background(), items); err != nil {
+		t.Fatalf("unexpected Commit error, %s", err)
+	}
+	for _, item := range items {
+		if !confirmed(item) {
+			t.Errorf("item %s not confirmed", item.ID)
+		}
+	}
+	if expected := map[string]int{"test": 1}; !reflect.DeepEqual(c.Summary(), expected) {
+		t.Errorf("wrong summary, expected %v, got %v", expected, c.Summary())
+	}
+	c.Close()
+
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		t.Fatalf("unable to read dead letter file, %s", err)
+	}
+	lines := strings.Split(strings.TrimSpace(string(b)), "\n")
+	if len(lines) != 1 {
+		t.Fatalf("wrong number of dead letters, expected 1, got %d", len(lines))
+	}
+	var f Failure
+	if err := json.Unmarshal([]byte(lines[0]), &f); err != nil {
+		t.Fatalf("malformed dead letter, %s", err)
+	}
+	if f.ID != "conflict" || f.Status != http.StatusBadRequest || f.Error.Type != "mapper_parsing_exception" || f.Document["name"] != "conflict" {
+		t.Errorf("wrong dead letter, got %+v", f)
+	}
+}
+
+func TestCommitTooManyFailures(t *testing.T) {
+	ts := bulkServer(func(id string, attempt int) (int, string) {
+		if strings.HasPrefix(id, "conflict") {
+			return http.StatusBadRequest, "mapper_parsing_exception"
+		}
+		return http.StatusCreated, ""
+	})
+	defer ts.Close()
+
+	var maxFailuresTests = []struct {
+		maxFailures int
+		err         error
+	}{
+		{0, ErrTooManyFailures},
+		{1, ErrTooManyFailures},
+		{2, nil},
+		{-1, nil},
+	}
+	for _, mt := range maxFailuresTests {
+		c := newTestCommitter(t, ts.URL, &ClientOptions{MaxFailures: mt.maxFailures})
+		if err := c.Commit(context.Background(), testItems("ok", "conflict1", "conflict2")); err != mt.err {
+			t.Errorf("[max_failures %d] wrong error, expected %v, got %v", mt.maxFailures, mt.err, err)
+		}
+	}
+}
+
+func TestCommitRetriesExhausted(t *testing.T) {
+	ts := bulkServer(func(id string, attempt int) (int, string) {
+		return http.StatusServiceUnavailable, "unavailable_shards_exception"
+	})
+	defer ts.Close()
+
+	c := newTestCommitter(t, ts.URL, &ClientOptions{BulkRetries: 1, MaxFailures: -1})
+	items := testItems("a")
+	if err := c.Commit(context.Background(), items); err != nil {
+		t.Fatalf("unexpected Commit error, %s", err)
+	}
+	if !confirmed(items[0]) {
+		t.Errorf("item not confirmed")
+	}
+	if got := fmt.Sprint(c.Summary()); got != "map[test:1]" {
+		t.Errorf("wrong summary, got %s", got)
+	}
+}
@@ -0,0 +1,293 @@
+package clients
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/appbaseio/abc/importer/message/data"
+	"github.com/appbaseio/abc/log"
+	"github.com/olivere/elastic/v7"
+)
+
+// indexMetadataKey holds the metadata in the data of the command message sent by the readers.
+const indexMetadataKey = "_index_metadata"
+
+// clusterSettings are the index settings tied to the cluster holding the index, dotted names
+// reach into the nested settings. They are not copied.
+var clusterSettings = []string{
+	"uuid",
+	"creation_date",
+	"creation_date_string",
+	"version",
+	"provided_name",
+	"history",
+	"resize",
+	"shrink",
+	"routing.allocation",
+	"blocks",
+	"lifecycle",
+	"frozen",
+	"search.throttled",
+	"store.snapshot",
+	"verified_before_close",
+	"replication",
+	"mapping.single_type",
+}
+
+// mappingKeys are the keys of a typeless mapping, a mapping without any of them holds types.
+var mappingKeys = map[string]bool{
+	"properties":        true,
+	"dynamic":           true,
+	"dynamic_templates": true,
+	"date_detection":    true,
+	"numeric_detection": true,
+	"runtime":           true,
+	"enabled":           true,
+	"_source":           true,
+	"_routing":          true,
+	"_meta":             true,
+	"_field_names":      true,
+}
+
+// IndexMetadata holds the mappings, settings and aliases of an index copied between clusters.
+type IndexMetadata struct {
+	Index    string                 `json:"index"`
+	Mappings map[string]interface{} `json:"mappings,omitempty"`
+	Settings map[string]interface{} `json:"settings,omitempty"`
+	Aliases  map[string]interface{} `json:"aliases,omitempty"`
+}
+
+// GetIndexMetadata returns the metadata of index without its cluster settings and with typeless
+// mappings. The newest index, in name order, is read when index matches several of them.
+func GetIndexMetadata(ctx context.Context, esClient *elastic.Client, index string, logger log.Logger) (*IndexMetadata, error) {
+	res, err := esClient.IndexGet(index).Do(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("unable to read metadata of %s, %s", index, err)
+	}
+	var names []string
+	for name := range res {
+		names = append(names, name)
+	}
+	if len(names) == 0 {
+		return nil, fmt.Errorf("no index found for %s", index)
+	}
+	sort.Strings(names)
+	name := names[len(names)-1]
+	if len(names) > 1 {
+		logger.With("index", index).Infof("%d indices found, copying the metadata of %s", len(names), name)
+	}
+
+	m := &IndexMetadata{Index: name, Aliases: res[name].Aliases}
+	m.Mappings = typelessMapping(res[name].Mappings, logger)
+	if settings, ok := res[name].Settings["index"].(map[string]interface{}); ok {
+		for _, setting := range clusterSettings {
+			deleteSetting(settings, strings.Split(setting, "."))
+		}
+		m.Settings = settings
+	}
+	return m, nil
+}
+
+// typelessMapping returns the mapping of the single type of a 6.x or older typed mapping,
+// the properties of several types are merged. The _all field, removed in 7.0, is dropped.
+func typelessMapping(mappings map[string]interface{}, logger log.Logger) map[string]interface{} {
+	if len(mappings) == 0 {
+		return nil
+	}
+	typed := true
+	for k := range mappings {
+		if mappingKeys[k] {
+			typed = false
+		}
+	}
+	if typed {
+		var types []string
+		for t := range mappings {
+			if t != "_default_" {
+				types = append(types, t)
+			}
+		}
+		sort.Strings(types)
+		if len(types) == 0 {
+			return nil
+		}
+		typeless, _ := mappings[types[0]].(map[string]interface{})
+		if typeless == nil {
+			typeless = map[string]interface{}{}
+		}
+		for _, t := range types[1:] {
+			logger.With("type", t).Infof("merging the properties of type %s into %s", t, types[0])
+			other, _ := mappings[t].(map[string]interface{})
+			props, _ := other["properties"].(map[string]interface{})
+			if len(props) == 0 {
+				continue
+			}
+			merged, _ := typeless["properties"].(map[string]interface{})
+			if merged == nil {
+				merged = map[string]interface{}{}
+				typeless["properties"] = merged
+			}
+			for k, v := range props {
+				if _, ok := merged[k]; !ok {
+					merged[k] = v
+				}
+			}
+		}
+		mappings = typeless
+	}
+	delete(mappings, "_all")
+	dropIncludeInAll(mappings)
+	return mappings
+}
+
+// dropIncludeInAll removes the include_in_all parameter of the fields of a mapping.
+func dropIncludeInAll(mapping map[string]interface{}) {
+	for _, key := range []string{"properties", "fields"} {
+		props, _ := mapping[key].(map[string]interface{})
+		for _, p := range props {
+			if field, ok := p.(map[string]interface{}); ok {
+				delete(field, "include_in_all")
+				dropIncludeInAll(field)
+			}
+		}
+	}
+}
+
+// deleteSetting deletes the setting at path from the nested settings, or from their flat
+// dotted keys.
+func deleteSetting(settings map[string]interface{}, path []string) {
+	delete(settings, strings.Join(path, "."))
+	for prefix := range settings {
+		if strings.HasPrefix(prefix, strings.Join(path, ".")+".") {
+			delete(settings, prefix)
+		}
+	}
+	if len(path) > 1 {
+		if inner, ok := settings[path[0]].(map[string]interface{}); ok {
+			deleteSetting(inner, path[1:])
+			if len(inner) == 0 {
+				delete(settings, path[0])
+			}
+		}
+	}
+}
+
+// Data returns the data of the command message carrying the metadata to the writers, it only
+// holds maps so that it is written to the commit log like documents.
+func (m *IndexMetadata) Data() data.Data {
+	return data.Data{indexMetadataKey: map[string]interface{}{
+		"index":    m.Index,
+		"mappings": m.Mappings,
+		"settings": m.Settings,
+		"aliases":  m.Aliases,
+	}}
+}
+
+// MetadataFrom returns the metadata carried by the data of a command message, false when it
+// holds none.
+func MetadataFrom(d data.Data) (*IndexMetadata, bool, error) {
+	v, ok := d[indexMetadataKey]
+	if !ok {
+		return nil, false, nil
+	}
+	b, err := json.Marshal(v)
+	if err != nil {
+		return nil, true, err
+	}
+	m := &IndexMetadata{}
+	if err := json.Unmarshal(b, m); err != nil {
+		return nil, true, fmt.Errorf("invalid index metadata, %s", err)
+	}
+	return m, true, nil
+}
+
+// Apply creates index with the metadata. When the index exists, the mapping is merged into its
+// own and the aliases are added, its settings are left as they are. The aliases named skip
+// are not copied.
+func (m *IndexMetadata) Apply(ctx context.Context, esClient *elastic.Client, index string, logger log.Logger, skip ...string) error {
+	aliases := map[string]interface{}{}
+	for alias, v := range m.Aliases {
+		if alias == index || contains(skip, alias) {
+			logger.With("alias", alias).Infoln("alias of the source index not copied")
+			continue
+		}
+		aliases[alias] = v
+	}
+
+	exists, err := esClient.IndexExists(index).Do(ctx)
+	if err != nil {
+		return err
+	}
+	if !exists {
+		body := map[string]interface{}{"aliases": aliases}
+		if m.Mappings != nil {
+			body["mappings"] = m.Mappings
+		}
+		if m.Settings != nil {
+			body["settings"] = map[string]interface{}{"index": m.Settings}
+		}
+		if _, err := esClient.CreateIndex(index).BodyJson(body).Do(ctx); err != nil {
+			return fmt.Errorf("unable to create %s with the metadata of %s, %s", index, m.Index, err)
+		}
+		logger.With("index", index).With("source", m.Index).Infoln("index created with the source metadata")
+		return nil
+	}
+
+	logger.With("index", index).Infoln("index exists, the settings of the source index are not copied")
+	if m.Mappings != nil {
+		if _, err := esClient.PutMapping().Index(index).BodyJson(m.Mappings).Do(ctx); err != nil {
+			return fmt.Errorf("unable to copy the mapping of %s to %s, %s", m.Index, index, err)
+		}
+	}
+	if len(aliases) > 0 {
+		var actions []elastic.AliasAction
+		for _, alias := range sortedKeys(aliases) {
+			actions = append(actions, aliasAction(alias, index, aliases[alias]))
+		}
+		if _, err := esClient.Alias().Action(actions...).Do(ctx); err != nil {
+			return fmt.Errorf("unable to copy the aliases of %s to %s, %s", m.Index, index, err)
+		}
+	}
+	return nil
+}
+
+// aliasAction adds alias to index with the filter and routing of the source alias.
+func aliasAction(alias, index string, v interface{}) *elastic.AliasAddAction {
+	action := elastic.NewAliasAddAction(alias).Index(index)
+	params, _ := v.(map[string]interface{})
+	if filter, ok := params["filter"]; ok {
+		b, _ := json.Marshal(filter)
+		action = action.Filter(elastic.NewRawStringQuery(string(b)))
+	}
+	if routing, ok := params["index_routing"].(string); ok {
+		action = action.IndexRouting(routing)
+	}
+	if routing, ok := params["search_routing"].(string); ok {
+		action = action.SearchRouting(routing)
+	}
+	if write, ok := params["is_write_index"].(bool); ok {
+		action = action.IsWriteIndex(write)
+	}
+	return action
+}
+
+func contains(values []string, v string) bool {
+	for _, value := range values {
+		if value == v {
+			return true
+		}
+	}
+	return false
+}
+
+func sortedKeys(m map[string]interface{}) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
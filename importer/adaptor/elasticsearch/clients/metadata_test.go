@@ -0,0 +1,187 @@
+package clients
+
+import (
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/appbaseio/abc/importer/message/data"
+	"github.com/appbaseio/abc/log"
+	"github.com/olivere/elastic/v7"
+)
+
+var typelessMappingTests = []struct {
+	name     string
+	mappings string
+	expected string
+}{
+	{
+		"typeless",
+		`{"dynamic":"strict","properties":{"name":{"type":"text"}}}`,
+		`{"dynamic":"strict","properties":{"name":{"type":"text"}}}`,
+	},
+	{
+		"single type",
+		`{"_doc":{"_all":{"enabled":false},"properties":{"name":{"type":"text","include_in_all":false,"fields":{"raw":{"type":"keyword","include_in_all":true}}}}}}`,
+		`{"properties":{"name":{"fields":{"raw":{"type":"keyword"}},"type":"text"}}}`,
+	},
+	{
+		"several types",
+		`{"_default_":{"dynamic":false},"book":{"properties":{"title":{"type":"text"}}},"author":{"properties":{"name":{"type":"keyword"},"title":{"type":"keyword"}}}}`,
+		`{"properties":{"name":{"type":"keyword"},"title":{"type":"keyword"}}}`,
+	},
+	{
+		"default only",
+		`{"_default_":{"dynamic":false}}`,
+		`null`,
+	},
+}
+
+func TestTypelessMapping(t *testing.T) {
+	for _, mt := range typelessMappingTests {
+		var mappings map[string]interface{}
+		if err := json.Unmarshal([]byte(mt.mappings), &mappings); err != nil {
+			t.Fatalf("[%s] invalid mappings, %s", mt.name, err)
+		}
+		b, _ := json.Marshal(typelessMapping(mappings, log.With("test", t.Name())))
+		if string(b) != mt.expected {
+			t.Errorf("[%s] wrong mapping\nexpected: %s\ngot: %s", mt.name, mt.expected, b)
+		}
+	}
+}
+
+// metadataServer fakes the index APIs of a cluster holding the indices of index.
+type metadataServer struct {
+	sync.Mutex
+	index    string
+	indices  map[string]bool
+	requests []string
+}
+
+func (s *metadataServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s.Lock()
+	defer s.Unlock()
+	path := strings.Trim(r.URL.Path, "/")
+	b, _ := ioutil.ReadAll(r.Body)
+	switch {
+	case r.Method == http.MethodGet:
+		w.Write([]byte(s.index))
+	case r.Method == http.MethodHead:
+		if !s.indices[path] {
+			w.WriteHeader(http.StatusNotFound)
+		}
+	default:
+		s.requests = append(s.requests, r.Method+" "+path+" "+string(b))
+		w.Write([]byte(`{"acknowledged":true}`))
+	}
+}
+
+const sourceIndex = `{
+  "orders-2020": {"aliases": {}, "mappings": {}, "settings": {}},
+  "orders-2021": {
+    "aliases": {"orders": {}, "recent": {"filter": {"term": {"year": 2021}}, "index_routing": "1"}},
+    "mappings": {"order": {"_all": {"enabled": true}, "properties": {"total": {"type": "scaled_float", "scaling_factor": 100}}}},
+    "settings": {"index": {
+      "number_of_shards": "3",
+      "uuid": "Hh1QTmM0RJu8uDBTkmYdVw",
+      "creation_date": "1600000000000",
+      "provided_name": "orders-2021",
+      "version": {"created": "6080099"},
+      "routing": {"allocation": {"require": {"box": "hot"}}},
+      "blocks": {"write": "true"},
+      "analysis": {"analyzer": {"folding": {"tokenizer": "standard", "filter": ["asciifolding"]}}}
+    }}
+  }
+}`
+
+func TestGetIndexMetadata(t *testing.T) {
+	ts := httptest.NewServer(&metadataServer{index: sourceIndex})
+	defer ts.Close()
+	esClient, err := elastic.NewClient(elastic.SetURL(ts.URL), elastic.SetSniff(false), elastic.SetHealthcheck(false))
+	if err != nil {
+		t.Fatalf("unable to create client, %s", err)
+	}
+	m, err := GetIndexMetadata(context.Background(), esClient, "orders-*", log.With("test", t.Name()))
+	if err != nil {
+		t.Fatalf("unexpected GetIndexMetadata error, %s", err)
+	}
+	b, _ := json.Marshal(m)
+	expected := `{"index":"orders-2021",` +
+		`"mappings":{"properties":{"total":{"scaling_factor":100,"type":"scaled_float"}}},` +
+		`"settings":{"analysis":{"analyzer":{"folding":{"filter":["asciifolding"],"tokenizer":"standard"}}},"number_of_shards":"3"},` +
+		`"aliases":{"orders":{},"recent":{"filter":{"term":{"year":2021}},"index_routing":"1"}}}`
+	if string(b) != expected {
+		t.Errorf("wrong metadata\nexpected: %s\ngot: %s", expected, b)
+	}
+
+	// the metadata goes through a command message
+	d := data.Data{}
+	b, _ = json.Marshal(m.Data())
+	json.Unmarshal(b, &d)
+	got, ok, err := MetadataFrom(d)
+	if !ok || err != nil {
+		t.Fatalf("no metadata read back, %v", err)
+	}
+	if !reflect.DeepEqual(got, m) {
+		t.Errorf("wrong metadata read back, expected %+v, got %+v", m, got)
+	}
+	if _, ok, _ := MetadataFrom(data.Data{"name": "abc"}); ok {
+		t.Errorf("unexpected metadata in a document")
+	}
+}
+
+var metadataApplyTests = []struct {
+	name     string
+	exists   bool
+	skip     []string
+	requests []string
+}{
+	{
+		"new index",
+		false,
+		[]string{"orders"},
+		[]string{
+			`PUT dest {"aliases":{"recent":{"index_routing":"1"}},"mappings":{"properties":{"total":{"type":"long"}}},"settings":{"index":{"number_of_shards":"3"}}}`,
+		},
+	},
+	{
+		"existing index",
+		true,
+		nil,
+		[]string{
+			`PUT dest/_mapping {"properties":{"total":{"type":"long"}}}`,
+			`POST _aliases {"actions":[{"add":{"alias":"orders","index":"dest"}},{"add":{"alias":"recent","index":"dest","index_routing":"1"}}]}`,
+		},
+	},
+}
+
+func TestIndexMetadataApply(t *testing.T) {
+	m := &IndexMetadata{
+		Index:    "orders",
+		Mappings: map[string]interface{}{"properties": map[string]interface{}{"total": map[string]interface{}{"type": "long"}}},
+		Settings: map[string]interface{}{"number_of_shards": "3"},
+		Aliases:  map[string]interface{}{"orders": map[string]interface{}{}, "recent": map[string]interface{}{"index_routing": "1"}, "dest": map[string]interface{}{}},
+	}
+	for _, at := range metadataApplyTests {
+		s := &metadataServer{indices: map[string]bool{"dest": at.exists}}
+		ts := httptest.NewServer(s)
+		esClient, err := elastic.NewClient(elastic.SetURL(ts.URL), elastic.SetSniff(false), elastic.SetHealthcheck(false))
+		if err != nil {
+			t.Fatalf("[%s] unable to create client, %s", at.name, err)
+		}
+		err = m.Apply(context.Background(), esClient, "dest", log.With("test", t.Name()), at.skip...)
+		ts.Close()
+		if err != nil {
+			t.Fatalf("[%s] unexpected Apply error, %s", at.name, err)
+		}
+		if !reflect.DeepEqual(s.requests, at.requests) {
+			t.Errorf("[%s] wrong requests\nexpected: %v\ngot: %v", at.name, at.requests, s.requests)
+		}
+	}
+}
@@ -0,0 +1,184 @@
+package clients
+
+import (
+	"context"
+	"fmt"
+	"hash/fnv"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/appbaseio/abc/log"
+)
+
+// DefaultBulkWorkers is the number of bulks sent at the same time.
+const DefaultBulkWorkers = 1
+
+// Processor batches items into bulks sent by concurrent workers, in the manner of
+// elastic.BulkProcessor. The items of a document always go to the same worker so that they
+// are applied in order, and adding an item blocks while its worker is sending a bulk.
+type Processor struct {
+	committer    *Committer
+	workers      []*bulkWorker
+	bulkRequests int
+	requestSize  int64
+	logger       log.Logger
+
+	wg      sync.WaitGroup
+	next    uint32
+	indexed int64
+
+	errMu sync.Mutex
+	err   error
+}
+
+type bulkWorker struct {
+	p      *Processor
+	logger log.Logger
+	in     chan *Item
+	flush  chan chan error
+	items  []*Item
+	size   int64
+}
+
+// NewProcessor starts the workers, a bulk holds at most bulkRequests items and requestSize bytes.
+func NewProcessor(committer *Committer, workers, bulkRequests int, requestSize int64, logger log.Logger) *Processor {
+	if workers < 1 {
+		workers = DefaultBulkWorkers
+	}
+	p := &Processor{
+		committer:    committer,
+		bulkRequests: bulkRequests,
+		requestSize:  requestSize,
+		logger:       logger,
+	}
+	for i := 0; i < workers; i++ {
+		w := &bulkWorker{
+			p:      p,
+			logger: logger.With("worker", i),
+			in:     make(chan *Item),
+			flush:  make(chan chan error),
+		}
+		p.workers = append(p.workers, w)
+		p.wg.Add(1)
+		go func() {
+			defer p.wg.Done()
+			w.run()
+		}()
+	}
+	return p
+}
+
+// Add hands the item to its worker, the error of a previous bulk is returned once one failed.
+func (p *Processor) Add(item *Item) error {
+	if err := p.Err(); err != nil {
+		return err
+	}
+	size, err := RequestSize(item.Request)
+	if err != nil {
+		return err
+	}
+	item.size = size
+	p.workers[p.route(item)].in <- item
+	return nil
+}
+
+// route returns the worker of the item, documents without an _id are spread over the workers.
+func (p *Processor) route(item *Item) int {
+	if len(p.workers) == 1 {
+		return 0
+	}
+	if item.ID == "" {
+		return int(atomic.AddUint32(&p.next, 1) % uint32(len(p.workers)))
+	}
+	h := fnv.New32a()
+	h.Write([]byte(item.Index))
+	h.Write([]byte{0})
+	h.Write([]byte(item.ID))
+	return int(h.Sum32() % uint32(len(p.workers)))
+}
+
+// Flush sends the pending bulk of every worker and waits for them.
+func (p *Processor) Flush() error {
+	replies := make([]chan error, len(p.workers))
+	for i, w := range p.workers {
+		replies[i] = make(chan error, 1)
+		w.flush <- replies[i]
+	}
+	for _, reply := range replies {
+		p.setErr(<-reply)
+	}
+	return p.Err()
+}
+
+// Close flushes the pending bulks and stops the workers.
+func (p *Processor) Close() error {
+	err := p.Flush()
+	for _, w := range p.workers {
+		close(w.in)
+	}
+	p.wg.Wait()
+	return err
+}
+
+// Err returns the first error of a bulk.
+func (p *Processor) Err() error {
+	p.errMu.Lock()
+	defer p.errMu.Unlock()
+	return p.err
+}
+
+// setErr keeps the first error.
+func (p *Processor) setErr(err error) {
+	p.errMu.Lock()
+	defer p.errMu.Unlock()
+	if p.err == nil {
+		p.err = err
+	}
+}
+
+func (w *bulkWorker) run() {
+	for {
+		select {
+		case item, ok := <-w.in:
+			if !ok {
+				return
+			}
+			w.add(item)
+		case reply := <-w.flush:
+			reply <- w.commit()
+		}
+	}
+}
+
+// add sends the bulk before the item would take it past either limit, a full bulk is sent right away.
+func (w *bulkWorker) add(item *Item) {
+	if n := len(w.items); n > 0 && (n+1 > w.p.bulkRequests || w.size+item.size > w.p.requestSize) {
+		w.p.setErr(w.commit())
+	}
+	w.items = append(w.items, item)
+	w.size += item.size
+	if len(w.items) >= w.p.bulkRequests || w.size >= w.p.requestSize {
+		w.p.setErr(w.commit())
+	}
+}
+
+func (w *bulkWorker) commit() error {
+	numberOfActions := len(w.items)
+	if numberOfActions == 0 {
+		return nil
+	}
+	items := w.items
+	w.items, w.size = nil, 0
+
+	w.logger.Infof("indexing %d data record(s)\n", numberOfActions)
+	startTime := time.Now()
+	// the messages are confirmed by the committer once indexed or dead lettered
+	err := w.p.committer.Commit(context.Background(), items)
+	w.logger.Infof("%d data record(s) indexed in %f seconds\n", numberOfActions, time.Since(startTime).Seconds())
+	fmt.Printf("%d total data record(s) indexed\n", atomic.AddInt64(&w.p.indexed, int64(numberOfActions)))
+	if err != nil {
+		w.logger.Errorln(err)
+	}
+	return err
+}
@@ -0,0 +1,150 @@
+package clients
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"sync"
+	"testing"
+
+	"github.com/olivere/elastic/v7"
+)
+
+// recordServer acknowledges every document of a bulk, recording the version of the documents in
+// the order they were received.
+func recordServer(received map[string][]int, mu *sync.Mutex) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var items []map[string]interface{}
+		scanner := bufio.NewScanner(r.Body)
+		for scanner.Scan() {
+			var action map[string]map[string]interface{}
+			if err := json.Unmarshal(scanner.Bytes(), &action); err != nil {
+				continue
+			}
+			scanner.Scan()
+			var doc struct {
+				Version int `json:"version"`
+			}
+			json.Unmarshal(scanner.Bytes(), &doc)
+			for name, meta := range action {
+				id, _ := meta["_id"].(string)
+				mu.Lock()
+				received[id] = append(received[id], doc.Version)
+				mu.Unlock()
+				items = append(items, map[string]interface{}{name: map[string]interface{}{"_index": "test", "_id": id, "status": http.StatusOK}})
+			}
+		}
+		json.NewEncoder(w).Encode(map[string]interface{}{"took": 1, "errors": false, "items": items})
+	}))
+}
+
+func TestProcessor(t *testing.T) {
+	var (
+		mu       sync.Mutex
+		received = make(map[string][]int)
+	)
+	ts := recordServer(received, &mu)
+	defer ts.Close()
+
+	var processorTests = []struct {
+		workers      int
+		bulkRequests int
+	}{
+		{1, 3},
+		{4, 3},
+		{4, 1000},
+		{0, 1},
+	}
+	for _, pt := range processorTests {
+		for id := range received {
+			delete(received, id)
+		}
+		c := newTestCommitter(t, ts.URL, &ClientOptions{})
+		p := NewProcessor(c, pt.workers, pt.bulkRequests, 2<<19, c.logger)
+
+		var items []*Item
+		for version := 0; version < 5; version++ {
+			for i := 0; i < 10; i++ {
+				id := fmt.Sprintf("doc%d", i)
+				doc := map[string]interface{}{"version": version}
+				item := &Item{
+					Request:  elastic.NewBulkIndexRequest().Id(id).Doc(doc),
+					Action:   "index",
+					ID:       id,
+					Doc:      doc,
+					Confirms: make(chan struct{}),
+				}
+				items = append(items, item)
+				if err := p.Add(item); err != nil {
+					t.Fatalf("[workers %d] unexpected Add error, %s", pt.workers, err)
+				}
+			}
+		}
+		if err := p.Close(); err != nil {
+			t.Fatalf("[workers %d] unexpected Close error, %s", pt.workers, err)
+		}
+
+		for _, item := range items {
+			if !confirmed(item) {
+				t.Errorf("[workers %d] item %s not confirmed", pt.workers, item.ID)
+			}
+		}
+		// the versions of a document are indexed in the order they were added
+		for i := 0; i < 10; i++ {
+			id := fmt.Sprintf("doc%d", i)
+			if expected := []int{0, 1, 2, 3, 4}; !reflect.DeepEqual(received[id], expected) {
+				t.Errorf("[workers %d] wrong versions of %s, expected %v, got %v", pt.workers, id, expected, received[id])
+			}
+		}
+	}
+}
+
+func TestProcessorFlush(t *testing.T) {
+	var (
+		mu       sync.Mutex
+		received = make(map[string][]int)
+	)
+	ts := recordServer(received, &mu)
+	defer ts.Close()
+
+	c := newTestCommitter(t, ts.URL, &ClientOptions{})
+	p := NewProcessor(c, 2, 1000, 2<<19, c.logger)
+	defer p.Close()
+	items := testItems("a", "b", "c")
+	for _, item := range items {
+		if err := p.Add(item); err != nil {
+			t.Fatalf("unexpected Add error, %s", err)
+		}
+	}
+	if err := p.Flush(); err != nil {
+		t.Fatalf("unexpected Flush error, %s", err)
+	}
+	for _, item := range items {
+		if !confirmed(item) {
+			t.Errorf("item %s not confirmed after Flush", item.ID)
+		}
+	}
+}
+
+func TestProcessorError(t *testing.T) {
+	ts := bulkServer(func(id string, attempt int) (int, string) {
+		return http.StatusBadRequest, "mapper_parsing_exception"
+	})
+	defer ts.Close()
+
+	c := newTestCommitter(t, ts.URL, &ClientOptions{})
+	p := NewProcessor(c, 2, 1, 2<<19, c.logger)
+	p.Add(testItems("a")[0])
+	if err := p.Flush(); err != ErrTooManyFailures {
+		t.Errorf("wrong Flush error, expected %v, got %v", ErrTooManyFailures, err)
+	}
+	if err := p.Add(testItems("b")[0]); err != ErrTooManyFailures {
+		t.Errorf("wrong Add error after a failed bulk, expected %v, got %v", ErrTooManyFailures, err)
+	}
+	if err := p.Close(); err != ErrTooManyFailures {
+		t.Errorf("wrong Close error, expected %v, got %v", ErrTooManyFailures, err)
+	}
+}
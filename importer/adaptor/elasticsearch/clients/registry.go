@@ -3,8 +3,10 @@ package clients
 import (
 	"net/http"
 	"net/url"
+	"time"
 
 	"github.com/appbaseio/abc/importer/client"
+	"github.com/appbaseio/abc/importer/function/mapping"
 	"github.com/hashicorp/go-version"
 )
 
@@ -37,11 +39,55 @@ func AddReader(v string, constraint version.Constraints, reader Reader) {
 
 // ClientOptions defines the available options that can be used to configured the client.Writer
 type ClientOptions struct {
-	URLs         []string
-	UserInfo     *url.Userinfo
-	HTTPClient   *http.Client
-	Index        string
-	RequestSize  int64
-	BulkRequests int
-	Tail         bool
+	URLs       []string
+	UserInfo   *url.Userinfo
+	HTTPClient *http.Client
+	// TransportStats is counted by the transport of HTTPClient, logged when the writer closes
+	TransportStats *TransportStats
+	Index          string
+	RequestSize    int64
+	BulkRequests   int
+	BulkWorkers    int
+	Tail           bool
+	TailField      string
+	PollInterval   time.Duration
+
+	// Source filters the documents read
+	Source SourceOptions
+
+	// bulk failure handling
+	BulkRetries     int
+	MaxFailures     int
+	DeadLetterFile  string
+	DeadLetterIndex string
+
+	// how update messages are applied
+	Update UpdateOptions
+
+	// pipeline, routing and versioning of the requests
+	Request RequestOptions
+
+	// DataStream writes the documents to data streams
+	DataStream DataStreamOptions
+
+	// IndexTemplate routes the messages to their index
+	IndexTemplate *IndexTemplate
+
+	// Mappings are the mappings the indices are created with, by index pattern
+	Mappings *mapping.Mappings
+
+	// Alias is moved to Index once the import completes
+	Alias            string
+	DeleteOldIndices bool
+}
+
+// DataStreamOptions defines how documents are written to data streams.
+type DataStreamOptions struct {
+	Enabled bool
+	// TimestampField is copied to the @timestamp of the documents without one
+	TimestampField string
+	// InstallTemplate installs an index template for every stream written to
+	InstallTemplate bool
+	// ILMPolicy is installed and set in the index template of every stream when not nil
+	ILMPolicy map[string]interface{}
 }
@@ -0,0 +1,140 @@
+package clients
+
+import (
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/olivere/elastic/v7"
+)
+
+const (
+	// VersionTypeExternal only indexes a document with a version greater than the indexed one.
+	VersionTypeExternal = "external"
+	// VersionTypeExternalGTE also indexes a document with the same version as the indexed one.
+	VersionTypeExternalGTE = "external_gte"
+)
+
+// RequestOptions defines the ingest pipeline, routing and versioning of the bulk requests.
+type RequestOptions struct {
+	Pipeline     string
+	RoutingField string
+	VersionField string
+	VersionType  string
+}
+
+// Validate checks the version type, external versions can not be used with the update API.
+func (o RequestOptions) Validate(update UpdateOptions) error {
+	if o.VersionField == "" {
+		return nil
+	}
+	switch o.VersionType {
+	case "", VersionTypeExternal, VersionTypeExternalGTE:
+	default:
+		return fmt.Errorf("invalid version_type %q, expected %s or %s", o.VersionType, VersionTypeExternal, VersionTypeExternalGTE)
+	}
+	if update.Mode != UpdateModeIndex {
+		return fmt.Errorf("version_field requires update_mode %q, the update API does not support external versions", UpdateModeIndex)
+	}
+	return nil
+}
+
+// Versioned returns whether the requests are sent with an external version.
+func (o RequestOptions) Versioned() bool {
+	return o.VersionField != ""
+}
+
+// Apply sets the pipeline, routing and version of a request from the fields of its document,
+// a document missing the routing or version field is sent without them.
+func (o RequestOptions) Apply(br elastic.BulkableRequest, doc map[string]interface{}) error {
+	var routing string
+	if o.RoutingField != "" {
+		if v := fieldValue(doc, o.RoutingField); v != nil {
+			routing = fmt.Sprint(v)
+		}
+	}
+	var (
+		version     int64
+		versionType = o.VersionType
+		versioned   bool
+	)
+	if o.VersionField != "" {
+		if v := fieldValue(doc, o.VersionField); v != nil {
+			var err error
+			if version, err = versionOf(v); err != nil {
+				return fmt.Errorf("invalid version in field %s, %s", o.VersionField, err)
+			}
+			versioned = true
+		}
+		if versionType == "" {
+			versionType = VersionTypeExternal
+		}
+	}
+
+	switch r := br.(type) {
+	case *elastic.BulkIndexRequest:
+		if o.Pipeline != "" {
+			r.Pipeline(o.Pipeline)
+		}
+		if routing != "" {
+			r.Routing(routing)
+		}
+		if versioned {
+			r.Version(version).VersionType(versionType)
+		}
+	case *elastic.BulkCreateRequest:
+		if o.Pipeline != "" {
+			r.Pipeline(o.Pipeline)
+		}
+		if routing != "" {
+			r.Routing(routing)
+		}
+	case *elastic.BulkDeleteRequest:
+		if routing != "" {
+			r.Routing(routing)
+		}
+		if versioned {
+			r.Version(version).VersionType(versionType)
+		}
+	case *elastic.BulkUpdateRequest:
+		if routing != "" {
+			r.Routing(routing)
+		}
+	}
+	return nil
+}
+
+// versionOf converts a field to a version, dates are converted to milliseconds since the epoch.
+func versionOf(v interface{}) (int64, error) {
+	switch v := v.(type) {
+	case int:
+		return int64(v), nil
+	case int32:
+		return int64(v), nil
+	case int64:
+		return v, nil
+	case uint32:
+		return int64(v), nil
+	case uint64:
+		return int64(v), nil
+	case float64:
+		return int64(v), nil
+	case time.Time:
+		return v.UnixNano() / int64(time.Millisecond), nil
+	case *time.Time:
+		if v != nil {
+			return v.UnixNano() / int64(time.Millisecond), nil
+		}
+	case string:
+		if n, err := strconv.ParseInt(v, 10, 64); err == nil {
+			return n, nil
+		}
+		for _, layout := range dateLayouts {
+			if t, err := time.Parse(layout, v); err == nil {
+				return t.UnixNano() / int64(time.Millisecond), nil
+			}
+		}
+		return 0, fmt.Errorf("unable to parse %q as a number or a date", v)
+	}
+	return 0, fmt.Errorf("unable to use %T as a version", v)
+}
@@ -0,0 +1,125 @@
+package clients
+
+import (
+	"context"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/olivere/elastic/v7"
+)
+
+var requestOptionsTests = []struct {
+	name   string
+	opts   RequestOptions
+	br     elastic.BulkableRequest
+	doc    map[string]interface{}
+	source string
+}{
+	{
+		"pipeline",
+		RequestOptions{Pipeline: "geoip"},
+		elastic.NewBulkIndexRequest().Index("test").Id("1"),
+		map[string]interface{}{"ip": "127.0.0.1"},
+		`{"index":{"_index":"test","_id":"1","pipeline":"geoip"}}`,
+	},
+	{
+		"routing and version",
+		RequestOptions{RoutingField: "user.id", VersionField: "updated_at"},
+		elastic.NewBulkIndexRequest().Index("test").Id("1"),
+		map[string]interface{}{"user": map[string]interface{}{"id": 42}, "updated_at": time.Unix(1600000000, 5e6)},
+		`{"index":{"_index":"test","_id":"1","routing":"42","version":1600000000005,"version_type":"external"}}`,
+	},
+	{
+		"delete version",
+		RequestOptions{Pipeline: "geoip", VersionField: "v", VersionType: VersionTypeExternalGTE},
+		elastic.NewBulkDeleteRequest().Index("test").Id("1"),
+		map[string]interface{}{"v": "12"},
+		`{"delete":{"_index":"test","_id":"1","version":12,"version_type":"external_gte"}}`,
+	},
+	{
+		"missing fields",
+		RequestOptions{RoutingField: "user", VersionField: "v"},
+		elastic.NewBulkIndexRequest().Index("test").Id("1"),
+		map[string]interface{}{},
+		`{"index":{"_index":"test","_id":"1"}}`,
+	},
+	{
+		"update routing",
+		RequestOptions{Pipeline: "geoip", RoutingField: "user"},
+		elastic.NewBulkUpdateRequest().Index("test").Id("1"),
+		map[string]interface{}{"user": "bob"},
+		`{"update":{"_index":"test","_id":"1","routing":"bob"}}`,
+	},
+}
+
+func TestRequestOptionsApply(t *testing.T) {
+	for _, rt := range requestOptionsTests {
+		if err := rt.opts.Apply(rt.br, rt.doc); err != nil {
+			t.Fatalf("[%s] unexpected Apply error, %s", rt.name, err)
+		}
+		source, err := rt.br.Source()
+		if err != nil {
+			t.Fatalf("[%s] unexpected Source error, %s", rt.name, err)
+		}
+		if source[0] != rt.source {
+			t.Errorf("[%s] wrong request\nexpected: %s\ngot: %s", rt.name, rt.source, source[0])
+		}
+	}
+
+	opts := RequestOptions{VersionField: "v"}
+	if err := opts.Apply(elastic.NewBulkIndexRequest(), map[string]interface{}{"v": "yesterday"}); err == nil {
+		t.Errorf("expected error for a malformed version")
+	}
+}
+
+var requestValidateTests = []struct {
+	opts   RequestOptions
+	update UpdateOptions
+	err    bool
+}{
+	{RequestOptions{Pipeline: "geoip", RoutingField: "user"}, UpdateOptions{Mode: UpdateModeUpsert}, false},
+	{RequestOptions{VersionField: "v"}, UpdateOptions{Mode: UpdateModeIndex}, false},
+	{RequestOptions{VersionField: "v", VersionType: VersionTypeExternalGTE}, UpdateOptions{Mode: UpdateModeIndex}, false},
+	{RequestOptions{VersionField: "v", VersionType: "internal"}, UpdateOptions{Mode: UpdateModeIndex}, true},
+	{RequestOptions{VersionField: "v"}, UpdateOptions{Mode: UpdateModeUpdate}, true},
+}
+
+func TestRequestOptionsValidate(t *testing.T) {
+	for _, vt := range requestValidateTests {
+		if err := vt.opts.Validate(vt.update); (err != nil) != vt.err {
+			t.Errorf("[%+v %s] wrong Validate error, got %v", vt.opts, vt.update.Mode, err)
+		}
+	}
+}
+
+func TestCommitVersionConflict(t *testing.T) {
+	ts := bulkServer(func(id string, attempt int) (int, string) {
+		if strings.HasPrefix(id, "older") {
+			return http.StatusConflict, "version_conflict_engine_exception"
+		}
+		return http.StatusCreated, ""
+	})
+	defer ts.Close()
+
+	c := newTestCommitter(t, ts.URL, &ClientOptions{Request: RequestOptions{VersionField: "v"}})
+	items := testItems("newer", "older")
+	if err := c.Commit(context.Background(), items); err != nil {
+		t.Fatalf("unexpected Commit error, %s", err)
+	}
+	for _, item := range items {
+		if !confirmed(item) {
+			t.Errorf("item %s not confirmed", item.ID)
+		}
+	}
+	if len(c.Summary()) != 0 {
+		t.Errorf("unexpected failures, got %v", c.Summary())
+	}
+
+	// conflicts are failures without external versions
+	c = newTestCommitter(t, ts.URL, &ClientOptions{})
+	if err := c.Commit(context.Background(), testItems("older")); err != ErrTooManyFailures {
+		t.Errorf("wrong Commit error, expected %v, got %v", ErrTooManyFailures, err)
+	}
+}
@@ -0,0 +1,212 @@
+package clients
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"sync"
+
+	"github.com/appbaseio/abc/log"
+	"github.com/olivere/elastic/v7"
+)
+
+const (
+	// DefaultSlices is the number of slices of an index read in parallel.
+	DefaultSlices = 1
+
+	// scanSize is the number of documents of every page read
+	scanSize = 1000
+	// scanKeepAlive is how long a point in time or scroll is kept between pages
+	scanKeepAlive = "5m"
+)
+
+// SourceOptions defines the documents read from an index by the readers.
+type SourceOptions struct {
+	// Query is a query DSL filtering the documents, all of them are read when empty
+	Query json.RawMessage
+	// Fields limits the _source of the documents read
+	Fields []string
+	// Slices is the number of slices of the index read in parallel
+	Slices int
+	// CopyMetadata sends the mappings, settings and aliases of the index before its documents
+	CopyMetadata bool
+}
+
+// ParseQuery validates a query DSL, a search body holding it in its query field is accepted.
+func ParseQuery(b []byte) (json.RawMessage, error) {
+	var q map[string]json.RawMessage
+	if err := json.Unmarshal(b, &q); err != nil {
+		return nil, fmt.Errorf("invalid query, %s", err)
+	}
+	if inner, ok := q["query"]; ok && len(q) == 1 {
+		return ParseQuery(inner)
+	}
+	if len(q) == 0 {
+		return nil, nil
+	}
+	var buf bytes.Buffer
+	if err := json.Compact(&buf, b); err != nil {
+		return nil, fmt.Errorf("invalid query, %s", err)
+	}
+	return buf.Bytes(), nil
+}
+
+// Filter returns q restricted to the documents matching the query of the options.
+func (o SourceOptions) Filter(q elastic.Query) elastic.Query {
+	if len(o.Query) == 0 {
+		return q
+	}
+	return elastic.NewBoolQuery().Must(q).Filter(elastic.NewRawStringQuery(string(o.Query)))
+}
+
+// FetchSource returns the _source fields to read, nil when the whole source is read.
+func (o SourceOptions) FetchSource() *elastic.FetchSourceContext {
+	if len(o.Fields) == 0 {
+		return nil
+	}
+	return elastic.NewFetchSourceContext(true).Include(o.Fields...)
+}
+
+func (o SourceOptions) slices() int {
+	if o.Slices < 1 {
+		return DefaultSlices
+	}
+	return o.Slices
+}
+
+// searchSource returns the search of one slice of the documents.
+func (o SourceOptions) searchSource(slice int) *elastic.SearchSource {
+	src := elastic.NewSearchSource().
+		Query(o.Filter(elastic.NewMatchAllQuery())).
+		Size(scanSize).
+		TrackTotalHits(false).
+		Sort("_shard_doc", true)
+	if fsc := o.FetchSource(); fsc != nil {
+		src = src.FetchSourceContext(fsc)
+	}
+	if o.slices() > 1 {
+		src = src.Slice(elastic.NewSliceQuery().Id(slice).Max(o.slices()))
+	}
+	return src
+}
+
+// Scan reads the documents of index matching the options, calling fn with every page of hits.
+// The slices of the index are read in parallel from a point in time, so fn is called from
+// several goroutines, and with a sliced scroll from clusters without points in time. Scanning
+// stops on the first error returned by fn or by a search.
+func Scan(ctx context.Context, esClient *elastic.Client, index string, opts SourceOptions, logger log.Logger, fn func([]*elastic.SearchHit) error) error {
+	pit, err := openPointInTime(ctx, esClient, index, opts)
+	if err != nil {
+		logger.With("index", index).Infof("unable to search a point in time, scrolling the index instead, %s", err)
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	var (
+		wg    sync.WaitGroup
+		errMu sync.Mutex
+		first error
+	)
+	for slice := 0; slice < opts.slices(); slice++ {
+		wg.Add(1)
+		go func(slice int) {
+			defer wg.Done()
+			var err error
+			if pit != "" {
+				err = scanPointInTime(ctx, esClient, pit, opts, slice, fn)
+			} else {
+				err = scanScroll(ctx, esClient, index, opts, slice, fn)
+			}
+			if err != nil {
+				errMu.Lock()
+				if first == nil {
+					first = err
+				}
+				errMu.Unlock()
+				cancel()
+			}
+		}(slice)
+	}
+	wg.Wait()
+
+	if pit != "" {
+		if _, err := esClient.ClosePointInTime(pit).Do(context.Background()); err != nil {
+			logger.With("index", index).Errorf("unable to close point in time, %s", err)
+		}
+	}
+	return first
+}
+
+// openPointInTime opens a point in time of index and checks that it can be searched, with
+// slices when several are read.
+func openPointInTime(ctx context.Context, esClient *elastic.Client, index string, opts SourceOptions) (string, error) {
+	res, err := esClient.OpenPointInTime(index).KeepAlive(scanKeepAlive).Do(ctx)
+	if err != nil {
+		return "", err
+	}
+	src := opts.searchSource(0).Size(0).PointInTime(elastic.NewPointInTimeWithKeepAlive(res.Id, scanKeepAlive))
+	if _, err := esClient.Search().SearchSource(src).Do(ctx); err != nil {
+		esClient.ClosePointInTime(res.Id).Do(context.Background())
+		return "", err
+	}
+	return res.Id, nil
+}
+
+// scanPointInTime reads a slice of a point in time with search_after.
+func scanPointInTime(ctx context.Context, esClient *elastic.Client, pit string, opts SourceOptions, slice int, fn func([]*elastic.SearchHit) error) error {
+	var after []interface{}
+	for {
+		src := opts.searchSource(slice).PointInTime(elastic.NewPointInTimeWithKeepAlive(pit, scanKeepAlive))
+		if after != nil {
+			src = src.SearchAfter(after...)
+		}
+		res, err := esClient.Search().SearchSource(src).Do(ctx)
+		if err != nil {
+			return err
+		}
+		if res.PitId != "" {
+			pit = res.PitId
+		}
+		hits := res.Hits.Hits
+		if len(hits) == 0 {
+			return nil
+		}
+		if err := fn(hits); err != nil {
+			return err
+		}
+		if len(hits) < scanSize {
+			return nil
+		}
+		after = hits[len(hits)-1].Sort
+	}
+}
+
+// scanScroll reads a slice of index with the scroll API, in index order.
+func scanScroll(ctx context.Context, esClient *elastic.Client, index string, opts SourceOptions, slice int, fn func([]*elastic.SearchHit) error) error {
+	scroll := esClient.Scroll(index).
+		Size(scanSize).
+		KeepAlive(scanKeepAlive).
+		Query(opts.Filter(elastic.NewMatchAllQuery())).
+		Sort("_doc", true)
+	if fsc := opts.FetchSource(); fsc != nil {
+		scroll = scroll.FetchSourceContext(fsc)
+	}
+	if opts.slices() > 1 {
+		scroll = scroll.Slice(elastic.NewSliceQuery().Id(slice).Max(opts.slices()))
+	}
+	defer scroll.Clear(context.Background())
+	for {
+		res, err := scroll.Do(ctx)
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		if err := fn(res.Hits.Hits); err != nil {
+			return err
+		}
+	}
+}
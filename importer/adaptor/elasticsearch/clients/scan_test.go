@@ -0,0 +1,188 @@
+package clients
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/appbaseio/abc/log"
+	"github.com/olivere/elastic/v7"
+)
+
+// scanServer fakes the point in time, search and scroll APIs of an index holding docs documents,
+// the documents of a slice are those whose _id modulo the number of slices is the slice id.
+type scanServer struct {
+	sync.Mutex
+	docs int
+	// pit is set when the cluster supports points in time
+	pit      bool
+	searches []map[string]interface{}
+	closed   []string
+}
+
+func (s *scanServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s.Lock()
+	defer s.Unlock()
+	var body map[string]interface{}
+	json.NewDecoder(r.Body).Decode(&body)
+	switch {
+	case r.Method == http.MethodPost && r.URL.Path == "/test/_pit":
+		if !s.pit {
+			w.WriteHeader(http.StatusBadRequest)
+			w.Write([]byte(`{"error":{"type":"illegal_argument_exception"},"status":400}`))
+			return
+		}
+		w.Write([]byte(`{"id":"pit-0"}`))
+	case r.Method == http.MethodDelete:
+		s.closed = append(s.closed, r.URL.Path)
+		w.Write([]byte(`{"succeeded":true,"num_freed":1}`))
+	case r.URL.Path == "/_search" || r.URL.Path == "/test/_search":
+		s.searches = append(s.searches, body)
+		slice, max := 0, 1
+		if sl, ok := body["slice"].(map[string]interface{}); ok {
+			slice, max = int(sl["id"].(float64)), int(sl["max"].(float64))
+		}
+		from := 0
+		if after, ok := body["search_after"].([]interface{}); ok {
+			from = int(after[0].(float64)) + 1
+		}
+		size, ok := body["size"].(float64)
+		if !ok {
+			// the scroll API sends the size as a parameter
+			fmt.Sscan(r.URL.Query().Get("size"), &size)
+		}
+		s.page(w, slice, max, from, int(size))
+	case r.URL.Path == "/_search/scroll":
+		var slice, max, from, size int
+		fmt.Sscanf(body["scroll_id"].(string), "%d:%d:%d:%d", &slice, &max, &from, &size)
+		s.page(w, slice, max, from, size)
+	default:
+		w.WriteHeader(http.StatusBadRequest)
+	}
+}
+
+// page writes size documents of a slice starting from its from-th document.
+func (s *scanServer) page(w http.ResponseWriter, slice, max, from, size int) {
+	var hits []map[string]interface{}
+	for id, pos := slice, 0; id < s.docs && len(hits) < size; id, pos = id+max, pos+1 {
+		if pos < from {
+			continue
+		}
+		hits = append(hits, map[string]interface{}{
+			"_index":  "test",
+			"_id":     fmt.Sprint(id),
+			"_source": map[string]interface{}{"n": id},
+			"sort":    []int{pos},
+		})
+	}
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"pit_id":     "pit-0",
+		"_scroll_id": fmt.Sprintf("%d:%d:%d:%d", slice, max, from+len(hits), size),
+		"hits":       map[string]interface{}{"hits": hits},
+	})
+}
+
+var scanTests = []struct {
+	name   string
+	pit    bool
+	opts   SourceOptions
+	closed []string
+}{
+	{"point in time", true, SourceOptions{}, []string{"/_pit"}},
+	{"sliced point in time", true, SourceOptions{Slices: 3, Query: json.RawMessage(`{"term":{"kind":"a"}}`), Fields: []string{"n"}}, []string{"/_pit"}},
+	{"scroll", false, SourceOptions{}, []string{"/_search/scroll"}},
+	{"sliced scroll", false, SourceOptions{Slices: 2, Fields: []string{"n"}}, []string{"/_search/scroll", "/_search/scroll"}},
+}
+
+func TestScan(t *testing.T) {
+	for _, st := range scanTests {
+		s := &scanServer{docs: 2500, pit: st.pit}
+		ts := httptest.NewServer(s)
+		esClient, err := elastic.NewClient(elastic.SetURL(ts.URL), elastic.SetSniff(false), elastic.SetHealthcheck(false))
+		if err != nil {
+			t.Fatalf("[%s] unable to create client, %s", st.name, err)
+		}
+
+		var (
+			mu   sync.Mutex
+			read = make(map[string]int)
+		)
+		err = Scan(context.Background(), esClient, "test", st.opts, log.With("test", t.Name()), func(hits []*elastic.SearchHit) error {
+			mu.Lock()
+			defer mu.Unlock()
+			for _, hit := range hits {
+				read[hit.Id]++
+			}
+			return nil
+		})
+		ts.Close()
+		if err != nil {
+			t.Fatalf("[%s] unexpected Scan error, %s", st.name, err)
+		}
+		for id := 0; id < s.docs; id++ {
+			if n := read[fmt.Sprint(id)]; n != 1 {
+				t.Errorf("[%s] document %d read %d times", st.name, id, n)
+			}
+		}
+		if strings.Join(s.closed, ",") != strings.Join(st.closed, ",") {
+			t.Errorf("[%s] wrong closed searches, expected %v, got %v", st.name, st.closed, s.closed)
+		}
+		for _, search := range s.searches {
+			b, _ := json.Marshal(search)
+			if st.pit && !strings.Contains(string(b), `"pit":{"id":"pit-0","keep_alive":"5m"}`) {
+				t.Errorf("[%s] search without point in time, got %s", st.name, b)
+			}
+			if st.opts.Query != nil && !strings.Contains(string(b), `"filter":{"term":{"kind":"a"}}`) {
+				t.Errorf("[%s] search without query, got %s", st.name, b)
+			}
+			if st.opts.Fields != nil && !strings.Contains(string(b), `"_source":{"includes":["n"]}`) {
+				t.Errorf("[%s] search without source fields, got %s", st.name, b)
+			}
+		}
+	}
+}
+
+func TestScanError(t *testing.T) {
+	ts := httptest.NewServer(&scanServer{docs: 2500, pit: true})
+	defer ts.Close()
+	esClient, err := elastic.NewClient(elastic.SetURL(ts.URL), elastic.SetSniff(false), elastic.SetHealthcheck(false))
+	if err != nil {
+		t.Fatalf("unable to create client, %s", err)
+	}
+	expected := fmt.Errorf("send failed")
+	err = Scan(context.Background(), esClient, "test", SourceOptions{Slices: 2}, log.With("test", t.Name()), func(hits []*elastic.SearchHit) error {
+		return expected
+	})
+	if err != expected {
+		t.Errorf("wrong Scan error, expected %v, got %v", expected, err)
+	}
+}
+
+var parseQueryTests = []struct {
+	query    string
+	expected string
+	err      bool
+}{
+	{`{"term": {"kind": "a"}}`, `{"term":{"kind":"a"}}`, false},
+	{`{"query": {"term": {"kind": "a"}}}`, `{"term":{"kind":"a"}}`, false},
+	{`{}`, ``, false},
+	{`{"term": `, ``, true},
+	{`["term"]`, ``, true},
+}
+
+func TestParseQuery(t *testing.T) {
+	for _, pt := range parseQueryTests {
+		q, err := ParseQuery([]byte(pt.query))
+		if (err != nil) != pt.err {
+			t.Errorf("[%s] wrong ParseQuery error, got %v", pt.query, err)
+		}
+		if string(q) != pt.expected {
+			t.Errorf("[%s] wrong query, expected %s, got %s", pt.query, pt.expected, q)
+		}
+	}
+}
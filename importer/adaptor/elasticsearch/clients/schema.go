@@ -0,0 +1,53 @@
+package clients
+
+import (
+	"sync"
+
+	"github.com/appbaseio/abc/importer/function/mapping"
+	"github.com/appbaseio/abc/importer/message"
+)
+
+// Schemas holds the mappings generated from the schema of the tables of a SQL source, by the
+// namespace of their rows.
+type Schemas struct {
+	sync.Mutex
+	mappings  map[string]map[string]interface{}
+	geoPoints map[string][]mapping.GeoPoint
+}
+
+// NewSchemas returns an empty Schemas.
+func NewSchemas() *Schemas {
+	return &Schemas{
+		mappings:  make(map[string]map[string]interface{}),
+		geoPoints: make(map[string][]mapping.GeoPoint),
+	}
+}
+
+// Add keeps the mapping of the rows of namespace generated from the schema and returns it.
+func (s *Schemas) Add(namespace string, schema *mapping.Schema) map[string]interface{} {
+	s.Lock()
+	defer s.Unlock()
+	m := mapping.FromSchema(*schema)
+	s.mappings[namespace] = m
+	s.geoPoints[namespace] = schema.GeoPoints()
+	return m
+}
+
+// Mapping returns the mapping of the rows of namespace, nil when the schema of its table was
+// not sent.
+func (s *Schemas) Mapping(namespace string) map[string]interface{} {
+	s.Lock()
+	defer s.Unlock()
+	return s.mappings[namespace]
+}
+
+// SetGeoPoints sets the geo_point fields of the mapping of the table of a row, from its latitude
+// and longitude.
+func (s *Schemas) SetGeoPoints(msg message.Msg) {
+	s.Lock()
+	points := s.geoPoints[msg.Namespace()]
+	s.Unlock()
+	for _, g := range points {
+		g.Set(msg.Data())
+	}
+}
@@ -0,0 +1,40 @@
+package clients
+
+import (
+	"sync/atomic"
+
+	"github.com/appbaseio/abc/log"
+)
+
+// TransportStats counts the bulk requests sent to elasticsearch and their size before and
+// after compression.
+type TransportStats struct {
+	Requests        int64
+	Bytes           int64
+	CompressedBytes int64
+}
+
+// Add counts a bulk request of n bytes sent as compressed bytes.
+func (s *TransportStats) Add(n, compressed int64) {
+	atomic.AddInt64(&s.Requests, 1)
+	atomic.AddInt64(&s.Bytes, n)
+	atomic.AddInt64(&s.CompressedBytes, compressed)
+}
+
+// Log logs the counts, nothing is logged for a nil TransportStats or when no bulk was sent.
+func (s *TransportStats) Log(logger log.Logger) {
+	if s == nil {
+		return
+	}
+	requests := atomic.LoadInt64(&s.Requests)
+	if requests == 0 {
+		return
+	}
+	n, compressed := atomic.LoadInt64(&s.Bytes), atomic.LoadInt64(&s.CompressedBytes)
+	logger.
+		With("requests", requests).
+		With("bytes", n).
+		With("compressed_bytes", compressed).
+		With("ratio", float64(compressed)/float64(n)).
+		Infoln("bulk requests sent")
+}
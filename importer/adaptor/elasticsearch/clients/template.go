@@ -0,0 +1,101 @@
+package clients
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+	"sync"
+	"text/template"
+	"time"
+
+	"github.com/appbaseio/abc/importer/message"
+	"github.com/appbaseio/abc/importer/message/ops"
+)
+
+// dateLayouts are the layouts tried on the string values given to the date function.
+var dateLayouts = []string{
+	time.RFC3339Nano,
+	"2006-01-02 15:04:05",
+	"2006-01-02T15:04:05",
+	"2006-01-02",
+}
+
+// IndexTemplate routes messages to the index named by a text/template evaluated with the
+// message data, e.g. {{ns}}-{{date .created_at "2006.01"}}. Besides the message fields, the
+// template can call ns for the namespace of the message and date to format a field. Deletes
+// often only hold the key of the document, those the template can not route go to the index of
+// the writer.
+type IndexTemplate struct {
+	sync.Mutex
+	tmpl *template.Template
+	ns   string
+}
+
+// NewIndexTemplate parses text, fields missing from a message are an error.
+func NewIndexTemplate(text string) (*IndexTemplate, error) {
+	t := &IndexTemplate{}
+	tmpl, err := template.New("index_template").Option("missingkey=error").Funcs(template.FuncMap{
+		"ns":   func() string { return t.ns },
+		"date": formatDate,
+	}).Parse(text)
+	if err != nil {
+		return nil, fmt.Errorf("invalid index_template, %s", err)
+	}
+	t.tmpl = tmpl
+	return t, nil
+}
+
+// Index returns the lowercased index of the message, an empty index for a delete the template
+// can not be rendered for.
+func (t *IndexTemplate) Index(msg message.Msg) (string, error) {
+	t.Lock()
+	defer t.Unlock()
+	t.ns = msg.Namespace()
+	var b bytes.Buffer
+	if err := t.tmpl.Execute(&b, map[string]interface{}(msg.Data())); err != nil {
+		if msg.OP() == ops.Delete {
+			return "", nil
+		}
+		return "", fmt.Errorf("unable to route message to an index, %s", err)
+	}
+	index := strings.ToLower(strings.TrimSpace(b.String()))
+	if index == "" {
+		return "", fmt.Errorf("index_template routed message to an empty index")
+	}
+	return index, nil
+}
+
+// formatDate formats a time, a string in one of dateLayouts or a number of seconds since the epoch.
+func formatDate(v interface{}, layout string) (string, error) {
+	var t time.Time
+	switch v := v.(type) {
+	case time.Time:
+		t = v
+	case *time.Time:
+		if v == nil {
+			return "", fmt.Errorf("date of a nil time")
+		}
+		t = *v
+	case string:
+		var err error
+		for _, l := range dateLayouts {
+			if t, err = time.Parse(l, v); err == nil {
+				break
+			}
+		}
+		if err != nil {
+			return "", fmt.Errorf("unable to parse date %q", v)
+		}
+	case int:
+		t = time.Unix(int64(v), 0)
+	case int32:
+		t = time.Unix(int64(v), 0)
+	case int64:
+		t = time.Unix(v, 0)
+	case float64:
+		t = time.Unix(int64(v), 0)
+	default:
+		return "", fmt.Errorf("unable to format %T as a date", v)
+	}
+	return t.UTC().Format(layout), nil
+}
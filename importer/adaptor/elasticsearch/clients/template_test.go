@@ -0,0 +1,53 @@
+package clients
+
+import (
+	"testing"
+	"time"
+
+	"github.com/appbaseio/abc/importer/message"
+	"github.com/appbaseio/abc/importer/message/data"
+	"github.com/appbaseio/abc/importer/message/ops"
+)
+
+var indexTemplateTests = []struct {
+	template string
+	ns       string
+	op       ops.Op
+	data     data.Data
+	index    string
+	err      bool
+}{
+	{`{{ns}}`, "shop.Orders", ops.Insert, data.Data{"_id": 1}, "shop.orders", false},
+	{`{{ns}}-{{.type}}`, "shop", ops.Insert, data.Data{"type": "book"}, "shop-book", false},
+	{`{{ns}}-{{date .created_at "2006.01"}}`, "orders", ops.Insert, data.Data{"created_at": time.Date(2020, 3, 4, 5, 6, 7, 0, time.UTC)}, "orders-2020.03", false},
+	{`logs-{{date .created_at "2006.01.02"}}`, "logs", ops.Insert, data.Data{"created_at": "2020-03-04T05:06:07Z"}, "logs-2020.03.04", false},
+	{`logs-{{date .created_at "2006.01.02"}}`, "logs", ops.Insert, data.Data{"created_at": "2020-03-04 05:06:07"}, "logs-2020.03.04", false},
+	{`logs-{{date .ts "2006"}}`, "logs", ops.Insert, data.Data{"ts": int64(1583298367)}, "logs-2020", false},
+	{`logs-{{date .ts "2006"}}`, "logs", ops.Insert, data.Data{"ts": float64(1583298367)}, "logs-2020", false},
+	{`logs-{{date .created_at "2006"}}`, "logs", ops.Insert, data.Data{"created_at": "yesterday"}, "", true},
+	{`{{ns}}-{{.missing}}`, "logs", ops.Insert, data.Data{"type": "book"}, "", true},
+	{`{{.empty}}`, "logs", ops.Insert, data.Data{"empty": ""}, "", true},
+	{`{{ns}}-{{date .created_at "2006.01"}}`, "orders", ops.Delete, data.Data{"_id": 1}, "", false},
+	{`{{ns}}-{{.type}}`, "shop", ops.Delete, data.Data{"_id": 1, "type": "book"}, "shop-book", false},
+	{`{{ns}}`, "shop", ops.Delete, data.Data{"_id": 1}, "shop", false},
+}
+
+func TestIndexTemplate(t *testing.T) {
+	for _, it := range indexTemplateTests {
+		tmpl, err := NewIndexTemplate(it.template)
+		if err != nil {
+			t.Fatalf("[%s] unexpected NewIndexTemplate error, %s", it.template, err)
+		}
+		index, err := tmpl.Index(message.From(it.op, it.ns, it.data))
+		if (err != nil) != it.err {
+			t.Errorf("[%s] wrong Index error, got %v", it.template, err)
+		}
+		if index != it.index {
+			t.Errorf("[%s] wrong index, expected %s, got %s", it.template, it.index, index)
+		}
+	}
+
+	if _, err := NewIndexTemplate(`{{ns`); err == nil {
+		t.Errorf("expected error for a malformed template")
+	}
+}
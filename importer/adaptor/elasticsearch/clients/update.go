@@ -0,0 +1,89 @@
+package clients
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/appbaseio/abc/importer/message/data"
+	"github.com/olivere/elastic/v7"
+)
+
+// The ways an update message is applied to its document.
+const (
+	// UpdateModeUpdate merges the fields of the message into the document, which must exist.
+	UpdateModeUpdate = "update"
+	// UpdateModeIndex replaces the document with the message, creating it when missing.
+	UpdateModeIndex = "index"
+	// UpdateModeUpsert merges the fields of the message into the document, creating it when missing.
+	UpdateModeUpsert = "upsert"
+	// UpdateModeScript runs a painless script on the document, the message is indexed when missing.
+	UpdateModeScript = "script"
+
+	// DefaultUpdateMode keeps partial updates of existing documents.
+	DefaultUpdateMode = UpdateModeUpdate
+)
+
+// UpdateOptions defines how the writers turn update messages into bulk requests.
+type UpdateOptions struct {
+	Mode   string
+	Script string
+	// ScriptParams maps the names of the script params to the message fields holding their value
+	ScriptParams map[string]string
+}
+
+// Validate checks the mode is known and that a script is set for the script mode.
+func (o UpdateOptions) Validate() error {
+	switch o.Mode {
+	case "", UpdateModeUpdate, UpdateModeIndex, UpdateModeUpsert:
+		if o.Script != "" {
+			return fmt.Errorf("script is only used with update_mode %q", UpdateModeScript)
+		}
+	case UpdateModeScript:
+		if o.Script == "" {
+			return fmt.Errorf("update_mode %q requires a script", UpdateModeScript)
+		}
+	default:
+		return fmt.Errorf("invalid update_mode %q, expected one of %s, %s, %s or %s", o.Mode, UpdateModeUpdate, UpdateModeIndex, UpdateModeUpsert, UpdateModeScript)
+	}
+	return nil
+}
+
+// Request returns the bulk request applying an update message to its document along with
+// the bulk action of the request, typ is left empty for the clusters without mapping types.
+func (o UpdateOptions) Request(index, typ, id string, doc data.Data) (elastic.BulkableRequest, string) {
+	switch o.Mode {
+	case UpdateModeIndex:
+		return elastic.NewBulkIndexRequest().Type(typ).Id(id).Index(index).Doc(doc), "index"
+	case UpdateModeUpsert:
+		return elastic.NewBulkUpdateRequest().Type(typ).Id(id).Index(index).Doc(doc).DocAsUpsert(true), "update"
+	case UpdateModeScript:
+		script := elastic.NewScript(o.Script).Lang("painless")
+		if len(o.ScriptParams) > 0 {
+			params := make(map[string]interface{}, len(o.ScriptParams))
+			for name, field := range o.ScriptParams {
+				params[name] = fieldValue(doc, field)
+			}
+			script = script.Params(params)
+		}
+		return elastic.NewBulkUpdateRequest().Type(typ).Id(id).Index(index).Script(script).Upsert(doc), "update"
+	}
+	return elastic.NewBulkUpdateRequest().Type(typ).Id(id).Index(index).Doc(doc), "update"
+}
+
+// fieldValue returns the value of a field, a dotted name reaches into the nested documents.
+func fieldValue(doc map[string]interface{}, field string) interface{} {
+	if v, ok := doc[field]; ok {
+		return v
+	}
+	parts := strings.SplitN(field, ".", 2)
+	if len(parts) < 2 {
+		return nil
+	}
+	switch nested := doc[parts[0]].(type) {
+	case map[string]interface{}:
+		return fieldValue(nested, parts[1])
+	case data.Data:
+		return fieldValue(nested, parts[1])
+	}
+	return nil
+}
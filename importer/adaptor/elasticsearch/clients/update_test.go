@@ -0,0 +1,85 @@
+package clients
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/appbaseio/abc/importer/message/data"
+)
+
+var updateRequestTests = []struct {
+	opts   UpdateOptions
+	typ    string
+	action string
+	source []string
+}{
+	{
+		UpdateOptions{Mode: UpdateModeUpdate},
+		"",
+		"update",
+		[]string{`{"update":{"_index":"test","_id":"1"}}`, `{"doc":{"address":{"city":"Paris"},"count":2,"name":"a"}}`},
+	},
+	{
+		UpdateOptions{},
+		"_doc",
+		"update",
+		[]string{`{"update":{"_index":"test","_type":"_doc","_id":"1"}}`, `{"doc":{"address":{"city":"Paris"},"count":2,"name":"a"}}`},
+	},
+	{
+		UpdateOptions{Mode: UpdateModeIndex},
+		"",
+		"index",
+		[]string{`{"index":{"_index":"test","_id":"1"}}`, `{"address":{"city":"Paris"},"count":2,"name":"a"}`},
+	},
+	{
+		UpdateOptions{Mode: UpdateModeUpsert},
+		"",
+		"update",
+		[]string{`{"update":{"_index":"test","_id":"1"}}`, `{"doc":{"address":{"city":"Paris"},"count":2,"name":"a"},"doc_as_upsert":true}`},
+	},
+	{
+		UpdateOptions{Mode: UpdateModeScript, Script: "ctx._source.count += params.n", ScriptParams: map[string]string{"n": "count", "city": "address.city", "missing": "nope"}},
+		"",
+		"update",
+		[]string{
+			`{"update":{"_index":"test","_id":"1"}}`,
+			`{"script":{"lang":"painless","params":{"city":"Paris","missing":null,"n":2},"source":"ctx._source.count += params.n"},"upsert":{"address":{"city":"Paris"},"count":2,"name":"a"}}`,
+		},
+	},
+}
+
+func TestUpdateRequest(t *testing.T) {
+	for _, ut := range updateRequestTests {
+		br, action := ut.opts.Request("test", ut.typ, "1", data.Data{"name": "a", "count": 2, "address": map[string]interface{}{"city": "Paris"}})
+		if action != ut.action {
+			t.Errorf("[%s] wrong action, expected %s, got %s", ut.opts.Mode, ut.action, action)
+		}
+		source, err := br.Source()
+		if err != nil {
+			t.Fatalf("[%s] unexpected Source error, %s", ut.opts.Mode, err)
+		}
+		if strings.Join(source, "\n") != strings.Join(ut.source, "\n") {
+			t.Errorf("[%s] wrong request\nexpected: %s\ngot: %s", ut.opts.Mode, ut.source, source)
+		}
+	}
+}
+
+var updateValidateTests = []struct {
+	opts UpdateOptions
+	err  bool
+}{
+	{UpdateOptions{}, false},
+	{UpdateOptions{Mode: UpdateModeUpsert}, false},
+	{UpdateOptions{Mode: UpdateModeScript, Script: "ctx.op = 'none'"}, false},
+	{UpdateOptions{Mode: UpdateModeScript}, true},
+	{UpdateOptions{Mode: UpdateModeIndex, Script: "ctx.op = 'none'"}, true},
+	{UpdateOptions{Mode: "replace"}, true},
+}
+
+func TestUpdateValidate(t *testing.T) {
+	for _, vt := range updateValidateTests {
+		if err := vt.opts.Validate(); (err != nil) != vt.err {
+			t.Errorf("[%+v] wrong Validate error, got %v", vt.opts, err)
+		}
+	}
+}
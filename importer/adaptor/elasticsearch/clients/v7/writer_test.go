@@ -1,15 +1,21 @@
 package v7
 
 import (
+	"bufio"
 	"encoding/json"
 	"fmt"
+	"io/ioutil"
 	"net/http"
+	"net/http/httptest"
 	"os"
+	"strings"
+	"sync"
 	"testing"
 	"time"
 
 	"github.com/appbaseio/abc/importer/adaptor/elasticsearch/clients"
 	"github.com/appbaseio/abc/importer/client"
+	"github.com/appbaseio/abc/importer/function/mapping"
 	"github.com/appbaseio/abc/importer/message"
 	"github.com/appbaseio/abc/importer/message/ops"
 	"github.com/appbaseio/abc/log"
@@ -109,3 +115,266 @@ func TestWriter(t *testing.T) {
 		t.Errorf("mismatched doc count, expected 1, got %d", r.Count)
 	}
 }
+
+func TestWriterFlushesBeforeAdd(t *testing.T) {
+	var (
+		mu    sync.Mutex
+		bulks []int
+	)
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/test_v7/_bulk" {
+			return
+		}
+		var items []map[string]interface{}
+		scanner := bufio.NewScanner(r.Body)
+		for scanner.Scan() {
+			scanner.Scan()
+			items = append(items, map[string]interface{}{"index": map[string]interface{}{"status": 201}})
+		}
+		mu.Lock()
+		bulks = append(bulks, len(items))
+		mu.Unlock()
+		json.NewEncoder(w).Encode(map[string]interface{}{"took": 1, "items": items})
+	}))
+	defer ts.Close()
+
+	opts := &clients.ClientOptions{
+		URLs:         []string{ts.URL},
+		HTTPClient:   http.DefaultClient,
+		Index:        defaultIndex,
+		BulkRequests: 2,
+		RequestSize:  2 << 19,
+	}
+	w, err := clients.Clients["v7"].Creator(opts)
+	if err != nil {
+		t.Fatalf("unable to create writer, %s", err)
+	}
+	var confirms []chan struct{}
+	for i := 0; i < 5; i++ {
+		confirm := make(chan struct{})
+		confirms = append(confirms, confirm)
+		msg := message.WithConfirms(confirm, message.From(ops.Insert, testType, map[string]interface{}{"_id": fmt.Sprint(i), "i": i}))
+		if _, err := w.Write(msg)(nil); err != nil {
+			t.Fatalf("unexpected Write error, %s", err)
+		}
+	}
+	w.(client.Closer).Close()
+
+	if fmt.Sprint(bulks) != "[2 2 1]" {
+		t.Errorf("wrong bulk sizes, expected [2 2 1], got %v", bulks)
+	}
+	for i, confirm := range confirms {
+		select {
+		case <-confirm:
+		default:
+			t.Errorf("message %d not confirmed", i)
+		}
+	}
+}
+
+func TestWriterCloseTail(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer ts.Close()
+
+	opts := &clients.ClientOptions{
+		URLs:         []string{ts.URL},
+		HTTPClient:   http.DefaultClient,
+		Index:        defaultIndex,
+		BulkRequests: 10,
+		RequestSize:  2 << 19,
+		Tail:         true,
+	}
+	w, err := clients.Clients["v7"].Creator(opts)
+	if err != nil {
+		t.Fatalf("unable to create writer, %s", err)
+	}
+	// Close waits for the flushes of the ticker to return before closing the processor
+	closed := make(chan struct{})
+	go func() {
+		w.(client.Closer).Close()
+		close(closed)
+	}()
+	select {
+	case <-closed:
+	case <-time.After(5 * time.Second):
+		t.Fatal("timed out closing the writer")
+	}
+}
+
+func TestWriterFlushError(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/test_v7/_bulk" {
+			w.WriteHeader(http.StatusUnauthorized)
+		}
+	}))
+	defer ts.Close()
+
+	opts := &clients.ClientOptions{
+		URLs:         []string{ts.URL},
+		HTTPClient:   http.DefaultClient,
+		Index:        defaultIndex,
+		BulkRequests: 10,
+		RequestSize:  2 << 19,
+	}
+	w, err := clients.Clients["v7"].Creator(opts)
+	if err != nil {
+		t.Fatalf("unable to create writer, %s", err)
+	}
+	write := func() error {
+		_, err := w.Write(message.From(ops.Insert, testType, map[string]interface{}{"_id": "1"}))(nil)
+		return err
+	}
+	if err := write(); err != nil {
+		t.Fatalf("unexpected Write error, %s", err)
+	}
+	if err := w.(client.Flusher).Flush(); err == nil {
+		t.Errorf("expected an error flushing the failed bulk")
+	}
+	if err := write(); err == nil {
+		t.Errorf("expected the Write following the failed bulk to fail")
+	}
+	// the error was reported already, Close only logs it
+	w.(client.Closer).Close()
+}
+
+func TestWriterIndexTemplate(t *testing.T) {
+	var (
+		mu      sync.Mutex
+		created = make(map[string]int)
+		bodies  = make(map[string]string)
+		routed  []string
+	)
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+		if r.Method == http.MethodPut {
+			created[r.URL.Path]++
+			b, _ := ioutil.ReadAll(r.Body)
+			bodies[r.URL.Path] = string(b)
+			fmt.Fprint(w, `{"acknowledged":true}`)
+			return
+		}
+		var items []map[string]interface{}
+		scanner := bufio.NewScanner(r.Body)
+		for scanner.Scan() {
+			var action map[string]map[string]interface{}
+			json.Unmarshal(scanner.Bytes(), &action)
+			routed = append(routed, fmt.Sprint(action["index"]["_index"]))
+			scanner.Scan()
+			items = append(items, map[string]interface{}{"index": map[string]interface{}{"status": 201}})
+		}
+		json.NewEncoder(w).Encode(map[string]interface{}{"took": 1, "items": items})
+	}))
+	defer ts.Close()
+
+	// each index gets the mapping of its pattern, the default index has none
+	mappings := &mapping.Mappings{}
+	mappings.Add("orders-*", map[string]interface{}{"properties": map[string]interface{}{"i": map[string]interface{}{"type": "long"}}})
+	mappings.Add("orders-b", map[string]interface{}{"properties": map[string]interface{}{"i": map[string]interface{}{"type": "keyword"}}})
+
+	tmpl, err := clients.NewIndexTemplate(`{{ns}}-{{.kind}}`)
+	if err != nil {
+		t.Fatalf("unexpected NewIndexTemplate error, %s", err)
+	}
+	opts := &clients.ClientOptions{
+		URLs:          []string{ts.URL},
+		HTTPClient:    http.DefaultClient,
+		Index:         defaultIndex,
+		BulkRequests:  10,
+		RequestSize:   2 << 19,
+		IndexTemplate: tmpl,
+		Mappings:      mappings,
+	}
+	w, err := clients.Clients["v7"].Creator(opts)
+	if err != nil {
+		t.Fatalf("unable to create writer, %s", err)
+	}
+	for i, kind := range []string{"a", "b", "a"} {
+		msg := message.From(ops.Insert, "orders", map[string]interface{}{"_id": fmt.Sprint(i), "i": i, "kind": kind})
+		if _, err := w.Write(msg)(nil); err != nil {
+			t.Fatalf("unexpected Write error, %s", err)
+		}
+	}
+	w.(client.Closer).Close()
+
+	if fmt.Sprint(routed) != "[orders-a orders-b orders-a]" {
+		t.Errorf("wrong indices, expected [orders-a orders-b orders-a], got %v", routed)
+	}
+	for _, index := range []string{"/orders-a", "/orders-b"} {
+		if created[index] != 1 {
+			t.Errorf("index %s created %d time(s), expected once", index, created[index])
+		}
+	}
+	for index, field := range map[string]string{"/orders-a": "long", "/orders-b": "keyword"} {
+		if !strings.Contains(bodies[index], `"i":{"type":"`+field+`"}`) {
+			t.Errorf("index %s created without its mapping, got %s", index, bodies[index])
+		}
+	}
+	if _, ok := created["/"+defaultIndex]; ok {
+		t.Errorf("index %s without mapping unexpectedly created", defaultIndex)
+	}
+}
+
+func TestWriterTableSchema(t *testing.T) {
+	var (
+		mu      sync.Mutex
+		created = make(map[string]string)
+		docs    []string
+	)
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+		if r.Method == http.MethodPut {
+			b, _ := ioutil.ReadAll(r.Body)
+			created[r.URL.Path] = string(b)
+			fmt.Fprint(w, `{"acknowledged":true}`)
+			return
+		}
+		var items []map[string]interface{}
+		scanner := bufio.NewScanner(r.Body)
+		for scanner.Scan() {
+			scanner.Scan()
+			docs = append(docs, scanner.Text())
+			items = append(items, map[string]interface{}{"index": map[string]interface{}{"status": 201}})
+		}
+		json.NewEncoder(w).Encode(map[string]interface{}{"took": 1, "items": items})
+	}))
+	defer ts.Close()
+
+	opts := &clients.ClientOptions{
+		URLs:         []string{ts.URL},
+		HTTPClient:   http.DefaultClient,
+		Index:        defaultIndex,
+		BulkRequests: 10,
+		RequestSize:  2 << 19,
+	}
+	w, err := clients.Clients["v7"].Creator(opts)
+	if err != nil {
+		t.Fatalf("unable to create writer, %s", err)
+	}
+	schema := mapping.Schema{Table: "stores", Columns: []mapping.Column{
+		{Name: "id", Type: "int(11)"},
+		{Name: "lat", Type: "decimal(9,6)"},
+		{Name: "lng", Type: "decimal(9,6)"},
+	}}
+	msgs := []message.Msg{
+		message.From(ops.Command, "stores", schema.Data()),
+		message.From(ops.Insert, "stores", map[string]interface{}{"_id": "1", "id": 1, "lat": 48.8566, "lng": 2.3522}),
+	}
+	for _, msg := range msgs {
+		if _, err := w.Write(msg)(nil); err != nil {
+			t.Fatalf("unexpected Write error, %s", err)
+		}
+	}
+	w.(client.Closer).Close()
+
+	expected := `{"mappings":{"properties":{"id":{"type":"integer"},"lat":{"scaling_factor":1000000,"type":"scaled_float"},` +
+		`"lng":{"scaling_factor":1000000,"type":"scaled_float"},"location":{"type":"geo_point"}}}}`
+	if created["/"+defaultIndex] != expected {
+		t.Errorf("wrong index created\nexpected: %s\ngot: %s", expected, created["/"+defaultIndex])
+	}
+	expected = `{"id":1,"lat":48.8566,"lng":2.3522,"location":{"lat":48.8566,"lon":2.3522}}`
+	if len(docs) != 1 || docs[0] != expected {
+		t.Errorf("wrong documents, expected [%s], got %v", expected, docs)
+	}
+}
@@ -0,0 +1,119 @@
+package v8
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+
+	"github.com/appbaseio/abc/importer/adaptor/elasticsearch/clients"
+	"github.com/appbaseio/abc/importer/function/mapping"
+	"github.com/appbaseio/abc/importer/message"
+	"github.com/appbaseio/abc/importer/message/ops"
+	"github.com/appbaseio/abc/log"
+	"github.com/olivere/elastic/v7"
+)
+
+const timestampField = "@timestamp"
+
+// dataStream turns messages into the create operations accepted by data streams, the index
+// template and ILM policy of a stream are installed before its first document when configured.
+type dataStream struct {
+	opts      clients.DataStreamOptions
+	mappings  *mapping.Mappings
+	client    *elastic.Client
+	logger    log.Logger
+	installed map[string]bool
+}
+
+func newDataStream(esClient *elastic.Client, opts clients.DataStreamOptions, mappings *mapping.Mappings, logger log.Logger) *dataStream {
+	return &dataStream{opts: opts, mappings: mappings, client: esClient, logger: logger, installed: make(map[string]bool)}
+}
+
+// request returns the create operation of an insert, updates and deletes are refused as the
+// documents of a data stream can not be changed. A nil request is returned for the other ops.
+func (d *dataStream) request(msg message.Msg, stream, id string) (elastic.BulkableRequest, error) {
+	switch msg.OP() {
+	case ops.Insert:
+	case ops.Update, ops.Delete:
+		return nil, fmt.Errorf("data stream %s only accepts new documents, refusing the %s of document %s", stream, msg.OP(), id)
+	default:
+		return nil, nil
+	}
+	doc := msg.Data()
+	if _, ok := doc[timestampField]; !ok && d.opts.TimestampField != "" {
+		if v, ok := doc[d.opts.TimestampField]; ok {
+			doc[timestampField] = v
+		}
+	}
+	if _, ok := doc[timestampField]; !ok {
+		return nil, fmt.Errorf("document %s of data stream %s has no %s, set timestamp_field to the field holding its time", id, stream, timestampField)
+	}
+	if err := d.install(context.Background(), stream); err != nil {
+		return nil, err
+	}
+	return elastic.NewBulkCreateRequest().Index(stream).Id(id).Doc(doc), nil
+}
+
+// install puts the ILM policy and the index template of the stream unless they exist.
+func (d *dataStream) install(ctx context.Context, stream string) error {
+	if d.installed[stream] || (!d.opts.InstallTemplate && d.opts.ILMPolicy == nil) {
+		return nil
+	}
+	if d.opts.ILMPolicy != nil {
+		_, err := d.client.XPackIlmGetLifecycle().Policy(stream).Do(ctx)
+		if elastic.IsStatusCode(err, http.StatusNotFound) {
+			_, err = d.client.XPackIlmPutLifecycle().Policy(stream).BodyJson(map[string]interface{}{
+				"policy": d.opts.ILMPolicy,
+			}).Do(ctx)
+			if err == nil {
+				d.logger.With("policy", stream).Infoln("ILM policy installed")
+			}
+		}
+		if err != nil {
+			return fmt.Errorf("unable to install ILM policy %s, %s", stream, err)
+		}
+	}
+
+	_, err := d.client.IndexGetIndexTemplate(stream).Do(ctx)
+	if elastic.IsStatusCode(err, http.StatusNotFound) {
+		_, err = d.client.IndexPutIndexTemplate(stream).Create(true).BodyJson(d.template(stream)).Do(ctx)
+		if err == nil {
+			d.logger.With("template", stream).Infoln("index template installed")
+		}
+	}
+	if err != nil {
+		return fmt.Errorf("unable to install index template %s, %s", stream, err)
+	}
+	d.installed[stream] = true
+	return nil
+}
+
+// template returns the index template creating the stream with the mapping set for it,
+// @timestamp is always mapped as a date.
+func (d *dataStream) template(stream string) map[string]interface{} {
+	properties := map[string]interface{}{}
+	mappings := map[string]interface{}{"properties": properties}
+	if m, ok := d.mappings.For(stream); ok {
+		for k, v := range m {
+			mappings[k] = v
+		}
+		if p, ok := m["properties"].(map[string]interface{}); ok {
+			for k, v := range p {
+				properties[k] = v
+			}
+		}
+		mappings["properties"] = properties
+	}
+	properties[timestampField] = map[string]interface{}{"type": "date"}
+
+	template := map[string]interface{}{"mappings": mappings}
+	if d.opts.ILMPolicy != nil {
+		template["settings"] = map[string]interface{}{"index.lifecycle.name": stream}
+	}
+	return map[string]interface{}{
+		"index_patterns": []string{stream},
+		"data_stream":    map[string]interface{}{},
+		"priority":       200,
+		"template":       template,
+	}
+}
@@ -3,10 +3,15 @@ package v8
 import (
 	"context"
 	"encoding/json"
+	"fmt"
+	"strconv"
 	"strings"
+	"sync"
+	"time"
 
 	"github.com/appbaseio/abc/importer/adaptor/elasticsearch/clients"
 	"github.com/appbaseio/abc/importer/client"
+	"github.com/appbaseio/abc/importer/commitlog"
 	"github.com/appbaseio/abc/importer/message"
 	"github.com/appbaseio/abc/importer/message/ops"
 	"github.com/appbaseio/abc/log"
@@ -14,15 +19,35 @@ import (
 	"github.com/olivere/elastic/v7"
 )
 
-var _ client.Reader = &Reader{}
+var (
+	_ client.Reader    = &Reader{}
+	_ client.ErrReader = &Reader{}
+)
+
+const (
+	chunkSize = 1000
+
+	// seqNoField is followed when no tail field is configured
+	seqNoField = "_seq_no"
+
+	// namespace of the messages sent by the reader
+	namespace = "_doc"
+)
 
 // Reader fulfills the client.Reader interface
 type Reader struct {
 	tail      bool
+	tailField string
+	interval  time.Duration
 	index     string
+	source    clients.SourceOptions
 	logger    log.Logger
 	esClient  *elastic.Client
 	isAppbase bool
+
+	// err is the error that stopped the copy of the index
+	mu  sync.Mutex
+	err error
 }
 
 func init() {
@@ -44,10 +69,13 @@ func init() {
 			return nil, err
 		}
 		r := &Reader{}
-		r.tail = false // TODO: fix
+		r.tail = opts.Tail
+		r.tailField = opts.TailField
+		r.interval = opts.PollInterval
 		r.esClient = esClient
 		r.logger = log.With("reader", "elasticsearch").With("version", 7)
 		r.index = opts.Index
+		r.source = opts.Source
 		// check appbase
 		uri := opts.URLs[0]
 		if strings.Contains(uri, "scalr.api.appbase.io") {
@@ -61,84 +89,336 @@ func init() {
 
 func (r *Reader) Read(resumeMap map[string]client.MessageSet, filterFn client.NsFilterFunc) client.MessageChanFunc {
 	return func(s client.Session, done chan struct{}) (chan client.MessageSet, error) {
+		var (
+			cursors  []*cursor
+			resumeTS int64
+			skipCopy bool
+		)
+		if r.tail {
+			// documents changed during the copy are read again once it completes
+			var err error
+			cursors, err = r.cursors()
+			if err != nil {
+				return nil, err
+			}
+			// only a tail field has a single position to resume from
+			if r.tailField != "" {
+				resumeTS = timestamp(cursors[0].last)
+				if m, ok := resumeMap[namespace]; ok && m.Mode != commitlog.Copy && m.Timestamp > 0 {
+					cursors[0].last = m.Timestamp
+					skipCopy = true
+				}
+			}
+		}
+
+		var metadata *clients.IndexMetadata
+		if r.source.CopyMetadata && !skipCopy {
+			var err error
+			metadata, err = clients.GetIndexMetadata(context.Background(), r.esClient, r.index, r.logger)
+			if err != nil {
+				return nil, err
+			}
+		}
+
 		out := make(chan client.MessageSet)
 		go func() {
 			defer close(out)
 			log.With("cluster", r.esClient).Infoln("starting Read func")
 
-			// fetch data
-			tableDone := r.iterateType(out, done)
-			func() {
-				for {
+			if skipCopy {
+				r.logger.Infoln("copy already complete, skipping...")
+			} else {
+				// the metadata is applied by the sink before the documents are written
+				if metadata != nil {
 					select {
-					case i, ok := <-tableDone:
-						if !ok {
-							return
-						}
-						r.logger.Infof("Mapping %s done", i)
+					case out <- client.MessageSet{
+						Msg:       message.From(ops.Command, namespace, metadata.Data()),
+						Timestamp: resumeTS,
+					}:
 					case <-done:
 						return
 					}
 				}
-			}()
+				// fetch data
+				tableDone := r.iterateType(out, done, resumeTS)
+				func() {
+					for {
+						select {
+						case i, ok := <-tableDone:
+							if !ok {
+								return
+							}
+							r.logger.Infof("Mapping %s done", i)
+						case <-done:
+							return
+						}
+					}
+				}()
+				// the changes are not read after a failed copy
+				if r.Err() != nil {
+					return
+				}
+			}
 
+			if r.tail {
+				r.tailChanges(cursors, out, done)
+			}
 			return
 		}()
 		return out, nil
 	}
 }
 
-func (r *Reader) iterateType(out chan<- client.MessageSet, done chan struct{}) <-chan string {
+// iterateType sends the documents of the index, tableDone receives once all of them were sent.
+func (r *Reader) iterateType(out chan<- client.MessageSet, done chan struct{}, ts int64) <-chan string {
 	tableDone := make(chan string)
 	go func() {
 		defer close(tableDone)
-		select {
-		default:
-			const chunkSize = 1000
-			searchService, _ := r.esClient.Search(r.index).Size(chunkSize).Query(elastic.NewMatchAllQuery()).TrackTotalHits(true).Sort("_id", true).Do(context.Background())
-			hitsSize := len(searchService.Hits.Hits)
-			if hitsSize != 0 {
-				lastData := searchService.Hits.Hits[hitsSize-1]
-				currHits := int64(hitsSize)
-				for searchService.TotalHits() >= currHits {
-					if r.writeHitToFile(searchService, out) {
-						return
-					}
-					searchService, _ = r.esClient.Search(r.index).Size(chunkSize).Query(elastic.NewMatchAllQuery()).TrackTotalHits(true).SearchAfter(lastData.Id).Sort("_id", true).Do(context.Background())
-					hitsSize = len(searchService.Hits.Hits)
-					if hitsSize == 0 {
-						break
-					}
-					lastData = searchService.Hits.Hits[hitsSize-1]
-					currHits += int64(hitsSize)
-				}
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+		go func() {
+			select {
+			case <-done:
+				cancel()
+			case <-ctx.Done():
 			}
-			// finish
-			tableDone <- "_doc"
-			return
-		case <-done:
+		}()
+
+		err := clients.Scan(ctx, r.esClient, r.index, r.source, r.logger, func(hits []*elastic.SearchHit) error {
+			return r.sendHits(ctx, hits, out, ts)
+		})
+		if ctx.Err() != nil {
 			log.With("cluster", r.esClient).Infoln("Done with iterating")
 			return
 		}
+		if err != nil {
+			r.logger.With("index", r.index).Errorf("unable to read index, %s", err)
+			r.mu.Lock()
+			r.err = fmt.Errorf("unable to read index %s, %s", r.index, err)
+			r.mu.Unlock()
+			return
+		}
+		select {
+		case tableDone <- namespace:
+		case <-done:
+		}
 	}()
 	return tableDone
 }
 
-func (r *Reader) writeHitToFile(searchService *elastic.SearchResult, out chan<- client.MessageSet) bool {
-	for _, hit := range searchService.Hits.Hits {
-		bytes, _ := hit.Source.MarshalJSON()
-		var m map[string]interface{}
-		err := json.Unmarshal(bytes, &m)
+// Err returns the error that stopped the copy of the index, the pipeline fails with it.
+func (r *Reader) Err() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.err
+}
+
+// sendHits sends the documents of hits until ctx is done.
+func (r *Reader) sendHits(ctx context.Context, hits []*elastic.SearchHit, out chan<- client.MessageSet, ts int64) error {
+	for _, hit := range hits {
+		m, err := hitData(hit)
+		if err != nil {
+			return fmt.Errorf("problem unmarshaling document %s, %s", hit.Id, err)
+		}
+		select {
+		case out <- client.MessageSet{
+			Msg:       message.From(ops.Insert, namespace, m),
+			Timestamp: ts,
+		}:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+	return nil
+}
+
+// hitData returns the source of a hit with its _id.
+func hitData(hit *elastic.SearchHit) (map[string]interface{}, error) {
+	bytes, _ := hit.Source.MarshalJSON()
+	var m map[string]interface{}
+	if err := json.Unmarshal(bytes, &m); err != nil {
+		return nil, err
+	}
+	if m == nil {
+		m = make(map[string]interface{})
+	}
+	m["_id"] = hit.Id
+	return m, nil
+}
+
+// cursor tracks the last change read from an index, or from one of its shards
+// when following sequence numbers as they only increase within a shard.
+type cursor struct {
+	index string
+	shard int
+	// last is the sort value of the last document read, nil until one was read
+	last interface{}
+	// seen holds the documents read with the last value of a tail field, they
+	// are skipped when read again as the field is not unique
+	seen map[string]bool
+}
+
+// cursors returns the cursors to follow starting from the last change made.
+func (r *Reader) cursors() ([]*cursor, error) {
+	if r.tailField != "" {
+		c := &cursor{index: r.index, shard: -1}
+		last, err := r.lastValue(c)
 		if err != nil {
-			r.logger.Errorf("Problem unmarshaling document %s", err)
-			return true
+			return nil, err
 		}
-		// r.logger.Infoln(m)
-		// send data
-		out <- client.MessageSet{
-			// _doc instead of t
-			Msg: message.From(ops.Insert, "_doc", m),
+		c.last = last
+		return []*cursor{c}, nil
+	}
+
+	settings, err := r.esClient.IndexGetSettings(r.index).Do(context.Background())
+	if err != nil {
+		return nil, err
+	}
+	var cursors []*cursor
+	for index, resp := range settings {
+		indexSettings, _ := resp.Settings["index"].(map[string]interface{})
+		shards, err := strconv.Atoi(fmt.Sprint(indexSettings["number_of_shards"]))
+		if err != nil {
+			return nil, fmt.Errorf("unable to read number of shards of %s", index)
 		}
+		for shard := 0; shard < shards; shard++ {
+			c := &cursor{index: index, shard: shard}
+			last, err := r.lastValue(c)
+			if err != nil {
+				return nil, err
+			}
+			c.last = last
+			cursors = append(cursors, c)
+		}
+	}
+	if len(cursors) == 0 {
+		return nil, fmt.Errorf("no index found for %s", r.index)
+	}
+	return cursors, nil
+}
+
+func (r *Reader) field() string {
+	if r.tailField != "" {
+		return r.tailField
+	}
+	return seqNoField
+}
+
+// search returns a search limited to the documents of a cursor.
+func (r *Reader) search(c *cursor) *elastic.SearchService {
+	search := r.esClient.Search(c.index)
+	if c.shard >= 0 {
+		search = search.Preference(fmt.Sprintf("_shards:%d", c.shard))
+	}
+	return search
+}
+
+// lastValue returns the highest value of the followed field for a cursor.
+func (r *Reader) lastValue(c *cursor) (interface{}, error) {
+	res, err := r.search(c).Size(1).Query(elastic.NewExistsQuery(r.field())).Sort(r.field(), false).Do(context.Background())
+	if err != nil {
+		return nil, err
+	}
+	if len(res.Hits.Hits) == 0 || len(res.Hits.Hits[0].Sort) == 0 {
+		return nil, nil
+	}
+	return res.Hits.Hits[0].Sort[0], nil
+}
+
+// changesQuery matches the documents changed after the last one read by a cursor, a tail
+// field is matched inclusively as other documents can be written with its last value.
+func (r *Reader) changesQuery(c *cursor) elastic.Query {
+	if c.last == nil {
+		return elastic.NewExistsQuery(r.field())
+	}
+	if r.tailField != "" {
+		return elastic.NewRangeQuery(r.tailField).Gte(c.last)
+	}
+	return elastic.NewRangeQuery(seqNoField).Gt(c.last)
+}
+
+// tailChanges polls the index for changed documents until done is closed.
+func (r *Reader) tailChanges(cursors []*cursor, out chan<- client.MessageSet, done chan struct{}) {
+	r.logger.With("field", r.field()).Infoln("Listening for changes...")
+	ticker := time.NewTicker(r.interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-done:
+			r.logger.Infoln("tailing stopping...")
+			return
+		case <-ticker.C:
+		}
+		for _, c := range cursors {
+			if err := r.pollChanges(c, out, done); err != nil {
+				r.logger.With("index", c.index).Errorf("error reading changes, %s", err)
+			}
+		}
+	}
+}
+
+// pollChanges sends the documents changed since the last poll of a cursor.
+func (r *Reader) pollChanges(c *cursor, out chan<- client.MessageSet, done chan struct{}) error {
+	search := r.search(c).Size(chunkSize).Query(r.source.Filter(r.changesQuery(c))).Sort(r.field(), true)
+	if fsc := r.source.FetchSource(); fsc != nil {
+		search = search.FetchSourceContext(fsc)
+	}
+	if r.tailField != "" {
+		search = search.Sort(seqNoField, true)
+	}
+	for {
+		res, err := search.Do(context.Background())
+		if err != nil {
+			return err
+		}
+		hits := res.Hits.Hits
+		for _, hit := range hits {
+			if len(hit.Sort) == 0 {
+				continue
+			}
+			value := hit.Sort[0]
+			if r.tailField != "" {
+				if value != c.last || c.seen == nil {
+					c.seen = make(map[string]bool)
+				} else if c.seen[hit.Id] {
+					continue
+				}
+				c.seen[hit.Id] = true
+			}
+			c.last = value
+
+			m, err := hitData(hit)
+			if err != nil {
+				return err
+			}
+			select {
+			case out <- client.MessageSet{
+				Msg:       message.From(ops.Insert, namespace, m),
+				Timestamp: timestamp(value),
+				Mode:      commitlog.Sync,
+			}:
+			case <-done:
+				return nil
+			}
+		}
+		if len(hits) < chunkSize {
+			return nil
+		}
+		search = search.SearchAfter(hits[len(hits)-1].Sort...)
+	}
+}
+
+// timestamp returns a numeric sort value for use as the message Timestamp, dates are sorted
+// on their epoch milliseconds, other values cannot be resumed from and 0 is returned.
+func timestamp(v interface{}) int64 {
+	switch v := v.(type) {
+	case float64:
+		return int64(v)
+	case int64:
+		return v
+	case json.Number:
+		i, _ := v.Int64()
+		return i
 	}
-	return false
+	return 0
 }
@@ -0,0 +1,78 @@
+package v8
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+
+	"github.com/appbaseio/abc/importer/adaptor/elasticsearch/clients"
+)
+
+var changesQueryTests = []struct {
+	name      string
+	tailField string
+	last      interface{}
+	expected  string
+}{
+	{"seq_no", "", float64(41), `{"range":{"_seq_no":{"from":41,"include_lower":false,"include_upper":true,"to":null}}}`},
+	{"empty shard", "", nil, `{"exists":{"field":"_seq_no"}}`},
+	{"tail field", "updated_at", float64(1600000000000), `{"range":{"updated_at":{"from":1600000000000,"include_lower":true,"include_upper":true,"to":null}}}`},
+}
+
+func TestChangesQuery(t *testing.T) {
+	for _, ct := range changesQueryTests {
+		r := &Reader{tailField: ct.tailField}
+		src, err := r.changesQuery(&cursor{last: ct.last}).Source()
+		if err != nil {
+			t.Fatalf("[%s] unexpected Source error, %s", ct.name, err)
+		}
+		b, _ := json.Marshal(src)
+		if string(b) != ct.expected {
+			t.Errorf("[%s] wrong query, expected %s, got %s", ct.name, ct.expected, b)
+		}
+	}
+}
+
+func TestTimestamp(t *testing.T) {
+	values := []interface{}{float64(1600000000000), json.Number("42"), "keyword"}
+	expected := []int64{1600000000000, 42, 0}
+	got := make([]int64, len(values))
+	for i, v := range values {
+		got[i] = timestamp(v)
+	}
+	if !reflect.DeepEqual(got, expected) {
+		t.Errorf("wrong timestamps, expected %v, got %v", expected, got)
+	}
+}
+
+func TestReaderScanError(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/" {
+			w.Write([]byte("{}"))
+			return
+		}
+		w.WriteHeader(http.StatusInternalServerError)
+	}))
+	defer ts.Close()
+
+	r, err := clients.Clients["v8_reader"].Reader(&clients.ClientOptions{
+		URLs:       []string{ts.URL},
+		HTTPClient: http.DefaultClient,
+		Index:      "test_v8",
+	})
+	if err != nil {
+		t.Fatalf("unable to create reader, %s", err)
+	}
+	out, err := r.Read(nil, func(string) bool { return true })(nil, make(chan struct{}))
+	if err != nil {
+		t.Fatalf("unexpected Read error, %s", err)
+	}
+	for range out {
+		t.Errorf("unexpected message")
+	}
+	if r.(*Reader).Err() == nil {
+		t.Errorf("expected the failed scan to be reported")
+	}
+}
@@ -18,24 +18,35 @@ import (
 )
 
 var (
-	_                client.Writer = &Writer{}
-	_                client.Closer = &Writer{}
-	isMappingApplied               = false
+	_ client.Writer    = &Writer{}
+	_ client.Closer    = &Writer{}
+	_ client.Completer = &Writer{}
 )
 
 // Writer implements client.Writer and client.Session for sending requests to an elasticsearch
 // cluster via its _bulk API.
 type Writer struct {
-	index      string
-	bs         *elastic.BulkService
-	indexCount int
-	sync.Mutex
-	confirmChan  chan struct{}
-	esClient     *elastic.Client
-	logger       log.Logger
-	ticker       *time.Ticker
-	requestSize  int64
-	bulkRequests int
+	index     string
+	processor *clients.Processor
+	update    clients.UpdateOptions
+	request   clients.RequestOptions
+	alias     *clients.AliasSwap
+	template  *clients.IndexTemplate
+	// dataStream is set when writing to data streams
+	dataStream *dataStream
+	// mappings are the mappings set for the indices written to, mapped holds the indices that
+	// were created with their mapping
+	mappings  *mapping.Mappings
+	mapped    map[string]bool
+	schemas   *clients.Schemas
+	committer *clients.Committer
+	stats     *clients.TransportStats
+	esClient  *elastic.Client
+	logger    log.Logger
+	ticker    *time.Ticker
+	// stop ends the flushes of the ticker, the processor is closed once they returned
+	stop     chan struct{}
+	flushing sync.WaitGroup
 }
 
 func init() {
@@ -57,22 +68,49 @@ func init() {
 			return nil, err
 		}
 		w := &Writer{
-			index:  opts.Index,
-			logger: log.With("writer", "elasticsearch").With("version", 7),
+			index:    opts.Index,
+			update:   opts.Update,
+			request:  opts.Request,
+			template: opts.IndexTemplate,
+			mappings: opts.Mappings,
+			mapped:   make(map[string]bool),
+			schemas:  clients.NewSchemas(),
+			stats:    opts.TransportStats,
+			logger:   log.With("writer", "elasticsearch").With("version", 7),
 		}
-		// bulk handler
-		w.bs = esClient.Bulk().Index(opts.Index)
 		w.esClient = esClient
+		w.committer, err = clients.NewCommitter(esClient, opts, w.logger)
+		if err != nil {
+			return nil, err
+		}
+		if opts.DataStream.Enabled {
+			w.dataStream = newDataStream(esClient, opts.DataStream, opts.Mappings, w.logger)
+		}
+		if opts.Alias != "" {
+			w.alias = clients.NewAliasSwap(esClient, opts.Alias, opts.Index, opts.DeleteOldIndices, w.logger)
+			if err := w.alias.Check(context.Background()); err != nil {
+				return nil, err
+			}
+		}
+		// bulk handler
+		w.processor = clients.NewProcessor(w.committer, opts.BulkWorkers, opts.BulkRequests, opts.RequestSize, w.logger)
 		w.ticker = time.NewTicker(5 * time.Second)
-		w.requestSize = opts.RequestSize
-		w.bulkRequests = opts.BulkRequests
+		w.stop = make(chan struct{})
 		if opts.Tail {
+			w.flushing.Add(1)
 			go func() {
-				for range w.ticker.C {
-					err = w.EsCommit()
-					if err != nil {
+				defer w.flushing.Done()
+				for {
+					select {
+					case <-w.ticker.C:
+					case <-w.stop:
+						return
+					}
+					// the processor keeps the error, the next Write or the final Flush fails
+					// the pipeline with it
+					if err := w.EsCommit(); err != nil {
 						w.logger.Errorln(err)
-						panic(err)
+						return
 					}
 				}
 			}()
@@ -83,14 +121,15 @@ func init() {
 
 func (w *Writer) Write(msg message.Msg) func(client.Session) (message.Msg, error) {
 	return func(s client.Session) (message.Msg, error) {
-		w.Lock()
-		w.confirmChan = msg.Confirms()
-		w.Unlock()
-
-		// apply mapping
-		if mapping.IsMappingSet {
-			isMappingApplied = true
-			err := w.setMapping(w.esClient, mapping.CurrentMapping)
+		if msg.OP() == ops.Command {
+			return msg, w.command(msg)
+		}
+
+		// apply the mapping set for the index, the mapping of data streams is set in their
+		// index template
+		if m, ok := w.indexMapping(w.index); ok && w.dataStream == nil && !w.mapped[w.index] {
+			w.mapped[w.index] = true
+			err := w.setMapping(w.esClient, w.index, m)
 			if err != nil {
 				return nil, err
 			}
@@ -99,6 +138,13 @@ func (w *Writer) Write(msg message.Msg) func(client.Session) (message.Msg, error
 		if msg.Data().AsMap() != nil && len(msg.Data().AsMap()) > 0 {
 			var id string
 			var index string
+			// route the message with the index template, a literal _index still wins
+			if w.template != nil {
+				var err error
+				if index, err = w.template.Index(msg); err != nil {
+					return msg, err
+				}
+			}
 			if _, ok := msg.Data()["_id"]; ok {
 				id = msg.ID()
 				msg.Data().Delete("_id")
@@ -109,94 +155,188 @@ func (w *Writer) Write(msg message.Msg) func(client.Session) (message.Msg, error
 				index = msg.Data()["_index"].(string)
 				msg.Data().Delete("_index")
 			}
+			// the indices routed to are created with the mapping on first use
+			if index != "" && index != w.index && w.dataStream == nil && !w.mapped[index] {
+				if m := w.mappingOf(index, msg); m != nil {
+					if err := w.setMapping(w.esClient, index, m); err != nil {
+						return nil, err
+					}
+				}
+				w.mapped[index] = true
+			}
+			// the geo points are only added to the indices mapped from the schema
+			target := index
+			if target == "" {
+				target = w.index
+			}
+			if _, ok := w.indexMapping(target); !ok {
+				w.schemas.SetGeoPoints(msg)
+			}
 
-			var br elastic.BulkableRequest
-			switch msg.OP() {
-			case ops.Delete:
+			var (
+				br     elastic.BulkableRequest
+				action string
+			)
+			switch {
+			case w.dataStream != nil:
+				stream := index
+				if stream == "" {
+					stream = w.index
+				}
+				var err error
+				if br, err = w.dataStream.request(msg, stream, id); err != nil {
+					return msg, err
+				}
+				action = "create"
+			case msg.OP() == ops.Delete:
+				action = "delete"
 				br = elastic.NewBulkDeleteRequest().Index(index).Id(id)
-			case ops.Insert:
+			case msg.OP() == ops.Insert:
+				action = "index"
 				br = elastic.NewBulkIndexRequest().Id(id).Index(index).Doc(msg.Data())
-			case ops.Update:
-				br = elastic.NewBulkUpdateRequest().Id(id).Index(index).Doc(msg.Data())
+			case msg.OP() == ops.Update:
+				br, action = w.update.Request(index, "", id, msg.Data())
 			}
 
-			// add a bulk request only if # of requests < --bulk_requests AND size of requests < --request_size switches
-			w.Lock()
-			if w.bs.NumberOfActions() < w.bulkRequests && w.bs.EstimatedSizeInBytes() < w.requestSize {
-				log.Debugln(br.String())
-				w.bs.Add(br)
+			if br == nil {
+				if msg.Confirms() != nil {
+					close(msg.Confirms())
+				}
+				return msg, nil
+			}
+			if err := w.request.Apply(br, msg.Data()); err != nil {
+				return msg, err
+			}
+			log.Debugln(br.String())
+			// the bulks are sent by the workers of the processor, a write waits while the
+			// worker of its document is sending one
+			err := w.processor.Add(&clients.Item{
+				Request:  br,
+				Action:   action,
+				Index:    index,
+				ID:       id,
+				Doc:      msg.Data(),
+				Confirms: msg.Confirms(),
+			})
+			if err != nil {
+				return msg, err
 			}
-			w.Unlock()
+		} else if msg.Confirms() != nil {
+			// nothing to index
+			close(msg.Confirms())
 		}
+		return msg, nil
+	}
+}
 
-		// clear confirmChan
-		if w.confirmChan != nil {
-			close(w.confirmChan)
-			w.confirmChan = nil
+// command applies the index metadata sent by an elasticsearch source, or the mapping of the
+// table schema sent by a SQL source, to the index. Neither is applied to data streams.
+func (w *Writer) command(msg message.Msg) error {
+	md, ok, err := clients.MetadataFrom(msg.Data())
+	if ok && err == nil {
+		if w.dataStream != nil {
+			w.logger.Infoln("index metadata not copied to data streams")
+		} else {
+			err = md.Apply(context.Background(), w.esClient, w.index, w.logger, w.alias.Alias())
 		}
+	}
+	if !ok {
+		err = w.applySchema(msg)
+	}
+	if err == nil && msg.Confirms() != nil {
+		close(msg.Confirms())
+	}
+	return err
+}
 
-		var err error
-		// commit if # requests exceed either constraint
-		if w.bs.NumberOfActions() >= w.bulkRequests || w.bs.EstimatedSizeInBytes() >= w.requestSize {
-			err = w.EsCommit()
-			if err != nil {
-				panic(err)
-			}
-		}
-		return msg, err
+// applySchema creates the index with the mapping of a table schema, unless a mapping is set for
+// it. The indices the rows of the table are routed to are created with it on first use.
+func (w *Writer) applySchema(msg message.Msg) error {
+	schema, ok, err := mapping.SchemaFrom(msg.Data())
+	if !ok || err != nil {
+		return err
+	}
+	if w.dataStream != nil {
+		w.logger.With("table", schema.Table).Infoln("table schema not mapped in data streams")
+		return nil
+	}
+	m := w.schemas.Add(msg.Namespace(), schema)
+	if w.template != nil {
+		return nil
+	}
+	if _, ok := w.indexMapping(w.index); ok {
+		w.logger.With("table", schema.Table).Infoln("mapping set, table schema not mapped")
+		return nil
+	}
+	return w.setMapping(w.esClient, w.index, m)
+}
+
+// mappingOf returns the mapping of an index a message is routed to, the mapping set for the
+// index or else the mapping of the schema of its table.
+func (w *Writer) mappingOf(index string, msg message.Msg) map[string]interface{} {
+	if m, ok := w.indexMapping(index); ok {
+		return m
 	}
+	return w.schemas.Mapping(msg.Namespace())
+}
+
+// indexMapping returns the mapping set for an index, the imported index is known by its alias.
+func (w *Writer) indexMapping(index string) (map[string]interface{}, bool) {
+	if index == w.index && w.alias != nil {
+		index = w.alias.Alias()
+	}
+	return w.mappings.For(index)
 }
 
 // EsCommit is called to commit changes to ES
 func (w *Writer) EsCommit() error {
-	defer w.Unlock()
-	w.Lock()
-	numberOfActions := w.bs.NumberOfActions()
-	if numberOfActions > 0 {
-		w.logger.Infof("Going through %d", numberOfActions)
-		w.indexCount += numberOfActions
-
-		w.logger.Infof("indexing %d data record(s)\n", numberOfActions)
-		startTime := time.Now()
-		data, err := w.bs.Do(context.Background())
-		w.logger.Infof("%d data record(s) indexed in %f seconds\n", numberOfActions, time.Since(startTime).Seconds())
-		fmt.Printf("%d total data record(s) indexed\n", w.indexCount)
+	return w.processor.Flush()
+}
 
-		if err != nil {
-			w.logger.Errorln(err)
-		}
-		if data != nil && len(data.Failed()) > 0 {
-			fl := data.Failed()[0]
-			w.logger.Infof("fail %s %s %v %v %v", fl.Id, fl.Index, fl.Type, fl.Error, fl.Status)
-			return errors.New(fmt.Sprintf("%v", fl.Error))
-		}
-		return err
+// Flush sends the pending bulks once the pipeline stopped writing, it returns the first error of
+// a bulk.
+func (w *Writer) Flush() error {
+	return w.EsCommit()
+}
+
+// Complete moves the alias to the imported index once every document was sent.
+func (w *Writer) Complete() error {
+	if w.alias == nil {
+		return nil
 	}
-	return nil
+	if err := w.processor.Flush(); err != nil {
+		return fmt.Errorf("alias not moved, %s", err)
+	}
+	// an empty import is created with the mapping set for the index
+	m, _ := w.indexMapping(w.index)
+	return w.alias.Swap(context.Background(), m)
 }
 
 // Close is called by clients.Close() when it receives on the done channel.
 func (w *Writer) Close() {
-	err := w.EsCommit() // save changes before exiting
-	w.logger.Infoln("closing BulkService")
-	w.esClient.Stop()
 	w.ticker.Stop()
-
-	if err != nil {
-		panic(err)
+	close(w.stop)
+	w.flushing.Wait()
+	// the error was returned by Write or Flush already
+	if err := w.processor.Close(); err != nil {
+		w.logger.Errorf("unable to send the last bulks, %s", err)
 	}
+	w.stats.Log(w.logger)
+	w.logger.Infoln("closing BulkService")
+	w.esClient.Stop()
+	w.committer.Close()
 }
 
 // setMapping sets the index mapping
-func (w *Writer) setMapping(esClient *elastic.Client, mapping map[string]interface{}) error {
+func (w *Writer) setMapping(esClient *elastic.Client, index string, mapping map[string]interface{}) error {
 	log.Debugf("Going to apply mapping %s", mapping)
-	_, err := esClient.CreateIndex(w.index).BodyJson(map[string]interface{}{
+	_, err := esClient.CreateIndex(index).BodyJson(map[string]interface{}{
 		"mappings": mapping,
 	}).Do(context.Background())
 	// BodyJson(mapping).Do(context.Background())
 	if err != nil {
 		// if above fails, try assuming the index already exists
-		_, innerErr := esClient.PutMapping().Index(w.index).BodyJson(mapping).Do(context.Background())
+		_, innerErr := esClient.PutMapping().Index(index).BodyJson(mapping).Do(context.Background())
 
 		if innerErr != nil {
 			return errors.New("Mapping request failed")
@@ -16,6 +16,7 @@ import (
 	// used to call init function for each client to register itself
 	_ "github.com/appbaseio/abc/importer/adaptor/elasticsearch/clients/all"
 	"github.com/appbaseio/abc/importer/client"
+	"github.com/appbaseio/abc/importer/function/mapping"
 	"github.com/appbaseio/abc/log"
 	"github.com/hashicorp/go-version"
 )
@@ -27,6 +28,7 @@ const (
 	DefaultESVersion    = "2.1"
 	DefaultRequestSize  = 2 << 19
 	DefaultBulkRequests = 1000
+	DefaultPollInterval = 5 * time.Second
 
 	description = "an elasticsearch source/sink adaptor"
 
@@ -35,23 +37,104 @@ const (
   // "timeout": "10s", // defaults to 30s
   // "aws_access_key": "ABCDEF", // used for signing requests to AWS Elasticsearch service
   // "aws_access_secret": "ABCDEF", // used for signing requests to AWS Elasticsearch service
+  // "api_key": "id:api_key", // API key sent instead of the basic auth of the uri
+  // "bearer_token": "ABCDEF", // or a bearer token
+  // "cacerts": ["/path/to/ca.pem"], // CA certificates of the cluster
+  // "client_cert": "/path/to/cert.pem", // client certificate
+  // "client_key": "/path/to/key.pem", // key of the client certificate
+  // "insecure_skip_verify": false, // do not verify the certificate of the cluster
+  // "gzip": false, // gzip the bodies of the bulk requests
+  // "max_idle_conns": 2, // idle connections kept open to each node of the cluster, at least bulk_workers
+  // "connection_retries": 3, // how many times a request is sent again after its connection was reset
   // "tail": false, // enable tailing
+  // "tail_field": "updated_at", // field that increases whenever a document changes, sequence numbers are followed by default
+  // "poll_interval": "5s", // how often the index is read for changes when tailing, defaults to 5s
+  // "query": {"range": {"created_at": {"gte": "now-1y"}}}, // query DSL filtering the documents read
+  // "query_file": "query.json", // or the file holding it
+  // "source_fields": ["name", "address.*"], // _source fields of the documents read
+  // "slices": 1, // number of slices of the index read in parallel
+  // "copy_metadata": false, // create the destination index with the mappings, settings and aliases of the source index
   // "request_size": 524288,
-  // "bulk_requests": 1000
+  // "bulk_requests": 1000,
+  // "bulk_workers": 1, // number of bulks sent at the same time
+  // "bulk_retries": 5, // how many times documents rejected with a 429 or 503 status are sent again
+  // "update_mode": "update", // update, index, upsert or script
+  // "script": "ctx._source.count += params.count", // painless script run by the script update mode
+  // "script_params": {"count": "count"}, // script params taken from the message fields
+  // "pipeline": "geoip", // ingest pipeline of the indexed documents
+  // "routing_field": "user_id", // field holding the routing value of the documents
+  // "version_field": "updated_at", // field holding the external version of the documents, requires the index update_mode
+  // "version_type": "external", // or external_gte
+  // "data_stream": false, // write to data streams with create operations, elasticsearch 8 only
+  // "timestamp_field": "created_at", // field copied to the @timestamp of the data stream documents
+  // "data_stream_template": false, // install an index template for the data streams written to
+  // "ilm_policy": {"phases": {"hot": {"actions": {"rollover": {"max_age": "7d"}}}}}, // ILM policy of the data streams
+  // "index_template": "{{ns}}-{{date .created_at \"2006.01\"}}", // index of every message, {{ns}} is its namespace
+  // "alias": false, // import into a new timestamped index and move the index of the uri, as an alias, to it once done
+  // "delete_old_indices": false, // delete the indices the alias pointed to before
+  // "max_failures": 0, // documents allowed to fail before the import aborts, -1 for no limit
+  // "dead_letter_file": "failed.jsonl", // JSON lines file receiving the documents that failed
+  // "dead_letter_index": "failed" // or the index receiving them
 }`
 )
 
-var _ adaptor.Adaptor = &Elasticsearch{}
+var (
+	_ adaptor.Adaptor = &Elasticsearch{}
+	_ mapping.Mapper  = &Elasticsearch{}
+)
 
 // Elasticsearch is an adaptor to connect a pipeline to
 // an elasticsearch cluster.
 type Elasticsearch struct {
 	adaptor.BaseConfig
-	AWSAccessKeyID  string `json:"aws_access_key" doc:"credentials for use with AWS Elasticsearch service"`
-	AWSAccessSecret string `json:"aws_access_secret" doc:"credentials for use with AWS Elasticsearch service"`
-	Tail            bool   `json:"tail" doc:"if tail is set, ES index will be watched for changes"`
-	RequestSize     int64  `json:"request_size"`
-	BulkRequests    int    `json:"bulk_requests"`
+	AWSAccessKeyID     string                 `json:"aws_access_key" doc:"credentials for use with AWS Elasticsearch service"`
+	AWSAccessSecret    string                 `json:"aws_access_secret" doc:"credentials for use with AWS Elasticsearch service"`
+	APIKey             string                 `json:"api_key" doc:"API key, id:api_key or its base64 encoding, sent instead of the basic auth of the uri"`
+	BearerToken        string                 `json:"bearer_token" doc:"bearer token sent instead of the basic auth of the uri"`
+	CACerts            []string               `json:"cacerts" doc:"CA certificates, files or PEM, the cluster certificate is verified with"`
+	ClientCert         string                 `json:"client_cert" doc:"client certificate, file or PEM, presented to the cluster"`
+	ClientKey          string                 `json:"client_key" doc:"key, file or PEM, of the client certificate"`
+	InsecureSkipVerify bool                   `json:"insecure_skip_verify" doc:"do not verify the certificate of the cluster"`
+	Gzip               bool                   `json:"gzip" doc:"gzip the bodies of the bulk requests"`
+	MaxIdleConns       int                    `json:"max_idle_conns" doc:"number of idle connections kept open to each node of the cluster, and in total, defaults to the 2 per node and 100 in total of the Go http client"`
+	ConnectionRetries  int                    `json:"connection_retries" doc:"how many times a request is sent again after its connection was reset"`
+	Tail               bool                   `json:"tail" doc:"if tail is set, ES index will be watched for changes"`
+	TailField          string                 `json:"tail_field" doc:"date or numeric field that increases whenever a document changes, the sequence numbers of the index are followed when not set"`
+	PollInterval       string                 `json:"poll_interval" doc:"how often the index is read for changes when tailing, defaults to 5s"`
+	Query              map[string]interface{} `json:"query" doc:"query DSL filtering the documents read"`
+	QueryFile          string                 `json:"query_file" doc:"file holding the query DSL filtering the documents read"`
+	SourceFields       []string               `json:"source_fields" doc:"_source fields of the documents read, wildcards are accepted"`
+	Slices             int                    `json:"slices" doc:"number of slices of the index read in parallel"`
+	CopyMetadata       bool                   `json:"copy_metadata" doc:"create the destination index with the mappings, settings and aliases of the source index"`
+	RequestSize        int64                  `json:"request_size"`
+	BulkRequests       int                    `json:"bulk_requests"`
+	BulkWorkers        int                    `json:"bulk_workers" doc:"number of bulks sent at the same time, the changes of a document are always sent in order"`
+	BulkRetries        int                    `json:"bulk_retries" doc:"how many times the documents rejected with a 429 or 503 status are sent again"`
+	UpdateMode         string                 `json:"update_mode" doc:"how update messages are applied: update (default), index, upsert or script"`
+	Script             string                 `json:"script" doc:"painless script run on the documents by the script update mode"`
+	ScriptParams       map[string]string      `json:"script_params" doc:"params of the script, mapped to the message fields holding their value"`
+	Pipeline           string                 `json:"pipeline" doc:"ingest pipeline the indexed documents go through"`
+	RoutingField       string                 `json:"routing_field" doc:"field holding the routing value of the documents"`
+	VersionField       string                 `json:"version_field" doc:"field holding the external version of the documents, a number or a date"`
+	VersionType        string                 `json:"version_type" doc:"external (default) or external_gte"`
+	DataStream         bool                   `json:"data_stream" doc:"write to data streams with create operations, updates and deletes are refused"`
+	TimestampField     string                 `json:"timestamp_field" doc:"field copied to the @timestamp of the data stream documents without one"`
+	DataStreamTemplate bool                   `json:"data_stream_template" doc:"install an index template, with the mapping, for the data streams written to"`
+	ILMPolicy          map[string]interface{} `json:"ilm_policy" doc:"ILM policy installed and set in the index template of the data streams written to"`
+	IndexTemplate      string                 `json:"index_template" doc:"text/template naming the index of every message from its fields, ns and date functions"`
+	Alias              bool                   `json:"alias" doc:"import into a new timestamped index, the index of the uri is an alias moved to it once the import completes"`
+	DeleteOldIndices   bool                   `json:"delete_old_indices" doc:"delete the indices the alias pointed to before the import"`
+	MaxFailures        int                    `json:"max_failures" doc:"number of documents allowed to fail before the import aborts, -1 for no limit"`
+	DeadLetterFile     string                 `json:"dead_letter_file" doc:"JSON lines file receiving the documents that failed to be indexed with their error"`
+	DeadLetterIndex    string                 `json:"dead_letter_index" doc:"index receiving the documents that failed to be indexed with their error"`
+
+	// mappings are set by the pipeline for the indices written to
+	mappings mapping.Mappings
+}
+
+// AddMapping sets the mapping the indices matching pattern are created with.
+func (e *Elasticsearch) AddMapping(pattern string, m map[string]interface{}) error {
+	return e.mappings.Add(pattern, m)
 }
 
 // Description for the Elasticsearcb adaptor
@@ -69,8 +152,13 @@ func init() {
 		"elasticsearch",
 		func() adaptor.Adaptor {
 			return &Elasticsearch{
-				RequestSize:  DefaultRequestSize,
-				BulkRequests: DefaultBulkRequests,
+				RequestSize:       DefaultRequestSize,
+				BulkRequests:      DefaultBulkRequests,
+				BulkWorkers:       clients.DefaultBulkWorkers,
+				BulkRetries:       clients.DefaultBulkRetries,
+				UpdateMode:        clients.DefaultUpdateMode,
+				Slices:            clients.DefaultSlices,
+				ConnectionRetries: DefaultConnectionRetries,
 			}
 		},
 	)
@@ -111,17 +199,35 @@ func setupWriter(conf *Elasticsearch) (client.Writer, error) {
 		uri.Path = fmt.Sprintf("/%s", DefaultIndex)
 	}
 
-	hostsAndPorts := strings.Split(uri.Host, ",")
-	stringVersion, err := determineVersion(uri, hostsAndPorts[0], uri.User)
-	// stringVersion, err := getESVersionFor(uri.String())
-	log.Infoln("ES Version: ", stringVersion)
-	if err != nil {
-		return nil, err
+	if conf.Alias && conf.Tail {
+		return nil, fmt.Errorf("alias can not be used with tail, the import never completes")
+	}
+	if conf.Alias && conf.DataStream {
+		return nil, fmt.Errorf("alias can not be used with data_stream")
+	}
+	if conf.Alias && conf.IndexTemplate != "" {
+		return nil, fmt.Errorf("alias can not be used with index_template, only the index of the uri is moved")
 	}
 
-	v, err := version.NewVersion(stringVersion)
-	if err != nil {
-		return nil, client.VersionError{URI: conf.URI, V: stringVersion, Err: err.Error()}
+	var indexTemplate *clients.IndexTemplate
+	if conf.IndexTemplate != "" {
+		if indexTemplate, err = clients.NewIndexTemplate(conf.IndexTemplate); err != nil {
+			return nil, err
+		}
+	}
+
+	update := clients.UpdateOptions{Mode: conf.UpdateMode, Script: conf.Script, ScriptParams: conf.ScriptParams}
+	if err := update.Validate(); err != nil {
+		return nil, err
+	}
+	request := clients.RequestOptions{
+		Pipeline:     conf.Pipeline,
+		RoutingField: conf.RoutingField,
+		VersionField: conf.VersionField,
+		VersionType:  conf.VersionType,
+	}
+	if err := request.Validate(update); err != nil {
+		return nil, err
 	}
 
 	timeout, err := time.ParseDuration(conf.Timeout)
@@ -130,9 +236,27 @@ func setupWriter(conf *Elasticsearch) (client.Writer, error) {
 		timeout = 300 * time.Second
 	}
 
+	stats := &clients.TransportStats{}
+	transport, err := newTransport(conf, stats)
+	if err != nil {
+		return nil, err
+	}
 	httpClient := &http.Client{
 		Timeout:   timeout,
-		Transport: newTransport(conf.AWSAccessKeyID, conf.AWSAccessSecret),
+		Transport: transport,
+	}
+
+	hostsAndPorts := strings.Split(uri.Host, ",")
+	stringVersion, err := determineVersion(httpClient, uri, hostsAndPorts[0], uri.User)
+	// stringVersion, err := getESVersionFor(httpClient, uri.String())
+	log.Infoln("ES Version: ", stringVersion)
+	if err != nil {
+		return nil, err
+	}
+
+	v, err := version.NewVersion(stringVersion)
+	if err != nil {
+		return nil, client.VersionError{URI: conf.URI, V: stringVersion, Err: err.Error()}
 	}
 
 	for _, vc := range clients.Clients {
@@ -142,16 +266,36 @@ func setupWriter(conf *Elasticsearch) (client.Writer, error) {
 				urls[i] = fmt.Sprintf("%s://%s", uri.Scheme, hAndP)
 			}
 			opts := &clients.ClientOptions{
-				URLs:         urls,
-				UserInfo:     uri.User,
-				HTTPClient:   httpClient,
-				Index:        uri.Path[1:],
-				RequestSize:  conf.RequestSize,
-				BulkRequests: conf.BulkRequests,
-				Tail:         conf.Tail,
+				URLs:            urls,
+				UserInfo:        uri.User,
+				HTTPClient:      httpClient,
+				TransportStats:  stats,
+				Index:           uri.Path[1:],
+				RequestSize:     conf.RequestSize,
+				BulkRequests:    conf.BulkRequests,
+				BulkWorkers:     conf.BulkWorkers,
+				Tail:            conf.Tail,
+				BulkRetries:     conf.BulkRetries,
+				MaxFailures:     conf.MaxFailures,
+				DeadLetterFile:  conf.DeadLetterFile,
+				DeadLetterIndex: conf.DeadLetterIndex,
+				Update:          update,
+				Request:         request,
+				DataStream: clients.DataStreamOptions{
+					Enabled:         conf.DataStream,
+					TimestampField:  conf.TimestampField,
+					InstallTemplate: conf.DataStreamTemplate,
+					ILMPolicy:       conf.ILMPolicy,
+				},
+				IndexTemplate: indexTemplate,
+				Mappings:      &conf.mappings,
 			}
-			versionedClient, _ := vc.Creator(opts)
-			return versionedClient, nil
+			if conf.Alias {
+				opts.Alias = opts.Index
+				opts.Index = clients.AliasIndex(opts.Alias, time.Now())
+				opts.DeleteOldIndices = conf.DeleteOldIndices
+			}
+			return vc.Creator(opts)
 		}
 	}
 
@@ -169,8 +313,23 @@ func setupReader(conf *Elasticsearch) (client.Reader, error) {
 		return nil, client.InvalidURIError{URI: conf.URI, Err: "Index not defined in URI"}
 	}
 
+	timeout, err := time.ParseDuration(conf.Timeout)
+	if err != nil {
+		log.Debugf("failed to parse duration, %s, falling back to default timeout of 30s", conf.Timeout)
+		timeout = 30 * time.Second
+	}
+
+	transport, err := newTransport(conf, nil)
+	if err != nil {
+		return nil, err
+	}
+	httpClient := &http.Client{
+		Timeout:   timeout,
+		Transport: transport,
+	}
+
 	hostsAndPorts := strings.Split(uri.Host, ",")
-	stringVersion, err := determineVersion(uri, hostsAndPorts[0], uri.User)
+	stringVersion, err := determineVersion(httpClient, uri, hostsAndPorts[0], uri.User)
 	if err != nil {
 		return nil, err
 	}
@@ -180,15 +339,17 @@ func setupReader(conf *Elasticsearch) (client.Reader, error) {
 		return nil, client.VersionError{URI: conf.URI, V: stringVersion, Err: err.Error()}
 	}
 
-	timeout, err := time.ParseDuration(conf.Timeout)
-	if err != nil {
-		log.Debugf("failed to parse duration, %s, falling back to default timeout of 30s", conf.Timeout)
-		timeout = 30 * time.Second
+	pollInterval := DefaultPollInterval
+	if conf.PollInterval != "" {
+		pollInterval, err = time.ParseDuration(conf.PollInterval)
+		if err != nil || pollInterval <= 0 {
+			return nil, fmt.Errorf("invalid poll_interval %q", conf.PollInterval)
+		}
 	}
 
-	httpClient := &http.Client{
-		Timeout:   timeout,
-		Transport: newTransport(conf.AWSAccessKeyID, conf.AWSAccessSecret),
+	source, err := sourceOptions(conf)
+	if err != nil {
+		return nil, err
 	}
 
 	for _, vc := range clients.Clients {
@@ -198,10 +359,14 @@ func setupReader(conf *Elasticsearch) (client.Reader, error) {
 				urls[i] = fmt.Sprintf("%s://%s", uri.Scheme, hAndP)
 			}
 			opts := &clients.ClientOptions{
-				URLs:       urls,
-				UserInfo:   uri.User,
-				HTTPClient: httpClient,
-				Index:      uri.Path[1:],
+				URLs:         urls,
+				UserInfo:     uri.User,
+				HTTPClient:   httpClient,
+				Index:        uri.Path[1:],
+				Tail:         conf.Tail,
+				TailField:    conf.TailField,
+				PollInterval: pollInterval,
+				Source:       source,
 			}
 			versionedClient, _ := vc.Reader(opts)
 			return versionedClient, nil
@@ -211,7 +376,35 @@ func setupReader(conf *Elasticsearch) (client.Reader, error) {
 	return nil, client.VersionError{URI: conf.URI, V: stringVersion, Err: "unsupported client"}
 }
 
-func getESVersionFor(uri string) (string, error) {
+// sourceOptions returns the documents read by the reader, the query is read from query_file
+// when set.
+func sourceOptions(conf *Elasticsearch) (clients.SourceOptions, error) {
+	source := clients.SourceOptions{Fields: conf.SourceFields, Slices: conf.Slices, CopyMetadata: conf.CopyMetadata}
+	if conf.Slices < 0 {
+		return source, fmt.Errorf("invalid slices %d", conf.Slices)
+	}
+	var (
+		b   []byte
+		err error
+	)
+	switch {
+	case conf.Query != nil && conf.QueryFile != "":
+		return source, fmt.Errorf("only one of query and query_file can be set")
+	case conf.Query != nil:
+		b, err = json.Marshal(conf.Query)
+	case conf.QueryFile != "":
+		b, err = ioutil.ReadFile(conf.QueryFile)
+	default:
+		return source, nil
+	}
+	if err != nil {
+		return source, err
+	}
+	source.Query, err = clients.ParseQuery(b)
+	return source, err
+}
+
+func getESVersionFor(httpClient *http.Client, uri string) (string, error) {
 	appName := getAppName(uri)
 	uri += "/_settings?human"
 
@@ -220,7 +413,7 @@ func getESVersionFor(uri string) (string, error) {
 		return DefaultESVersion, err
 	}
 
-	resp, err := http.DefaultClient.Do(req)
+	resp, err := httpClient.Do(req)
 	if err != nil {
 		return DefaultESVersion, client.ConnectError{Reason: uri}
 	}
@@ -265,12 +458,12 @@ func getVersionStringFrom(jsonResp interface{}, appName string) string {
 	return ver["created_string"].(string)
 }
 
-func determineVersion(uri *url.URL, host string, user *url.Userinfo) (string, error) {
+func determineVersion(httpClient *http.Client, uri *url.URL, host string, user *url.Userinfo) (string, error) {
 	reqURL := fmt.Sprintf("%s://%s", uri.Scheme, host)
 
 	// check if appbase.io
 	if strings.Contains(reqURL, "scalr.api.appbase.io") {
-		return getESVersionFor(uri.String())
+		return getESVersionFor(httpClient, uri.String())
 	}
 
 	// normal ES cluster
@@ -283,7 +476,7 @@ func determineVersion(uri *url.URL, host string, user *url.Userinfo) (string, er
 			req.SetBasicAuth(user.Username(), pwd)
 		}
 	}
-	resp, err := http.DefaultClient.Do(req)
+	resp, err := httpClient.Do(req)
 	if err != nil {
 		return "", client.ConnectError{Reason: reqURL}
 	}
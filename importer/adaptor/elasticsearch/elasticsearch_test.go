@@ -144,6 +144,27 @@ func TestInit(t *testing.T) {
 	}
 }
 
+var writerOptionsTests = []struct {
+	name string
+	cfg  adaptor.Config
+}{
+	{"alias with tail", adaptor.Config{"uri": "http://localhost:9200/movies", "alias": true, "tail": true}},
+	{"alias with data_stream", adaptor.Config{"uri": "http://localhost:9200/movies", "alias": true, "data_stream": true}},
+	{"alias with index_template", adaptor.Config{"uri": "http://localhost:9200/movies", "alias": true, "index_template": "{{ns}}"}},
+}
+
+func TestWriterOptions(t *testing.T) {
+	for _, wt := range writerOptionsTests {
+		c, err := adaptor.GetAdaptor("elasticsearch", wt.cfg)
+		if err != nil {
+			t.Fatalf("[%s] unexpected error: %q", wt.name, err)
+		}
+		if _, err := c.Writer(nil, nil); err == nil {
+			t.Errorf("[%s] expected an error", wt.name)
+		}
+	}
+}
+
 type MockWriter struct {
 	msgCount int
 }
@@ -1,29 +1,168 @@
 package elasticsearch
 
 import (
+	"bytes"
+	"compress/gzip"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"io"
+	"io/ioutil"
 	"net/http"
+	"net/http/httptrace"
+	"os"
+	"strings"
+	"sync/atomic"
+	"syscall"
+	"time"
 
+	"github.com/appbaseio/abc/importer/adaptor/elasticsearch/clients"
+	"github.com/appbaseio/abc/importer/client"
+	"github.com/appbaseio/abc/log"
 	awsauth "github.com/smartystreets/go-aws-auth"
 )
 
+const (
+	// DefaultConnectionRetries is how many times a request is sent again after its connection was reset.
+	DefaultConnectionRetries = 3
+
+	connectionRetryDelay = 500 * time.Millisecond
+)
+
+// ErrConflictingAuth is returned when more than one of the AWS credentials, the API key and
+// the bearer token are configured.
+var ErrConflictingAuth = errors.New("only one of aws_access_key, api_key and bearer_token can be set")
+
 // AWSTransport handles wrapping requests to AWS Elasticsearch service
 type AWSTransport struct {
 	Credentials awsauth.Credentials
 	transport   http.RoundTripper
 }
 
-func newTransport(accessKeyID, secretAccessKey string) http.RoundTripper {
+// AuthTransport sets the Authorization header of the requests, used for API keys and bearer tokens.
+type AuthTransport struct {
+	Authorization string
+	transport     http.RoundTripper
+}
+
+// BulkTransport gzips the bodies of the bulk requests, counting their size in stats, and sends
+// again the requests whose connection was reset. A bulk request the cluster may have applied
+// is only sent again when every action names its document, the others would index their
+// documents twice. It wraps the transport signing the requests so that the signature covers
+// the compressed body.
+type BulkTransport struct {
+	Gzip      bool
+	Retries   int
+	stats     *clients.TransportStats
+	transport http.RoundTripper
+}
+
+// newTransport returns the transport of the requests sent to elasticsearch, configured with
+// the TLS settings, connection pool and credentials of conf. The bulk requests are counted in
+// stats when it is not nil.
+func newTransport(conf *Elasticsearch, stats *clients.TransportStats) (http.RoundTripper, error) {
+	aws := conf.AWSAccessKeyID != "" && conf.AWSAccessSecret != ""
+	var set int
+	for _, ok := range []bool{aws, conf.APIKey != "", conf.BearerToken != ""} {
+		if ok {
+			set++
+		}
+	}
+	if set > 1 {
+		return nil, ErrConflictingAuth
+	}
+
 	t := http.DefaultTransport
-	if accessKeyID != "" && secretAccessKey != "" {
-		return &AWSTransport{
+	tlsConfig, err := conf.tlsConfig()
+	if err != nil {
+		return nil, err
+	}
+	if tlsConfig != nil || conf.MaxIdleConns > 0 {
+		dt := http.DefaultTransport.(*http.Transport).Clone()
+		dt.TLSClientConfig = tlsConfig
+		if conf.MaxIdleConns > 0 {
+			dt.MaxIdleConns = conf.MaxIdleConns
+			dt.MaxIdleConnsPerHost = conf.MaxIdleConns
+		}
+		t = dt
+	}
+
+	switch {
+	case aws:
+		t = &AWSTransport{
 			Credentials: awsauth.Credentials{
-				AccessKeyID:     accessKeyID,
-				SecretAccessKey: secretAccessKey,
+				AccessKeyID:     conf.AWSAccessKeyID,
+				SecretAccessKey: conf.AWSAccessSecret,
 			},
 			transport: t,
 		}
+	case conf.APIKey != "":
+		t = &AuthTransport{Authorization: "ApiKey " + encodeAPIKey(conf.APIKey), transport: t}
+	case conf.BearerToken != "":
+		t = &AuthTransport{Authorization: "Bearer " + conf.BearerToken, transport: t}
+	}
+
+	if conf.Gzip || conf.ConnectionRetries > 0 || stats != nil {
+		t = &BulkTransport{Gzip: conf.Gzip, Retries: conf.ConnectionRetries, stats: stats, transport: t}
+	}
+	return t, nil
+}
+
+// tlsConfig returns the TLS settings of the connections to elasticsearch, nil when the
+// defaults are used.
+func (e *Elasticsearch) tlsConfig() (*tls.Config, error) {
+	if len(e.CACerts) == 0 && e.ClientCert == "" && e.ClientKey == "" && !e.InsecureSkipVerify {
+		return nil, nil
+	}
+	c := &tls.Config{InsecureSkipVerify: e.InsecureSkipVerify}
+	if len(e.CACerts) > 0 {
+		roots := x509.NewCertPool()
+		for _, cert := range e.CACerts {
+			b, err := readPEM(cert)
+			if err != nil {
+				return nil, err
+			}
+			if ok := roots.AppendCertsFromPEM(b); !ok {
+				return nil, client.ErrInvalidCert
+			}
+		}
+		c.RootCAs = roots
+	}
+	if e.ClientCert != "" || e.ClientKey != "" {
+		cert, err := readPEM(e.ClientCert)
+		if err != nil {
+			return nil, err
+		}
+		key, err := readPEM(e.ClientKey)
+		if err != nil {
+			return nil, err
+		}
+		pair, err := tls.X509KeyPair(cert, key)
+		if err != nil {
+			return nil, client.ErrInvalidCert
+		}
+		c.Certificates = []tls.Certificate{pair}
+	}
+	return c, nil
+}
+
+// readPEM returns the content of the file at path, or path itself when it is not a file.
+func readPEM(path string) ([]byte, error) {
+	if _, err := os.Stat(path); err == nil {
+		return ioutil.ReadFile(path)
+	}
+	return []byte(path), nil
+}
+
+// encodeAPIKey base64 encodes an API key given as id:api_key, keys returned already encoded by
+// the create API key endpoint are kept as they are.
+func encodeAPIKey(key string) string {
+	if strings.Contains(key, ":") {
+		return base64.StdEncoding.EncodeToString([]byte(key))
 	}
-	return t
+	return key
 }
 
 // RoundTrip implementation
@@ -31,3 +170,115 @@ func (a AWSTransport) RoundTrip(req *http.Request) (*http.Response, error) {
 	awsauth.Sign4(req, a.Credentials)
 	return a.transport.RoundTrip(req)
 }
+
+// RoundTrip implementation, the Authorization header replaces the basic auth of the uri.
+func (a AuthTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	req = req.Clone(req.Context())
+	req.Header.Set("Authorization", a.Authorization)
+	return a.transport.RoundTrip(req)
+}
+
+// RoundTrip implementation, the body of the request is kept in memory to be sent again.
+func (b BulkTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if req.Body == nil || req.Body == http.NoBody {
+		return b.roundTrip(req, true)
+	}
+	body, err := ioutil.ReadAll(req.Body)
+	req.Body.Close()
+	if err != nil {
+		return nil, err
+	}
+	req = req.Clone(req.Context())
+	bulk := strings.HasSuffix(req.URL.Path, "/_bulk")
+	replayable := !bulk
+	if bulk && req.Header.Get("Content-Encoding") == "" {
+		replayable = bulkHasIDs(body)
+		n := len(body)
+		if b.Gzip {
+			if body, err = gzipBody(body); err != nil {
+				return nil, err
+			}
+			req.Header.Set("Content-Encoding", "gzip")
+		}
+		if b.stats != nil {
+			b.stats.Add(int64(n), int64(len(body)))
+		}
+	}
+	req.ContentLength = int64(len(body))
+	req.GetBody = func() (io.ReadCloser, error) {
+		return ioutil.NopCloser(bytes.NewReader(body)), nil
+	}
+	return b.roundTrip(req, replayable)
+}
+
+// roundTrip sends req again when its connection was reset, unless it was written and is not
+// replayable.
+func (b BulkTransport) roundTrip(req *http.Request, replayable bool) (*http.Response, error) {
+	for attempt := 1; ; attempt++ {
+		if req.GetBody != nil {
+			req.Body, _ = req.GetBody()
+		}
+		var written int32
+		trace := &httptrace.ClientTrace{
+			WroteRequest: func(info httptrace.WroteRequestInfo) {
+				if info.Err == nil {
+					atomic.StoreInt32(&written, 1)
+				}
+			},
+		}
+		resp, err := b.transport.RoundTrip(req.WithContext(httptrace.WithClientTrace(req.Context(), trace)))
+		if err == nil || attempt > b.Retries || !isConnectionReset(err) || req.Context().Err() != nil {
+			return resp, err
+		}
+		if !replayable && atomic.LoadInt32(&written) == 1 {
+			log.With("url", req.URL.Redacted()).Errorf("connection reset after sending the bulk, its documents without _id are not sent again, %s", err)
+			return resp, err
+		}
+		log.With("url", req.URL.Redacted()).With("attempt", attempt).Errorf("connection reset, sending the request again, %s", err)
+		time.Sleep(time.Duration(attempt) * connectionRetryDelay)
+	}
+}
+
+// bulkHasIDs returns whether every action of a bulk body names its document with an _id, sending
+// it twice then writes the same documents. Creates fail when sent twice and are never replayable.
+func bulkHasIDs(body []byte) bool {
+	lines := bytes.Split(bytes.TrimSpace(body), []byte("\n"))
+	for i := 0; i < len(lines); i++ {
+		var action map[string]struct {
+			ID string `json:"_id"`
+		}
+		if err := json.Unmarshal(lines[i], &action); err != nil || len(action) != 1 {
+			return false
+		}
+		for op, meta := range action {
+			if op == "create" || meta.ID == "" {
+				return false
+			}
+			// the document follows the action, deletes have none
+			if op != "delete" {
+				i++
+			}
+		}
+	}
+	return true
+}
+
+// isConnectionReset returns whether err is a connection closed by the cluster or the network.
+func isConnectionReset(err error) bool {
+	return errors.Is(err, syscall.ECONNRESET) ||
+		errors.Is(err, syscall.EPIPE) ||
+		errors.Is(err, io.EOF) ||
+		errors.Is(err, io.ErrUnexpectedEOF)
+}
+
+func gzipBody(body []byte) ([]byte, error) {
+	var buf bytes.Buffer
+	w := gzip.NewWriter(&buf)
+	if _, err := w.Write(body); err != nil {
+		return nil, err
+	}
+	if err := w.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
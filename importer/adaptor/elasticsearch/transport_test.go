@@ -1,11 +1,20 @@
 package elasticsearch
 
 import (
+	"compress/gzip"
+	"encoding/pem"
 	"fmt"
+	"io"
+	"io/ioutil"
+	"net"
 	"net/http"
 	"net/http/httptest"
+	"os"
 	"strings"
 	"testing"
+
+	"github.com/appbaseio/abc/importer/adaptor/elasticsearch/clients"
+	"github.com/appbaseio/abc/importer/client"
 )
 
 const (
@@ -29,17 +38,29 @@ func isAWSRequest(r *http.Request) bool {
 		r.Header.Get("X-Amz-Date") != ""
 }
 
+func mustTransport(conf *Elasticsearch) http.RoundTripper {
+	return mustTransportStats(conf, nil)
+}
+
+func mustTransportStats(conf *Elasticsearch, stats *clients.TransportStats) http.RoundTripper {
+	t, err := newTransport(conf, stats)
+	if err != nil {
+		panic(err)
+	}
+	return t
+}
+
 var transportTests = []struct {
 	path string
 	c    *http.Client
 }{
 	{
 		"/aws",
-		&http.Client{Transport: newTransport(awsAccessKey, awsSecretKey)},
+		&http.Client{Transport: mustTransport(&Elasticsearch{AWSAccessKeyID: awsAccessKey, AWSAccessSecret: awsSecretKey})},
 	},
 	{
 		"/other",
-		&http.Client{Transport: newTransport("", "")},
+		&http.Client{Transport: mustTransport(&Elasticsearch{})},
 	},
 }
 
@@ -63,3 +84,227 @@ func TestTransport(t *testing.T) {
 		}
 	}
 }
+
+var authTransportTests = []struct {
+	conf          *Elasticsearch
+	authorization string
+}{
+	{&Elasticsearch{APIKey: "id:secret"}, "ApiKey aWQ6c2VjcmV0"},
+	{&Elasticsearch{APIKey: "aWQ6c2VjcmV0"}, "ApiKey aWQ6c2VjcmV0"},
+	{&Elasticsearch{BearerToken: "token"}, "Bearer token"},
+	{&Elasticsearch{}, "Basic dXNlcjpwYXNz"},
+}
+
+func TestAuthTransport(t *testing.T) {
+	var authorization string
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		authorization = r.Header.Get("Authorization")
+		fmt.Fprint(w, "{\"ok\":1}")
+	}))
+	defer ts.Close()
+
+	for _, at := range authTransportTests {
+		req, err := http.NewRequest(http.MethodGet, ts.URL, nil)
+		if err != nil {
+			t.Fatalf("unable to build request, %s", err)
+		}
+		req.SetBasicAuth("user", "pass")
+		resp, err := (&http.Client{Transport: mustTransport(at.conf)}).Do(req)
+		if err != nil {
+			t.Fatalf("failed to send request, %s", err)
+		}
+		resp.Body.Close()
+		if authorization != at.authorization {
+			t.Errorf("wrong Authorization header, expected %s, got %s", at.authorization, authorization)
+		}
+		if req.Header.Get("Authorization") != "Basic dXNlcjpwYXNz" {
+			t.Errorf("request modified by the transport")
+		}
+	}
+
+	conf := &Elasticsearch{AWSAccessKeyID: awsAccessKey, AWSAccessSecret: awsSecretKey, BearerToken: "token"}
+	if _, err := newTransport(conf, nil); err != ErrConflictingAuth {
+		t.Errorf("wrong error, expected %v, got %v", ErrConflictingAuth, err)
+	}
+}
+
+func TestTLSTransport(t *testing.T) {
+	ts := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, "{\"ok\":1}")
+	}))
+	defer ts.Close()
+
+	caFile, err := ioutil.TempFile("", "ca")
+	if err != nil {
+		t.Fatalf("unable to create CA file, %s", err)
+	}
+	defer os.Remove(caFile.Name())
+	pem.Encode(caFile, &pem.Block{Type: "CERTIFICATE", Bytes: ts.Certificate().Raw})
+	caFile.Close()
+
+	tlsTests := []struct {
+		conf *Elasticsearch
+		err  bool
+	}{
+		{&Elasticsearch{}, true},
+		{&Elasticsearch{CACerts: []string{caFile.Name()}}, false},
+		{&Elasticsearch{InsecureSkipVerify: true}, false},
+	}
+	for _, tt := range tlsTests {
+		resp, err := (&http.Client{Transport: mustTransport(tt.conf)}).Get(ts.URL)
+		if (err != nil) != tt.err {
+			t.Errorf("[%+v] wrong request error, got %v", tt.conf, err)
+		}
+		if err == nil {
+			resp.Body.Close()
+		}
+	}
+
+	badConfs := []*Elasticsearch{
+		{CACerts: []string{"not a certificate"}},
+		{ClientCert: caFile.Name(), ClientKey: "not a key"},
+	}
+	for _, conf := range badConfs {
+		if _, err := newTransport(conf, nil); err != client.ErrInvalidCert {
+			t.Errorf("[%+v] wrong error, expected %v, got %v", conf, client.ErrInvalidCert, err)
+		}
+	}
+}
+
+func TestBulkTransport(t *testing.T) {
+	var encoding, received string
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		encoding = r.Header.Get("Content-Encoding")
+		body := io.Reader(r.Body)
+		if encoding == "gzip" {
+			gz, err := gzip.NewReader(r.Body)
+			if err != nil {
+				w.WriteHeader(http.StatusBadRequest)
+				return
+			}
+			body = gz
+		}
+		b, _ := ioutil.ReadAll(body)
+		received = string(b)
+		fmt.Fprint(w, "{\"ok\":1}")
+	}))
+	defer ts.Close()
+
+	bulk := strings.Repeat("{\"index\":{\"_index\":\"test\"}}\n{\"name\":\"abc\"}\n", 100)
+	bulkTests := []struct {
+		path     string
+		gzip     bool
+		encoding string
+		counted  bool
+	}{
+		{"/_bulk", true, "gzip", true},
+		{"/test/_bulk", false, "", true},
+		{"/test/_search", true, "", false},
+	}
+	for _, bt := range bulkTests {
+		stats := &clients.TransportStats{}
+		c := &http.Client{Transport: mustTransportStats(&Elasticsearch{Gzip: bt.gzip}, stats)}
+		resp, err := c.Post(ts.URL+bt.path, "application/x-ndjson", strings.NewReader(bulk))
+		if err != nil {
+			t.Fatalf("[%s] failed to send request, %s", bt.path, err)
+		}
+		resp.Body.Close()
+		if resp.StatusCode != http.StatusOK {
+			t.Errorf("[%s] wrong status, got %d", bt.path, resp.StatusCode)
+		}
+		if encoding != bt.encoding {
+			t.Errorf("[%s] wrong Content-Encoding, expected %q, got %q", bt.path, bt.encoding, encoding)
+		}
+		if received != bulk {
+			t.Errorf("[%s] wrong body received, got %q", bt.path, received)
+		}
+		if !bt.counted {
+			if stats.Requests != 0 {
+				t.Errorf("[%s] request counted in stats", bt.path)
+			}
+			continue
+		}
+		if stats.Requests != 1 || stats.Bytes != int64(len(bulk)) {
+			t.Errorf("[%s] wrong stats, got %+v", bt.path, stats)
+		}
+		if bt.gzip && stats.CompressedBytes >= stats.Bytes {
+			t.Errorf("[%s] body not compressed, got %+v", bt.path, stats)
+		}
+		if !bt.gzip && stats.CompressedBytes != stats.Bytes {
+			t.Errorf("[%s] wrong stats, got %+v", bt.path, stats)
+		}
+	}
+}
+
+func TestBulkTransportRetries(t *testing.T) {
+	var requests int
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		if requests == 1 {
+			// reset the connection of the first request
+			conn, _, err := w.(http.Hijacker).Hijack()
+			if err != nil {
+				t.Errorf("unable to hijack connection, %s", err)
+				return
+			}
+			conn.(*net.TCPConn).SetLinger(0)
+			conn.Close()
+			return
+		}
+		b, _ := ioutil.ReadAll(r.Body)
+		fmt.Fprint(w, string(b))
+	}))
+	defer ts.Close()
+
+	withIDs := "{\"index\":{\"_id\":\"1\"}}\n{\"a\":1}\n"
+	retryTests := []struct {
+		retries  int
+		body     string
+		err      bool
+		requests int
+	}{
+		{0, withIDs, true, 1},
+		{1, withIDs, false, 2},
+		// the reset bulk may have been applied, documents without _id would be indexed twice
+		{1, "{\"index\":{}}\n{\"a\":1}\n", true, 1},
+	}
+	for _, rt := range retryTests {
+		requests = 0
+		c := &http.Client{Transport: mustTransport(&Elasticsearch{ConnectionRetries: rt.retries})}
+		resp, err := c.Post(ts.URL+"/_bulk", "application/x-ndjson", strings.NewReader(rt.body))
+		if (err != nil) != rt.err {
+			t.Errorf("[%d] wrong request error, got %v", rt.retries, err)
+		}
+		if err == nil {
+			b, _ := ioutil.ReadAll(resp.Body)
+			resp.Body.Close()
+			if string(b) != rt.body {
+				t.Errorf("[%d] wrong body sent again, got %q", rt.retries, b)
+			}
+		}
+		if requests != rt.requests {
+			t.Errorf("[%d] wrong number of requests, expected %d, got %d", rt.retries, rt.requests, requests)
+		}
+	}
+}
+
+var bulkHasIDsTests = []struct {
+	name string
+	body string
+	ids  bool
+}{
+	{"index", `{"index":{"_index":"a","_id":"1"}}` + "\n" + `{"a":1}` + "\n", true},
+	{"index without id", `{"index":{"_index":"a"}}` + "\n" + `{"a":1}` + "\n", false},
+	{"update and delete", `{"update":{"_id":"1"}}` + "\n" + `{"doc":{"a":1}}` + "\n" + `{"delete":{"_id":"2"}}` + "\n" + `{"index":{"_id":"3"}}` + "\n" + `{"a":1}` + "\n", true},
+	{"delete without id", `{"delete":{"_index":"a"}}` + "\n", false},
+	{"create", `{"create":{"_id":"1"}}` + "\n" + `{"a":1}` + "\n", false},
+	{"malformed", `{"index":` + "\n", false},
+}
+
+func TestBulkHasIDs(t *testing.T) {
+	for _, bt := range bulkHasIDsTests {
+		if ids := bulkHasIDs([]byte(bt.body)); ids != bt.ids {
+			t.Errorf("[%s] wrong result, expected %v, got %v", bt.name, bt.ids, ids)
+		}
+	}
+}
@@ -18,6 +18,9 @@ const (
 
 	// Project-Id designated for the firebase project
 	DefaultProjectID = "appbase-firestore-adapter"
+
+	// EmulatorHostEnv is the environment variable holding the address of the firestore emulator to use.
+	EmulatorHostEnv = "FIRESTORE_EMULATOR_HOST"
 )
 
 var (
@@ -55,8 +58,15 @@ func NewClient(options ...ClientOptionFunc) (*Client, error) {
 
 func (c *Client) Connect() (client.Session, error) {
 	if c.fcClient == nil {
-		sa := option.WithCredentialsFile(c.sacPath)
-		c.fcClient, _ = firestore.NewClient(context.Background(), c.projectID, sa)
+		var opts []option.ClientOption
+		if c.sacPath != "" {
+			opts = append(opts, option.WithCredentialsFile(c.sacPath))
+		}
+		var err error
+		c.fcClient, err = firestore.NewClient(context.Background(), c.projectID, opts...)
+		if err != nil {
+			return nil, err
+		}
 	}
 	return &Session{c.fcClient, c.db}, nil
 }
@@ -84,3 +94,12 @@ func WithConfig(sacPath string) ClientOptionFunc {
 		return nil
 	}
 }
+
+// WithProjectID sets the project without reading a credentials file, for use with the emulator.
+func WithProjectID(projectID string) ClientOptionFunc {
+	return func(c *Client) error {
+		c.projectID = projectID
+		log.Infof("Using firestore emulator at %v for %v", os.Getenv(EmulatorHostEnv), projectID)
+		return nil
+	}
+}
@@ -1,6 +1,7 @@
 package firestore
 
 import (
+	"os"
 	"sync"
 
 	"github.com/appbaseio/abc/importer/adaptor"
@@ -11,6 +12,7 @@ const (
 	sampleConfig = `{
 	"sacPath": "ServiceAccountKey.json",
 	"projectId": "sample-project"
+	// "tail": false // listen for changes after reading the collections
 	}`
 
 	description = "a firestore source adaptor"
@@ -20,6 +22,7 @@ type Firestore struct {
 	adaptor.BaseConfig
 	SACPath   string
 	ProjectID string
+	Tail      bool `json:"tail" doc:"if tail is set, collections will be listened to for changes"`
 }
 
 func init() {
@@ -35,11 +38,17 @@ func init() {
 }
 
 func (f *Firestore) Client() (client.Client, error) {
+	if os.Getenv(EmulatorHostEnv) != "" {
+		// the emulator needs no credentials
+		if _, err := os.Stat(f.SACPath); os.IsNotExist(err) {
+			return NewClient(WithProjectID(f.ProjectID))
+		}
+	}
 	return NewClient(WithConfig(f.SACPath))
 }
 
 func (f *Firestore) Reader() (client.Reader, error) {
-	return &Reader{}, nil
+	return &Reader{tail: f.Tail}, nil
 }
 
 func (f *Firestore) Verify() error {
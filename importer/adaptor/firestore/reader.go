@@ -2,18 +2,34 @@ package firestore
 
 import (
 	"context"
+	"sync"
+	"time"
 
 	"cloud.google.com/go/firestore"
 	"github.com/appbaseio/abc/importer/client"
+	"github.com/appbaseio/abc/importer/commitlog"
 	"github.com/appbaseio/abc/importer/message"
 	"github.com/appbaseio/abc/importer/message/ops"
 	"github.com/appbaseio/abc/log"
 	"google.golang.org/api/iterator"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
 )
 
+const listenRetryDelay = 5 * time.Second
+
 var _ client.Reader = &Reader{}
 
-type Reader struct{}
+type Reader struct {
+	tail bool
+}
+
+// watchedCollection holds the update time of every document of a collection sent so far,
+// used to tell inserts from updates and to find the documents deleted while not listening.
+type watchedCollection struct {
+	ref  *firestore.CollectionRef
+	docs map[string]time.Time
+}
 
 func (r *Reader) listCollections(fc firestore.Client, collectionFilterFn func(collectionID string) bool) (<-chan *firestore.CollectionRef, error) {
 	out := make(chan *firestore.CollectionRef)
@@ -55,11 +71,14 @@ func (r *Reader) Read(_ map[string]client.MessageSet, filterFn client.NsFilterFu
 
 		go func() {
 			defer close(out)
+			var collections []*watchedCollection
 			for {
 				collection, ok := <-collectionRef
 				if !ok {
 					break
 				} else {
+					wc := &watchedCollection{ref: collection, docs: make(map[string]time.Time)}
+					collections = append(collections, wc)
 					docSnapshots := collection.Documents(context.Background())
 					for {
 						docSnapshot, err := docSnapshots.Next()
@@ -69,14 +88,140 @@ func (r *Reader) Read(_ map[string]client.MessageSet, filterFn client.NsFilterFu
 						if err != nil {
 							continue
 						}
-						out <- client.MessageSet{
-							Msg: message.From(ops.Insert, docSnapshot.Ref.Parent.ID, docSnapshot.Data()),
+						wc.docs[docSnapshot.Ref.ID] = docSnapshot.UpdateTime
+						select {
+						case out <- client.MessageSet{
+							Msg: message.From(ops.Insert, docSnapshot.Ref.Parent.ID, docData(docSnapshot)),
+						}:
+						case <-done:
+							return
 						}
 					}
 				}
 			}
+			if !r.tail {
+				return
+			}
+
+			// listen for changes
+			ctx, cancel := context.WithCancel(context.Background())
+			go func() {
+				<-done
+				cancel()
+			}()
+			var wg sync.WaitGroup
+			for _, wc := range collections {
+				wg.Add(1)
+				go func(wc *watchedCollection) {
+					defer wg.Done()
+					wc.listen(ctx, out, done)
+				}(wc)
+			}
+			wg.Wait()
+			log.Infoln("tailing stopped")
 		}()
 
 		return out, nil
 	}
 }
+
+// listen sends the changes of the collection until ctx is cancelled, the listener is
+// opened again after an error.
+func (wc *watchedCollection) listen(ctx context.Context, out chan<- client.MessageSet, done chan struct{}) {
+	for {
+		log.With("collectionID", wc.ref.ID).Infoln("listening for changes...")
+		err := wc.listenOnce(ctx, out, done)
+		if ctx.Err() != nil || status.Code(err) == codes.Canceled {
+			return
+		}
+		log.With("collectionID", wc.ref.ID).Errorf("error listening for changes, %s", err)
+		select {
+		case <-time.After(listenRetryDelay):
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+func (wc *watchedCollection) listenOnce(ctx context.Context, out chan<- client.MessageSet, done chan struct{}) error {
+	snapshots := wc.ref.Snapshots(ctx)
+	defer snapshots.Stop()
+	first := true
+	for {
+		snapshot, err := snapshots.Next()
+		if err != nil {
+			return err
+		}
+		for _, msg := range wc.changes(snapshot.Changes, first) {
+			select {
+			case out <- msg:
+			case <-done:
+				return nil
+			}
+		}
+		first = false
+	}
+}
+
+// changes converts document changes to messages. The first snapshot of a listener lists every
+// document as added, only the ones changed since they were last sent are kept and the documents
+// missing from it are deleted.
+func (wc *watchedCollection) changes(changes []firestore.DocumentChange, first bool) []client.MessageSet {
+	var msgs []client.MessageSet
+	present := make(map[string]bool)
+	for _, change := range changes {
+		id := change.Doc.Ref.ID
+		last, seen := wc.docs[id]
+		var op ops.Op
+		switch change.Kind {
+		case firestore.DocumentRemoved:
+			if !seen {
+				continue
+			}
+			delete(wc.docs, id)
+			msgs = append(msgs, syncMessage(ops.Delete, wc.ref.ID, map[string]interface{}{"_id": id}))
+			continue
+		case firestore.DocumentAdded, firestore.DocumentModified:
+			present[id] = true
+			if seen && !change.Doc.UpdateTime.After(last) {
+				continue
+			}
+			op = ops.Insert
+			if seen {
+				op = ops.Update
+			}
+		default:
+			continue
+		}
+		wc.docs[id] = change.Doc.UpdateTime
+		msgs = append(msgs, syncMessage(op, wc.ref.ID, docData(change.Doc)))
+	}
+	if first {
+		for id := range wc.docs {
+			if !present[id] {
+				delete(wc.docs, id)
+				msgs = append(msgs, syncMessage(ops.Delete, wc.ref.ID, map[string]interface{}{"_id": id}))
+			}
+		}
+	}
+	return msgs
+}
+
+func syncMessage(op ops.Op, collection string, data map[string]interface{}) client.MessageSet {
+	return client.MessageSet{
+		Msg:  message.From(op, collection, data),
+		Mode: commitlog.Sync,
+	}
+}
+
+// docData returns the fields of a document with its ID as _id.
+func docData(doc *firestore.DocumentSnapshot) map[string]interface{} {
+	data := doc.Data()
+	if data == nil {
+		data = make(map[string]interface{})
+	}
+	if _, ok := data["_id"]; !ok {
+		data["_id"] = doc.Ref.ID
+	}
+	return data
+}
@@ -0,0 +1,126 @@
+package firestore
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"reflect"
+	"testing"
+	"time"
+
+	"cloud.google.com/go/firestore"
+	"github.com/appbaseio/abc/importer/client"
+	"github.com/appbaseio/abc/importer/message/ops"
+)
+
+type change struct {
+	op ops.Op
+	id interface{}
+}
+
+func collectChanges(msgs []client.MessageSet) []change {
+	var got []change
+	for _, m := range msgs {
+		got = append(got, change{m.Msg.OP(), m.Msg.Data()["_id"]})
+	}
+	return got
+}
+
+func TestChanges(t *testing.T) {
+	coll := (&firestore.Client{}).Collection("users")
+	base := time.Unix(1600000000, 0)
+	doc := func(id string, updated int) *firestore.DocumentSnapshot {
+		return &firestore.DocumentSnapshot{Ref: coll.Doc(id), UpdateTime: base.Add(time.Duration(updated) * time.Second)}
+	}
+	wc := &watchedCollection{ref: coll, docs: map[string]time.Time{
+		"a": base,
+		"b": base,
+		"c": base,
+	}}
+
+	// the first snapshot is compared with the copied documents
+	got := collectChanges(wc.changes([]firestore.DocumentChange{
+		{Kind: firestore.DocumentAdded, Doc: doc("a", 0)},
+		{Kind: firestore.DocumentAdded, Doc: doc("b", 1)},
+		{Kind: firestore.DocumentAdded, Doc: doc("d", 1)},
+	}, true))
+	expected := []change{{ops.Update, "b"}, {ops.Insert, "d"}, {ops.Delete, "c"}}
+	if !reflect.DeepEqual(got, expected) {
+		t.Errorf("wrong first changes, expected %v, got %v", expected, got)
+	}
+
+	got = collectChanges(wc.changes([]firestore.DocumentChange{
+		{Kind: firestore.DocumentModified, Doc: doc("a", 2)},
+		{Kind: firestore.DocumentRemoved, Doc: doc("d", 2)},
+		{Kind: firestore.DocumentAdded, Doc: doc("e", 2)},
+	}, false))
+	expected = []change{{ops.Update, "a"}, {ops.Delete, "d"}, {ops.Insert, "e"}}
+	if !reflect.DeepEqual(got, expected) {
+		t.Errorf("wrong changes, expected %v, got %v", expected, got)
+	}
+}
+
+func readChange(t *testing.T, msgChan chan client.MessageSet) change {
+	select {
+	case m := <-msgChan:
+		return change{m.Msg.OP(), m.Msg.Data()["_id"]}
+	case <-time.After(10 * time.Second):
+		t.Fatal("timed out waiting for message")
+	}
+	return change{}
+}
+
+// TestTailEmulator runs against the firestore emulator, started with
+// gcloud beta emulators firestore start --host-port=localhost:8080
+// and FIRESTORE_EMULATOR_HOST=localhost:8080
+func TestTailEmulator(t *testing.T) {
+	if os.Getenv(EmulatorHostEnv) == "" {
+		t.Skipf("%s is not set", EmulatorHostEnv)
+	}
+	c, err := NewClient(WithProjectID("abc-test"))
+	if err != nil {
+		t.Fatalf("unable to create client, %s", err)
+	}
+	s, err := c.Connect()
+	if err != nil {
+		t.Fatalf("unable to connect, %s", err)
+	}
+	defer c.Close()
+
+	ctx := context.Background()
+	name := fmt.Sprintf("tail_%d", time.Now().UnixNano())
+	coll := s.(*Session).fc.Collection(name)
+	if _, err := coll.Doc("a").Set(ctx, map[string]interface{}{"name": "a"}); err != nil {
+		t.Fatalf("unable to write document, %s", err)
+	}
+
+	done := make(chan struct{})
+	defer close(done)
+	r := &Reader{tail: true}
+	msgChan, err := r.Read(nil, func(ns string) bool { return ns == name })(s, done)
+	if err != nil {
+		t.Fatalf("unexpected Read error, %s", err)
+	}
+	if got := readChange(t, msgChan); got != (change{ops.Insert, "a"}) {
+		t.Fatalf("wrong copy, got %v", got)
+	}
+
+	if _, err := coll.Doc("b").Set(ctx, map[string]interface{}{"name": "b"}); err != nil {
+		t.Fatalf("unable to write document, %s", err)
+	}
+	if got := readChange(t, msgChan); got != (change{ops.Insert, "b"}) {
+		t.Fatalf("wrong insert, got %v", got)
+	}
+	if _, err := coll.Doc("a").Set(ctx, map[string]interface{}{"name": "c"}); err != nil {
+		t.Fatalf("unable to write document, %s", err)
+	}
+	if got := readChange(t, msgChan); got != (change{ops.Update, "a"}) {
+		t.Fatalf("wrong update, got %v", got)
+	}
+	if _, err := coll.Doc("b").Delete(ctx); err != nil {
+		t.Fatalf("unable to delete document, %s", err)
+	}
+	if got := readChange(t, msgChan); got != (change{ops.Delete, "b"}) {
+		t.Fatalf("wrong delete, got %v", got)
+	}
+}
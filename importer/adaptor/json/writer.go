@@ -6,6 +6,7 @@ import (
 
 	"github.com/appbaseio/abc/importer/client"
 	"github.com/appbaseio/abc/importer/message"
+	"github.com/appbaseio/abc/importer/message/ops"
 )
 
 var _ client.Writer = &Writer{}
@@ -20,8 +21,11 @@ func newWriter() *Writer {
 
 func (w *Writer) Write(msg message.Msg) func(client.Session) (message.Msg, error) {
 	return func(s client.Session) (message.Msg, error) {
-		if err := dumpMessage(msg, s.(*Session).file); err != nil {
-			return nil, err
+		// commands, like the schema of a table, are only applied by the elasticsearch sink
+		if msg.OP() != ops.Command {
+			if err := dumpMessage(msg, s.(*Session).file); err != nil {
+				return nil, err
+			}
 		}
 		if msg.Confirms() != nil {
 			close(msg.Confirms())
@@ -33,6 +33,11 @@ func TestWrite(t *testing.T) {
 			t.Errorf("unexpected Write error, %s\n", err)
 		}
 	}
+	// commands are not written
+	cmd := message.WithConfirms(make(chan struct{}), message.From(ops.Command, "test", map[string]interface{}{"_table_schema": "test"}))
+	if _, err := w.Write(cmd)(tmpSession); err != nil {
+		t.Errorf("unexpected Write error, %s\n", err)
+	}
 	golden := filepath.Join("testdata", "write_test.golden")
 	expected, _ := ioutil.ReadFile(golden)
 	actual, _ := ioutil.ReadFile(filepath.Join(tmpD, "data.json"))
@@ -0,0 +1,447 @@
+package kafka
+
+import (
+	"bytes"
+	"encoding/json"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/Shopify/sarama"
+	"github.com/appbaseio/abc/importer/client"
+	"github.com/appbaseio/abc/importer/commitlog"
+	"github.com/appbaseio/abc/importer/message"
+	"github.com/appbaseio/abc/importer/message/data"
+	"github.com/appbaseio/abc/importer/message/ops"
+	"github.com/appbaseio/abc/log"
+)
+
+const (
+	sessionTimeout    = 30 * time.Second
+	heartbeatInterval = 3 * time.Second
+	commitInterval    = time.Second
+	joinRetryDelay    = 2 * time.Second
+
+	// rangeStrategy is the partition assignment protocol used by the group members.
+	rangeStrategy = "range"
+)
+
+// groupConsumer consumes the partitions assigned to it as a member of a consumer group, the
+// offset of a message is committed once the sinks confirmed it and every message before it.
+type groupConsumer struct {
+	client   sarama.Client
+	consumer sarama.Consumer
+	group    string
+	topics   []string
+	// initial is the offset used for the partitions without a committed offset
+	initial int64
+
+	memberID   string
+	generation int32
+	offsets    *offsetTracker
+}
+
+// newGroupConfig returns the configuration needed by the group membership requests.
+func newGroupConfig() *sarama.Config {
+	config := sarama.NewConfig()
+	config.Version = sarama.V0_10_0_0
+	// a join request waits up to the session timeout for the other members
+	config.Net.ReadTimeout = sessionTimeout + 10*time.Second
+	return config
+}
+
+// run consumes until done is closed, joining the group again whenever it rebalances.
+func (g *groupConsumer) run(out chan<- client.MessageSet, done chan struct{}) {
+	defer g.leave()
+	for {
+		assignment, err := g.join()
+		if err != nil {
+			log.With("group", g.group).Errorf("unable to join consumer group, %s", err)
+			select {
+			case <-time.After(joinRetryDelay):
+				continue
+			case <-done:
+				return
+			}
+		}
+		log.With("group", g.group).With("generation", g.generation).Infof("consuming partitions %v", assignment)
+		if !g.consume(assignment, out, done) {
+			return
+		}
+		log.With("group", g.group).Infoln("consumer group is rebalancing, joining again...")
+	}
+}
+
+// join joins the group and returns the partitions assigned to this member, the
+// partitions of every member are assigned here when this member is the leader.
+func (g *groupConsumer) join() (map[string][]int32, error) {
+	if err := g.client.RefreshCoordinator(g.group); err != nil {
+		return nil, err
+	}
+	coordinator, err := g.client.Coordinator(g.group)
+	if err != nil {
+		return nil, err
+	}
+
+	req := &sarama.JoinGroupRequest{
+		GroupId:        g.group,
+		SessionTimeout: int32(sessionTimeout / time.Millisecond),
+		MemberId:       g.memberID,
+		ProtocolType:   "consumer",
+	}
+	if err := req.AddGroupProtocolMetadata(rangeStrategy, &sarama.ConsumerGroupMemberMetadata{Version: 1, Topics: g.topics}); err != nil {
+		return nil, err
+	}
+	resp, err := coordinator.JoinGroup(req)
+	if err != nil {
+		return nil, err
+	}
+	if resp.Err == sarama.ErrUnknownMemberId {
+		g.memberID = ""
+	}
+	if resp.Err != sarama.ErrNoError {
+		return nil, resp.Err
+	}
+	g.memberID = resp.MemberId
+	g.generation = resp.GenerationId
+
+	syncReq := &sarama.SyncGroupRequest{
+		GroupId:      g.group,
+		GenerationId: g.generation,
+		MemberId:     g.memberID,
+	}
+	if resp.LeaderId == resp.MemberId {
+		members, err := resp.GetMembers()
+		if err != nil {
+			return nil, err
+		}
+		subscriptions := make(map[string][]string)
+		partitions := make(map[string][]int32)
+		for id, meta := range members {
+			subscriptions[id] = meta.Topics
+			for _, topic := range meta.Topics {
+				if _, ok := partitions[topic]; ok {
+					continue
+				}
+				if partitions[topic], err = g.client.Partitions(topic); err != nil {
+					return nil, err
+				}
+			}
+		}
+		for id, topics := range assignRange(subscriptions, partitions) {
+			if err := syncReq.AddGroupAssignmentMember(id, &sarama.ConsumerGroupMemberAssignment{Version: 1, Topics: topics}); err != nil {
+				return nil, err
+			}
+		}
+	}
+	syncResp, err := coordinator.SyncGroup(syncReq)
+	if err != nil {
+		return nil, err
+	}
+	if syncResp.Err != sarama.ErrNoError {
+		return nil, syncResp.Err
+	}
+	if len(syncResp.MemberAssignment) == 0 {
+		return nil, nil
+	}
+	assignment, err := syncResp.GetMemberAssignment()
+	if err != nil {
+		return nil, err
+	}
+	return assignment.Topics, nil
+}
+
+// assignRange splits the partitions of every topic in ranges over the members subscribed to it.
+func assignRange(subscriptions map[string][]string, partitions map[string][]int32) map[string]map[string][]int32 {
+	assignments := make(map[string]map[string][]int32)
+	topicMembers := make(map[string][]string)
+	for id, topics := range subscriptions {
+		assignments[id] = make(map[string][]int32)
+		for _, topic := range topics {
+			topicMembers[topic] = append(topicMembers[topic], id)
+		}
+	}
+	for topic, members := range topicMembers {
+		sort.Strings(members)
+		parts := append([]int32(nil), partitions[topic]...)
+		sort.Slice(parts, func(i, j int) bool { return parts[i] < parts[j] })
+		size, extra := len(parts)/len(members), len(parts)%len(members)
+		start := 0
+		for i, id := range members {
+			n := size
+			if i < extra {
+				n++
+			}
+			if n > 0 {
+				assignments[id][topic] = parts[start : start+n]
+			}
+			start += n
+		}
+	}
+	return assignments
+}
+
+// consume reads the assigned partitions until the group rebalances or done is closed, in which
+// case false is returned. The confirmed offsets are committed before returning.
+func (g *groupConsumer) consume(assignment map[string][]int32, out chan<- client.MessageSet, done chan struct{}) bool {
+	g.offsets = newOffsetTracker()
+	offsets, err := g.fetchOffsets(assignment)
+	if err != nil {
+		log.With("group", g.group).Errorf("unable to fetch committed offsets, %s", err)
+		select {
+		case <-time.After(joinRetryDelay):
+			return true
+		case <-done:
+			return false
+		}
+	}
+
+	stop := make(chan struct{})
+	var wg sync.WaitGroup
+	for topic, partitions := range assignment {
+		for _, partition := range partitions {
+			tp := topicPartition{topic, partition}
+			offset, ok := offsets[tp]
+			if !ok {
+				offset = g.initial
+			}
+			pc, err := g.consumer.ConsumePartition(topic, partition, offset)
+			if err == sarama.ErrOffsetOutOfRange {
+				log.With("topic", topic).With("partition", partition).Errorf("committed offset %d is out of range, starting from the initial offset", offset)
+				pc, err = g.consumer.ConsumePartition(topic, partition, g.initial)
+			}
+			if err != nil {
+				log.With("topic", topic).With("partition", partition).Errorf("unable to consume partition, %s", err)
+				continue
+			}
+			wg.Add(1)
+			go func(tp topicPartition, pc sarama.PartitionConsumer) {
+				defer wg.Done()
+				defer pc.Close()
+				g.consumePartition(tp, pc, out, stop)
+			}(tp, pc)
+		}
+	}
+	finish := func() {
+		close(stop)
+		wg.Wait()
+		g.commit()
+	}
+
+	heartbeat := time.NewTicker(heartbeatInterval)
+	defer heartbeat.Stop()
+	commit := time.NewTicker(commitInterval)
+	defer commit.Stop()
+	for {
+		select {
+		case <-done:
+			finish()
+			return false
+		case <-commit.C:
+			g.commit()
+		case <-heartbeat.C:
+			if err := g.heartbeat(); err != nil {
+				if err != sarama.ErrRebalanceInProgress {
+					log.With("group", g.group).Errorf("heartbeat failed, %s", err)
+				}
+				finish()
+				return true
+			}
+		}
+	}
+}
+
+// consumePartition sends the messages of a partition with a confirms channel closed by the sinks.
+func (g *groupConsumer) consumePartition(tp topicPartition, pc sarama.PartitionConsumer, out chan<- client.MessageSet, stop chan struct{}) {
+	for {
+		select {
+		case msg, ok := <-pc.Messages():
+			if !ok {
+				return
+			}
+			confirm := make(chan struct{})
+			g.offsets.add(tp, msg.Offset, confirm)
+			var result map[string]interface{}
+			if jerr := json.NewDecoder(bytes.NewReader(msg.Value)).Decode(&result); jerr != nil {
+				log.Errorf("unable to decode message to JSON, %s", jerr)
+				close(confirm)
+				continue
+			}
+			select {
+			case out <- client.MessageSet{
+				Msg:  message.WithConfirms(confirm, message.From(ops.Insert, msg.Topic, data.Data(result))),
+				Mode: commitlog.Sync,
+			}:
+			case <-stop:
+				return
+			}
+		case <-stop:
+			return
+		}
+	}
+}
+
+func (g *groupConsumer) heartbeat() error {
+	coordinator, err := g.client.Coordinator(g.group)
+	if err != nil {
+		return err
+	}
+	resp, err := coordinator.Heartbeat(&sarama.HeartbeatRequest{
+		GroupId:      g.group,
+		GenerationId: g.generation,
+		MemberId:     g.memberID,
+	})
+	if err != nil {
+		return err
+	}
+	if resp.Err != sarama.ErrNoError {
+		return resp.Err
+	}
+	return nil
+}
+
+// fetchOffsets returns the next offset to read for the partitions that have a committed offset.
+func (g *groupConsumer) fetchOffsets(assignment map[string][]int32) (map[topicPartition]int64, error) {
+	coordinator, err := g.client.Coordinator(g.group)
+	if err != nil {
+		return nil, err
+	}
+	req := &sarama.OffsetFetchRequest{ConsumerGroup: g.group, Version: 1}
+	for topic, partitions := range assignment {
+		for _, partition := range partitions {
+			req.AddPartition(topic, partition)
+		}
+	}
+	resp, err := coordinator.FetchOffset(req)
+	if err != nil {
+		return nil, err
+	}
+	offsets := make(map[topicPartition]int64)
+	for topic, partitions := range assignment {
+		for _, partition := range partitions {
+			block := resp.GetBlock(topic, partition)
+			if block == nil || block.Err != sarama.ErrNoError || block.Offset < 0 {
+				continue
+			}
+			offsets[topicPartition{topic, partition}] = block.Offset
+		}
+	}
+	return offsets, nil
+}
+
+// commit commits the offsets confirmed since the last commit.
+func (g *groupConsumer) commit() {
+	offsets := g.offsets.confirmed()
+	if len(offsets) == 0 {
+		return
+	}
+	coordinator, err := g.client.Coordinator(g.group)
+	if err != nil {
+		log.With("group", g.group).Errorf("unable to commit offsets, %s", err)
+		return
+	}
+	req := &sarama.OffsetCommitRequest{
+		Version:                 2,
+		ConsumerGroup:           g.group,
+		ConsumerGroupGeneration: g.generation,
+		ConsumerID:              g.memberID,
+		RetentionTime:           -1,
+	}
+	for tp, offset := range offsets {
+		// the committed offset is the next one to read
+		req.AddBlock(tp.topic, tp.partition, offset+1, 0, "")
+	}
+	resp, err := coordinator.CommitOffset(req)
+	if err != nil {
+		log.With("group", g.group).Errorf("unable to commit offsets, %s", err)
+		return
+	}
+	for tp, offset := range offsets {
+		if kerr := resp.Errors[tp.topic][tp.partition]; kerr != sarama.ErrNoError {
+			log.With("group", g.group).With("topic", tp.topic).With("partition", tp.partition).Errorf("unable to commit offset, %s", kerr)
+			continue
+		}
+		g.offsets.committed(tp, offset)
+	}
+}
+
+func (g *groupConsumer) leave() {
+	if g.memberID == "" {
+		return
+	}
+	coordinator, err := g.client.Coordinator(g.group)
+	if err != nil {
+		return
+	}
+	if _, err := coordinator.LeaveGroup(&sarama.LeaveGroupRequest{GroupId: g.group, MemberId: g.memberID}); err != nil {
+		log.With("group", g.group).Errorf("unable to leave consumer group, %s", err)
+	}
+}
+
+type topicPartition struct {
+	topic     string
+	partition int32
+}
+
+type pendingOffset struct {
+	offset  int64
+	confirm chan struct{}
+}
+
+// offsetTracker keeps the messages sent per partition until the sinks confirm them.
+type offsetTracker struct {
+	sync.Mutex
+	pending map[topicPartition][]pendingOffset
+	// last is the highest offset of each partition confirmed along with every offset before it
+	last map[topicPartition]int64
+	// commits is the last offset committed for each partition
+	commits map[topicPartition]int64
+}
+
+func newOffsetTracker() *offsetTracker {
+	return &offsetTracker{
+		pending: make(map[topicPartition][]pendingOffset),
+		last:    make(map[topicPartition]int64),
+		commits: make(map[topicPartition]int64),
+	}
+}
+
+func (t *offsetTracker) add(tp topicPartition, offset int64, confirm chan struct{}) {
+	t.Lock()
+	defer t.Unlock()
+	t.pending[tp] = append(t.pending[tp], pendingOffset{offset, confirm})
+}
+
+// confirmed returns the offsets to commit, the highest offset of every partition
+// whose messages up to it were all confirmed and that was not committed yet.
+func (t *offsetTracker) confirmed() map[topicPartition]int64 {
+	t.Lock()
+	defer t.Unlock()
+	for tp, pending := range t.pending {
+		n := 0
+	loop:
+		for _, p := range pending {
+			select {
+			case <-p.confirm:
+				t.last[tp] = p.offset
+				n++
+			default:
+				break loop
+			}
+		}
+		t.pending[tp] = pending[n:]
+	}
+	offsets := make(map[topicPartition]int64)
+	for tp, offset := range t.last {
+		if committed, ok := t.commits[tp]; !ok || offset > committed {
+			offsets[tp] = offset
+		}
+	}
+	return offsets
+}
+
+func (t *offsetTracker) committed(tp topicPartition, offset int64) {
+	t.Lock()
+	defer t.Unlock()
+	t.commits[tp] = offset
+}
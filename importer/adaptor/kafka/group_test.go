@@ -0,0 +1,435 @@
+package kafka
+
+import (
+	"bytes"
+	"encoding/binary"
+	"io"
+	"net"
+	"reflect"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/Shopify/sarama"
+)
+
+var assignRangeTests = []struct {
+	name          string
+	subscriptions map[string][]string
+	partitions    map[string][]int32
+	expected      map[string]map[string][]int32
+}{
+	{
+		"single member",
+		map[string][]string{"a": {"logs"}},
+		map[string][]int32{"logs": {1, 0, 2}},
+		map[string]map[string][]int32{"a": {"logs": {0, 1, 2}}},
+	},
+	{
+		"uneven split",
+		map[string][]string{"b": {"logs"}, "a": {"logs"}},
+		map[string][]int32{"logs": {0, 1, 2}},
+		map[string]map[string][]int32{"a": {"logs": {0, 1}}, "b": {"logs": {2}}},
+	},
+	{
+		"more members than partitions",
+		map[string][]string{"a": {"logs"}, "b": {"logs", "users"}},
+		map[string][]int32{"logs": {0}, "users": {0, 1}},
+		map[string]map[string][]int32{"a": {"logs": {0}}, "b": {"users": {0, 1}}},
+	},
+}
+
+func TestAssignRange(t *testing.T) {
+	for _, at := range assignRangeTests {
+		if got := assignRange(at.subscriptions, at.partitions); !reflect.DeepEqual(got, at.expected) {
+			t.Errorf("[%s] wrong assignment, expected %v, got %v", at.name, at.expected, got)
+		}
+	}
+}
+
+func TestOffsetTracker(t *testing.T) {
+	tracker := newOffsetTracker()
+	tp := topicPartition{"logs", 0}
+	confirms := make([]chan struct{}, 3)
+	for i := range confirms {
+		confirms[i] = make(chan struct{})
+		tracker.add(tp, int64(10+i), confirms[i])
+	}
+	if got := tracker.confirmed(); len(got) != 0 {
+		t.Fatalf("expected nothing to commit, got %v", got)
+	}
+
+	// offsets are only committed once every message before them is confirmed
+	close(confirms[1])
+	if got := tracker.confirmed(); len(got) != 0 {
+		t.Fatalf("expected nothing to commit, got %v", got)
+	}
+	close(confirms[0])
+	expected := map[topicPartition]int64{tp: 11}
+	if got := tracker.confirmed(); !reflect.DeepEqual(got, expected) {
+		t.Fatalf("wrong offsets, expected %v, got %v", expected, got)
+	}
+
+	tracker.committed(tp, 11)
+	if got := tracker.confirmed(); len(got) != 0 {
+		t.Fatalf("expected nothing to commit after commit, got %v", got)
+	}
+	close(confirms[2])
+	expected = map[topicPartition]int64{tp: 12}
+	if got := tracker.confirmed(); !reflect.DeepEqual(got, expected) {
+		t.Errorf("wrong offsets, expected %v, got %v", expected, got)
+	}
+}
+
+// memberAssignment encodes the assignment of partition 0 of a topic as sent by the group leader.
+func memberAssignment(topic string) []byte {
+	b := []byte{0, 1, 0, 0, 0, 1, 0, byte(len(topic))}
+	b = append(b, topic...)
+	return append(b, 0, 0, 0, 1, 0, 0, 0, 0, 0, 0, 0, 0)
+}
+
+func TestGroupConsumer(t *testing.T) {
+	mb := sarama.NewMockBroker(t, 1)
+	defer mb.Close()
+	mb.SetHandlerByMap(map[string]sarama.MockResponse{
+		"MetadataRequest": sarama.NewMockMetadataResponse(t).
+			SetBroker(mb.Addr(), mb.BrokerID()).
+			SetLeader("logs", 0, mb.BrokerID()),
+		"ConsumerMetadataRequest": sarama.NewMockConsumerMetadataResponse(t).
+			SetCoordinator("abc", mb),
+		"JoinGroupRequest": sarama.NewMockWrapper(&sarama.JoinGroupResponse{
+			GenerationId: 1,
+			LeaderId:     "leader",
+			MemberId:     "member",
+		}),
+		"SyncGroupRequest": sarama.NewMockWrapper(&sarama.SyncGroupResponse{
+			MemberAssignment: memberAssignment("logs"),
+		}),
+		"HeartbeatRequest":  sarama.NewMockWrapper(&sarama.HeartbeatResponse{}),
+		"LeaveGroupRequest": sarama.NewMockWrapper(&sarama.LeaveGroupResponse{}),
+		"OffsetFetchRequest": sarama.NewMockOffsetFetchResponse(t).
+			SetOffset("abc", "logs", 0, 1, "", sarama.ErrNoError),
+		"OffsetRequest": sarama.NewMockOffsetResponse(t).
+			SetOffset("logs", 0, sarama.OffsetOldest, 0).
+			SetOffset("logs", 0, sarama.OffsetNewest, 3),
+		"FetchRequest": sarama.NewMockFetchResponse(t, 1).SetVersion(2).
+			SetMessage("logs", 0, 1, sarama.StringEncoder(`{"n": 1}`)).
+			SetMessage("logs", 0, 2, sarama.StringEncoder(`{"n": 2}`)),
+		"OffsetCommitRequest": sarama.NewMockOffsetCommitResponse(t),
+	})
+
+	s := &Session{broker: sarama.NewBroker(mb.Addr()), topic: []string{"logs"}}
+	r := &Reader{Topics: []string{"logs"}, GroupID: "abc", Offset: sarama.OffsetNewest}
+	done := make(chan struct{})
+	msgChan, err := r.Read(nil, func(string) bool { return true })(s, done)
+	if err != nil {
+		t.Fatalf("unexpected Read error, %s", err)
+	}
+
+	for _, expected := range []float64{1, 2} {
+		select {
+		case m := <-msgChan:
+			if got := m.Msg.Data()["n"]; got != expected {
+				t.Fatalf("wrong message, expected %v, got %v", expected, got)
+			}
+			close(m.Msg.Confirms())
+		case <-time.After(5 * time.Second):
+			t.Fatal("timed out waiting for message")
+		}
+	}
+	time.Sleep(2 * commitInterval)
+	close(done)
+	for range msgChan {
+	}
+
+	expected := &sarama.OffsetCommitRequest{
+		Version:                 2,
+		ConsumerGroup:           "abc",
+		ConsumerGroupGeneration: 1,
+		ConsumerID:              "member",
+		RetentionTime:           -1,
+	}
+	expected.AddBlock("logs", 0, 3, 0, "")
+	var committed bool
+	for _, rr := range mb.History() {
+		if req, ok := rr.Request.(*sarama.OffsetCommitRequest); ok && reflect.DeepEqual(req, expected) {
+			committed = true
+		}
+	}
+	if !committed {
+		t.Errorf("offset 3 was not committed")
+	}
+}
+
+// packet concatenates the fields of a golden packet.
+func packet(fields ...[]byte) []byte {
+	return bytes.Join(fields, nil)
+}
+
+var (
+	// rangeMetadata is the metadata of a member subscribed to logs with the range strategy
+	rangeMetadata = packet(
+		[]byte{0x00, 0x01},             // version
+		[]byte{0x00, 0x00, 0x00, 0x01}, // topics
+		[]byte{0x00, 0x04, 'l', 'o', 'g', 's'},
+		[]byte{0xff, 0xff, 0xff, 0xff}, // user data
+	)
+	noMember = []byte{0x00, 0x00}
+	member1  = []byte{0x00, 0x08, 'm', 'e', 'm', 'b', 'e', 'r', '-', '1'}
+	member2  = []byte{0x00, 0x08, 'm', 'e', 'm', 'b', 'e', 'r', '-', '2'}
+	// groupMember1 is the group, generation 1 and member id of the heartbeat and commit requests
+	groupMember1 = packet([]byte{0x00, 0x03, 'a', 'b', 'c'}, []byte{0x00, 0x00, 0x00, 0x01}, member1)
+
+	// assignments of the partitions 0 and 1 and of the partition 1 of logs
+	assignment01 = packet(
+		[]byte{0x00, 0x01},
+		[]byte{0x00, 0x00, 0x00, 0x01},
+		[]byte{0x00, 0x04, 'l', 'o', 'g', 's'},
+		[]byte{0x00, 0x00, 0x00, 0x02, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x01},
+		[]byte{0xff, 0xff, 0xff, 0xff},
+	)
+	assignment1 = packet(
+		[]byte{0x00, 0x01},
+		[]byte{0x00, 0x00, 0x00, 0x01},
+		[]byte{0x00, 0x04, 'l', 'o', 'g', 's'},
+		[]byte{0x00, 0x00, 0x00, 0x01, 0x00, 0x00, 0x00, 0x01},
+		[]byte{0xff, 0xff, 0xff, 0xff},
+	)
+)
+
+// joinRequest is the join request of the member subscribed to logs.
+func joinRequest(member []byte) []byte {
+	return packet(
+		[]byte{0x00, 0x03, 'a', 'b', 'c'}, // group
+		[]byte{0x00, 0x00, 0x75, 0x30},    // session timeout
+		member,
+		[]byte{0x00, 0x08, 'c', 'o', 'n', 's', 'u', 'm', 'e', 'r'}, // protocol type
+		[]byte{0x00, 0x00, 0x00, 0x01},                             // protocols
+		[]byte{0x00, 0x05, 'r', 'a', 'n', 'g', 'e'},
+		[]byte{0x00, 0x00, 0x00, 0x10},
+		rangeMetadata,
+	)
+}
+
+// groupExchange is a request the coordinator expects with the response it sends back.
+type groupExchange struct {
+	name     string
+	key      int16
+	version  int16
+	request  []byte
+	response []byte
+}
+
+// groupExchanges are the packets of a member that joins as the leader, commits an offset and
+// joins again as a follower once the group rebalances and forgot its member id.
+var groupExchanges = []groupExchange{
+	{
+		"join as leader", 11, 0,
+		joinRequest(noMember),
+		packet(
+			[]byte{0x00, 0x00},                          // error
+			[]byte{0x00, 0x00, 0x00, 0x01},              // generation
+			[]byte{0x00, 0x05, 'r', 'a', 'n', 'g', 'e'}, // protocol
+			member1,                        // leader
+			member1,                        // member
+			[]byte{0x00, 0x00, 0x00, 0x01}, // members
+			member1,
+			[]byte{0x00, 0x00, 0x00, 0x10},
+			rangeMetadata,
+		),
+	},
+	{
+		"sync as leader", 14, 0,
+		packet(groupMember1, []byte{0x00, 0x00, 0x00, 0x01}, member1, []byte{0x00, 0x00, 0x00, 0x1c}, assignment01),
+		packet([]byte{0x00, 0x00}, []byte{0x00, 0x00, 0x00, 0x1c}, assignment01),
+	},
+	{
+		"heartbeat", 12, 0,
+		groupMember1,
+		[]byte{0x00, 0x00},
+	},
+	{
+		"commit", 8, 2,
+		packet(
+			groupMember1,
+			[]byte{0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff}, // retention time
+			[]byte{0x00, 0x00, 0x00, 0x01},
+			[]byte{0x00, 0x04, 'l', 'o', 'g', 's'},
+			[]byte{0x00, 0x00, 0x00, 0x01},
+			[]byte{0x00, 0x00, 0x00, 0x00},                         // partition
+			[]byte{0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x05}, // offset
+			[]byte{0x00, 0x00},                                     // metadata
+		),
+		packet(
+			[]byte{0x00, 0x00, 0x00, 0x01},
+			[]byte{0x00, 0x04, 'l', 'o', 'g', 's'},
+			[]byte{0x00, 0x00, 0x00, 0x01},
+			[]byte{0x00, 0x00, 0x00, 0x00, 0x00, 0x00},
+		),
+	},
+	{
+		"heartbeat during rebalance", 12, 0,
+		groupMember1,
+		[]byte{0x00, 0x1b},
+	},
+	{
+		"join with an unknown member id", 11, 0,
+		joinRequest(member1),
+		packet(
+			[]byte{0x00, 0x19},
+			[]byte{0xff, 0xff, 0xff, 0xff},
+			[]byte{0x00, 0x00},
+			[]byte{0x00, 0x00},
+			[]byte{0x00, 0x00},
+			[]byte{0x00, 0x00, 0x00, 0x00},
+		),
+	},
+	{
+		"join as follower", 11, 0,
+		joinRequest(noMember),
+		packet(
+			[]byte{0x00, 0x00},
+			[]byte{0x00, 0x00, 0x00, 0x02},
+			[]byte{0x00, 0x05, 'r', 'a', 'n', 'g', 'e'},
+			member2,
+			member1,
+			[]byte{0x00, 0x00, 0x00, 0x00},
+		),
+	},
+	{
+		"sync as follower", 14, 0,
+		packet([]byte{0x00, 0x03, 'a', 'b', 'c'}, []byte{0x00, 0x00, 0x00, 0x02}, member1, []byte{0x00, 0x00, 0x00, 0x00}),
+		packet([]byte{0x00, 0x00}, []byte{0x00, 0x00, 0x00, 0x18}, assignment1),
+	},
+	{
+		"leave", 13, 0,
+		packet([]byte{0x00, 0x03, 'a', 'b', 'c'}, member1),
+		[]byte{0x00, 0x00},
+	},
+}
+
+// serveGroup answers the requests read from conn with the exchanges, in order.
+func serveGroup(t *testing.T, conn net.Conn, exchanges []groupExchange) {
+	defer conn.Close()
+	for {
+		var size int32
+		if err := binary.Read(conn, binary.BigEndian, &size); err != nil {
+			if len(exchanges) > 0 {
+				t.Errorf("missing requests, next is %s", exchanges[0].name)
+			}
+			return
+		}
+		req := make([]byte, size)
+		if _, err := io.ReadFull(conn, req); err != nil {
+			t.Errorf("unable to read request, %s", err)
+			return
+		}
+		if len(exchanges) == 0 {
+			t.Errorf("unexpected request %v", req)
+			return
+		}
+		ex := exchanges[0]
+		exchanges = exchanges[1:]
+		key := int16(binary.BigEndian.Uint16(req))
+		version := int16(binary.BigEndian.Uint16(req[2:]))
+		correlation := req[4:8]
+		// the header ends with the client id
+		body := req[10+binary.BigEndian.Uint16(req[8:]):]
+		if key != ex.key || version != ex.version {
+			t.Errorf("[%s] wrong request, expected key %d version %d, got key %d version %d", ex.name, ex.key, ex.version, key, version)
+		} else if !bytes.Equal(body, ex.request) {
+			t.Errorf("[%s] wrong request\nexpected: %v\ngot: %v", ex.name, ex.request, body)
+		}
+		resp := make([]byte, 4, 8+len(ex.response))
+		binary.BigEndian.PutUint32(resp, uint32(4+len(ex.response)))
+		resp = append(append(resp, correlation...), ex.response...)
+		if _, err := conn.Write(resp); err != nil {
+			t.Errorf("[%s] unable to write response, %s", ex.name, err)
+			return
+		}
+	}
+}
+
+func TestGroupPackets(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("unable to listen, %s", err)
+	}
+	defer ln.Close()
+	served := make(chan struct{})
+	go func() {
+		defer close(served)
+		conn, err := ln.Accept()
+		if err != nil {
+			t.Errorf("unable to accept coordinator connection, %s", err)
+			return
+		}
+		serveGroup(t, conn, groupExchanges)
+	}()
+
+	mb := sarama.NewMockBroker(t, 1)
+	defer mb.Close()
+	host, port, _ := net.SplitHostPort(ln.Addr().String())
+	p, _ := strconv.Atoi(port)
+	mb.SetHandlerByMap(map[string]sarama.MockResponse{
+		"MetadataRequest": sarama.NewMockMetadataResponse(t).
+			SetBroker(mb.Addr(), mb.BrokerID()).
+			SetLeader("logs", 0, mb.BrokerID()).
+			SetLeader("logs", 1, mb.BrokerID()),
+		"ConsumerMetadataRequest": sarama.NewMockWrapper(&sarama.ConsumerMetadataResponse{
+			CoordinatorID:   2,
+			CoordinatorHost: host,
+			CoordinatorPort: int32(p),
+		}),
+	})
+	c, err := sarama.NewClient([]string{mb.Addr()}, newGroupConfig())
+	if err != nil {
+		t.Fatalf("unexpected NewClient error, %s", err)
+	}
+
+	g := &groupConsumer{client: c, group: "abc", topics: []string{"logs"}}
+	assignment, err := g.join()
+	if err != nil {
+		t.Fatalf("unexpected join error, %s", err)
+	}
+	if expected := map[string][]int32{"logs": {0, 1}}; !reflect.DeepEqual(assignment, expected) {
+		t.Errorf("wrong assignment, expected %v, got %v", expected, assignment)
+	}
+	if err := g.heartbeat(); err != nil {
+		t.Errorf("unexpected heartbeat error, %s", err)
+	}
+
+	g.offsets = newOffsetTracker()
+	tp := topicPartition{"logs", 0}
+	confirm := make(chan struct{})
+	close(confirm)
+	g.offsets.add(tp, 4, confirm)
+	g.commit()
+	if got := g.offsets.commits[tp]; got != 4 {
+		t.Errorf("wrong committed offset, expected 4, got %d", got)
+	}
+
+	if err := g.heartbeat(); err != sarama.ErrRebalanceInProgress {
+		t.Errorf("wrong heartbeat error, expected %v, got %v", sarama.ErrRebalanceInProgress, err)
+	}
+	if _, err := g.join(); err != sarama.ErrUnknownMemberId {
+		t.Errorf("wrong join error, expected %v, got %v", sarama.ErrUnknownMemberId, err)
+	}
+	if g.memberID != "" {
+		t.Errorf("expected the member id to be reset, got %s", g.memberID)
+	}
+	assignment, err = g.join()
+	if err != nil {
+		t.Fatalf("unexpected join error, %s", err)
+	}
+	if expected := map[string][]int32{"logs": {1}}; !reflect.DeepEqual(assignment, expected) {
+		t.Errorf("wrong assignment, expected %v, got %v", expected, assignment)
+	}
+	if g.generation != 2 {
+		t.Errorf("wrong generation, expected 2, got %d", g.generation)
+	}
+	g.leave()
+
+	c.Close()
+	<-served
+}
@@ -14,7 +14,8 @@ const (
   	"uri": "${KAFKA_URI}",
  	"topic": "",
  	"partition": 0,
-	"offset": -1
+	"offset": -1,
+	// "group_id": "abc" // consume as a member of a consumer group, committing offsets once indexed
 	}`
 
 	description = "an adaptor that handles publish/subscribe messaging with Kafka"
@@ -28,6 +29,7 @@ type Kafka struct {
 	Topics    []string `json:"topic"`
 	Partition int32    `json:"partition"`
 	Offset    int64    `json:"offset"`
+	GroupID   string   `json:"group_id" doc:"consumer group to join, offsets are committed once the messages are written by the sink"`
 	SSL       bool     `json:"ssl"`
 	CACerts   []string `json:"cacerts"`
 }
@@ -53,7 +55,7 @@ func (r *Kafka) Client() (client.Client, error) {
 
 // Reader instantiates a Reader for use with subscribing to one or more topics.
 func (r *Kafka) Reader() (client.Reader, error) {
-	return &Reader{r.URI, r.Topics}, nil
+	return &Reader{Uri: r.URI, Topics: r.Topics, GroupID: r.GroupID, Offset: r.Offset}, nil
 }
 
 // Writer instantiates a Writer for use with publishing to one or more exchanges.
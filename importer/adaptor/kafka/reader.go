@@ -21,6 +21,10 @@ var _ client.Reader = &Reader{}
 type Reader struct {
 	Uri    string
 	Topics []string
+	// GroupID is the consumer group joined to consume the topics, if any
+	GroupID string
+	// Offset is where a consumer group starts on the partitions without a committed offset
+	Offset int64
 }
 
 func (r *Reader) Read(_ map[string]client.MessageSet, filterFn client.NsFilterFunc) client.MessageChanFunc {
@@ -31,6 +35,9 @@ func (r *Reader) Read(_ map[string]client.MessageSet, filterFn client.NsFilterFu
 		broker := s.(*Session).broker
 		topics = s.(*Session).topic
 		uri := strings.Split(broker.Addr(), ",")
+		if r.GroupID != "" {
+			config = newGroupConfig()
+		}
 		Client, err := sarama.NewClient(uri, config)
 		if err != nil {
 			log.Errorln(err)
@@ -53,6 +60,29 @@ func (r *Reader) Read(_ map[string]client.MessageSet, filterFn client.NsFilterFu
 				filterTopics = append(filterTopics, q)
 			}
 		}
+		if r.GroupID != "" {
+			consumer, err := sarama.NewConsumerFromClient(Client)
+			if err != nil {
+				return nil, err
+			}
+			log.With("group", r.GroupID).Infoln("Consuming as a member of the consumer group")
+			g := &groupConsumer{
+				client:   Client,
+				consumer: consumer,
+				group:    r.GroupID,
+				topics:   filterTopics,
+				initial:  r.Offset,
+			}
+			go func() {
+				defer func() {
+					consumer.Close()
+					Client.Close()
+					close(out)
+				}()
+				g.run(out, done)
+			}()
+			return out, nil
+		}
 		go func(qs []string, session *Session) {
 			defer func() {
 				broker.Close()
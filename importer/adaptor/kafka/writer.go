@@ -8,6 +8,7 @@ import (
 	"github.com/Shopify/sarama"
 	"github.com/appbaseio/abc/importer/client"
 	"github.com/appbaseio/abc/importer/message"
+	"github.com/appbaseio/abc/importer/message/ops"
 )
 
 const (
@@ -28,6 +29,13 @@ type Writer struct {
 
 func (w *Writer) Write(msg message.Msg) func(client.Session) (message.Msg, error) {
 	return func(s client.Session) (message.Msg, error) {
+		// commands, like the schema of a table, are only applied by the elasticsearch sink
+		if msg.OP() == ops.Command {
+			if msg.Confirms() != nil {
+				close(msg.Confirms())
+			}
+			return msg, nil
+		}
 		config := s.(*Session).conn
 		uri := strings.Split(w.Uri, ",")
 		producer, err := sarama.NewAsyncProducer(uri, config)
@@ -35,11 +43,6 @@ func (w *Writer) Write(msg message.Msg) func(client.Session) (message.Msg, error
 			panic(err) // Should not reach here
 		}
 
-		defer func() {
-			if err := producer.Close(); err != nil {
-				panic(err) // Should not reach here
-			}
-		}()
 		b := new(bytes.Buffer)
 		json.NewEncoder(b).Encode(msg.Data())
 		saramaMsg := &sarama.ProducerMessage{
@@ -50,9 +53,17 @@ func (w *Writer) Write(msg message.Msg) func(client.Session) (message.Msg, error
 		select {
 		case producer.Input() <- saramaMsg:
 		case err := <-producer.Errors():
+			producer.Close()
 			return msg, err
 		}
 
-		return msg, err
+		// Close returns once the message was sent
+		if err := producer.Close(); err != nil {
+			return msg, err
+		}
+		if msg.Confirms() != nil {
+			close(msg.Confirms())
+		}
+		return msg, nil
 	}
 }
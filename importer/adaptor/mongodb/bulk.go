@@ -25,7 +25,6 @@ var _ client.Writer = &Bulk{}
 type Bulk struct {
 	bulkMap map[string]*bulkOperation
 	*sync.RWMutex
-	confirmChan chan struct{}
 }
 
 type bulkOperation struct {
@@ -36,6 +35,8 @@ type bulkOperation struct {
 	avgTotal   int
 	avgOpSize  float64
 	bsonOpSize int
+	// confirms are the confirms of the messages of the bulk, closed once it is run
+	confirms []chan struct{}
 }
 
 func newBulker(done chan struct{}, wg *sync.WaitGroup) *Bulk {
@@ -50,9 +51,15 @@ func newBulker(done chan struct{}, wg *sync.WaitGroup) *Bulk {
 
 func (b *Bulk) Write(msg message.Msg) func(client.Session) (message.Msg, error) {
 	return func(s client.Session) (message.Msg, error) {
+		// commands, like the schema of a table, are only applied by the elasticsearch sink
+		if msg.OP() == ops.Command {
+			if msg.Confirms() != nil {
+				close(msg.Confirms())
+			}
+			return msg, nil
+		}
 		coll := msg.Namespace()
 		b.Lock()
-		b.confirmChan = msg.Confirms()
 		bOp, ok := b.bulkMap[coll]
 		if !ok {
 			s := s.(*Session).mgoSession.Copy()
@@ -62,6 +69,9 @@ func (b *Bulk) Write(msg message.Msg) func(client.Session) (message.Msg, error)
 			}
 			b.bulkMap[coll] = bOp
 		}
+		if msg.Confirms() != nil {
+			bOp.confirms = append(bOp.confirms, msg.Confirms())
+		}
 		switch msg.OP() {
 		case ops.Delete:
 			bOp.bulk.Remove(bson.M{"_id": msg.Data().Get("_id")})
@@ -79,9 +89,6 @@ func (b *Bulk) Write(msg message.Msg) func(client.Session) (message.Msg, error)
 		var err error
 		if bOp.opCounter >= maxObjSize || bOp.bsonOpSize >= maxBSONObjSize {
 			err = b.flush(coll, bOp)
-			if err == nil && b.confirmChan != nil {
-				b.confirmChan <- struct{}{}
-			}
 		}
 		b.Unlock()
 		return msg, err
@@ -118,16 +125,12 @@ func (b *Bulk) run(done chan struct{}, wg *sync.WaitGroup) {
 
 func (b *Bulk) flushAll() error {
 	b.Lock()
+	defer b.Unlock()
 	for c, bOp := range b.bulkMap {
 		if err := b.flush(c, bOp); err != nil {
 			return err
 		}
 	}
-	if b.confirmChan != nil {
-		close(b.confirmChan)
-		b.confirmChan = nil
-	}
-	b.Unlock()
 	return nil
 }
 
@@ -145,6 +148,9 @@ func (b *Bulk) flush(c string, bOp *bulkOperation) error {
 		}
 	}
 	bOp.s.Close()
+	for _, confirm := range bOp.confirms {
+		close(confirm)
+	}
 	log.With("collection", c).Debugln("flush complete")
 	delete(b.bulkMap, c)
 	return nil
@@ -0,0 +1,420 @@
+package mongodb
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/appbaseio/abc/importer/client"
+	"github.com/appbaseio/abc/importer/commitlog"
+	"github.com/appbaseio/abc/importer/message"
+	"github.com/appbaseio/abc/importer/message/data"
+	"github.com/appbaseio/abc/importer/message/ops"
+	"github.com/appbaseio/abc/log"
+	"github.com/globalsign/mgo"
+	"github.com/globalsign/mgo/bson"
+)
+
+const (
+	// DefaultFullDocument looks up the current version of updated documents.
+	DefaultFullDocument = mgo.UpdateLookup
+
+	tokenSaveInterval = time.Second
+
+	// maxPendingChanges is the number of documents whose changes are kept while copying, the
+	// stream is not read further until the copy completes
+	maxPendingChanges = 100000
+
+	// streamRetries is the number of attempts to reopen a failed change stream, the delay
+	// between them doubles from streamRetryDelay
+	streamRetries    = 5
+	streamRetryDelay = time.Second
+)
+
+// changeEvent is the representation of a change stream document
+// detailed here https://docs.mongodb.com/manual/reference/change-events/
+type changeEvent struct {
+	ID                bson.Raw            `bson:"_id"`
+	OperationType     string              `bson:"operationType"`
+	ClusterTime       bson.MongoTimestamp `bson:"clusterTime"`
+	FullDocument      bson.M              `bson:"fullDocument"`
+	DocumentKey       bson.M              `bson:"documentKey"`
+	UpdateDescription struct {
+		UpdatedFields bson.M   `bson:"updatedFields"`
+		RemovedFields []string `bson:"removedFields"`
+	} `bson:"updateDescription"`
+}
+
+// key identifies the changed document.
+func (e *changeEvent) key() string {
+	return fmt.Sprintf("%#v", e.DocumentKey["_id"])
+}
+
+// message converts the event to a message, false is returned for the events that do not
+// change a document. Without the lookup of the full document, updates only hold the changed
+// fields and the removed ones as nil.
+func (e *changeEvent) message(c string, lookup bool) (message.Msg, bool) {
+	var (
+		op  ops.Op
+		doc bson.M
+	)
+	switch e.OperationType {
+	case "insert":
+		op = ops.Insert
+		doc = e.FullDocument
+	case "replace":
+		op = ops.Update
+		doc = e.FullDocument
+	case "update":
+		op = ops.Update
+		doc = e.FullDocument
+		if !lookup {
+			doc = bson.M{"_id": e.DocumentKey["_id"]}
+			for k, v := range e.UpdateDescription.UpdatedFields {
+				doc[k] = v
+			}
+			for _, k := range e.UpdateDescription.RemovedFields {
+				doc[k] = nil
+			}
+		}
+	case "delete":
+		op = ops.Delete
+		doc = bson.M{"_id": e.DocumentKey["_id"]}
+	}
+	// the document looked up for an update was deleted since, its delete event follows
+	if doc == nil {
+		return nil, false
+	}
+	msg := message.From(op, c, data.Data(doc)).(*message.Base)
+	msg.TS = int64(e.ClusterTime) >> 32
+	return msg, true
+}
+
+// changeStreamPipeline matches the change events of the documents selected by a collection
+// filter, the fields of the filter are looked up in the full document. Deletes, and updates
+// without the full document, can not be filtered.
+func changeStreamPipeline(filter CollectionFilter, fullDocument string) []bson.M {
+	if len(filter) == 0 {
+		return []bson.M{}
+	}
+	unfiltered := []string{"delete", "invalidate"}
+	if fullDocument != mgo.UpdateLookup {
+		unfiltered = append(unfiltered, "update")
+	}
+	return []bson.M{{"$match": bson.M{"$or": []interface{}{
+		bson.M{"operationType": bson.M{"$in": unfiltered}},
+		prefixFields(map[string]interface{}(filter), "fullDocument."),
+	}}}}
+}
+
+// prefixFields prefixes the field names of a query, recursing into the logical operators.
+func prefixFields(query map[string]interface{}, prefix string) bson.M {
+	prefixed := bson.M{}
+	for k, v := range query {
+		if !strings.HasPrefix(k, "$") {
+			prefixed[prefix+k] = v
+			continue
+		}
+		if clauses, ok := v.([]interface{}); ok {
+			var out []interface{}
+			for _, clause := range clauses {
+				if m, ok := clause.(map[string]interface{}); ok {
+					out = append(out, prefixFields(m, prefix))
+				} else {
+					out = append(out, clause)
+				}
+			}
+			v = out
+		}
+		prefixed[k] = v
+	}
+	return prefixed
+}
+
+// watchCollection opens a change stream on the collection, resuming after token when set. The
+// changes received until copied is closed are collected, only the last one of every document
+// is sent once the copy completes. The stream is opened again after the last change read when
+// reading fails, errc receives the error when it can not be.
+func (r *Reader) watchCollection(c string, mgoSession *mgo.Session, token *bson.Raw, copied <-chan struct{}, out chan<- client.MessageSet, done chan struct{}) (chan error, error) {
+	db := mgoSession.DB("").Name
+	stream, err := r.openStream(mgoSession, c, token)
+	if err != nil {
+		mgoSession.Close()
+		return nil, fmt.Errorf("unable to watch collection %s, %s", c, err)
+	}
+
+	errc := make(chan error, 1)
+	go func() {
+		defer func() {
+			stream.Close()
+			mgoSession.Close()
+			close(errc)
+		}()
+
+		var (
+			copying = true
+			pending = make(map[string]changeEvent)
+			order   []string
+			last    *bson.Raw
+		)
+		send := func(e changeEvent, token *bson.Raw) bool {
+			msg, ok := e.message(c, r.fullDocument == mgo.UpdateLookup)
+			if !ok {
+				// the token still moves past the skipped event
+				if r.tokens != nil && token != nil {
+					confirm := make(chan struct{})
+					close(confirm)
+					r.tokens.track(c, confirm, token)
+				}
+				return true
+			}
+			if r.tokens != nil {
+				confirm := make(chan struct{})
+				msg = message.WithConfirms(confirm, msg)
+				r.tokens.track(c, confirm, token)
+			}
+			select {
+			case out <- client.MessageSet{Msg: msg, Timestamp: msg.(*message.Base).TS, Mode: commitlog.Sync}:
+				return true
+			case <-done:
+				return false
+			}
+		}
+		// flush sends the changes collected during the copy, the resume token is only stored
+		// with the last one as they are not sent in order
+		flush := func() bool {
+			log.With("db", db).With("collection", c).With("changes", len(order)).Infoln("sending changes received while copying")
+			for i, key := range order {
+				var token *bson.Raw
+				if i == len(order)-1 {
+					token = last
+				}
+				if !send(pending[key], token) {
+					return false
+				}
+			}
+			pending, order = nil, nil
+			return true
+		}
+		// reopen opens the stream again after the last change read, waiting longer between
+		// every attempt
+		reopen := func(cause error) bool {
+			stream.Close()
+			if token == nil {
+				errc <- fmt.Errorf("error reading change stream, no change to resume after, %s", cause)
+				return false
+			}
+			for attempt := 0; attempt < streamRetries; attempt++ {
+				log.With("db", db).With("collection", c).Errorf("error reading change stream, reopening it, %s", cause)
+				select {
+				case <-time.After(streamRetryDelay << uint(attempt)):
+				case <-done:
+					return false
+				}
+				mgoSession.Refresh()
+				s, err := r.openStream(mgoSession, c, token)
+				if err == nil {
+					stream = s
+					return true
+				}
+				cause = err
+			}
+			errc <- fmt.Errorf("unable to reopen change stream, %s", cause)
+			return false
+		}
+
+		log.With("db", db).With("collection", c).Infoln("listening for changes...")
+		for {
+			if copying {
+				if len(pending) < maxPendingChanges {
+					select {
+					case <-copied:
+						copying = false
+					default:
+					}
+				} else {
+					// the changes wait in the stream, the oplog has to hold them until the copy completes
+					log.With("db", db).With("collection", c).Infoln("too many changes received while copying, waiting for the copy to complete")
+					select {
+					case <-copied:
+						copying = false
+					case <-done:
+						return
+					}
+				}
+				if !copying && !flush() {
+					return
+				}
+			}
+			select {
+			case <-done:
+				log.With("db", db).Infoln("tailing stopping...")
+				return
+			default:
+			}
+
+			var event changeEvent
+			if !stream.Next(&event) {
+				if err := stream.Err(); err != nil && !reopen(err) {
+					return
+				}
+				continue
+			}
+			if event.OperationType == "invalidate" {
+				errc <- fmt.Errorf("change stream of collection %s invalidated, the collection was dropped or renamed", c)
+				return
+			}
+			id := event.ID
+			token = &id
+			if copying {
+				key := event.key()
+				if _, ok := pending[key]; !ok {
+					order = append(order, key)
+				}
+				pending[key] = event
+				last = token
+				continue
+			}
+			if !send(event, token) {
+				return
+			}
+		}
+	}()
+	return errc, nil
+}
+
+// openStream watches the changes of the collection after token, from now when it is nil.
+func (r *Reader) openStream(mgoSession *mgo.Session, c string, token *bson.Raw) (*mgo.ChangeStream, error) {
+	return mgoSession.DB("").C(c).Watch(changeStreamPipeline(r.collectionFilters[c], r.fullDocument), mgo.ChangeStreamOptions{
+		FullDocument:   mgo.FullDocument(r.fullDocument),
+		ResumeAfter:    token,
+		MaxAwaitTimeMS: r.oplogTimeout,
+	})
+}
+
+// tokenStore keeps the resume token of every collection in a file, a token is only stored once
+// the messages sent before it are confirmed by the sink.
+type tokenStore struct {
+	sync.Mutex
+	path    string
+	tokens  map[string]string
+	pending map[string][]pendingToken
+}
+
+type pendingToken struct {
+	confirm chan struct{}
+	token   *bson.Raw
+}
+
+func newTokenStore(path string) (*tokenStore, error) {
+	s := &tokenStore{
+		path:    path,
+		tokens:  make(map[string]string),
+		pending: make(map[string][]pendingToken),
+	}
+	b, err := ioutil.ReadFile(path)
+	if os.IsNotExist(err) {
+		return s, nil
+	} else if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(b, &s.tokens); err != nil {
+		return nil, fmt.Errorf("malformed resume token file %s, %s", path, err)
+	}
+	return s, nil
+}
+
+// get returns the stored resume token of a collection, nil if there is none.
+func (s *tokenStore) get(c string) *bson.Raw {
+	if s == nil {
+		return nil
+	}
+	s.Lock()
+	defer s.Unlock()
+	encoded, ok := s.tokens[c]
+	if !ok {
+		return nil
+	}
+	b, err := base64.StdEncoding.DecodeString(encoded)
+	if err != nil {
+		log.With("collection", c).Errorf("ignoring malformed resume token, %s", err)
+		return nil
+	}
+	return &bson.Raw{Kind: 0x03, Data: b}
+}
+
+// track holds the token until confirm is closed, a nil token only waits for the confirmation.
+func (s *tokenStore) track(c string, confirm chan struct{}, token *bson.Raw) {
+	s.Lock()
+	defer s.Unlock()
+	s.pending[c] = append(s.pending[c], pendingToken{confirm, token})
+}
+
+// confirmed moves the tokens of the confirmed messages to the stored tokens, it returns
+// whether any changed.
+func (s *tokenStore) confirmed() bool {
+	s.Lock()
+	defer s.Unlock()
+	var changed bool
+	for c, pending := range s.pending {
+		i := 0
+	confirms:
+		for ; i < len(pending); i++ {
+			select {
+			case <-pending[i].confirm:
+				if pending[i].token != nil {
+					s.tokens[c] = base64.StdEncoding.EncodeToString(pending[i].token.Data)
+					changed = true
+				}
+			default:
+				break confirms
+			}
+		}
+		s.pending[c] = pending[i:]
+	}
+	return changed
+}
+
+// save writes the tokens to a temporary file renamed over the previous one.
+func (s *tokenStore) save() error {
+	s.Lock()
+	b, err := json.Marshal(s.tokens)
+	s.Unlock()
+	if err != nil {
+		return err
+	}
+	tmp := filepath.Join(filepath.Dir(s.path), "."+filepath.Base(s.path)+".tmp")
+	if err := ioutil.WriteFile(tmp, b, 0644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, s.path)
+}
+
+// run saves the confirmed tokens until done is closed.
+func (s *tokenStore) run(done chan struct{}) {
+	ticker := time.NewTicker(tokenSaveInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+		case <-done:
+			// save what was confirmed before stopping
+		}
+		if s.confirmed() {
+			if err := s.save(); err != nil {
+				log.With("path", s.path).Errorf("unable to save resume tokens, %s", err)
+			}
+		}
+		select {
+		case <-done:
+			return
+		default:
+		}
+	}
+}
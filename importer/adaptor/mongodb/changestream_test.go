@@ -0,0 +1,250 @@
+package mongodb
+
+import (
+	"fmt"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/appbaseio/abc/importer/client"
+	"github.com/appbaseio/abc/importer/message/data"
+	"github.com/appbaseio/abc/importer/message/ops"
+	"github.com/globalsign/mgo"
+	"github.com/globalsign/mgo/bson"
+)
+
+var changeEventTests = []struct {
+	name   string
+	event  changeEvent
+	lookup bool
+	op     ops.Op
+	data   data.Data
+}{
+	{
+		"insert",
+		changeEvent{OperationType: "insert", FullDocument: bson.M{"_id": 1, "i": 1}, DocumentKey: bson.M{"_id": 1}},
+		true,
+		ops.Insert,
+		data.Data{"_id": 1, "i": 1},
+	},
+	{
+		"replace",
+		changeEvent{OperationType: "replace", FullDocument: bson.M{"_id": 1, "i": 2}, DocumentKey: bson.M{"_id": 1}},
+		false,
+		ops.Update,
+		data.Data{"_id": 1, "i": 2},
+	},
+	{
+		"update with lookup",
+		changeEvent{OperationType: "update", FullDocument: bson.M{"_id": 1, "i": 3, "j": 1}, DocumentKey: bson.M{"_id": 1}},
+		true,
+		ops.Update,
+		data.Data{"_id": 1, "i": 3, "j": 1},
+	},
+	{
+		"update without lookup",
+		func() changeEvent {
+			e := changeEvent{OperationType: "update", DocumentKey: bson.M{"_id": 1}}
+			e.UpdateDescription.UpdatedFields = bson.M{"i": 3}
+			e.UpdateDescription.RemovedFields = []string{"j"}
+			return e
+		}(),
+		false,
+		ops.Update,
+		data.Data{"_id": 1, "i": 3, "j": nil},
+	},
+	{
+		"delete",
+		changeEvent{OperationType: "delete", DocumentKey: bson.M{"_id": 1}},
+		true,
+		ops.Delete,
+		data.Data{"_id": 1},
+	},
+}
+
+func TestChangeEventMessage(t *testing.T) {
+	for _, ct := range changeEventTests {
+		ct.event.ClusterTime = bson.MongoTimestamp(1600000000<<32 | 1)
+		msg, ok := ct.event.message("foo", ct.lookup)
+		if !ok {
+			t.Errorf("[%s] no message", ct.name)
+			continue
+		}
+		if msg.OP() != ct.op {
+			t.Errorf("[%s] wrong op, expected %s, got %s", ct.name, ct.op, msg.OP())
+		}
+		if !reflect.DeepEqual(msg.Data(), ct.data) {
+			t.Errorf("[%s] wrong data, expected %v, got %v", ct.name, ct.data, msg.Data())
+		}
+		if msg.Timestamp() != 1600000000 {
+			t.Errorf("[%s] wrong timestamp, got %d", ct.name, msg.Timestamp())
+		}
+	}
+
+	// the document of the update was deleted before the lookup
+	if _, ok := (&changeEvent{OperationType: "update", DocumentKey: bson.M{"_id": 1}}).message("foo", true); ok {
+		t.Errorf("unexpected message for an update without document")
+	}
+	if _, ok := (&changeEvent{OperationType: "drop"}).message("foo", true); ok {
+		t.Errorf("unexpected message for a drop")
+	}
+}
+
+func TestChangeStreamPipeline(t *testing.T) {
+	filter := CollectionFilter{"i": map[string]interface{}{"$gt": 10}, "$or": []interface{}{
+		map[string]interface{}{"a": 1},
+		map[string]interface{}{"b": 2},
+	}}
+	expected := []bson.M{{"$match": bson.M{"$or": []interface{}{
+		bson.M{"operationType": bson.M{"$in": []string{"delete", "invalidate"}}},
+		bson.M{
+			"fullDocument.i": map[string]interface{}{"$gt": 10},
+			"$or":            []interface{}{bson.M{"fullDocument.a": 1}, bson.M{"fullDocument.b": 2}},
+		},
+	}}}}
+	if got := changeStreamPipeline(filter, mgo.UpdateLookup); !reflect.DeepEqual(got, expected) {
+		t.Errorf("wrong pipeline, expected %v, got %v", expected, got)
+	}
+	if got := changeStreamPipeline(nil, mgo.UpdateLookup); len(got) != 0 {
+		t.Errorf("unexpected pipeline without filter, got %v", got)
+	}
+}
+
+func TestTokenStore(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "tokens.json")
+	s, err := newTokenStore(path)
+	if err != nil {
+		t.Fatalf("unexpected newTokenStore error, %s", err)
+	}
+	if s.get("foo") != nil {
+		t.Fatalf("unexpected token in empty store")
+	}
+
+	token := func(i int) *bson.Raw {
+		b, _ := bson.Marshal(bson.M{"_data": fmt.Sprintf("token%d", i)})
+		return &bson.Raw{Kind: 0x03, Data: b}
+	}
+	confirms := []chan struct{}{make(chan struct{}), make(chan struct{}), make(chan struct{})}
+	s.track("foo", confirms[0], token(1))
+	s.track("foo", confirms[1], nil)
+	s.track("foo", confirms[2], token(3))
+
+	// tokens are only stored once the messages before them are confirmed
+	close(confirms[0])
+	close(confirms[2])
+	if !s.confirmed() || !reflect.DeepEqual(s.get("foo"), token(1)) {
+		t.Errorf("wrong token, expected %v, got %v", token(1), s.get("foo"))
+	}
+	close(confirms[1])
+	if !s.confirmed() || !reflect.DeepEqual(s.get("foo"), token(3)) {
+		t.Errorf("wrong token, expected %v, got %v", token(3), s.get("foo"))
+	}
+	if s.confirmed() {
+		t.Errorf("unexpected change without confirmations")
+	}
+
+	if err := s.save(); err != nil {
+		t.Fatalf("unexpected save error, %s", err)
+	}
+	s, err = newTokenStore(path)
+	if err != nil {
+		t.Fatalf("unexpected newTokenStore error, %s", err)
+	}
+	if !reflect.DeepEqual(s.get("foo"), token(3)) {
+		t.Errorf("wrong saved token, expected %v, got %v", token(3), s.get("foo"))
+	}
+}
+
+var changeStreamTestData = &TestData{"change_stream_test", "foo", 10}
+
+// TestChangeStreamTail needs mongod running as a single node replica set, started with
+// mongod --replSet rs0 and initiated with rs.initiate()
+func TestChangeStreamTail(t *testing.T) {
+	if testing.Short() {
+		t.Skip("skipping TestChangeStreamTail in short mode")
+	}
+	setupData(changeStreamTestData)
+	coll := defaultSession.mgoSession.DB(changeStreamTestData.DB).C(changeStreamTestData.C)
+
+	tokens, err := newTokenStore(filepath.Join(t.TempDir(), "tokens.json"))
+	if err != nil {
+		t.Fatalf("unexpected newTokenStore error, %s", err)
+	}
+	c, _ := NewClient(WithURI(fmt.Sprintf("mongodb://127.0.0.1:27017/%s", changeStreamTestData.DB)))
+	s, err := c.Connect()
+	if err != nil {
+		t.Fatalf("unable to initialize connection to mongodb, %s", err)
+	}
+	defer s.(*Session).Close()
+
+	var reader client.Reader
+	read := func() (chan client.MessageSet, chan struct{}) {
+		done := make(chan struct{})
+		reader = newChangeStreamReader(true, DefaultCollectionFilter, mgo.UpdateLookup, tokens)
+		msgChan, err := reader.Read(map[string]client.MessageSet{}, filterFunc)(s, done)
+		if err != nil {
+			t.Fatalf("unexpected Read error, %s", err)
+		}
+		return msgChan, done
+	}
+	next := func(msgChan chan client.MessageSet) client.MessageSet {
+		select {
+		case m := <-msgChan:
+			if m.Msg.Confirms() != nil {
+				close(m.Msg.Confirms())
+			}
+			return m
+		case <-time.After(10 * time.Second):
+			t.Fatal("timed out waiting for message")
+		}
+		return client.MessageSet{}
+	}
+
+	msgChan, done := read()
+	for i := 0; i < changeStreamTestData.InsertCount; i++ {
+		next(msgChan)
+	}
+	if err := coll.Insert(bson.M{"_id": 100, "i": 100}); err != nil {
+		t.Fatalf("unexpected Insert error, %s", err)
+	}
+	if m := next(msgChan); m.Msg.OP() != ops.Insert || m.Msg.ID() != "100" {
+		t.Errorf("wrong insert, got %s %s", m.Msg.OP(), m.Msg.ID())
+	}
+	if err := coll.UpdateId(100, bson.M{"$set": bson.M{"j": 1}}); err != nil {
+		t.Fatalf("unexpected Update error, %s", err)
+	}
+	if m := next(msgChan); m.Msg.OP() != ops.Update || m.Msg.Data().Get("i") != 100 {
+		t.Errorf("wrong update, got %s %v", m.Msg.OP(), m.Msg.Data())
+	}
+	time.Sleep(2 * tokenSaveInterval)
+	close(done)
+	for range msgChan {
+	}
+
+	// changes made while stopped are read from the stored token, without copying again
+	if err := coll.RemoveId(100); err != nil {
+		t.Fatalf("unexpected Remove error, %s", err)
+	}
+	msgChan, done = read()
+	defer close(done)
+	if m := next(msgChan); m.Msg.OP() != ops.Delete || m.Msg.ID() != "100" {
+		t.Errorf("wrong delete, got %s %s", m.Msg.OP(), m.Msg.ID())
+	}
+
+	// dropping the collection invalidates the stream, the read stops with an error
+	if err := coll.DropCollection(); err != nil {
+		t.Fatalf("unexpected DropCollection error, %s", err)
+	}
+	timeout := time.After(10 * time.Second)
+	for open := true; open; {
+		select {
+		case _, open = <-msgChan:
+		case <-timeout:
+			t.Fatal("timed out waiting for the read to stop")
+		}
+	}
+	if err := reader.(client.ErrReader).Err(); err == nil {
+		t.Error("expected an error once the stream was invalidated")
+	}
+}
@@ -7,6 +7,7 @@ import (
 
 	adaptor "github.com/appbaseio/abc/importer/adaptor"
 	"github.com/appbaseio/abc/importer/client"
+	"github.com/globalsign/mgo"
 )
 
 const (
@@ -21,7 +22,10 @@ const (
   // "wc": 1,
   // "fsync": false,
   // "bulk": false,
-  // "collection_filters": "{}"
+  // "collection_filters": "{}",
+  // "change_streams": false,
+  // "full_document": "updateLookup",
+  // "resume_token_file": "/path/to/tokens.json"
 }`
 )
 
@@ -30,10 +34,13 @@ var (
 
 	// ErrCollectionFilter is returned when an error occurs attempting to Unmarshal the string.
 	ErrCollectionFilter = errors.New("malformed collection_filters")
+
+	// ErrFullDocument is returned when full_document is neither default nor updateLookup.
+	ErrFullDocument = errors.New("full_document must be default or updateLookup")
 )
 
 // MongoDB is an adaptor to read / write to mongodb.
-// it works as a source by copying files, and then optionally tailing the oplog
+// it works as a source by copying files, and then optionally tailing the oplog or change streams
 type MongoDB struct {
 	adaptor.BaseConfig
 	SSL               bool     `json:"ssl"`
@@ -43,6 +50,9 @@ type MongoDB struct {
 	FSync             bool     `json:"fsync"`
 	Bulk              bool     `json:"bulk"`
 	CollectionFilters string   `json:"collection_filters"`
+	ChangeStreams     bool     `json:"change_streams" doc:"tail with change streams instead of reading the oplog, requires a replica set or a sharded cluster"`
+	FullDocument      string   `json:"full_document" doc:"updateLookup sends the current document on updates, default only sends the changed fields"`
+	ResumeTokenFile   string   `json:"resume_token_file" doc:"file storing the change stream resume token of every collection"`
 }
 
 func init() {
@@ -60,7 +70,7 @@ func (m *MongoDB) Client() (client.Client, error) {
 		WithSSL(m.SSL),
 		WithCACerts(m.CACerts),
 		WithFsync(m.FSync),
-		WithTail(m.Tail),
+		WithTail(m.Tail && !m.ChangeStreams),
 		WithWriteConcern(m.Wc))
 }
 
@@ -71,7 +81,23 @@ func (m *MongoDB) Reader() (client.Reader, error) {
 			return nil, ErrCollectionFilter
 		}
 	}
-	return newReader(m.Tail, f), nil
+	if !m.ChangeStreams {
+		return newReader(m.Tail, f), nil
+	}
+	fullDocument := m.FullDocument
+	if fullDocument == "" {
+		fullDocument = DefaultFullDocument
+	} else if fullDocument != mgo.Default && fullDocument != mgo.UpdateLookup {
+		return nil, ErrFullDocument
+	}
+	var tokens *tokenStore
+	if m.ResumeTokenFile != "" {
+		var err error
+		if tokens, err = newTokenStore(m.ResumeTokenFile); err != nil {
+			return nil, err
+		}
+	}
+	return newChangeStreamReader(m.Tail, f, fullDocument, tokens), nil
 }
 
 func (m *MongoDB) Writer(done chan struct{}, wg *sync.WaitGroup) (client.Writer, error) {
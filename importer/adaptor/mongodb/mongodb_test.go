@@ -66,6 +66,18 @@ var initTests = []struct {
 		&MongoDB{BaseConfig: adaptor.BaseConfig{URI: DefaultURI}, CollectionFilters: `{"foo":{"i":{"$gt":10}}`},
 		nil, ErrCollectionFilter, nil,
 	},
+	{
+		"with change streams",
+		map[string]interface{}{"uri": DefaultURI, "tail": true, "change_streams": true, "full_document": "default"},
+		&MongoDB{BaseConfig: adaptor.BaseConfig{URI: DefaultURI}, Tail: true, ChangeStreams: true, FullDocument: "default"},
+		nil, nil, nil,
+	},
+	{
+		"bad full document",
+		map[string]interface{}{"uri": DefaultURI, "change_streams": true, "full_document": "whenAvailable"},
+		&MongoDB{BaseConfig: adaptor.BaseConfig{URI: DefaultURI}, ChangeStreams: true, FullDocument: "whenAvailable"},
+		nil, ErrFullDocument, nil,
+	},
 }
 
 func TestInit(t *testing.T) {
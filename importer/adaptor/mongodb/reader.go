@@ -18,7 +18,8 @@ import (
 )
 
 var (
-	_ client.Reader = &Reader{}
+	_ client.Reader    = &Reader{}
+	_ client.ErrReader = &Reader{}
 
 	// DefaultCollectionFilter is an empty map of empty maps
 	DefaultCollectionFilter = map[string]CollectionFilter{}
@@ -32,10 +33,32 @@ type Reader struct {
 	tail              bool
 	collectionFilters map[string]CollectionFilter
 	oplogTimeout      time.Duration
+
+	// tail with change streams instead of the oplog
+	changeStreams bool
+	fullDocument  string
+	tokens        *tokenStore
+
+	// err is the error that stopped the read
+	mu  sync.Mutex
+	err error
 }
 
 func newReader(tail bool, filters map[string]CollectionFilter) client.Reader {
-	return &Reader{tail, filters, 5 * time.Second}
+	return &Reader{tail: tail, collectionFilters: filters, oplogTimeout: 5 * time.Second}
+}
+
+// newChangeStreamReader returns a Reader tailing with change streams, the resume tokens are
+// kept in tokens when it is set.
+func newChangeStreamReader(tail bool, filters map[string]CollectionFilter, fullDocument string, tokens *tokenStore) client.Reader {
+	return &Reader{
+		tail:              tail,
+		collectionFilters: filters,
+		oplogTimeout:      5 * time.Second,
+		changeStreams:     true,
+		fullDocument:      fullDocument,
+		tokens:            tokens,
+	}
 }
 
 type resultDoc struct {
@@ -52,6 +75,27 @@ func (r *Reader) Read(resumeMap map[string]client.MessageSet, filterFn client.Ns
 	return func(s client.Session, done chan struct{}) (chan client.MessageSet, error) {
 		out := make(chan client.MessageSet)
 		session := s.(*Session).mgoSession.Copy()
+		// the collections are read until done is closed or one of them fails
+		var (
+			stop     = make(chan struct{})
+			stopOnce sync.Once
+			quit     = make(chan struct{})
+		)
+		fail := func(err error) {
+			r.mu.Lock()
+			if r.err == nil {
+				r.err = err
+			}
+			r.mu.Unlock()
+			stopOnce.Do(func() { close(stop) })
+		}
+		go func() {
+			select {
+			case <-done:
+			case <-stop:
+			}
+			close(quit)
+		}()
 		go func() {
 			defer func() {
 				session.Close()
@@ -61,9 +105,17 @@ func (r *Reader) Read(resumeMap map[string]client.MessageSet, filterFn client.Ns
 			collections, err := r.listCollections(session.Copy(), filterFn)
 			if err != nil {
 				log.With("db", session.DB("").Name).Errorf("unable to list collections, %s", err)
+				fail(fmt.Errorf("unable to list collections, %s", err))
 				return
 			}
 			var wg sync.WaitGroup
+			if r.tail && r.changeStreams && r.tokens != nil {
+				wg.Add(1)
+				go func() {
+					defer wg.Done()
+					r.tokens.run(quit)
+				}()
+			}
 			for _, c := range collections {
 				var lastID interface{}
 				oplogTime := timeAsMongoTimestamp(time.Now())
@@ -73,22 +125,61 @@ func (r *Reader) Read(resumeMap map[string]client.MessageSet, filterFn client.Ns
 					mode = m.Mode
 					oplogTime = timeAsMongoTimestamp(time.Unix(m.Timestamp, 0))
 				}
+				var (
+					copied chan struct{}
+					errc   chan error
+				)
+				if r.tail && r.changeStreams {
+					// the stream is opened before the copy so that no change is missed, a collection
+					// is copied again unless the stream can resume after a stored token
+					token := r.tokens.get(c)
+					if token != nil {
+						mode = commitlog.Sync
+					} else if mode != commitlog.Copy || lastID != nil {
+						log.With("db", session.DB("").Name).With("collection", c).Infoln("no resume token, copying again")
+						mode, lastID = commitlog.Copy, nil
+					}
+					copied = make(chan struct{})
+					errc, err = r.watchCollection(c, session.Copy(), token, copied, out, quit)
+					if err != nil {
+						log.With("db", session.DB("").Name).Errorln(err)
+						fail(err)
+						break
+					}
+					// the stream fails the read even while the collection is copied
+					wg.Add(1)
+					go func(c string, errc chan error) {
+						defer wg.Done()
+						for err := range errc {
+							log.With("db", session.DB("").Name).With("collection", c).Errorln(err)
+							fail(err)
+						}
+					}(c, errc)
+				}
 				if mode == commitlog.Copy {
-					if err := r.iterateCollection(r.iterate(lastID, session.Copy(), c), out, done, int64(oplogTime)>>32); err != nil {
+					if err := r.iterateCollection(r.iterate(lastID, session.Copy(), c), out, quit, int64(oplogTime)>>32); err != nil {
 						log.With("db", session.DB("").Name).Errorln(err)
-						return
+						select {
+						case <-quit:
+							// cancelled
+						default:
+							fail(fmt.Errorf("unable to copy collection %s, %s", c, err))
+						}
+						break
 					}
 					log.With("db", session.DB("").Name).With("collection", c).Infoln("iterating complete")
 				}
-				if r.tail {
+				if copied != nil {
+					close(copied)
+				} else if r.tail {
 					wg.Add(1)
 					log.With("collection", c).Infof("oplog start timestamp: %d", oplogTime)
 					go func(wg *sync.WaitGroup, c string, o bson.MongoTimestamp) {
 						defer wg.Done()
-						errc := r.tailCollection(c, session.Copy(), o, out, done)
+						errc := r.tailCollection(c, session.Copy(), o, out, quit)
 						for err := range errc {
 							log.With("db", session.DB("").Name).With("collection", c).Errorln(err)
-							return
+							fail(err)
 						}
 					}(&wg, c, oplogTime)
 				}
@@ -103,6 +194,13 @@ func (r *Reader) Read(resumeMap map[string]client.MessageSet, filterFn client.Ns
 	}
 }
 
+// Err returns the error that stopped the read, the pipeline fails with it.
+func (r *Reader) Err() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.err
+}
+
 func (r *Reader) listCollections(mgoSession *mgo.Session, filterFn func(name string) bool) ([]string, error) {
 	defer mgoSession.Close()
 	var colls []string
@@ -1,7 +1,9 @@
 package mssql
 
 import (
+	"fmt"
 	"sync"
+	"time"
 
 	adaptor "github.com/appbaseio/abc/importer/adaptor"
 	"github.com/appbaseio/abc/importer/client"
@@ -16,7 +18,11 @@ const (
 	sampleConfig = `{
   "uri": "${MSSQL_URI}"
   // "timeout": "30s", // defaults to 30s
-  // "tail": false // enable tailing
+  // "tail": false, // enable tailing
+  // "poll_interval": "5s", // how often change tracking is read when tailing, defaults to 5s
+  // "id_columns": {"logs": ["host", "ts"]}, // columns used as _id per table, defaults to the primary key
+  // "chunk_size": 10000, // rows read per query when copying a table, defaults to 10000
+  // "concurrency": 1 // number of tables copied at the same time, defaults to 1
 }`
 )
 
@@ -25,7 +31,11 @@ var _ adaptor.Adaptor = &MSSQL{}
 // MSSQL is an adaptor
 type MSSQL struct {
 	adaptor.BaseConfig
-	Tail bool `json:"tail" doc:"if tail is set, database will be watched for changes"`
+	Tail         bool                `json:"tail" doc:"if tail is set, database will be watched for changes"`
+	PollInterval string              `json:"poll_interval" doc:"how often the change tracking tables are read when tailing, defaults to 5s"`
+	IDColumns    map[string][]string `json:"id_columns" doc:"columns used as _id per table, for tables without a primary key, defaults to the primary key"`
+	ChunkSize    int                 `json:"chunk_size" doc:"number of rows read per query when copying a table, defaults to 10000"`
+	Concurrency  int                 `json:"concurrency" doc:"number of tables copied at the same time, defaults to 1"`
 }
 
 func init() {
@@ -44,7 +54,30 @@ func (ms *MSSQL) Client() (client.Client, error) {
 
 // Reader ...
 func (ms *MSSQL) Reader() (client.Reader, error) {
-	return newReader(ms.Tail), nil
+	chunkSize := ms.ChunkSize
+	if chunkSize == 0 {
+		chunkSize = DefaultChunkSize
+	}
+	concurrency := ms.Concurrency
+	if concurrency == 0 {
+		concurrency = 1
+	}
+	if chunkSize < 0 || concurrency < 0 {
+		return nil, fmt.Errorf("chunk_size and concurrency must be positive")
+	}
+	reader := newReader(ms.Tail, ms.IDColumns, chunkSize, concurrency)
+	if ms.Tail {
+		interval := DefaultPollInterval
+		if ms.PollInterval != "" {
+			var err error
+			interval, err = time.ParseDuration(ms.PollInterval)
+			if err != nil || interval <= 0 {
+				return nil, fmt.Errorf("invalid poll_interval %q", ms.PollInterval)
+			}
+		}
+		return newTailer(reader, interval), nil
+	}
+	return reader, nil
 }
 
 // Writer ...
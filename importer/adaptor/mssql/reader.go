@@ -2,26 +2,52 @@ package mssql
 
 import (
 	"database/sql"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
 
 	"github.com/appbaseio/abc/importer/client"
+	"github.com/appbaseio/abc/importer/commitlog"
+	"github.com/appbaseio/abc/importer/function/mapping"
 	"github.com/appbaseio/abc/importer/message"
 	"github.com/appbaseio/abc/importer/message/ops"
 	"github.com/appbaseio/abc/log"
 )
 
-var _ client.Reader = &Reader{}
+const (
+	// DefaultChunkSize is the number of rows read by each query when copying a table.
+	DefaultChunkSize = 10000
+
+	copyRetries = 5
+	retryDelay  = 5 * time.Second
+
+	// defaultSchema holds the tables named without their schema
+	defaultSchema = "dbo"
+)
+
+var (
+	_ client.Reader     = &Reader{}
+	_ mapping.Describer = &Reader{}
+
+	errStopped = errors.New("read stopped")
+)
 
 // Reader fulfills the client.Reader interface for use with both copying and tailing a MSSQL database.
 type Reader struct {
-	tail   bool
-	dbName string
+	tail        bool
+	dbName      string
+	idColumns   map[string][]string
+	chunkSize   int
+	concurrency int
 }
 
-func newReader(tail bool) client.Reader {
-	return &Reader{tail, ""}
+func newReader(tail bool, idColumns map[string][]string, chunkSize, concurrency int) *Reader {
+	return &Reader{tail, "", idColumns, chunkSize, concurrency}
 }
 
-func (r *Reader) Read(_ map[string]client.MessageSet, filterFn client.NsFilterFunc) client.MessageChanFunc {
+func (r *Reader) Read(resumeMap map[string]client.MessageSet, filterFn client.NsFilterFunc) client.MessageChanFunc {
 	return func(s client.Session, done chan struct{}) (chan client.MessageSet, error) {
 		out := make(chan client.MessageSet)
 		r.dbName = s.(*Session).dbName // set database name
@@ -38,8 +64,20 @@ func (r *Reader) Read(_ map[string]client.MessageSet, filterFn client.NsFilterFu
 				log.With("db", r.dbName).Errorf("unable to list tables, %s", err)
 				return
 			}
-			// iterate tables
-			iterationComplete := r.iterateTable(db, tables, out, done)
+			// iterate tables, concurrency of them at a time
+			iterationComplete := make(chan string)
+			var wg sync.WaitGroup
+			for i := 0; i < r.concurrency; i++ {
+				wg.Add(1)
+				go func() {
+					defer wg.Done()
+					r.iterateTable(db, tables, resumeMap, out, iterationComplete, done)
+				}()
+			}
+			go func() {
+				wg.Wait()
+				close(iterationComplete)
+			}()
 			func() {
 				for {
 					select {
@@ -65,7 +103,7 @@ func (r *Reader) Read(_ map[string]client.MessageSet, filterFn client.NsFilterFu
 func (r *Reader) listTables(db *sql.DB, filterFn func(name string) bool) (<-chan string, error) {
 	out := make(chan string)
 	// https://stackoverflow.com/questions/175415/
-	rows, err := db.Query("SELECT table_name FROM INFORMATION_SCHEMA.TABLES WHERE TABLE_TYPE='BASE TABLE'")
+	rows, err := db.Query("SELECT TABLE_SCHEMA, TABLE_NAME FROM INFORMATION_SCHEMA.TABLES WHERE TABLE_TYPE='BASE TABLE'")
 	if err != nil {
 		return nil, err
 	}
@@ -73,12 +111,13 @@ func (r *Reader) listTables(db *sql.DB, filterFn func(name string) bool) (<-chan
 	go func() {
 		defer close(out)
 		defer rows.Close()
-		var table string
+		var schema, name string
 		for rows.Next() {
-			err := rows.Scan(&table)
+			err := rows.Scan(&schema, &name)
 			if err != nil {
 				log.With("db", r.dbName).Errorln(err)
 			}
+			table := tableName(schema, name)
 
 			if filterFn(table) {
 				log.Infof("table %s\n", table)
@@ -93,67 +132,396 @@ func (r *Reader) listTables(db *sql.DB, filterFn func(name string) bool) (<-chan
 	return out, nil
 }
 
-// iterateTable takes care of a table
-func (r *Reader) iterateTable(db *sql.DB, in <-chan string, out chan<- client.MessageSet, done chan struct{}) <-chan string {
-	tableDone := make(chan string)
-	go func() {
-		defer close(tableDone)
-		for {
+// iterateTable copies the tables received on in until it is closed
+func (r *Reader) iterateTable(db *sql.DB, in <-chan string, resumeMap map[string]client.MessageSet, out chan<- client.MessageSet, tableDone chan<- string, done chan struct{}) {
+	for {
+		select {
+		case t, ok := <-in:
+			if !ok {
+				return
+			}
+			log.With("db", r.dbName).With("table", t).Infoln("iterating...")
+			err := r.copyTable(db, t, resumeMap[t], out, done)
+			if err == errStopped {
+				log.With("db", r.dbName).Infoln("Reading table stopped midway")
+				return
+			}
+			if err != nil {
+				log.With("db", r.dbName).With("table", t).Errorf("Error reading rows %s", err)
+				continue
+			}
 			select {
-			case t, ok := <-in:
-				if !ok {
-					return
-				}
-				log.With("db", r.dbName).With("table", t).Infoln("iterating...")
-				// read table
-				rows, err := db.Query("select * from " + t)
-				if err != nil {
-					log.With("db", r.dbName).With("table", t).Errorf("Error reading rows %s", err)
-					return
-				}
-				// get columns
-				columns, err := rows.Columns()
-				if err != nil {
-					log.With("db", r.dbName).With("table", t).Errorf("Error reading columns %s", err)
-					return
-				}
-				colCount := len(columns)
-				// get data
-				for rows.Next() {
-					results := make([]interface{}, colCount)
-					for i := 0; i < colCount; i++ {
-						var temp interface{}
-						results[i] = &temp
-					}
-					err = rows.Scan(results...)
-					if err != nil {
-						log.With("db", r.dbName).With("table", t).Errorf("Error reading row %s", err)
-						return
-					}
-					data := make(map[string]interface{})
-					for i := 0; i < colCount; i++ {
-						data[columns[i]] = *(results[i].(*interface{}))
-					}
-					// send data
-					// log.Infoln(data)
-					out <- client.MessageSet{
-						Msg: message.From(ops.Insert, t, data),
-					}
-					// return early?
-					select {
-					default:
-					case <-done:
-						log.With("db", r.dbName).Infoln("Reading table stopped midway")
-						return
-					}
-				}
-
-				tableDone <- t
+			case tableDone <- t:
 			case <-done:
-				log.With("db", r.dbName).Infoln("iterating no more")
 				return
 			}
+		case <-done:
+			log.With("db", r.dbName).Infoln("iterating no more")
+			return
 		}
-	}()
-	return tableDone
+	}
+}
+
+// copyTable reads a table in chunks ordered by its primary key, starting after the row of the
+// resume message if the table was being copied. Tables without a primary key are read at once.
+func (r *Reader) copyTable(db *sql.DB, t string, resume client.MessageSet, out chan<- client.MessageSet, done chan struct{}) error {
+	// get column types and primary key
+	cols, err := describeTable(db, t)
+	if err != nil {
+		log.With("db", r.dbName).With("table", t).Errorf("Error reading types %s", err)
+	}
+	// the schema of the table goes first, for the writers to map its columns
+	if len(cols) > 0 {
+		select {
+		case out <- client.MessageSet{Msg: message.From(ops.Command, t, tableSchema(t, cols).Data())}:
+		case <-done:
+			return errStopped
+		}
+	}
+	primary, err := primaryKey(db, t)
+	if err != nil {
+		log.With("db", r.dbName).With("table", t).Errorf("Error reading primary key %s", err)
+	}
+	if len(primary) == 0 {
+		log.With("db", r.dbName).With("table", t).Infoln("table has no primary key, reading it in one query")
+	}
+	last := resumeKey(primary, resume)
+	if last != nil {
+		log.With("db", r.dbName).With("table", t).Infof("resuming copy after key %v", last)
+	}
+
+	failures := 0
+	for {
+		query, args := chunkQuery(t, primary, last, r.chunkSize)
+		n, err := r.copyChunk(db, t, primary, query, args, &last, out, done)
+		if err == errStopped {
+			return err
+		}
+		if err != nil {
+			// rows read before the error were sent, the chunk is read again from the last one
+			failures++
+			if len(primary) == 0 || failures > copyRetries {
+				return err
+			}
+			log.With("db", r.dbName).With("table", t).Errorf("error reading chunk, retrying, %s", err)
+			select {
+			case <-time.After(retryDelay):
+			case <-done:
+				return errStopped
+			}
+			continue
+		}
+		failures = 0
+		if len(primary) == 0 || n < r.chunkSize {
+			return nil
+		}
+	}
+}
+
+// copyChunk sends the rows returned by query and updates last with the primary key of each row.
+func (r *Reader) copyChunk(db *sql.DB, t string, primary []string, query string, args []interface{}, last *[]interface{}, out chan<- client.MessageSet, done chan struct{}) (int, error) {
+	// read table
+	rows, err := db.Query(query, args...)
+	if err != nil {
+		return 0, err
+	}
+	defer rows.Close()
+	// get columns
+	columns, err := rows.Columns()
+	if err != nil {
+		return 0, err
+	}
+	colCount := len(columns)
+	decimals, err := decimalColumns(rows)
+	if err != nil {
+		return 0, err
+	}
+	keys := idKeys(t, columns, primary, r.idColumns)
+	n := 0
+	// get data
+	for rows.Next() {
+		values, err := scanRow(rows, colCount)
+		if err != nil {
+			return n, err
+		}
+		data := make(map[string]interface{})
+		for i := 0; i < colCount; i++ {
+			if decimals[i] {
+				data[columns[i]] = keyValue(values[i])
+				continue
+			}
+			data[columns[i]] = values[i]
+		}
+		if len(primary) > 0 {
+			key := make([]interface{}, len(primary))
+			for i, k := range primary {
+				key[i] = keyValue(data[k])
+			}
+			*last = key
+		}
+		setID(keys, data)
+		// send data
+		// log.Infoln(data)
+		select {
+		case out <- client.MessageSet{
+			Msg: message.From(ops.Insert, t, data),
+		}:
+		case <-done:
+			return n, errStopped
+		}
+		n++
+	}
+	return n, rows.Err()
+}
+
+// resumeKey returns the primary key of the last row copied from a table before a restart.
+func resumeKey(primary []string, resume client.MessageSet) []interface{} {
+	if len(primary) == 0 || resume.Msg == nil || resume.Mode == commitlog.Sync || resume.Msg.OP() != ops.Insert {
+		return nil
+	}
+	data := resume.Msg.Data()
+	key := make([]interface{}, len(primary))
+	for i, k := range primary {
+		v, ok := data[k]
+		if !ok {
+			return nil
+		}
+		key[i] = keyValue(v)
+	}
+	return key
+}
+
+// chunkQuery selects the next chunk of a table ordered by its primary key, after the last key read if any.
+func chunkQuery(table string, primary []string, last []interface{}, chunkSize int) (string, []interface{}) {
+	if len(primary) == 0 {
+		return "SELECT * FROM " + quoteTable(table), nil
+	}
+	query := fmt.Sprintf("SELECT TOP %d * FROM %s", chunkSize, quoteTable(table))
+	var args []interface{}
+	if last != nil {
+		// (a, b) > (x, y) expands to a > x OR (a = x AND b > y)
+		var or []string
+		for i := range primary {
+			var and []string
+			for j := 0; j < i; j++ {
+				and = append(and, quoteIdent(primary[j])+" = ?")
+				args = append(args, last[j])
+			}
+			and = append(and, quoteIdent(primary[i])+" > ?")
+			args = append(args, last[i])
+			or = append(or, "("+strings.Join(and, " AND ")+")")
+		}
+		query += " WHERE " + strings.Join(or, " OR ")
+	}
+	order := make([]string, len(primary))
+	for i, k := range primary {
+		order[i] = quoteIdent(k)
+	}
+	return query + " ORDER BY " + strings.Join(order, ", "), args
+}
+
+// scanRow reads the current row as the values returned by the driver.
+func scanRow(rows *sql.Rows, colCount int) ([]interface{}, error) {
+	values := make([]interface{}, colCount)
+	results := make([]interface{}, colCount)
+	for i := range values {
+		results[i] = &values[i]
+	}
+	if err := rows.Scan(results...); err != nil {
+		return nil, err
+	}
+	return values, nil
+}
+
+// decimalColumns returns which columns of rows hold decimals, the driver returns them as byte
+// slices which are sent as strings to be indexed as numbers.
+func decimalColumns(rows *sql.Rows) ([]bool, error) {
+	colTypes, err := rows.ColumnTypes()
+	if err != nil {
+		return nil, err
+	}
+	decimals := make([]bool, len(colTypes))
+	for i, ct := range colTypes {
+		switch ct.DatabaseTypeName() {
+		case "DECIMAL", "NUMERIC", "MONEY", "SMALLMONEY":
+			decimals[i] = true
+		}
+	}
+	return decimals, nil
+}
+
+// primaryKey gets the primary key columns of a table in their key order.
+func primaryKey(db *sql.DB, table string) ([]string, error) {
+	schema, name := splitTable(table)
+	rows, err := db.Query(`SELECT kcu.COLUMN_NAME
+FROM INFORMATION_SCHEMA.TABLE_CONSTRAINTS tc
+JOIN INFORMATION_SCHEMA.KEY_COLUMN_USAGE kcu
+  ON tc.CONSTRAINT_NAME = kcu.CONSTRAINT_NAME AND tc.TABLE_SCHEMA = kcu.TABLE_SCHEMA AND tc.TABLE_NAME = kcu.TABLE_NAME
+WHERE tc.CONSTRAINT_TYPE = 'PRIMARY KEY' AND tc.TABLE_SCHEMA = ? AND tc.TABLE_NAME = ?
+ORDER BY kcu.ORDINAL_POSITION`, schema, name)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var keys []string
+	for rows.Next() {
+		var key string
+		if err := rows.Scan(&key); err != nil {
+			return nil, err
+		}
+		keys = append(keys, key)
+	}
+	return keys, rows.Err()
+}
+
+// describeTable gets the columns of a table in their ordinal position, with their types like
+// decimal(10,2) or nvarchar(64).
+func describeTable(db *sql.DB, table string) ([]mapping.Column, error) {
+	schema, name := splitTable(table)
+	rows, err := db.Query(`SELECT COLUMN_NAME, DATA_TYPE, CHARACTER_MAXIMUM_LENGTH, NUMERIC_PRECISION, NUMERIC_SCALE
+FROM INFORMATION_SCHEMA.COLUMNS
+WHERE TABLE_SCHEMA = ? AND TABLE_NAME = ?
+ORDER BY ORDINAL_POSITION`, schema, name)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var cols []mapping.Column
+	for rows.Next() {
+		var (
+			name, dataType   string
+			length, prec, sc sql.NullInt64
+		)
+		if err := rows.Scan(&name, &dataType, &length, &prec, &sc); err != nil {
+			return nil, err
+		}
+		cols = append(cols, mapping.Column{Name: name, Type: columnType(dataType, length, prec, sc)})
+	}
+	return cols, rows.Err()
+}
+
+// columnType adds the length of string columns and the precision of decimal and float columns
+// to their type, the length of max columns is -1 and left out.
+func columnType(dataType string, length, prec, scale sql.NullInt64) string {
+	switch strings.ToLower(dataType) {
+	case "char", "varchar", "nchar", "nvarchar":
+		if length.Valid && length.Int64 > 0 {
+			return fmt.Sprintf("%s(%d)", dataType, length.Int64)
+		}
+	case "decimal", "numeric":
+		if prec.Valid {
+			return fmt.Sprintf("%s(%d,%d)", dataType, prec.Int64, scale.Int64)
+		}
+	case "float":
+		if prec.Valid {
+			return fmt.Sprintf("%s(%d)", dataType, prec.Int64)
+		}
+	}
+	return dataType
+}
+
+// tableSchema returns the schema of a table with the columns returned by describeTable.
+func tableSchema(table string, cols []mapping.Column) mapping.Schema {
+	return mapping.Schema{Table: table, Columns: cols}
+}
+
+// Describe returns the schema of the tables passing the filter.
+func (r *Reader) Describe(s client.Session, filterFn client.NsFilterFunc) ([]mapping.Schema, error) {
+	db := s.(*Session).db
+	tables, err := r.listTables(db, filterFn)
+	if err != nil {
+		return nil, err
+	}
+	var schemas []mapping.Schema
+	for t := range tables {
+		// the tables left are drained after an error
+		if err != nil {
+			continue
+		}
+		var cols []mapping.Column
+		if cols, err = describeTable(db, t); err == nil {
+			schemas = append(schemas, tableSchema(t, cols))
+		}
+	}
+	return schemas, err
+}
+
+// idKeys returns the columns used as _id for a table, the configured columns of the table
+// if any or else its primary key.
+func idKeys(table string, columns, primary []string, idColumns map[string][]string) []string {
+	override, ok := idColumns[table]
+	if !ok || len(override) == 0 {
+		return primary
+	}
+	names := make(map[string]bool)
+	for _, c := range columns {
+		names[c] = true
+	}
+	for _, k := range override {
+		if !names[k] {
+			log.With("table", table).Errorf("id column %s does not exist, using the primary key", k)
+			return primary
+		}
+	}
+	return override
+}
+
+// setID uses the key columns of the row as _id, values of composite keys are joined with "_".
+// Rows that already carry an _id column or that miss a key column are left untouched.
+func setID(keys []string, data map[string]interface{}) {
+	if _, ok := data["_id"]; ok || len(keys) == 0 {
+		return
+	}
+	for _, k := range keys {
+		if _, ok := data[k]; !ok {
+			return
+		}
+	}
+	if len(keys) == 1 {
+		data["_id"] = keyValue(data[keys[0]])
+		return
+	}
+	parts := make([]string, len(keys))
+	for i, k := range keys {
+		parts[i] = fmt.Sprintf("%v", keyValue(data[k]))
+	}
+	data["_id"] = strings.Join(parts, "_")
+}
+
+// keyValue converts the byte slices the driver returns for decimal keys to strings.
+func keyValue(v interface{}) interface{} {
+	if b, ok := v.([]byte); ok {
+		return string(b)
+	}
+	return v
+}
+
+// tableName returns the namespace of a table, the tables of other schemas than dbo are
+// named schema.table.
+func tableName(schema, name string) string {
+	if schema == defaultSchema {
+		return name
+	}
+	return schema + "." + name
+}
+
+// splitTable returns the schema and the name of the table of a namespace.
+func splitTable(table string) (string, string) {
+	if i := strings.Index(table, "."); i > 0 {
+		return table[:i], table[i+1:]
+	}
+	return defaultSchema, table
+}
+
+// quoteTable quotes the table of a namespace, with its schema, for use in a query.
+func quoteTable(table string) string {
+	schema, name := splitTable(table)
+	return quoteIdent(schema) + "." + quoteIdent(name)
+}
+
+// quoteIdent quotes a table or column name for use in a query.
+func quoteIdent(name string) string {
+	return "[" + strings.Replace(name, "]", "]]", -1) + "]"
 }
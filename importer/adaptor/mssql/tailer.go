@@ -0,0 +1,427 @@
+package mssql
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/appbaseio/abc/importer/client"
+	"github.com/appbaseio/abc/importer/commitlog"
+	"github.com/appbaseio/abc/importer/message"
+	"github.com/appbaseio/abc/importer/message/ops"
+	"github.com/appbaseio/abc/log"
+)
+
+// DefaultPollInterval is the time waited between two reads of the change tables.
+const DefaultPollInterval = 5 * time.Second
+
+var (
+	_ client.Reader    = &Tailer{}
+	_ client.ErrReader = &Tailer{}
+
+	// ErrChangeTrackingDisabled is returned when change tracking is not enabled for the database.
+	ErrChangeTrackingDisabled = errors.New("tailing requires change tracking to be enabled on the database")
+
+	// ErrTableTrackingDisabled is returned when change tracking was disabled for a tailed table.
+	ErrTableTrackingDisabled = errors.New("change tracking was disabled for the table")
+
+	// errChangesCleanedUp is returned when changes of a table were cleaned up by the retention
+	// period before being read, the table is copied again
+	errChangesCleanedUp = errors.New("changes were cleaned up before being read")
+)
+
+// Tailer copies the tables with a Reader and then polls the change tracking
+// tables of the database to emit every row changed afterwards.
+type Tailer struct {
+	reader    *Reader
+	interval  time.Duration
+	idColumns map[string][]string
+
+	// err is the error that stopped the tailing
+	mu  sync.Mutex
+	err error
+}
+
+func newTailer(reader *Reader, interval time.Duration) client.Reader {
+	return &Tailer{reader: reader, interval: interval, idColumns: reader.idColumns}
+}
+
+// Err returns the error that stopped the tailing, the pipeline fails with it.
+func (t *Tailer) Err() error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.err
+}
+
+// trackedTable holds the change tracking state of a table.
+type trackedTable struct {
+	name string
+	// keys is the primary key, used to join the change table
+	keys []string
+	// idKeys are the columns used as _id
+	idKeys  []string
+	version int64
+	// copyFailures counts the failed copies of the table since the last one that completed
+	copyFailures int
+}
+
+// Read copies the tables and then tails their changes, the change tracking version of every
+// message is sent as its Timestamp so that a restart resumes from the last version processed.
+func (t *Tailer) Read(resumeMap map[string]client.MessageSet, filterFn client.NsFilterFunc) client.MessageChanFunc {
+	return func(s client.Session, done chan struct{}) (chan client.MessageSet, error) {
+		session := s.(*Session)
+		db := session.db
+
+		// changes made during the copy are read again once it completes
+		current, err := currentVersion(db)
+		if err != nil {
+			return nil, err
+		}
+
+		minVersions, err := minValidVersions(db)
+		if err != nil {
+			return nil, err
+		}
+		var tables []*trackedTable
+		copyTables := make(map[string]bool)
+		// copyVersions holds the version sent with the copied rows of each table, the
+		// version before the copy started when resuming an interrupted copy
+		copyVersions := make(map[string]int64)
+		readerResume := make(map[string]client.MessageSet)
+		for name, minVersion := range minVersions {
+			if !filterFn(name) {
+				continue
+			}
+			if !minVersion.Valid {
+				log.With("db", session.dbName).With("table", name).Infoln("change tracking is not enabled for table, changes will not be synced")
+				copyTables[name] = true
+				if m, ok := resumeMap[name]; ok {
+					readerResume[name] = m
+				}
+				continue
+			}
+			keys, err := primaryKey(db, name)
+			if err != nil {
+				return nil, err
+			}
+			columns, err := tableColumns(db, name)
+			if err != nil {
+				return nil, err
+			}
+			tt := &trackedTable{name: name, keys: keys, idKeys: idKeys(name, columns, keys, t.idColumns), version: current}
+			for _, k := range tt.idKeys {
+				if !contains(keys, k) {
+					log.With("db", session.dbName).With("table", name).Infoln("id columns are not part of the primary key, deletes will not be synced")
+					break
+				}
+			}
+			if m, ok := resumeMap[name]; ok && m.Timestamp > 0 {
+				// the last version is read again in case the run stopped midway through its changes
+				if m.Timestamp-1 >= minVersion.Int64 {
+					tt.version = m.Timestamp - 1
+					if m.Mode != commitlog.Sync {
+						// the copy continues after the last row read
+						copyTables[name] = true
+						copyVersions[name] = m.Timestamp
+						readerResume[name] = m
+					}
+				} else {
+					log.With("db", session.dbName).With("table", name).Infoln("changes since the last run were cleaned up, copying table again")
+					copyTables[name] = true
+				}
+			} else {
+				copyTables[name] = true
+			}
+			tables = append(tables, tt)
+		}
+		sort.Slice(tables, func(i, j int) bool { return tables[i].name < tables[j].name })
+
+		copyFilter := func(table string) bool {
+			if !copyTables[table] {
+				log.With("db", session.dbName).With("table", table).Infoln("copy already complete, skipping...")
+				return false
+			}
+			return filterFn(table)
+		}
+		readFunc := t.reader.Read(readerResume, copyFilter)
+		msgChan, err := readFunc(s, done)
+		if err != nil {
+			return nil, err
+		}
+
+		out := make(chan client.MessageSet)
+		go func() {
+			defer close(out)
+			// read until reader done
+			for msg := range msgChan {
+				msg.Timestamp = current
+				if v, ok := copyVersions[msg.Msg.Namespace()]; ok {
+					msg.Timestamp = v
+				}
+				out <- msg
+			}
+			// start tailing
+			log.With("db", session.dbName).Infoln("Listening for changes...")
+			ticker := time.NewTicker(t.interval)
+			defer ticker.Stop()
+			for {
+				select {
+				case <-done:
+					log.With("db", session.dbName).Infoln("tailing stopping...")
+					return
+				case <-ticker.C:
+				}
+				for _, tt := range tables {
+					err := pollChanges(session, tt, out, done)
+					if err == errChangesCleanedUp {
+						log.With("db", session.dbName).With("table", tt.name).Infoln("changes since the last poll were cleaned up, copying table again")
+						if err = t.copyTable(s, tt, out, done); err != nil {
+							// the table is copied again on the next poll
+							tt.copyFailures++
+							if tt.copyFailures >= copyRetries {
+								log.With("db", session.dbName).With("table", tt.name).Errorf("unable to copy table, %s", err)
+								t.mu.Lock()
+								t.err = fmt.Errorf("unable to copy table %s again, %s", tt.name, err)
+								t.mu.Unlock()
+								return
+							}
+						} else {
+							tt.copyFailures = 0
+						}
+					}
+					if err == ErrChangeTrackingDisabled || err == ErrTableTrackingDisabled {
+						log.With("db", session.dbName).With("table", tt.name).Errorf("unable to read changes, %s", err)
+						t.mu.Lock()
+						t.err = fmt.Errorf("unable to read the changes of table %s, %s", tt.name, err)
+						t.mu.Unlock()
+						return
+					}
+					if err != nil {
+						log.With("db", session.dbName).With("table", tt.name).Errorf("error reading changes, %s", err)
+					}
+				}
+			}
+		}()
+
+		return out, nil
+	}
+}
+
+// copyTable copies a table again with the reader, its changes are then read from the version
+// before the copy started.
+func (t *Tailer) copyTable(s client.Session, tt *trackedTable, out chan<- client.MessageSet, done chan struct{}) error {
+	db := s.(*Session).db
+	version, err := currentVersion(db)
+	if err != nil {
+		return err
+	}
+	copied := make(chan client.MessageSet)
+	errc := make(chan error, 1)
+	go func() {
+		defer close(copied)
+		errc <- t.reader.copyTable(db, tt.name, client.MessageSet{}, copied, done)
+	}()
+	for msg := range copied {
+		msg.Timestamp = version
+		select {
+		case out <- msg:
+		case <-done:
+		}
+	}
+	if err := <-errc; err != nil {
+		if err == errStopped {
+			return nil
+		}
+		return err
+	}
+	tt.version = version
+	return nil
+}
+
+func currentVersion(db *sql.DB) (int64, error) {
+	var version sql.NullInt64
+	if err := db.QueryRow("SELECT CHANGE_TRACKING_CURRENT_VERSION()").Scan(&version); err != nil {
+		return 0, err
+	}
+	if !version.Valid {
+		return 0, ErrChangeTrackingDisabled
+	}
+	return version.Int64, nil
+}
+
+// minValidVersions gets the oldest version that changes can be read from for each table,
+// it is NULL for the tables that are not tracked.
+func minValidVersions(db *sql.DB) (map[string]sql.NullInt64, error) {
+	rows, err := db.Query("SELECT SCHEMA_NAME(schema_id), name, CHANGE_TRACKING_MIN_VALID_VERSION(object_id) FROM sys.tables")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	versions := make(map[string]sql.NullInt64)
+	for rows.Next() {
+		var (
+			schema, name string
+			version      sql.NullInt64
+		)
+		if err := rows.Scan(&schema, &name, &version); err != nil {
+			return nil, err
+		}
+		versions[tableName(schema, name)] = version
+	}
+	return versions, rows.Err()
+}
+
+// tableColumns gets the column names of a table.
+func tableColumns(db *sql.DB, table string) ([]string, error) {
+	schema, name := splitTable(table)
+	rows, err := db.Query("SELECT COLUMN_NAME FROM INFORMATION_SCHEMA.COLUMNS WHERE TABLE_SCHEMA = ? AND TABLE_NAME = ? ORDER BY ORDINAL_POSITION", schema, name)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var columns []string
+	for rows.Next() {
+		var column string
+		if err := rows.Scan(&column); err != nil {
+			return nil, err
+		}
+		columns = append(columns, column)
+	}
+	return columns, rows.Err()
+}
+
+func contains(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
+
+// changesQuery selects the rows of table changed after a version together with
+// their current values, the key values of deleted rows are only in the change table.
+func changesQuery(table string, keys []string) string {
+	fields := []string{"CT.SYS_CHANGE_VERSION", "CT.SYS_CHANGE_OPERATION"}
+	on := make([]string, len(keys))
+	for i, k := range keys {
+		fields = append(fields, "CT."+quoteIdent(k))
+		on[i] = "T." + quoteIdent(k) + " = CT." + quoteIdent(k)
+	}
+	fields = append(fields, "T.*")
+	return "SELECT " + strings.Join(fields, ", ") +
+		" FROM CHANGETABLE(CHANGES " + quoteTable(table) + ", ?) AS CT" +
+		" LEFT OUTER JOIN " + quoteTable(table) + " AS T ON " + strings.Join(on, " AND ") +
+		" WHERE CT.SYS_CHANGE_VERSION <= ?" +
+		" ORDER BY CT.SYS_CHANGE_VERSION"
+}
+
+// pollChanges sends the changes of a table made since the last poll.
+func pollChanges(session *Session, tt *trackedTable, out chan<- client.MessageSet, done chan struct{}) error {
+	db := session.db
+	current, err := currentVersion(db)
+	if err != nil {
+		return err
+	}
+	if current <= tt.version {
+		return nil
+	}
+
+	var minVersion sql.NullInt64
+	if err := db.QueryRow("SELECT CHANGE_TRACKING_MIN_VALID_VERSION(OBJECT_ID(?))", quoteTable(tt.name)).Scan(&minVersion); err != nil {
+		return err
+	}
+	if !minVersion.Valid {
+		return ErrTableTrackingDisabled
+	}
+	if tt.version < minVersion.Int64 {
+		return errChangesCleanedUp
+	}
+
+	rows, err := db.Query(changesQuery(tt.name, tt.keys), tt.version, current)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	columns, err := rows.Columns()
+	if err != nil {
+		return err
+	}
+	decimals, err := decimalColumns(rows)
+	if err != nil {
+		return err
+	}
+	meta := 2 + len(tt.keys)
+	rowKeys := make([]int, len(tt.keys))
+	for i, k := range tt.keys {
+		for j, c := range columns[meta:] {
+			if c == k {
+				rowKeys[i] = meta + j
+			}
+		}
+	}
+
+	for rows.Next() {
+		values, err := scanRow(rows, len(columns))
+		if err != nil {
+			return err
+		}
+		version, _ := values[0].(int64)
+		operation, _ := keyValue(values[1]).(string)
+		operation = strings.TrimSpace(operation)
+
+		data := make(map[string]interface{})
+		var op ops.Op
+		switch operation {
+		case "D":
+			op = ops.Delete
+			for i, k := range tt.keys {
+				data[k] = values[2+i]
+			}
+		case "I", "U":
+			op = ops.Update
+			if operation == "I" {
+				op = ops.Insert
+			}
+			if len(rowKeys) > 0 && values[rowKeys[0]] == nil {
+				// deleted since, the next poll reads the delete
+				continue
+			}
+			for i, c := range columns[meta:] {
+				if decimals[meta+i] {
+					data[c] = keyValue(values[meta+i])
+					continue
+				}
+				data[c] = values[meta+i]
+			}
+		default:
+			continue
+		}
+		setID(tt.idKeys, data)
+		if _, ok := data["_id"]; !ok && op == ops.Delete {
+			continue
+		}
+
+		select {
+		case out <- client.MessageSet{
+			Msg:       message.From(op, tt.name, data),
+			Timestamp: version,
+			Mode:      commitlog.Sync,
+		}:
+		case <-done:
+			return nil
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return err
+	}
+	tt.version = current
+	return nil
+}
@@ -0,0 +1,155 @@
+package mssql
+
+import (
+	"database/sql"
+	"reflect"
+	"testing"
+)
+
+var changesQueryTests = []struct {
+	table    string
+	keys     []string
+	expected string
+}{
+	{
+		"users",
+		[]string{"id"},
+		"SELECT CT.SYS_CHANGE_VERSION, CT.SYS_CHANGE_OPERATION, CT.[id], T.* FROM CHANGETABLE(CHANGES [dbo].[users], ?) AS CT" +
+			" LEFT OUTER JOIN [dbo].[users] AS T ON T.[id] = CT.[id] WHERE CT.SYS_CHANGE_VERSION <= ? ORDER BY CT.SYS_CHANGE_VERSION",
+	},
+	{
+		"sales.order]items",
+		[]string{"order_id", "item_id"},
+		"SELECT CT.SYS_CHANGE_VERSION, CT.SYS_CHANGE_OPERATION, CT.[order_id], CT.[item_id], T.* FROM CHANGETABLE(CHANGES [sales].[order]]items], ?) AS CT" +
+			" LEFT OUTER JOIN [sales].[order]]items] AS T ON T.[order_id] = CT.[order_id] AND T.[item_id] = CT.[item_id]" +
+			" WHERE CT.SYS_CHANGE_VERSION <= ? ORDER BY CT.SYS_CHANGE_VERSION",
+	},
+}
+
+func TestChangesQuery(t *testing.T) {
+	for _, ct := range changesQueryTests {
+		if got := changesQuery(ct.table, ct.keys); got != ct.expected {
+			t.Errorf("[%s] wrong query, expected\n%s\ngot\n%s", ct.table, ct.expected, got)
+		}
+	}
+}
+
+var setIDTests = []struct {
+	name     string
+	keys     []string
+	data     map[string]interface{}
+	expected interface{}
+}{
+	{"single", []string{"id"}, map[string]interface{}{"id": int64(1)}, int64(1)},
+	{"decimal", []string{"id"}, map[string]interface{}{"id": []byte("1.50")}, "1.50"},
+	{"composite", []string{"a", "b"}, map[string]interface{}{"a": int64(1), "b": "x"}, "1_x"},
+	{"existing", []string{"id"}, map[string]interface{}{"id": int64(1), "_id": "custom"}, "custom"},
+	{"missing key", []string{"a", "b"}, map[string]interface{}{"a": int64(1)}, nil},
+	{"no key", nil, map[string]interface{}{"name": "a"}, nil},
+}
+
+func TestSetID(t *testing.T) {
+	for _, st := range setIDTests {
+		setID(st.keys, st.data)
+		if !reflect.DeepEqual(st.data["_id"], st.expected) {
+			t.Errorf("[%s] wrong _id, expected %v, got %v", st.name, st.expected, st.data["_id"])
+		}
+	}
+}
+
+var idKeysTests = []struct {
+	name      string
+	primary   []string
+	idColumns map[string][]string
+	expected  []string
+}{
+	{"primary key", []string{"id"}, nil, []string{"id"}},
+	{"override", nil, map[string][]string{"users": {"email"}}, []string{"email"}},
+	{"unknown column", []string{"id"}, map[string][]string{"users": {"missing"}}, []string{"id"}},
+}
+
+func TestIDKeys(t *testing.T) {
+	columns := []string{"id", "email"}
+	for _, it := range idKeysTests {
+		if got := idKeys("users", columns, it.primary, it.idColumns); !reflect.DeepEqual(got, it.expected) {
+			t.Errorf("[%s] wrong keys, expected %v, got %v", it.name, it.expected, got)
+		}
+	}
+}
+
+var chunkQueryTests = []struct {
+	name         string
+	primary      []string
+	last         []interface{}
+	expected     string
+	expectedArgs []interface{}
+}{
+	{"no key", nil, nil, "SELECT * FROM [dbo].[logs]", nil},
+	{"first chunk", []string{"id"}, nil, "SELECT TOP 100 * FROM [dbo].[logs] ORDER BY [id]", nil},
+	{
+		"composite key",
+		[]string{"host", "ts"},
+		[]interface{}{"a", int64(10)},
+		"SELECT TOP 100 * FROM [dbo].[logs] WHERE ([host] > ?) OR ([host] = ? AND [ts] > ?) ORDER BY [host], [ts]",
+		[]interface{}{"a", "a", int64(10)},
+	},
+}
+
+func TestChunkQuery(t *testing.T) {
+	for _, ct := range chunkQueryTests {
+		query, args := chunkQuery("logs", ct.primary, ct.last, 100)
+		if query != ct.expected {
+			t.Errorf("[%s] wrong query, expected\n%s\ngot\n%s", ct.name, ct.expected, query)
+		}
+		if !reflect.DeepEqual(args, ct.expectedArgs) {
+			t.Errorf("[%s] wrong args, expected %v, got %v", ct.name, ct.expectedArgs, args)
+		}
+	}
+}
+
+var columnTypeTests = []struct {
+	dataType string
+	length   sql.NullInt64
+	prec     sql.NullInt64
+	scale    sql.NullInt64
+	expected string
+}{
+	{"nvarchar", sql.NullInt64{Int64: 64, Valid: true}, sql.NullInt64{}, sql.NullInt64{}, "nvarchar(64)"},
+	{"nvarchar", sql.NullInt64{Int64: -1, Valid: true}, sql.NullInt64{}, sql.NullInt64{}, "nvarchar"},
+	{"decimal", sql.NullInt64{}, sql.NullInt64{Int64: 10, Valid: true}, sql.NullInt64{Int64: 2, Valid: true}, "decimal(10,2)"},
+	{"float", sql.NullInt64{}, sql.NullInt64{Int64: 53, Valid: true}, sql.NullInt64{}, "float(53)"},
+	{"int", sql.NullInt64{}, sql.NullInt64{Int64: 10, Valid: true}, sql.NullInt64{Int64: 0, Valid: true}, "int"},
+}
+
+func TestColumnType(t *testing.T) {
+	for _, ct := range columnTypeTests {
+		if got := columnType(ct.dataType, ct.length, ct.prec, ct.scale); got != ct.expected {
+			t.Errorf("wrong type, expected %s, got %s", ct.expected, got)
+		}
+	}
+}
+
+var tableNameTests = []struct {
+	schema   string
+	name     string
+	expected string
+	quoted   string
+}{
+	{"dbo", "users", "users", "[dbo].[users]"},
+	{"sales", "orders", "sales.orders", "[sales].[orders]"},
+}
+
+func TestTableName(t *testing.T) {
+	for _, tt := range tableNameTests {
+		got := tableName(tt.schema, tt.name)
+		if got != tt.expected {
+			t.Errorf("wrong name, expected %s, got %s", tt.expected, got)
+		}
+		if schema, name := splitTable(got); schema != tt.schema || name != tt.name {
+			t.Errorf("[%s] wrong split, got %s and %s", got, schema, name)
+		}
+		if quoted := quoteTable(got); quoted != tt.quoted {
+			t.Errorf("[%s] wrong quoted name, expected %s, got %s", got, tt.quoted, quoted)
+		}
+	}
+}
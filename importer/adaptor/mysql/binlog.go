@@ -0,0 +1,471 @@
+package mysql
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha1"
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/binary"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"time"
+
+	"github.com/go-sql-driver/mysql"
+)
+
+// client capability flags used during the replication handshake,
+// https://dev.mysql.com/doc/internals/en/capability-flags.html
+const (
+	clientLongPassword     uint32 = 0x00000001
+	clientConnectWithDB    uint32 = 0x00000008
+	clientProtocol41       uint32 = 0x00000200
+	clientSSL              uint32 = 0x00000800
+	clientTransactions     uint32 = 0x00002000
+	clientSecureConnection uint32 = 0x00008000
+	clientPluginAuth       uint32 = 0x00080000
+)
+
+const (
+	comQuery      byte = 0x03
+	comBinlogDump byte = 0x12
+
+	maxPacketSize = 1<<24 - 1
+
+	// utf8mb4_general_ci
+	defaultCollation byte = 45
+)
+
+var (
+	// ErrMalformedPacket is returned when the server sends a packet that cannot be decoded.
+	ErrMalformedPacket = errors.New("malformed packet")
+
+	// ErrBinlogEOF is returned when the server ends the binlog stream.
+	ErrBinlogEOF = errors.New("binlog stream ended by server")
+)
+
+// ServerError wraps an ERR packet sent by the server.
+type ServerError struct {
+	Code    uint16
+	Message string
+}
+
+func (e ServerError) Error() string {
+	return fmt.Sprintf("mysql error %d: %s", e.Code, e.Message)
+}
+
+// binlogConn is a bare bones connection speaking the mysql client/server protocol
+// that is able to register itself as a replica and receive binlog events.
+type binlogConn struct {
+	conn net.Conn
+	br   *bufio.Reader
+	seq  byte
+}
+
+// dialBinlog opens a connection to the server described by the go-sql-driver dsn and authenticates.
+func dialBinlog(dsn string, timeout time.Duration) (*binlogConn, error) {
+	cfg, err := mysql.ParseDSN(dsn)
+	if err != nil {
+		return nil, err
+	}
+	network := cfg.Net
+	if network == "" {
+		network = "tcp"
+	}
+	tlsCfg, err := tlsConfig(cfg)
+	if err != nil {
+		return nil, err
+	}
+	conn, err := net.DialTimeout(network, cfg.Addr, timeout)
+	if err != nil {
+		return nil, err
+	}
+	c := &binlogConn{conn: conn, br: bufio.NewReaderSize(conn, 16*1024)}
+	if err := c.handshake(cfg.User, cfg.Passwd, cfg.DBName, tlsCfg, cfg.TLSConfig == "preferred"); err != nil {
+		c.conn.Close()
+		return nil, err
+	}
+	return c, nil
+}
+
+// tlsConfig returns the configuration of the tls dsn parameter, nil without encryption. The
+// configurations registered with mysql.RegisterTLSConfig can not be looked up and are refused.
+func tlsConfig(cfg *mysql.Config) (*tls.Config, error) {
+	switch cfg.TLSConfig {
+	case "", "false":
+		return nil, nil
+	case "true":
+		host, _, err := net.SplitHostPort(cfg.Addr)
+		if err != nil {
+			host = cfg.Addr
+		}
+		return &tls.Config{ServerName: host}, nil
+	case "skip-verify", "preferred":
+		return &tls.Config{InsecureSkipVerify: true}, nil
+	}
+	return nil, fmt.Errorf("unsupported tls config %q for reading the binlog", cfg.TLSConfig)
+}
+
+// Close closes the underlying network connection.
+func (c *binlogConn) Close() error {
+	return c.conn.Close()
+}
+
+func (c *binlogConn) readPacket() ([]byte, error) {
+	var payload []byte
+	for {
+		header := make([]byte, 4)
+		if _, err := io.ReadFull(c.br, header); err != nil {
+			return nil, err
+		}
+		length := int(uint32(header[0]) | uint32(header[1])<<8 | uint32(header[2])<<16)
+		c.seq = header[3] + 1
+		data := make([]byte, length)
+		if _, err := io.ReadFull(c.br, data); err != nil {
+			return nil, err
+		}
+		payload = append(payload, data...)
+		// payloads of exactly 2^24-1 bytes are continued in the next packet
+		if length < maxPacketSize {
+			return payload, nil
+		}
+	}
+}
+
+func (c *binlogConn) writePacket(payload []byte) error {
+	for {
+		length := len(payload)
+		if length > maxPacketSize {
+			length = maxPacketSize
+		}
+		header := []byte{byte(length), byte(length >> 8), byte(length >> 16), c.seq}
+		if _, err := c.conn.Write(append(header, payload[:length]...)); err != nil {
+			return err
+		}
+		c.seq++
+		payload = payload[length:]
+		if length < maxPacketSize {
+			return nil
+		}
+	}
+}
+
+func (c *binlogConn) writeCommand(cmd byte, arg []byte) error {
+	c.seq = 0
+	return c.writePacket(append([]byte{cmd}, arg...))
+}
+
+// handshake authenticates the connection, it is encrypted when tlsCfg is set. Unless optional,
+// servers without tls support are refused.
+func (c *binlogConn) handshake(user, password, dbName string, tlsCfg *tls.Config, optional bool) error {
+	data, err := c.readPacket()
+	if err != nil {
+		return err
+	}
+	if len(data) == 0 {
+		return ErrMalformedPacket
+	}
+	if data[0] == 0xff {
+		return parseErrPacket(data)
+	}
+	if data[0] != 10 {
+		return fmt.Errorf("unsupported handshake protocol version %v", data[0])
+	}
+	// skip server version
+	end := bytes.IndexByte(data[1:], 0x00)
+	if end < 0 {
+		return ErrMalformedPacket
+	}
+	pos := end + 2
+	// connection id
+	pos += 4
+	if len(data) < pos+8+1+2 {
+		return ErrMalformedPacket
+	}
+	scramble := append([]byte{}, data[pos:pos+8]...)
+	pos += 8 + 1
+	capabilities := uint32(binary.LittleEndian.Uint16(data[pos : pos+2]))
+	pos += 2
+	plugin := "mysql_native_password"
+	if len(data) > pos {
+		// charset, status flags, upper capability flags, auth data length and reserved bytes
+		if len(data) < pos+3+2+1+10 {
+			return ErrMalformedPacket
+		}
+		pos += 3
+		capabilities |= uint32(binary.LittleEndian.Uint16(data[pos:pos+2])) << 16
+		pos += 2
+		authDataLen := int(data[pos])
+		pos += 1 + 10
+		if capabilities&clientSecureConnection != 0 {
+			n := authDataLen - 8
+			if n < 13 {
+				n = 13
+			}
+			if len(data) < pos+n {
+				return ErrMalformedPacket
+			}
+			// the last byte of the second part is a NUL terminator
+			scramble = append(scramble, data[pos:pos+n-1]...)
+			pos += n
+		}
+		if capabilities&clientPluginAuth != 0 && pos < len(data) {
+			end := bytes.IndexByte(data[pos:], 0x00)
+			if end < 0 {
+				end = len(data) - pos
+			}
+			plugin = string(data[pos : pos+end])
+		}
+	}
+	if capabilities&clientProtocol41 == 0 {
+		return errors.New("server does not support the 4.1 protocol")
+	}
+	if tlsCfg != nil && capabilities&clientSSL == 0 {
+		if !optional {
+			return errors.New("server does not support tls")
+		}
+		tlsCfg = nil
+	}
+
+	authResp, err := scramblePassword(plugin, scramble, password)
+	if err != nil {
+		return err
+	}
+
+	flags := clientLongPassword | clientProtocol41 | clientTransactions | clientSecureConnection | clientPluginAuth
+	if dbName != "" {
+		flags |= clientConnectWithDB
+	}
+	if tlsCfg != nil {
+		flags |= clientSSL
+	}
+	resp := make([]byte, 32, 128)
+	binary.LittleEndian.PutUint32(resp[0:4], flags)
+	binary.LittleEndian.PutUint32(resp[4:8], maxPacketSize)
+	resp[8] = defaultCollation
+	if tlsCfg != nil {
+		// the ssl request is the start of the response, the rest is sent encrypted
+		if err := c.writePacket(resp); err != nil {
+			return err
+		}
+		conn := tls.Client(c.conn, tlsCfg)
+		if err := conn.Handshake(); err != nil {
+			return err
+		}
+		c.conn = conn
+		c.br = bufio.NewReaderSize(conn, 16*1024)
+	}
+	resp = append(resp, user...)
+	resp = append(resp, 0x00, byte(len(authResp)))
+	resp = append(resp, authResp...)
+	if dbName != "" {
+		resp = append(resp, dbName...)
+		resp = append(resp, 0x00)
+	}
+	resp = append(resp, plugin...)
+	resp = append(resp, 0x00)
+	if err := c.writePacket(resp); err != nil {
+		return err
+	}
+	return c.readAuthResult(plugin, scramble, password)
+}
+
+func (c *binlogConn) readAuthResult(plugin string, scramble []byte, password string) error {
+	for {
+		data, err := c.readPacket()
+		if err != nil {
+			return err
+		}
+		if len(data) == 0 {
+			return ErrMalformedPacket
+		}
+		switch data[0] {
+		case 0x00:
+			return nil
+		case 0xff:
+			return parseErrPacket(data)
+		case 0xfe:
+			// auth switch request
+			end := bytes.IndexByte(data[1:], 0x00)
+			if end < 0 {
+				return ErrMalformedPacket
+			}
+			plugin = string(data[1 : end+1])
+			scramble = bytes.TrimRight(data[end+2:], "\x00")
+			authResp, err := scramblePassword(plugin, scramble, password)
+			if err != nil {
+				return err
+			}
+			if err := c.writePacket(authResp); err != nil {
+				return err
+			}
+		case 0x01:
+			if plugin != "caching_sha2_password" || len(data) < 2 {
+				return ErrMalformedPacket
+			}
+			switch data[1] {
+			case 3:
+				// fast auth succeeded, the OK packet follows
+			case 4:
+				// full authentication, the password is sent as is on an encrypted connection
+				if _, ok := c.conn.(*tls.Conn); ok {
+					if err := c.writePacket(append([]byte(password), 0x00)); err != nil {
+						return err
+					}
+					continue
+				}
+				// and RSA encrypted with the server's key otherwise
+				if err := c.writePacket([]byte{0x02}); err != nil {
+					return err
+				}
+				keyData, err := c.readPacket()
+				if err != nil {
+					return err
+				}
+				if len(keyData) == 0 || keyData[0] != 0x01 {
+					return ErrMalformedPacket
+				}
+				enc, err := encryptPassword(password, scramble, keyData[1:])
+				if err != nil {
+					return err
+				}
+				if err := c.writePacket(enc); err != nil {
+					return err
+				}
+			default:
+				return ErrMalformedPacket
+			}
+		default:
+			return ErrMalformedPacket
+		}
+	}
+}
+
+// exec runs a statement that does not return rows.
+func (c *binlogConn) exec(query string) error {
+	if err := c.writeCommand(comQuery, []byte(query)); err != nil {
+		return err
+	}
+	data, err := c.readPacket()
+	if err != nil {
+		return err
+	}
+	if len(data) > 0 && data[0] == 0xff {
+		return parseErrPacket(data)
+	}
+	if len(data) == 0 || data[0] != 0x00 {
+		return fmt.Errorf("unexpected result for %q", query)
+	}
+	return nil
+}
+
+// dump asks the server to start streaming binlog events from the given position.
+func (c *binlogConn) dump(serverID uint32, pos binlogPosition) error {
+	arg := make([]byte, 10, 10+len(pos.name))
+	binary.LittleEndian.PutUint32(arg[0:4], pos.pos)
+	binary.LittleEndian.PutUint16(arg[4:6], 0)
+	binary.LittleEndian.PutUint32(arg[6:10], serverID)
+	arg = append(arg, pos.name...)
+	return c.writeCommand(comBinlogDump, arg)
+}
+
+// readEvent returns the raw bytes of the next binlog event, header included.
+func (c *binlogConn) readEvent() ([]byte, error) {
+	data, err := c.readPacket()
+	if err != nil {
+		return nil, err
+	}
+	if len(data) == 0 {
+		return nil, ErrMalformedPacket
+	}
+	switch data[0] {
+	case 0x00:
+		return data[1:], nil
+	case 0xff:
+		return nil, parseErrPacket(data)
+	case 0xfe:
+		if len(data) < 9 {
+			return nil, ErrBinlogEOF
+		}
+	}
+	return nil, ErrMalformedPacket
+}
+
+func parseErrPacket(data []byte) error {
+	if len(data) < 3 {
+		return ErrMalformedPacket
+	}
+	e := ServerError{Code: binary.LittleEndian.Uint16(data[1:3])}
+	msg := data[3:]
+	// skip the sql state marker and state
+	if len(msg) > 0 && msg[0] == '#' && len(msg) >= 6 {
+		msg = msg[6:]
+	}
+	e.Message = string(msg)
+	return e
+}
+
+func scramblePassword(plugin string, scramble []byte, password string) ([]byte, error) {
+	if password == "" {
+		return []byte{}, nil
+	}
+	switch plugin {
+	case "mysql_native_password":
+		// SHA1(password) XOR SHA1(scramble + SHA1(SHA1(password)))
+		if len(scramble) > 20 {
+			scramble = scramble[:20]
+		}
+		h := sha1.Sum([]byte(password))
+		hh := sha1.Sum(h[:])
+		s := sha1.New()
+		s.Write(scramble)
+		s.Write(hh[:])
+		r := s.Sum(nil)
+		for i := range r {
+			r[i] ^= h[i]
+		}
+		return r, nil
+	case "caching_sha2_password":
+		// SHA256(password) XOR SHA256(SHA256(SHA256(password)) + scramble)
+		h := sha256.Sum256([]byte(password))
+		hh := sha256.Sum256(h[:])
+		s := sha256.New()
+		s.Write(hh[:])
+		s.Write(scramble)
+		r := s.Sum(nil)
+		for i := range r {
+			r[i] ^= h[i]
+		}
+		return r, nil
+	}
+	return nil, fmt.Errorf("unsupported authentication plugin %s", plugin)
+}
+
+func encryptPassword(password string, scramble, keyPEM []byte) ([]byte, error) {
+	block, _ := pem.Decode(keyPEM)
+	if block == nil {
+		return nil, errors.New("invalid server public key")
+	}
+	key, err := x509.ParsePKIXPublicKey(block.Bytes)
+	if err != nil {
+		return nil, err
+	}
+	rsaKey, ok := key.(*rsa.PublicKey)
+	if !ok {
+		return nil, errors.New("server public key is not an RSA key")
+	}
+	if len(scramble) == 0 {
+		return nil, ErrMalformedPacket
+	}
+	plain := append([]byte(password), 0x00)
+	for i := range plain {
+		plain[i] ^= scramble[i%len(scramble)]
+	}
+	return rsa.EncryptOAEP(sha1.New(), rand.Reader, rsaKey, plain, nil)
+}
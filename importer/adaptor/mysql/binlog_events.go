@@ -0,0 +1,924 @@
+package mysql
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// binlog event types this package understands,
+// https://dev.mysql.com/doc/internals/en/binlog-event-type.html
+const (
+	queryEvent         byte = 2
+	rotateEvent        byte = 4
+	formatDescEvent    byte = 15
+	xidEvent           byte = 16
+	tableMapEvent      byte = 19
+	writeRowsEventV1   byte = 23
+	updateRowsEventV1  byte = 24
+	deleteRowsEventV1  byte = 25
+	heartbeatEvent     byte = 27
+	writeRowsEventV2   byte = 30
+	updateRowsEventV2  byte = 31
+	deleteRowsEventV2  byte = 32
+	eventHeaderLen          = 19
+	binlogChecksumSize      = 4
+)
+
+// column types as written in the TABLE_MAP_EVENT
+const (
+	typeDecimal    byte = 0
+	typeTiny       byte = 1
+	typeShort      byte = 2
+	typeLong       byte = 3
+	typeFloat      byte = 4
+	typeDouble     byte = 5
+	typeNull       byte = 6
+	typeTimestamp  byte = 7
+	typeLongLong   byte = 8
+	typeInt24      byte = 9
+	typeDate       byte = 10
+	typeTime       byte = 11
+	typeDatetime   byte = 12
+	typeYear       byte = 13
+	typeNewDate    byte = 14
+	typeVarchar    byte = 15
+	typeBit        byte = 16
+	typeTimestamp2 byte = 17
+	typeDatetime2  byte = 18
+	typeTime2      byte = 19
+	typeJSON       byte = 245
+	typeNewDecimal byte = 246
+	typeEnum       byte = 247
+	typeSet        byte = 248
+	typeTinyBlob   byte = 249
+	typeMediumBlob byte = 250
+	typeLongBlob   byte = 251
+	typeBlob       byte = 252
+	typeVarString  byte = 253
+	typeString     byte = 254
+	typeGeometry   byte = 255
+)
+
+// binlogPosition identifies a location in the binary log of the server.
+type binlogPosition struct {
+	name string
+	pos  uint32
+}
+
+func (p binlogPosition) String() string {
+	return fmt.Sprintf("%s:%d", p.name, p.pos)
+}
+
+// encode packs the position into an int64 so it can travel as client.MessageSet.Timestamp,
+// the sequence number of the binlog file goes into the upper 32 bits and the offset into the lower.
+func (p binlogPosition) encode() int64 {
+	idx := strings.LastIndex(p.name, ".")
+	seq, err := strconv.ParseInt(p.name[idx+1:], 10, 32)
+	if idx < 0 || err != nil {
+		return 0
+	}
+	return seq<<32 | int64(p.pos)
+}
+
+// decodePosition reverses encode, the base name of the binlog files is needed to rebuild the file name.
+func decodePosition(base string, ts int64) binlogPosition {
+	return binlogPosition{
+		name: fmt.Sprintf("%s.%06d", base, ts>>32),
+		pos:  uint32(ts & math.MaxUint32),
+	}
+}
+
+type eventHeader struct {
+	timestamp uint32
+	eventType byte
+	serverID  uint32
+	size      uint32
+	logPos    uint32
+	flags     uint16
+}
+
+func parseEventHeader(data []byte) (eventHeader, error) {
+	if len(data) < eventHeaderLen {
+		return eventHeader{}, ErrMalformedPacket
+	}
+	return eventHeader{
+		timestamp: binary.LittleEndian.Uint32(data[0:4]),
+		eventType: data[4],
+		serverID:  binary.LittleEndian.Uint32(data[5:9]),
+		size:      binary.LittleEndian.Uint32(data[9:13]),
+		logPos:    binary.LittleEndian.Uint32(data[13:17]),
+		flags:     binary.LittleEndian.Uint16(data[17:19]),
+	}, nil
+}
+
+// parseRotate returns the binlog position announced by a ROTATE_EVENT body.
+func parseRotate(body []byte) (binlogPosition, error) {
+	if len(body) < 8 {
+		return binlogPosition{}, ErrMalformedPacket
+	}
+	return binlogPosition{
+		name: string(body[8:]),
+		pos:  uint32(binary.LittleEndian.Uint64(body[0:8])),
+	}, nil
+}
+
+// parseQuery returns the schema and statement of a QUERY_EVENT body.
+func parseQuery(body []byte) (string, string, error) {
+	if len(body) < 13 {
+		return "", "", ErrMalformedPacket
+	}
+	schemaLen := int(body[8])
+	statusLen := int(binary.LittleEndian.Uint16(body[11:13]))
+	pos := 13 + statusLen
+	if len(body) < pos+schemaLen+1 {
+		return "", "", ErrMalformedPacket
+	}
+	schema := string(body[pos : pos+schemaLen])
+	return schema, string(body[pos+schemaLen+1:]), nil
+}
+
+// tableMap holds the column layout of a table as announced by a TABLE_MAP_EVENT.
+type tableMap struct {
+	id          uint64
+	schema      string
+	table       string
+	columnTypes []byte
+	columnMeta  []uint16
+	// columnNames is only written with binlog_row_metadata=FULL
+	columnNames []string
+}
+
+// optional metadata of the TABLE_MAP_EVENT holding the column names
+const columnNameMeta byte = 4
+
+func parseTableMap(body []byte) (*tableMap, error) {
+	if len(body) < 8 {
+		return nil, ErrMalformedPacket
+	}
+	tm := &tableMap{id: readUint48(body[0:6])}
+	pos := 8
+	schemaLen := int(body[pos])
+	pos++
+	if len(body) < pos+schemaLen+2 {
+		return nil, ErrMalformedPacket
+	}
+	tm.schema = string(body[pos : pos+schemaLen])
+	pos += schemaLen + 1
+	tableLen := int(body[pos])
+	pos++
+	if len(body) < pos+tableLen+1 {
+		return nil, ErrMalformedPacket
+	}
+	tm.table = string(body[pos : pos+tableLen])
+	pos += tableLen + 1
+
+	count, n := readLengthEncodedInt(body[pos:])
+	pos += n
+	if len(body) < pos+int(count) {
+		return nil, ErrMalformedPacket
+	}
+	tm.columnTypes = body[pos : pos+int(count)]
+	pos += int(count)
+
+	metaLen, n := readLengthEncodedInt(body[pos:])
+	pos += n
+	metaEnd := pos + int(metaLen)
+	if len(body) < metaEnd {
+		return nil, ErrMalformedPacket
+	}
+	tm.columnMeta = make([]uint16, count)
+	for i, t := range tm.columnTypes {
+		switch t {
+		case typeFloat, typeDouble, typeBlob, typeGeometry, typeJSON,
+			typeTime2, typeDatetime2, typeTimestamp2:
+			if len(body) < pos+1 {
+				return nil, ErrMalformedPacket
+			}
+			tm.columnMeta[i] = uint16(body[pos])
+			pos++
+		case typeVarchar, typeVarString:
+			if len(body) < pos+2 {
+				return nil, ErrMalformedPacket
+			}
+			tm.columnMeta[i] = binary.LittleEndian.Uint16(body[pos:])
+			pos += 2
+		case typeNewDecimal, typeString, typeEnum, typeSet, typeBit:
+			// first byte is precision/real type/bits, second is scale/length/bytes
+			if len(body) < pos+2 {
+				return nil, ErrMalformedPacket
+			}
+			tm.columnMeta[i] = uint16(body[pos])<<8 | uint16(body[pos+1])
+			pos += 2
+		}
+	}
+
+	// skip the nullable columns bitmap
+	pos = metaEnd + (int(count)+7)/8
+	if len(body) < pos {
+		return nil, ErrMalformedPacket
+	}
+	// the optional metadata is a list of type, length and value
+	for pos < len(body) {
+		metaType := body[pos]
+		pos++
+		length, n := readLengthEncodedInt(body[pos:])
+		pos += n
+		if n == 0 || len(body) < pos+int(length) {
+			return nil, ErrMalformedPacket
+		}
+		value := body[pos : pos+int(length)]
+		pos += int(length)
+		if metaType != columnNameMeta {
+			continue
+		}
+		names := make([]string, 0, count)
+		for len(value) > 0 {
+			nameLen, n := readLengthEncodedInt(value)
+			if len(value) < n+int(nameLen) {
+				return nil, ErrMalformedPacket
+			}
+			names = append(names, string(value[n:n+int(nameLen)]))
+			value = value[n+int(nameLen):]
+		}
+		if len(names) != int(count) {
+			return nil, ErrMalformedPacket
+		}
+		tm.columnNames = names
+	}
+	return tm, nil
+}
+
+// rowsEvent is a decoded WRITE/UPDATE/DELETE_ROWS_EVENT, for updates rows alternates
+// between the before and after image of each row.
+type rowsEvent struct {
+	tableID uint64
+	rows    [][]interface{}
+}
+
+func parseRowsEvent(eventType byte, body []byte, tables map[uint64]*tableMap, tz *time.Location) (*rowsEvent, error) {
+	if len(body) < 8 {
+		return nil, ErrMalformedPacket
+	}
+	ev := &rowsEvent{tableID: readUint48(body[0:6])}
+	pos := 8
+	if eventType >= writeRowsEventV2 {
+		extraLen := int(binary.LittleEndian.Uint16(body[pos:]))
+		pos += extraLen
+	}
+	tm, ok := tables[ev.tableID]
+	if !ok {
+		return nil, fmt.Errorf("no table map for table id %d", ev.tableID)
+	}
+	count, n := readLengthEncodedInt(body[pos:])
+	pos += n
+	bitmapLen := int(count+7) / 8
+	if len(body) < pos+bitmapLen {
+		return nil, ErrMalformedPacket
+	}
+	present := body[pos : pos+bitmapLen]
+	pos += bitmapLen
+	presentAfter := present
+	isUpdate := eventType == updateRowsEventV1 || eventType == updateRowsEventV2
+	if isUpdate {
+		if len(body) < pos+bitmapLen {
+			return nil, ErrMalformedPacket
+		}
+		presentAfter = body[pos : pos+bitmapLen]
+		pos += bitmapLen
+	}
+	for pos < len(body) {
+		row, n, err := decodeRow(body[pos:], tm, present, tz)
+		if err != nil {
+			return nil, err
+		}
+		pos += n
+		ev.rows = append(ev.rows, row)
+		if isUpdate {
+			row, n, err = decodeRow(body[pos:], tm, presentAfter, tz)
+			if err != nil {
+				return nil, err
+			}
+			pos += n
+			ev.rows = append(ev.rows, row)
+		}
+	}
+	return ev, nil
+}
+
+// absentValue marks a column that is not part of a row image, e.g. with binlog_row_image=MINIMAL.
+type absentValue struct{}
+
+// decodeRow decodes a single row image, values are returned in the text form mysql
+// would send them in (as strings), nil for NULL and absentValue for columns not present in the image.
+func decodeRow(data []byte, tm *tableMap, present []byte, tz *time.Location) ([]interface{}, int, error) {
+	row := make([]interface{}, len(tm.columnTypes))
+	presentCount := 0
+	for i := range tm.columnTypes {
+		if bitSet(present, i) {
+			presentCount++
+		}
+	}
+	nullLen := (presentCount + 7) / 8
+	if len(data) < nullLen {
+		return nil, 0, ErrMalformedPacket
+	}
+	nulls := data[:nullLen]
+	pos := nullLen
+	idx := 0
+	for i, t := range tm.columnTypes {
+		if !bitSet(present, i) {
+			row[i] = absentValue{}
+			continue
+		}
+		isNull := bitSet(nulls, idx)
+		idx++
+		if isNull {
+			continue
+		}
+		v, n, err := decodeValue(data[pos:], t, tm.columnMeta[i], tz)
+		if err != nil {
+			return nil, 0, fmt.Errorf("%s.%s column %d: %s", tm.schema, tm.table, i, err)
+		}
+		row[i] = v
+		pos += n
+	}
+	return row, pos, nil
+}
+
+// decodeValue decodes one column value, integers are returned as their raw unsigned
+// bits in a uint64 so that signedness can be applied once the column definition is known.
+func decodeValue(data []byte, t byte, meta uint16, tz *time.Location) (interface{}, int, error) {
+	need := func(n int) error {
+		if len(data) < n {
+			return ErrMalformedPacket
+		}
+		return nil
+	}
+	switch t {
+	case typeTiny:
+		if err := need(1); err != nil {
+			return nil, 0, err
+		}
+		return rawInt{uint64(data[0]), 1}, 1, nil
+	case typeShort:
+		if err := need(2); err != nil {
+			return nil, 0, err
+		}
+		return rawInt{uint64(binary.LittleEndian.Uint16(data)), 2}, 2, nil
+	case typeInt24:
+		if err := need(3); err != nil {
+			return nil, 0, err
+		}
+		return rawInt{uint64(readUint24(data)), 3}, 3, nil
+	case typeLong:
+		if err := need(4); err != nil {
+			return nil, 0, err
+		}
+		return rawInt{uint64(binary.LittleEndian.Uint32(data)), 4}, 4, nil
+	case typeLongLong:
+		if err := need(8); err != nil {
+			return nil, 0, err
+		}
+		return rawInt{binary.LittleEndian.Uint64(data), 8}, 8, nil
+	case typeFloat:
+		if err := need(4); err != nil {
+			return nil, 0, err
+		}
+		f := math.Float32frombits(binary.LittleEndian.Uint32(data))
+		return strconv.FormatFloat(float64(f), 'g', -1, 32), 4, nil
+	case typeDouble:
+		if err := need(8); err != nil {
+			return nil, 0, err
+		}
+		f := math.Float64frombits(binary.LittleEndian.Uint64(data))
+		return strconv.FormatFloat(f, 'g', -1, 64), 8, nil
+	case typeNewDecimal:
+		return decodeDecimal(data, int(meta>>8), int(meta&0xff))
+	case typeYear:
+		if err := need(1); err != nil {
+			return nil, 0, err
+		}
+		if data[0] == 0 {
+			return "0000", 1, nil
+		}
+		return strconv.Itoa(1900 + int(data[0])), 1, nil
+	case typeDate, typeNewDate:
+		if err := need(3); err != nil {
+			return nil, 0, err
+		}
+		v := readUint24(data)
+		return fmt.Sprintf("%04d-%02d-%02d", v>>9, (v>>5)&15, v&31), 3, nil
+	case typeTime:
+		if err := need(3); err != nil {
+			return nil, 0, err
+		}
+		v := int32(readUint24(data)<<8) >> 8
+		sign := ""
+		if v < 0 {
+			sign = "-"
+			v = -v
+		}
+		return fmt.Sprintf("%s%02d:%02d:%02d", sign, v/10000, (v%10000)/100, v%100), 3, nil
+	case typeTime2:
+		return decodeTime2(data, int(meta))
+	case typeDatetime:
+		if err := need(8); err != nil {
+			return nil, 0, err
+		}
+		v := binary.LittleEndian.Uint64(data)
+		date, clock := v/1000000, v%1000000
+		return fmt.Sprintf("%04d-%02d-%02d %02d:%02d:%02d",
+			date/10000, (date%10000)/100, date%100, clock/10000, (clock%10000)/100, clock%100), 8, nil
+	case typeDatetime2:
+		return decodeDatetime2(data, int(meta))
+	case typeTimestamp:
+		if err := need(4); err != nil {
+			return nil, 0, err
+		}
+		return formatTimestamp(int64(binary.LittleEndian.Uint32(data)), 0, 0, tz), 4, nil
+	case typeTimestamp2:
+		fsp := int(meta)
+		n := 4 + (fsp+1)/2
+		if err := need(n); err != nil {
+			return nil, 0, err
+		}
+		sec := int64(binary.BigEndian.Uint32(data))
+		return formatTimestamp(sec, readFraction(data[4:n], fsp), fsp, tz), n, nil
+	case typeVarchar, typeVarString:
+		if meta < 256 {
+			return readPrefixedString(data, 1)
+		}
+		return readPrefixedString(data, 2)
+	case typeString, typeEnum, typeSet:
+		realType, length := byte(meta>>8), int(meta&0xff)
+		if meta >= 256 && realType&0x30 != 0x30 {
+			// lengths above 255 borrow two bits of the type byte
+			length |= int((realType&0x30)^0x30) << 4
+			realType |= 0x30
+		}
+		switch realType {
+		case typeEnum, typeSet:
+			if err := need(length); err != nil {
+				return nil, 0, err
+			}
+			var v uint64
+			for i := length - 1; i >= 0; i-- {
+				v = v<<8 | uint64(data[i])
+			}
+			return rawInt{v, length}, length, nil
+		}
+		if length < 256 {
+			return readPrefixedString(data, 1)
+		}
+		return readPrefixedString(data, 2)
+	case typeBit:
+		nbits := int(meta&0xff)*8 + int(meta>>8)
+		n := (nbits + 7) / 8
+		if err := need(n); err != nil {
+			return nil, 0, err
+		}
+		return string(data[:n]), n, nil
+	case typeBlob, typeGeometry, typeTinyBlob, typeMediumBlob, typeLongBlob:
+		return readPrefixedString(data, int(meta))
+	case typeJSON:
+		s, n, err := readPrefixedString(data, int(meta))
+		if err != nil {
+			return nil, 0, err
+		}
+		str := s.(string)
+		if len(str) == 0 {
+			return "null", n, nil
+		}
+		v, err := decodeJSON([]byte(str))
+		if err != nil {
+			return nil, 0, err
+		}
+		b, err := json.Marshal(v)
+		if err != nil {
+			return nil, 0, err
+		}
+		return string(b), n, nil
+	}
+	return nil, 0, fmt.Errorf("unsupported column type %d", t)
+}
+
+// rawInt is an integer (or enum/set index) whose interpretation depends on the column definition.
+type rawInt struct {
+	bits uint64
+	size int
+}
+
+// text renders the integer in its text form, applying the sign if the column is not unsigned.
+func (i rawInt) text(unsigned bool) string {
+	if unsigned {
+		return strconv.FormatUint(i.bits, 10)
+	}
+	shift := uint(64 - 8*i.size)
+	return strconv.FormatInt(int64(i.bits<<shift)>>shift, 10)
+}
+
+var decimalCompressedBytes = []int{0, 1, 1, 2, 2, 3, 3, 4, 4, 4}
+
+func decodeDecimal(data []byte, precision, scale int) (interface{}, int, error) {
+	const digitsPerInt = 9
+	intg := precision - scale
+	intg0, intg0x := intg/digitsPerInt, intg%digitsPerInt
+	frac0, frac0x := scale/digitsPerInt, scale%digitsPerInt
+	size := intg0*4 + decimalCompressedBytes[intg0x] + frac0*4 + decimalCompressedBytes[frac0x]
+	if len(data) < size || size == 0 {
+		return nil, 0, ErrMalformedPacket
+	}
+	buf := make([]byte, size)
+	copy(buf, data[:size])
+	negative := buf[0]&0x80 == 0
+	buf[0] ^= 0x80
+	if negative {
+		for i := range buf {
+			buf[i] = ^buf[i]
+		}
+	}
+
+	var intPart, fracPart strings.Builder
+	pos := 0
+	if n := decimalCompressedBytes[intg0x]; n > 0 {
+		intPart.WriteString(strconv.FormatUint(readUintBE(buf[pos:pos+n]), 10))
+		pos += n
+	}
+	for i := 0; i < intg0; i++ {
+		fmt.Fprintf(&intPart, "%09d", readUintBE(buf[pos:pos+4]))
+		pos += 4
+	}
+	for i := 0; i < frac0; i++ {
+		fmt.Fprintf(&fracPart, "%09d", readUintBE(buf[pos:pos+4]))
+		pos += 4
+	}
+	if n := decimalCompressedBytes[frac0x]; n > 0 {
+		fmt.Fprintf(&fracPart, "%0*d", frac0x, readUintBE(buf[pos:pos+n]))
+		pos += n
+	}
+
+	s := strings.TrimLeft(intPart.String(), "0")
+	if s == "" {
+		s = "0"
+	}
+	if scale > 0 {
+		s += "." + fracPart.String()
+	}
+	if negative {
+		s = "-" + s
+	}
+	return s, size, nil
+}
+
+// readFraction returns the fractional seconds stored in fsp/2 big endian bytes as microseconds.
+func readFraction(data []byte, fsp int) int {
+	switch fsp {
+	case 1, 2:
+		return int(data[0]) * 10000
+	case 3, 4:
+		return int(binary.BigEndian.Uint16(data)) * 100
+	case 5, 6:
+		return int(readUint24BE(data))
+	}
+	return 0
+}
+
+func formatFraction(micro, fsp int) string {
+	if fsp == 0 {
+		return ""
+	}
+	return fmt.Sprintf(".%0*d", fsp, micro/int(math.Pow10(6-fsp)))
+}
+
+func formatTimestamp(sec int64, micro, fsp int, tz *time.Location) string {
+	if sec == 0 && micro == 0 {
+		return "0000-00-00 00:00:00" + formatFraction(0, fsp)
+	}
+	return time.Unix(sec, 0).In(tz).Format("2006-01-02 15:04:05") + formatFraction(micro, fsp)
+}
+
+func decodeDatetime2(data []byte, fsp int) (interface{}, int, error) {
+	n := 5 + (fsp+1)/2
+	if len(data) < n {
+		return nil, 0, ErrMalformedPacket
+	}
+	v := int64(readUintBE(data[:5])) - 0x8000000000
+	if v < 0 {
+		v = -v
+	}
+	ymdhms := v
+	ymd := ymdhms >> 17
+	ym := ymd >> 5
+	hms := ymdhms % (1 << 17)
+	s := fmt.Sprintf("%04d-%02d-%02d %02d:%02d:%02d",
+		ym/13, ym%13, ymd%(1<<5), hms>>12, (hms>>6)%(1<<6), hms%(1<<6))
+	return s + formatFraction(readFraction(data[5:n], fsp), fsp), n, nil
+}
+
+func decodeTime2(data []byte, fsp int) (interface{}, int, error) {
+	n := 3 + (fsp+1)/2
+	if len(data) < n {
+		return nil, 0, ErrMalformedPacket
+	}
+	var tmp int64
+	switch fsp {
+	case 1, 2:
+		intPart := int64(readUint24BE(data)) - 0x800000
+		frac := int64(data[3])
+		if intPart < 0 && frac > 0 {
+			intPart++
+			frac -= 0x100
+		}
+		tmp = intPart<<24 + frac*10000
+	case 3, 4:
+		intPart := int64(readUint24BE(data)) - 0x800000
+		frac := int64(binary.BigEndian.Uint16(data[3:]))
+		if intPart < 0 && frac > 0 {
+			intPart++
+			frac -= 0x10000
+		}
+		tmp = intPart<<24 + frac*100
+	case 5, 6:
+		tmp = int64(readUintBE(data[:6])) - 0x800000000000
+	default:
+		tmp = (int64(readUint24BE(data)) - 0x800000) << 24
+	}
+	sign := ""
+	if tmp < 0 {
+		tmp = -tmp
+		sign = "-"
+	}
+	hms := tmp >> 24
+	micro := int(tmp % (1 << 24))
+	s := fmt.Sprintf("%s%02d:%02d:%02d", sign, (hms>>12)%(1<<10), (hms>>6)%(1<<6), hms%(1<<6))
+	return s + formatFraction(micro, fsp), n, nil
+}
+
+func readPrefixedString(data []byte, lenBytes int) (interface{}, int, error) {
+	if lenBytes < 1 || lenBytes > 4 || len(data) < lenBytes {
+		return nil, 0, ErrMalformedPacket
+	}
+	var length int
+	for i := lenBytes - 1; i >= 0; i-- {
+		length = length<<8 | int(data[i])
+	}
+	if len(data) < lenBytes+length {
+		return nil, 0, ErrMalformedPacket
+	}
+	return string(data[lenBytes : lenBytes+length]), lenBytes + length, nil
+}
+
+// binary JSON value types, https://dev.mysql.com/worklog/task/?id=8132
+const (
+	jsonSmallObject byte = 0x00
+	jsonLargeObject byte = 0x01
+	jsonSmallArray  byte = 0x02
+	jsonLargeArray  byte = 0x03
+	jsonLiteral     byte = 0x04
+	jsonInt16       byte = 0x05
+	jsonUint16      byte = 0x06
+	jsonInt32       byte = 0x07
+	jsonUint32      byte = 0x08
+	jsonInt64       byte = 0x09
+	jsonUint64      byte = 0x0a
+	jsonDouble      byte = 0x0b
+	jsonString      byte = 0x0c
+	jsonOpaque      byte = 0x0f
+)
+
+// decodeJSON converts the binary JSON representation used by mysql into plain go values.
+func decodeJSON(data []byte) (interface{}, error) {
+	if len(data) < 1 {
+		return nil, ErrMalformedPacket
+	}
+	return decodeJSONValue(data[0], data[1:])
+}
+
+func decodeJSONValue(t byte, data []byte) (interface{}, error) {
+	switch t {
+	case jsonSmallObject:
+		return decodeJSONComposite(data, false, true)
+	case jsonLargeObject:
+		return decodeJSONComposite(data, true, true)
+	case jsonSmallArray:
+		return decodeJSONComposite(data, false, false)
+	case jsonLargeArray:
+		return decodeJSONComposite(data, true, false)
+	case jsonLiteral:
+		if len(data) < 1 {
+			return nil, ErrMalformedPacket
+		}
+		switch data[0] {
+		case 0x01:
+			return true, nil
+		case 0x02:
+			return false, nil
+		}
+		return nil, nil
+	case jsonInt16:
+		if len(data) < 2 {
+			return nil, ErrMalformedPacket
+		}
+		return int64(int16(binary.LittleEndian.Uint16(data))), nil
+	case jsonUint16:
+		if len(data) < 2 {
+			return nil, ErrMalformedPacket
+		}
+		return uint64(binary.LittleEndian.Uint16(data)), nil
+	case jsonInt32:
+		if len(data) < 4 {
+			return nil, ErrMalformedPacket
+		}
+		return int64(int32(binary.LittleEndian.Uint32(data))), nil
+	case jsonUint32:
+		if len(data) < 4 {
+			return nil, ErrMalformedPacket
+		}
+		return uint64(binary.LittleEndian.Uint32(data)), nil
+	case jsonInt64:
+		if len(data) < 8 {
+			return nil, ErrMalformedPacket
+		}
+		return int64(binary.LittleEndian.Uint64(data)), nil
+	case jsonUint64:
+		if len(data) < 8 {
+			return nil, ErrMalformedPacket
+		}
+		return binary.LittleEndian.Uint64(data), nil
+	case jsonDouble:
+		if len(data) < 8 {
+			return nil, ErrMalformedPacket
+		}
+		return math.Float64frombits(binary.LittleEndian.Uint64(data)), nil
+	case jsonString:
+		length, n, err := readJSONVarLen(data)
+		if err != nil {
+			return nil, err
+		}
+		if len(data) < n+length {
+			return nil, ErrMalformedPacket
+		}
+		return string(data[n : n+length]), nil
+	case jsonOpaque:
+		if len(data) < 1 {
+			return nil, ErrMalformedPacket
+		}
+		length, n, err := readJSONVarLen(data[1:])
+		if err != nil {
+			return nil, err
+		}
+		if len(data) < 1+n+length {
+			return nil, ErrMalformedPacket
+		}
+		return string(data[1+n : 1+n+length]), nil
+	}
+	return nil, fmt.Errorf("unknown json type %d", t)
+}
+
+func decodeJSONComposite(data []byte, large, isObject bool) (interface{}, error) {
+	offsetSize := 2
+	if large {
+		offsetSize = 4
+	}
+	readOffset := func(b []byte) int {
+		if large {
+			return int(binary.LittleEndian.Uint32(b))
+		}
+		return int(binary.LittleEndian.Uint16(b))
+	}
+	if len(data) < 2*offsetSize {
+		return nil, ErrMalformedPacket
+	}
+	count := readOffset(data)
+	size := readOffset(data[offsetSize:])
+	if len(data) < size {
+		return nil, ErrMalformedPacket
+	}
+	pos := 2 * offsetSize
+
+	keys := make([]string, count)
+	if isObject {
+		for i := 0; i < count; i++ {
+			if len(data) < pos+offsetSize+2 {
+				return nil, ErrMalformedPacket
+			}
+			keyOffset := readOffset(data[pos:])
+			keyLen := int(binary.LittleEndian.Uint16(data[pos+offsetSize:]))
+			pos += offsetSize + 2
+			if len(data) < keyOffset+keyLen {
+				return nil, ErrMalformedPacket
+			}
+			keys[i] = string(data[keyOffset : keyOffset+keyLen])
+		}
+	}
+
+	values := make([]interface{}, count)
+	for i := 0; i < count; i++ {
+		if len(data) < pos+1+offsetSize {
+			return nil, ErrMalformedPacket
+		}
+		t := data[pos]
+		var (
+			v   interface{}
+			err error
+		)
+		if jsonInlined(t, large) {
+			v, err = decodeJSONValue(t, data[pos+1:pos+1+offsetSize])
+		} else {
+			valueOffset := readOffset(data[pos+1:])
+			if len(data) < valueOffset {
+				return nil, ErrMalformedPacket
+			}
+			v, err = decodeJSONValue(t, data[valueOffset:size])
+		}
+		if err != nil {
+			return nil, err
+		}
+		values[i] = v
+		pos += 1 + offsetSize
+	}
+
+	if !isObject {
+		return values, nil
+	}
+	m := make(map[string]interface{}, count)
+	for i, k := range keys {
+		m[k] = values[i]
+	}
+	return m, nil
+}
+
+func jsonInlined(t byte, large bool) bool {
+	switch t {
+	case jsonLiteral, jsonInt16, jsonUint16:
+		return true
+	case jsonInt32, jsonUint32:
+		return large
+	}
+	return false
+}
+
+func readJSONVarLen(data []byte) (int, int, error) {
+	var length int
+	for i := 0; i < 5 && i < len(data); i++ {
+		length |= int(data[i]&0x7f) << uint(7*i)
+		if data[i]&0x80 == 0 {
+			return length, i + 1, nil
+		}
+	}
+	return 0, 0, ErrMalformedPacket
+}
+
+func readLengthEncodedInt(data []byte) (uint64, int) {
+	if len(data) == 0 {
+		return 0, 0
+	}
+	switch data[0] {
+	case 0xfc:
+		if len(data) < 3 {
+			return 0, len(data)
+		}
+		return uint64(binary.LittleEndian.Uint16(data[1:])), 3
+	case 0xfd:
+		if len(data) < 4 {
+			return 0, len(data)
+		}
+		return uint64(readUint24(data[1:])), 4
+	case 0xfe:
+		if len(data) < 9 {
+			return 0, len(data)
+		}
+		return binary.LittleEndian.Uint64(data[1:]), 9
+	}
+	return uint64(data[0]), 1
+}
+
+func readUint24(data []byte) uint32 {
+	return uint32(data[0]) | uint32(data[1])<<8 | uint32(data[2])<<16
+}
+
+func readUint24BE(data []byte) uint32 {
+	return uint32(data[2]) | uint32(data[1])<<8 | uint32(data[0])<<16
+}
+
+func readUint48(data []byte) uint64 {
+	return uint64(data[0]) | uint64(data[1])<<8 | uint64(data[2])<<16 |
+		uint64(data[3])<<24 | uint64(data[4])<<32 | uint64(data[5])<<40
+}
+
+func readUintBE(data []byte) uint64 {
+	var v uint64
+	for _, b := range data {
+		v = v<<8 | uint64(b)
+	}
+	return v
+}
+
+func bitSet(bitmap []byte, i int) bool {
+	return bitmap[i/8]&(1<<uint(i%8)) != 0
+}
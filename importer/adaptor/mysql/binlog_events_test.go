@@ -0,0 +1,328 @@
+package mysql
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/appbaseio/abc/importer/client"
+	"github.com/appbaseio/abc/importer/message/ops"
+)
+
+var decodeValueTests = []struct {
+	name     string
+	data     []byte
+	colType  byte
+	meta     uint16
+	expected interface{}
+	size     int
+}{
+	{"tiny", []byte{0xff}, typeTiny, 0, rawInt{0xff, 1}, 1},
+	{"long", []byte{0x2a, 0x00, 0x00, 0x00}, typeLong, 0, rawInt{42, 4}, 4},
+	{"double", []byte{0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0xf8, 0x3f}, typeDouble, 8, "1.5", 8},
+	{"decimal", []byte{0x80, 0x00, 0x04, 0xd2, 0x38}, typeNewDecimal, 10<<8 | 2, "1234.56", 5},
+	{"negative decimal", []byte{0x7f, 0xff, 0xfb, 0x2d, 0xc7}, typeNewDecimal, 10<<8 | 2, "-1234.56", 5},
+	{"year", []byte{121}, typeYear, 0, "2021", 1},
+	{"date", []byte{0xc4, 0xca, 0x0f}, typeDate, 0, "2021-06-04", 3},
+	{"datetime2", []byte{0x99, 0xa9, 0x08, 0x51, 0x87}, typeDatetime2, 0, "2021-03-04 05:06:07", 5},
+	{"datetime2 fsp", []byte{0x99, 0xa9, 0x08, 0x51, 0x87, 0x04, 0xce}, typeDatetime2, 3, "2021-03-04 05:06:07.123", 7},
+	{"varchar", []byte{0x05, 'h', 'e', 'l', 'l', 'o'}, typeVarchar, 20, "hello", 6},
+	{"long varchar", []byte{0x02, 0x00, 'h', 'i'}, typeVarchar, 300, "hi", 4},
+	{"char", []byte{0x02, 'h', 'i'}, typeString, uint16(typeString)<<8 | 10, "hi", 3},
+	{"enum", []byte{0x02}, typeString, uint16(typeEnum)<<8 | 1, rawInt{2, 1}, 1},
+	{"blob", []byte{0x03, 0x00, 'a', 'b', 'c'}, typeBlob, 2, "abc", 5},
+	{"json", []byte{0x0d, 0x00, 0x01, 0x00, 0x0c, 0x00, 0x0b, 0x00, 0x01, 0x00, 0x05, 0x01, 0x00, 0x61}, typeJSON, 1, `{"a":1}`, 14},
+}
+
+func TestDecodeValue(t *testing.T) {
+	for _, dt := range decodeValueTests {
+		v, n, err := decodeValue(dt.data, dt.colType, dt.meta, time.UTC)
+		if err != nil {
+			t.Errorf("[%s] unexpected error, %s", dt.name, err)
+			continue
+		}
+		if !reflect.DeepEqual(v, dt.expected) {
+			t.Errorf("[%s] wrong value, expected %v, got %v", dt.name, dt.expected, v)
+		}
+		if n != dt.size {
+			t.Errorf("[%s] wrong size, expected %d, got %d", dt.name, dt.size, n)
+		}
+	}
+}
+
+func TestDecodeJSON(t *testing.T) {
+	data := []byte{
+		0x00,                   // small object
+		0x02, 0x00, 0x17, 0x00, // count, size
+		0x12, 0x00, 0x01, 0x00, // key "a"
+		0x13, 0x00, 0x01, 0x00, // key "b"
+		0x05, 0x01, 0x00, // inlined int16 1
+		0x0c, 0x14, 0x00, // string at offset 20
+		'a', 'b',
+		0x02, 'x', 'y',
+	}
+	v, err := decodeJSON(data)
+	if err != nil {
+		t.Fatalf("unexpected decodeJSON error, %s", err)
+	}
+	expected := map[string]interface{}{"a": int64(1), "b": "xy"}
+	if !reflect.DeepEqual(v, expected) {
+		t.Errorf("wrong json, expected %v, got %v", expected, v)
+	}
+}
+
+func TestRowsEvent(t *testing.T) {
+	tm, err := parseTableMap([]byte{
+		0x01, 0x00, 0x00, 0x00, 0x00, 0x00, // table id
+		0x01, 0x00, // flags
+		0x04, 't', 'e', 's', 't', 0x00,
+		0x03, 'f', 'o', 'o', 0x00,
+		0x02,       // column count
+		0x03, 0x0f, // int, varchar
+		0x02,       // metadata length
+		0x14, 0x00, // varchar(20)
+		0x02, // nullable columns
+	})
+	if err != nil {
+		t.Fatalf("unexpected parseTableMap error, %s", err)
+	}
+	if tm.schema != "test" || tm.table != "foo" {
+		t.Errorf("wrong table, expected test.foo, got %s.%s", tm.schema, tm.table)
+	}
+
+	ev, err := parseRowsEvent(writeRowsEventV2, []byte{
+		0x01, 0x00, 0x00, 0x00, 0x00, 0x00, // table id
+		0x00, 0x00, // flags
+		0x02, 0x00, // extra data length
+		0x02, // column count
+		0x03, // columns present
+		0x00, 0x2a, 0x00, 0x00, 0x00, 0x05, 'h', 'e', 'l', 'l', 'o',
+		0x02, 0x07, 0x00, 0x00, 0x00,
+	}, map[uint64]*tableMap{tm.id: tm}, time.UTC)
+	if err != nil {
+		t.Fatalf("unexpected parseRowsEvent error, %s", err)
+	}
+	expected := [][]interface{}{
+		{rawInt{42, 4}, "hello"},
+		{rawInt{7, 4}, nil},
+	}
+	if !reflect.DeepEqual(ev.rows, expected) {
+		t.Errorf("wrong rows, expected %v, got %v", expected, ev.rows)
+	}
+
+	// binlog_row_image=MINIMAL only logs the primary key of deleted rows
+	ev, err = parseRowsEvent(deleteRowsEventV2, []byte{
+		0x01, 0x00, 0x00, 0x00, 0x00, 0x00,
+		0x00, 0x00,
+		0x02, 0x00,
+		0x02,
+		0x01,
+		0x00, 0x2a, 0x00, 0x00, 0x00,
+	}, map[uint64]*tableMap{tm.id: tm}, time.UTC)
+	if err != nil {
+		t.Fatalf("unexpected parseRowsEvent error, %s", err)
+	}
+	expected = [][]interface{}{{rawInt{42, 4}, absentValue{}}}
+	if !reflect.DeepEqual(ev.rows, expected) {
+		t.Errorf("wrong rows, expected %v, got %v", expected, ev.rows)
+	}
+}
+
+func TestHandleUpdateRows(t *testing.T) {
+	tm, err := parseTableMap([]byte{
+		0x01, 0x00, 0x00, 0x00, 0x00, 0x00,
+		0x01, 0x00,
+		0x04, 't', 'e', 's', 't', 0x00,
+		0x03, 'f', 'o', 'o', 0x00,
+		0x02,
+		0x03, 0x0f,
+		0x02,
+		0x14, 0x00,
+		0x02,
+	})
+	if err != nil {
+		t.Fatalf("unexpected parseTableMap error, %s", err)
+	}
+	st := &binlogStream{
+		tailer:   &Tailer{},
+		session:  &Session{dbName: "test"},
+		filterFn: func(string) bool { return true },
+		columns: map[string][]column{
+			"foo": {{name: "id", colType: "int(11)", primary: true}, {name: "name", colType: "varchar(20)"}},
+		},
+	}
+	out := make(chan client.MessageSet, 3)
+	err = st.handleRows(updateRowsEventV2, []byte{
+		0x01, 0x00, 0x00, 0x00, 0x00, 0x00, // table id
+		0x00, 0x00, // flags
+		0x02, 0x00, // extra data length
+		0x02,       // column count
+		0x03, 0x03, // columns present before and after
+		0x00, 0x2a, 0x00, 0x00, 0x00, 0x01, 'a', // the key changes from 42
+		0x00, 0x2b, 0x00, 0x00, 0x00, 0x01, 'a', // to 43
+		0x00, 0x07, 0x00, 0x00, 0x00, 0x01, 'b',
+		0x00, 0x07, 0x00, 0x00, 0x00, 0x01, 'c',
+	}, map[uint64]*tableMap{tm.id: tm}, out, make(chan struct{}))
+	if err != nil {
+		t.Fatalf("unexpected handleRows error, %s", err)
+	}
+	close(out)
+	expected := []struct {
+		op ops.Op
+		id string
+	}{
+		{ops.Delete, "42"},
+		{ops.Insert, "43"},
+		{ops.Update, "7"},
+	}
+	var i int
+	for ms := range out {
+		if i >= len(expected) {
+			t.Fatalf("unexpected message, %+v", ms.Msg)
+		}
+		if ms.Msg.OP() != expected[i].op || ms.Msg.ID() != expected[i].id {
+			t.Errorf("wrong message %d, expected %s %s, got %s %s", i, expected[i].op, expected[i].id, ms.Msg.OP(), ms.Msg.ID())
+		}
+		i++
+	}
+	if i != len(expected) {
+		t.Errorf("wrong number of messages, expected %d, got %d", len(expected), i)
+	}
+}
+
+func TestTableMapColumnNames(t *testing.T) {
+	tm, err := parseTableMap([]byte{
+		0x01, 0x00, 0x00, 0x00, 0x00, 0x00, // table id
+		0x01, 0x00, // flags
+		0x04, 't', 'e', 's', 't', 0x00,
+		0x03, 'f', 'o', 'o', 0x00,
+		0x02,       // column count
+		0x03, 0x0f, // int, varchar
+		0x02,       // metadata length
+		0x14, 0x00, // varchar(20)
+		0x02,             // nullable columns
+		0x01, 0x01, 0x00, // signedness
+		0x04, 0x08, 0x02, 'i', 'd', 0x04, 'n', 'a', 'm', 'e', // column names
+	})
+	if err != nil {
+		t.Fatalf("unexpected parseTableMap error, %s", err)
+	}
+	if expected := []string{"id", "name"}; !reflect.DeepEqual(tm.columnNames, expected) {
+		t.Errorf("wrong column names, expected %v, got %v", expected, tm.columnNames)
+	}
+}
+
+var matchColumnsTests = []struct {
+	name     string
+	names    []string
+	cols     []column
+	expected []string
+	err      bool
+}{
+	{"by position", nil, []column{{name: "id", colType: "int(11)"}, {name: "name", colType: "varchar(20)"}}, []string{"id", "name"}, false},
+	{"added column", nil, []column{{name: "id", colType: "int(11)"}, {name: "name", colType: "varchar(20)"}, {name: "age", colType: "int(11)"}}, nil, true},
+	{"reordered columns", nil, []column{{name: "name", colType: "varchar(20)"}, {name: "id", colType: "int(11)"}}, nil, true},
+	{"retyped column", nil, []column{{name: "id", colType: "bigint(20)"}, {name: "name", colType: "varchar(20)"}}, nil, true},
+	{"by name", []string{"id", "name"}, []column{{name: "name", colType: "varchar(20)"}, {name: "age", colType: "int(11)"}, {name: "id", colType: "int unsigned"}}, []string{"id", "name"}, false},
+	{"renamed column", []string{"id", "name"}, []column{{name: "id", colType: "int(11)"}, {name: "full_name", colType: "varchar(20)"}}, nil, true},
+}
+
+func TestMatchColumns(t *testing.T) {
+	for _, mt := range matchColumnsTests {
+		tm := &tableMap{
+			table:       "foo",
+			columnTypes: []byte{typeLong, typeVarchar},
+			columnMeta:  []uint16{0, 20},
+			columnNames: mt.names,
+		}
+		cols, err := matchColumns(tm, mt.cols)
+		if mt.err {
+			if !errors.Is(err, ErrTableChanged) {
+				t.Errorf("[%s] expected ErrTableChanged, got %v", mt.name, err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("[%s] unexpected error, %s", mt.name, err)
+			continue
+		}
+		var names []string
+		for _, c := range cols {
+			names = append(names, c.name)
+		}
+		if !reflect.DeepEqual(names, mt.expected) {
+			t.Errorf("[%s] wrong columns, expected %v, got %v", mt.name, mt.expected, names)
+		}
+	}
+}
+
+var textValueTests = []struct {
+	colType  string
+	v        interface{}
+	expected string
+}{
+	{"int(11)", rawInt{0xffffffff, 4}, "-1"},
+	{"int(10) unsigned", rawInt{0xffffffff, 4}, "4294967295"},
+	{"enum('a','it''s')", rawInt{2, 1}, "it's"},
+	{"set('a','b','c')", rawInt{5, 1}, "a,c"},
+	{"varchar(20)", "hello", "hello"},
+}
+
+func TestTextValue(t *testing.T) {
+	for _, tt := range textValueTests {
+		got := string(textValue(column{colType: tt.colType}, tt.v))
+		if got != tt.expected {
+			t.Errorf("[%s] wrong text, expected %s, got %s", tt.colType, tt.expected, got)
+		}
+	}
+}
+
+func TestBinlogPosition(t *testing.T) {
+	p := binlogPosition{"mysql-bin.000042", 1234}
+	if got := decodePosition("mysql-bin", p.encode()); got != p {
+		t.Errorf("wrong position, expected %s, got %s", p, got)
+	}
+}
+
+var setIDTests = []struct {
+	name     string
+	keys     []string
+	data     map[string]interface{}
+	expected interface{}
+}{
+	{"single", []string{"id"}, map[string]interface{}{"id": 1, "name": "a"}, 1},
+	{"composite", []string{"a", "b"}, map[string]interface{}{"a": 1, "b": "x"}, "1_x"},
+	{"existing", []string{"id"}, map[string]interface{}{"id": 1, "_id": "custom"}, "custom"},
+	{"missing key", []string{"a", "b"}, map[string]interface{}{"a": 1}, nil},
+	{"no key", nil, map[string]interface{}{"name": "a"}, nil},
+}
+
+func TestSetID(t *testing.T) {
+	for _, st := range setIDTests {
+		setID(st.keys, st.data)
+		if !reflect.DeepEqual(st.data["_id"], st.expected) {
+			t.Errorf("[%s] wrong _id, expected %v, got %v", st.name, st.expected, st.data["_id"])
+		}
+	}
+}
+
+var idKeysTests = []struct {
+	name      string
+	idColumns map[string][]string
+	expected  []string
+}{
+	{"primary key", nil, []string{"id"}},
+	{"override", map[string][]string{"users": {"email", "name"}}, []string{"email", "name"}},
+	{"other table", map[string][]string{"logs": {"email"}}, []string{"id"}},
+	{"unknown column", map[string][]string{"users": {"missing"}}, []string{"id"}},
+}
+
+func TestIDKeys(t *testing.T) {
+	cols := []column{{name: "id", primary: true}, {name: "email"}, {name: "name"}}
+	for _, it := range idKeysTests {
+		if got := idKeys("users", cols, it.idColumns); !reflect.DeepEqual(got, it.expected) {
+			t.Errorf("[%s] wrong keys, expected %v, got %v", it.name, it.expected, got)
+		}
+	}
+}
@@ -0,0 +1,369 @@
+package mysql
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/tls"
+	"errors"
+	"io"
+	"net"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/go-sql-driver/mysql"
+)
+
+// handshakePacket is the start of a protocol 10 handshake supporting the 4.1 protocol, up to
+// the lower capability flags.
+var handshakePacket = []byte{
+	10,               // protocol version
+	'8', '.', '0', 0, // server version
+	1, 0, 0, 0, // connection id
+	1, 2, 3, 4, 5, 6, 7, 8, // scramble
+	0,          // filler
+	0x00, 0x82, // capability flags
+}
+
+var handshakeTests = []struct {
+	name   string
+	packet []byte
+	tls    bool
+}{
+	{"empty", []byte{}, false},
+	{"version only", []byte{10}, false},
+	{"unterminated server version", []byte{10, '8', '.', '0'}, false},
+	{"no scramble", handshakePacket[:9], false},
+	{"no capability flags", handshakePacket[:len(handshakePacket)-1], false},
+	{"charset only", append(append([]byte{}, handshakePacket...), defaultCollation), false},
+	{
+		"short auth data",
+		append(append([]byte{}, handshakePacket...), defaultCollation, 0, 0, 0x08, 0x00, 21, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 'a'),
+		false,
+	},
+	{"tls unsupported", handshakePacket, true},
+}
+
+func TestHandshakeErrors(t *testing.T) {
+	for _, ht := range handshakeTests {
+		client, server := net.Pipe()
+		go func(packet []byte) {
+			defer server.Close()
+			length := len(packet)
+			server.Write(append([]byte{byte(length), byte(length >> 8), byte(length >> 16), 0}, packet...))
+		}(ht.packet)
+		c := &binlogConn{conn: client, br: bufio.NewReader(client)}
+		var tlsCfg *tls.Config
+		if ht.tls {
+			tlsCfg = &tls.Config{}
+		}
+		if err := c.handshake("user", "", "", tlsCfg, false); err == nil {
+			t.Errorf("[%s] expected an error", ht.name)
+		}
+		client.Close()
+	}
+}
+
+var tlsConfigTests = []struct {
+	dsn        string
+	tls        bool
+	serverName string
+	err        bool
+}{
+	{"user@tcp(db:3306)/test", false, "", false},
+	{"user@tcp(db:3306)/test?tls=false", false, "", false},
+	{"user@tcp(db:3306)/test?tls=true", true, "db", false},
+	{"user@tcp(db:3306)/test?tls=skip-verify", true, "", false},
+	{"user@tcp(db:3306)/test?tls=preferred", true, "", false},
+}
+
+func TestTLSConfig(t *testing.T) {
+	for _, tt := range tlsConfigTests {
+		cfg, err := mysql.ParseDSN(tt.dsn)
+		if err != nil {
+			t.Fatalf("[%s] unexpected ParseDSN error, %s", tt.dsn, err)
+		}
+		tlsCfg, err := tlsConfig(cfg)
+		if (err != nil) != tt.err {
+			t.Errorf("[%s] wrong error, %v", tt.dsn, err)
+			continue
+		}
+		if (tlsCfg != nil) != tt.tls {
+			t.Errorf("[%s] wrong tls config, got %+v", tt.dsn, tlsCfg)
+			continue
+		}
+		if tlsCfg != nil && tlsCfg.ServerName != tt.serverName {
+			t.Errorf("[%s] wrong server name, expected %s, got %s", tt.dsn, tt.serverName, tlsCfg.ServerName)
+		}
+	}
+
+	// registered configurations can not be looked up
+	mysql.RegisterTLSConfig("custom", &tls.Config{})
+	defer mysql.DeregisterTLSConfig("custom")
+	cfg, err := mysql.ParseDSN("user@tcp(db:3306)/test?tls=custom")
+	if err != nil {
+		t.Fatalf("unexpected ParseDSN error, %s", err)
+	}
+	if _, err := tlsConfig(cfg); err == nil {
+		t.Error("expected an error for a registered tls config")
+	}
+}
+
+// join concatenates the fields of a golden packet.
+func join(fields ...[]byte) []byte {
+	return bytes.Join(fields, nil)
+}
+
+// The golden packets of the handshakes reuse the scrambles of the go-sql-driver tests together
+// with the authentication responses it computes for the password "secret".
+var (
+	// cachingSHA2Handshake is the initial handshake of a MySQL 8.0 server
+	cachingSHA2Handshake = join(
+		[]byte{0x4a, 0x00, 0x00, 0x00},           // length and sequence
+		[]byte{0x0a},                             // protocol version
+		[]byte("8.0.36\x00"),                     // server version
+		[]byte{0x0d, 0x00, 0x00, 0x00},           // connection id
+		[]byte{90, 105, 74, 126, 30, 48, 37, 56}, // scramble, first part
+		[]byte{0x00},                             // filler
+		[]byte{0x00, 0xa2},                       // lower capability flags
+		[]byte{0xff},                             // charset
+		[]byte{0x02, 0x00},                       // status flags
+		[]byte{0x08, 0x00},                       // upper capability flags
+		[]byte{0x15},                             // auth data length
+		make([]byte, 10),                         // reserved
+		[]byte{3, 23, 115, 127, 69, 22, 41, 84, 32, 123, 43, 118, 0x00}, // scramble, second part
+		[]byte("caching_sha2_password\x00"),
+	)
+	cachingSHA2Response = join(
+		[]byte{0x5c, 0x00, 0x00, 0x01},
+		[]byte{0x01, 0xa2, 0x08, 0x00}, // capability flags
+		[]byte{0xff, 0xff, 0xff, 0x00}, // max packet size
+		[]byte{0x2d},                   // utf8mb4_general_ci
+		make([]byte, 23),
+		[]byte("root\x00"),
+		[]byte{0x20, 102, 32, 5, 35, 143, 161, 140, 241, 171, 232, 56, 139, 43, 14, 107, 196, 249,
+			170, 147, 60, 220, 204, 120, 178, 214, 15, 184, 150, 26, 61, 57, 235},
+		[]byte("caching_sha2_password\x00"),
+	)
+
+	nativeHandshake = join(
+		[]byte{0x4a, 0x00, 0x00, 0x00},
+		[]byte{0x0a},
+		[]byte("8.0.36\x00"),
+		[]byte{0x0d, 0x00, 0x00, 0x00},
+		[]byte{70, 114, 92, 94, 1, 38, 11, 116},
+		[]byte{0x00},
+		[]byte{0x00, 0xa2},
+		[]byte{0xff},
+		[]byte{0x02, 0x00},
+		[]byte{0x08, 0x00},
+		[]byte{0x15},
+		make([]byte, 10),
+		[]byte{63, 114, 23, 101, 126, 103, 26, 95, 81, 17, 24, 21, 0x00},
+		[]byte("mysql_native_password\x00"),
+	)
+	nativeResponse = join(
+		[]byte{0x50, 0x00, 0x00, 0x01},
+		[]byte{0x01, 0xa2, 0x08, 0x00},
+		[]byte{0xff, 0xff, 0xff, 0x00},
+		[]byte{0x2d},
+		make([]byte, 23),
+		[]byte("root\x00"),
+		[]byte{0x14, 53, 177, 140, 159, 251, 189, 127, 53, 109, 252, 172, 50, 211, 192, 240, 164, 26, 48, 207, 45},
+		[]byte("mysql_native_password\x00"),
+	)
+
+	// nativeAuthSwitch asks the client to authenticate with mysql_native_password instead
+	nativeAuthSwitch = join(
+		[]byte{44, 0x00, 0x00, 0x02, 0xfe},
+		[]byte("mysql_native_password\x00"),
+		[]byte{96, 71, 63, 8, 1, 58, 75, 12, 69, 95, 66, 60, 117, 31, 48, 31, 89, 39, 55, 31, 0x00},
+	)
+	nativeAuthSwitchResponse = []byte{20, 0x00, 0x00, 0x03, 202, 41, 195, 164, 34, 226, 49, 103,
+		21, 211, 167, 199, 227, 116, 8, 48, 57, 71, 149, 146}
+)
+
+// exchange is a step of a scripted server, it sends its packets and then reads the packet the
+// client is expected to write, if any.
+type exchange struct {
+	send   []byte
+	expect []byte
+}
+
+var handshakePacketTests = []struct {
+	name  string
+	steps []exchange
+	err   error
+}{
+	{
+		"caching_sha2_password fast auth",
+		[]exchange{
+			{cachingSHA2Handshake, cachingSHA2Response},
+			{[]byte{0x02, 0x00, 0x00, 0x02, 0x01, 0x03}, nil},                               // fast auth succeeded
+			{[]byte{0x07, 0x00, 0x00, 0x03, 0x00, 0x00, 0x00, 0x02, 0x00, 0x00, 0x00}, nil}, // OK
+		},
+		nil,
+	},
+	{
+		"auth switch to mysql_native_password",
+		[]exchange{
+			{cachingSHA2Handshake, cachingSHA2Response},
+			{nativeAuthSwitch, nativeAuthSwitchResponse},
+			{[]byte{0x07, 0x00, 0x00, 0x04, 0x00, 0x00, 0x00, 0x02, 0x00, 0x00, 0x00}, nil},
+		},
+		nil,
+	},
+	{
+		"access denied",
+		[]exchange{
+			{nativeHandshake, nativeResponse},
+			{join([]byte{0x16, 0x00, 0x00, 0x02, 0xff, 0x15, 0x04}, []byte("#28000Access denied")), nil},
+		},
+		ServerError{Code: 1045, Message: "Access denied"},
+	},
+}
+
+func TestHandshakePackets(t *testing.T) {
+	for _, ht := range handshakePacketTests {
+		client, server := net.Pipe()
+		served := make(chan struct{})
+		go func(steps []exchange) {
+			defer close(served)
+			defer server.Close()
+			for i, step := range steps {
+				if _, err := server.Write(step.send); err != nil {
+					t.Errorf("[%s] step %d: unable to send, %s", ht.name, i, err)
+					return
+				}
+				if step.expect == nil {
+					continue
+				}
+				got := make([]byte, len(step.expect))
+				if _, err := io.ReadFull(server, got); err != nil {
+					t.Errorf("[%s] step %d: unable to read the client packet, %s", ht.name, i, err)
+					return
+				}
+				if !bytes.Equal(got, step.expect) {
+					t.Errorf("[%s] step %d: wrong client packet\nexpected: %v\ngot: %v", ht.name, i, step.expect, got)
+					return
+				}
+			}
+		}(ht.steps)
+		c := &binlogConn{conn: client, br: bufio.NewReader(client)}
+		err := c.handshake("root", "secret", "", nil, false)
+		if !reflect.DeepEqual(err, ht.err) {
+			t.Errorf("[%s] wrong error, expected %v, got %v", ht.name, ht.err, err)
+		}
+		client.Close()
+		<-served
+	}
+}
+
+// eventPackets are the binlog events sent by a MySQL 8.0 server with binlog_checksum=CRC32 and
+// binlog_row_metadata=FULL for the table test.users (id INT, name VARCHAR(20)) after
+// INSERT (1, 'alice'), UPDATE name = 'bob' and DELETE, ended by an EOF packet.
+var eventPackets = join(
+	// TABLE_MAP_EVENT, log position 1069
+	[]byte{0x46, 0x00, 0x00, 0x01, 0x00},
+	[]byte{0x2b, 0x9a, 0x40, 0x60, 0x13, 0x01, 0x00, 0x00, 0x00, 0x45, 0x00, 0x00, 0x00, 0x2d, 0x04, 0x00, 0x00, 0x00, 0x00},
+	[]byte{0x6c, 0x00, 0x00, 0x00, 0x00, 0x00, 0x01, 0x00}, // table id and flags
+	[]byte{0x04, 't', 'e', 's', 't', 0x00, 0x05, 'u', 's', 'e', 'r', 's', 0x00},
+	[]byte{0x02, 0x03, 0x0f, 0x02, 0x50, 0x00, 0x02}, // column types, metadata and nullable columns
+	[]byte{0x01, 0x01, 0x00},                                     // signedness
+	[]byte{0x02, 0x03, 0xfc, 0xff, 0x00},                         // default charset
+	[]byte{0x04, 0x08, 0x02, 'i', 'd', 0x04, 'n', 'a', 'm', 'e'}, // column names
+	[]byte{0x74, 0x3a, 0x46, 0xae},                               // checksum
+	// WRITE_ROWS_EVENT v2, log position 1115
+	[]byte{0x2f, 0x00, 0x00, 0x02, 0x00},
+	[]byte{0x2b, 0x9a, 0x40, 0x60, 0x1e, 0x01, 0x00, 0x00, 0x00, 0x2e, 0x00, 0x00, 0x00, 0x5b, 0x04, 0x00, 0x00, 0x00, 0x00},
+	[]byte{0x6c, 0x00, 0x00, 0x00, 0x00, 0x00, 0x01, 0x00, 0x02, 0x00, 0x02, 0x03},
+	[]byte{0x00, 0x01, 0x00, 0x00, 0x00, 0x05, 'a', 'l', 'i', 'c', 'e'},
+	[]byte{0xce, 0xa3, 0x88, 0xce},
+	// UPDATE_ROWS_EVENT v2, log position 1171
+	[]byte{0x39, 0x00, 0x00, 0x03, 0x00},
+	[]byte{0x2b, 0x9a, 0x40, 0x60, 0x1f, 0x01, 0x00, 0x00, 0x00, 0x38, 0x00, 0x00, 0x00, 0x93, 0x04, 0x00, 0x00, 0x00, 0x00},
+	[]byte{0x6c, 0x00, 0x00, 0x00, 0x00, 0x00, 0x01, 0x00, 0x02, 0x00, 0x02, 0x03, 0x03},
+	[]byte{0x00, 0x01, 0x00, 0x00, 0x00, 0x05, 'a', 'l', 'i', 'c', 'e'},
+	[]byte{0x00, 0x01, 0x00, 0x00, 0x00, 0x03, 'b', 'o', 'b'},
+	[]byte{0x70, 0x8c, 0xd1, 0x3b},
+	// DELETE_ROWS_EVENT v2, log position 1215
+	[]byte{0x2d, 0x00, 0x00, 0x04, 0x00},
+	[]byte{0x2b, 0x9a, 0x40, 0x60, 0x20, 0x01, 0x00, 0x00, 0x00, 0x2c, 0x00, 0x00, 0x00, 0xbf, 0x04, 0x00, 0x00, 0x00, 0x00},
+	[]byte{0x6c, 0x00, 0x00, 0x00, 0x00, 0x00, 0x01, 0x00, 0x02, 0x00, 0x02, 0x03},
+	[]byte{0x00, 0x01, 0x00, 0x00, 0x00, 0x03, 'b', 'o', 'b'},
+	[]byte{0x80, 0xdf, 0xe5, 0x67},
+	// EOF
+	[]byte{0x05, 0x00, 0x00, 0x05, 0xfe, 0x00, 0x00, 0x02, 0x00},
+)
+
+func TestEventPackets(t *testing.T) {
+	client, server := net.Pipe()
+	go func() {
+		defer server.Close()
+		server.Write(eventPackets)
+	}()
+	c := &binlogConn{conn: client, br: bufio.NewReader(client)}
+	defer c.Close()
+
+	type event struct {
+		eventType byte
+		logPos    uint32
+		rows      [][]interface{}
+	}
+	var events []event
+	tables := make(map[uint64]*tableMap)
+	for {
+		ev, err := c.readEvent()
+		if errors.Is(err, ErrBinlogEOF) {
+			break
+		}
+		if err != nil {
+			t.Fatalf("unexpected readEvent error, %s", err)
+		}
+		ev = ev[:len(ev)-binlogChecksumSize]
+		h, err := parseEventHeader(ev)
+		if err != nil {
+			t.Fatalf("unexpected parseEventHeader error, %s", err)
+		}
+		if int(h.size) != len(ev)+binlogChecksumSize {
+			t.Errorf("wrong event size, expected %d, got %d", len(ev)+binlogChecksumSize, h.size)
+		}
+		body := ev[eventHeaderLen:]
+		e := event{eventType: h.eventType, logPos: h.logPos}
+		if h.eventType == tableMapEvent {
+			tm, err := parseTableMap(body)
+			if err != nil {
+				t.Fatalf("unexpected parseTableMap error, %s", err)
+			}
+			expected := &tableMap{
+				id:          108,
+				schema:      "test",
+				table:       "users",
+				columnTypes: []byte{typeLong, typeVarchar},
+				columnMeta:  []uint16{0, 80},
+				columnNames: []string{"id", "name"},
+			}
+			if !reflect.DeepEqual(tm, expected) {
+				t.Errorf("wrong table map, expected %+v, got %+v", expected, tm)
+			}
+			tables[tm.id] = tm
+		} else {
+			rows, err := parseRowsEvent(h.eventType, body, tables, time.UTC)
+			if err != nil {
+				t.Fatalf("unexpected parseRowsEvent error, %s", err)
+			}
+			e.rows = rows.rows
+		}
+		events = append(events, e)
+	}
+
+	expected := []event{
+		{tableMapEvent, 1069, nil},
+		{writeRowsEventV2, 1115, [][]interface{}{{rawInt{1, 4}, "alice"}}},
+		{updateRowsEventV2, 1171, [][]interface{}{{rawInt{1, 4}, "alice"}, {rawInt{1, 4}, "bob"}}},
+		{deleteRowsEventV2, 1215, [][]interface{}{{rawInt{1, 4}, "bob"}}},
+	}
+	if !reflect.DeepEqual(events, expected) {
+		t.Errorf("wrong events\nexpected: %v\ngot: %v", expected, events)
+	}
+}
@@ -14,7 +14,7 @@ import (
 )
 
 const (
-	// DefaultURI is the default endpoint for MSSQL on the local machine.
+	// DefaultURI is the default endpoint for MySQL on the local machine.
 	// Primarily used when initializing a new Client without a specific URI.
 	DefaultURI = "user:password@tcp(localhost:1234)/test"
 
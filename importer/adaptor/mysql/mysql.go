@@ -1,7 +1,10 @@
 package mysql
 
 import (
+	"fmt"
+	"math/rand"
 	"sync"
+	"time"
 
 	adaptor "github.com/appbaseio/abc/importer/adaptor"
 	"github.com/appbaseio/abc/importer/client"
@@ -16,7 +19,11 @@ const (
 	sampleConfig = `{
   "uri": "${MYSQL_URI}"
   // "timeout": "30s", // defaults to 30s
-  // "tail": false // enable tailing
+  // "tail": false, // enable tailing
+  // "server_id": 1001, // replica server id used when tailing the binlog, defaults to a random id
+  // "id_columns": {"logs": ["host", "ts"]}, // columns used as _id per table, defaults to the primary key
+  // "chunk_size": 10000, // rows read per query when copying a table, defaults to 10000
+  // "concurrency": 1 // number of tables copied at the same time, defaults to 1
 }`
 )
 
@@ -25,7 +32,11 @@ var _ adaptor.Adaptor = &MYSQL{}
 // MYSQL is an adaptor
 type MYSQL struct {
 	adaptor.BaseConfig
-	Tail bool `json:"tail" doc:"if tail is set, database will be watched for changes"`
+	Tail        bool                `json:"tail" doc:"if tail is set, database will be watched for changes"`
+	ServerID    uint32              `json:"server_id" doc:"server id used to register as a replica when tailing the binlog, must be unique among the replicas"`
+	IDColumns   map[string][]string `json:"id_columns" doc:"columns used as _id per table, for tables without a primary key, defaults to the primary key"`
+	ChunkSize   int                 `json:"chunk_size" doc:"number of rows read per query when copying a table, defaults to 10000"`
+	Concurrency int                 `json:"concurrency" doc:"number of tables copied at the same time, defaults to 1"`
 }
 
 func init() {
@@ -44,7 +55,27 @@ func (ms *MYSQL) Client() (client.Client, error) {
 
 // Reader ...
 func (ms *MYSQL) Reader() (client.Reader, error) {
-	return newReader(ms.Tail), nil
+	chunkSize := ms.ChunkSize
+	if chunkSize == 0 {
+		chunkSize = DefaultChunkSize
+	}
+	concurrency := ms.Concurrency
+	if concurrency == 0 {
+		concurrency = 1
+	}
+	if chunkSize < 0 || concurrency < 0 {
+		return nil, fmt.Errorf("chunk_size and concurrency must be positive")
+	}
+	reader := newReader(ms.Tail, ms.IDColumns, chunkSize, concurrency)
+	if ms.Tail {
+		serverID := ms.ServerID
+		if serverID == 0 {
+			// stay clear of the ids usually given to real replicas
+			serverID = uint32(rand.New(rand.NewSource(time.Now().UnixNano())).Int31n(1<<30)) + 1<<30
+		}
+		return newTailer(reader, ms.URI, serverID), nil
+	}
+	return reader, nil
 }
 
 // Writer ...
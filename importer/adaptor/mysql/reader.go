@@ -2,26 +2,49 @@ package mysql
 
 import (
 	"database/sql"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
 
 	"github.com/appbaseio/abc/importer/client"
+	"github.com/appbaseio/abc/importer/commitlog"
+	"github.com/appbaseio/abc/importer/function/mapping"
 	"github.com/appbaseio/abc/importer/message"
 	"github.com/appbaseio/abc/importer/message/ops"
 	"github.com/appbaseio/abc/log"
 )
 
-var _ client.Reader = &Reader{}
+const (
+	// DefaultChunkSize is the number of rows read by each query when copying a table.
+	DefaultChunkSize = 10000
 
-// Reader fulfills the client.Reader interface for use with both copying and tailing a MSSQL database.
+	copyRetries = 5
+	retryDelay  = 5 * time.Second
+)
+
+var (
+	_ client.Reader     = &Reader{}
+	_ mapping.Describer = &Reader{}
+
+	errStopped = errors.New("read stopped")
+)
+
+// Reader fulfills the client.Reader interface for use with both copying and tailing a MySQL database.
 type Reader struct {
-	tail   bool
-	dbName string
+	tail        bool
+	dbName      string
+	idColumns   map[string][]string
+	chunkSize   int
+	concurrency int
 }
 
-func newReader(tail bool) client.Reader {
-	return &Reader{tail, ""}
+func newReader(tail bool, idColumns map[string][]string, chunkSize, concurrency int) *Reader {
+	return &Reader{tail, "", idColumns, chunkSize, concurrency}
 }
 
-func (r *Reader) Read(_ map[string]client.MessageSet, filterFn client.NsFilterFunc) client.MessageChanFunc {
+func (r *Reader) Read(resumeMap map[string]client.MessageSet, filterFn client.NsFilterFunc) client.MessageChanFunc {
 	return func(s client.Session, done chan struct{}) (chan client.MessageSet, error) {
 		out := make(chan client.MessageSet)
 		r.dbName = s.(*Session).dbName // set database name
@@ -38,8 +61,20 @@ func (r *Reader) Read(_ map[string]client.MessageSet, filterFn client.NsFilterFu
 				log.With("db", r.dbName).Errorf("unable to list tables, %s", err)
 				return
 			}
-			// iterate tables
-			iterationComplete := r.iterateTable(db, tables, out, done)
+			// iterate tables, concurrency of them at a time
+			iterationComplete := make(chan string)
+			var wg sync.WaitGroup
+			for i := 0; i < r.concurrency; i++ {
+				wg.Add(1)
+				go func() {
+					defer wg.Done()
+					r.iterateTable(db, tables, resumeMap, out, iterationComplete, done)
+				}()
+			}
+			go func() {
+				wg.Wait()
+				close(iterationComplete)
+			}()
 			func() {
 				for {
 					select {
@@ -97,115 +132,324 @@ func (r *Reader) listTables(db *sql.DB, filterFn func(name string) bool) (<-chan
 	return out, nil
 }
 
-// iterateTable takes care of a table
-func (r *Reader) iterateTable(db *sql.DB, in <-chan string, out chan<- client.MessageSet, done chan struct{}) <-chan string {
-	tableDone := make(chan string)
-	go func() {
-		defer close(tableDone)
-		for {
+// iterateTable copies the tables received on in until it is closed
+func (r *Reader) iterateTable(db *sql.DB, in <-chan string, resumeMap map[string]client.MessageSet, out chan<- client.MessageSet, tableDone chan<- string, done chan struct{}) {
+	for {
+		select {
+		case t, ok := <-in:
+			if !ok {
+				return
+			}
+			log.With("db", r.dbName).With("table", t).Infoln("iterating...")
+			err := r.copyTable(db, t, resumeMap[t], out, done)
+			if err == errStopped {
+				log.With("db", r.dbName).Infoln("Reading table stopped midway")
+				return
+			}
+			if err != nil {
+				log.With("db", r.dbName).With("table", t).Errorf("Error reading rows %s", err)
+				continue
+			}
 			select {
-			case t, ok := <-in:
-				if !ok {
-					return
-				}
-				log.With("db", r.dbName).With("table", t).Infoln("iterating...")
-				// read table
-				rows, err := db.Query("select * from " + t)
-				if err != nil {
-					log.With("db", r.dbName).With("table", t).Errorf("Error reading rows %s", err)
-					return
-				}
-				// get columns
-				columns, err := rows.Columns()
-				if err != nil {
-					log.With("db", r.dbName).With("table", t).Errorf("Error reading columns %s", err)
-					return
-				}
-				colCount := len(columns)
-
-				// get column types
-				colTypes, err := r.getColumnTypes(db, t, colCount)
-				if err != nil {
-					log.With("db", r.dbName).With("table", t).Errorf("Error reading types %s", err)
-				}
-
-				// get row
-				values := make([]sql.RawBytes, colCount)
-				results := make([]interface{}, colCount)
-				for i := 0; i < colCount; i++ {
-					results[i] = &values[i]
-				}
-				// get data
-				for rows.Next() {
-					err = rows.Scan(results...)
-					if err != nil {
-						log.With("db", r.dbName).With("table", t).Errorf("Error reading row %s", err)
-						return
-					}
-					data := make(map[string]interface{})
-					for i := 0; i < colCount; i++ {
-						data[columns[i]] = castType(colTypes[i], values[i])
-						// log.Infoln(data[columns[i]])
-					}
-					// send data
-					// log.Infoln(data)
-					out <- client.MessageSet{
-						Msg: message.From(ops.Insert, t, data),
-					}
-					// return early?
-					select {
-					default:
-					case <-done:
-						log.With("db", r.dbName).Infoln("Reading table stopped midway")
-						return
-					}
-				}
-
-				tableDone <- t
+			case tableDone <- t:
 			case <-done:
-				log.With("db", r.dbName).Infoln("iterating no more")
 				return
 			}
+		case <-done:
+			log.With("db", r.dbName).Infoln("iterating no more")
+			return
 		}
-	}()
-	return tableDone
+	}
 }
 
-// getColumnTypes gets types of columns
-func (r *Reader) getColumnTypes(db *sql.DB, table string, count int) ([]string, error) {
-	log.With("db", r.dbName).With("table", table).Infoln("getting types...")
-	types := make([]string, count)
+// copyTable reads a table in chunks ordered by its primary key, starting after the row of the
+// resume message if the table was being copied. Tables without a primary key are read at once.
+func (r *Reader) copyTable(db *sql.DB, t string, resume client.MessageSet, out chan<- client.MessageSet, done chan struct{}) error {
+	// get column types and primary key
+	cols, err := describeTable(db, t)
+	if err != nil {
+		log.With("db", r.dbName).With("table", t).Errorf("Error reading types %s", err)
+	}
+	// the schema of the table goes first, for the writers to map its columns
+	if len(cols) > 0 {
+		select {
+		case out <- client.MessageSet{Msg: message.From(ops.Command, t, tableSchema(t, cols).Data())}:
+		case <-done:
+			return errStopped
+		}
+	}
+	keys := idKeys(t, cols, r.idColumns)
+	var primary []string
+	for _, c := range cols {
+		if c.primary {
+			primary = append(primary, c.name)
+		}
+	}
+	if len(primary) == 0 {
+		log.With("db", r.dbName).With("table", t).Infoln("table has no primary key, reading it in one query")
+	}
+	last := resumeKey(primary, resume)
+	if last != nil {
+		log.With("db", r.dbName).With("table", t).Infof("resuming copy after key %v", last)
+	}
+
+	failures := 0
+	for {
+		query, args := chunkQuery(t, primary, last, r.chunkSize)
+		n, err := r.copyChunk(db, t, cols, keys, primary, query, args, &last, out, done)
+		if err == errStopped {
+			return err
+		}
+		if err != nil {
+			// rows read before the error were sent, the chunk is read again from the last one
+			failures++
+			if len(primary) == 0 || failures > copyRetries {
+				return err
+			}
+			log.With("db", r.dbName).With("table", t).Errorf("error reading chunk, retrying, %s", err)
+			select {
+			case <-time.After(retryDelay):
+			case <-done:
+				return errStopped
+			}
+			continue
+		}
+		failures = 0
+		if len(primary) == 0 || n < r.chunkSize {
+			return nil
+		}
+	}
+}
 
+// copyChunk sends the rows returned by query and updates last with the primary key of each row.
+func (r *Reader) copyChunk(db *sql.DB, t string, cols []column, keys, primary []string, query string, args []interface{}, last *[]interface{}, out chan<- client.MessageSet, done chan struct{}) (int, error) {
 	// read table
-	rows, err := db.Query("show columns from " + table)
+	rows, err := db.Query(query, args...)
 	if err != nil {
-		return nil, err
+		return 0, err
 	}
-
+	defer rows.Close()
+	// get columns
 	columns, err := rows.Columns()
 	if err != nil {
-		log.With("db", r.dbName).With("table", table).Errorf("Error reading columns %s", err)
-		return nil, err
+		return 0, err
 	}
 	colCount := len(columns)
+	if len(cols) != colCount {
+		log.With("db", r.dbName).With("table", t).Errorln("Error reading types, column count mismatch")
+		cols = make([]column, colCount)
+	}
 
+	// get row
 	values := make([]sql.RawBytes, colCount)
 	results := make([]interface{}, colCount)
 	for i := 0; i < colCount; i++ {
 		results[i] = &values[i]
 	}
-	ct := 0
+	n := 0
+	// get data
+	for rows.Next() {
+		err = rows.Scan(results...)
+		if err != nil {
+			return n, err
+		}
+		data := make(map[string]interface{})
+		for i := 0; i < colCount; i++ {
+			data[columns[i]] = castType(cols[i].colType, values[i])
+			// log.Infoln(data[columns[i]])
+		}
+		if len(primary) > 0 {
+			key := make([]interface{}, len(primary))
+			for i, k := range primary {
+				key[i] = data[k]
+			}
+			*last = key
+		}
+		setID(keys, data)
+		// send data
+		// log.Infoln(data)
+		select {
+		case out <- client.MessageSet{
+			Msg: message.From(ops.Insert, t, data),
+		}:
+		case <-done:
+			return n, errStopped
+		}
+		n++
+	}
+	return n, rows.Err()
+}
+
+// resumeKey returns the primary key of the last row copied from a table before a restart.
+func resumeKey(primary []string, resume client.MessageSet) []interface{} {
+	if len(primary) == 0 || resume.Msg == nil || resume.Mode == commitlog.Sync || resume.Msg.OP() != ops.Insert {
+		return nil
+	}
+	data := resume.Msg.Data()
+	key := make([]interface{}, len(primary))
+	for i, k := range primary {
+		v, ok := data[k]
+		if !ok {
+			return nil
+		}
+		key[i] = v
+	}
+	return key
+}
+
+// chunkQuery selects the next chunk of a table ordered by its primary key, after the last key read if any.
+func chunkQuery(table string, primary []string, last []interface{}, chunkSize int) (string, []interface{}) {
+	query := "select * from " + quoteIdent(table)
+	if len(primary) == 0 {
+		return query, nil
+	}
+	var args []interface{}
+	if last != nil {
+		// (a, b) > (x, y) expands to a > x OR (a = x AND b > y)
+		var or []string
+		for i := range primary {
+			var and []string
+			for j := 0; j < i; j++ {
+				and = append(and, quoteIdent(primary[j])+" = ?")
+				args = append(args, last[j])
+			}
+			and = append(and, quoteIdent(primary[i])+" > ?")
+			args = append(args, last[i])
+			or = append(or, "("+strings.Join(and, " AND ")+")")
+		}
+		query += " where " + strings.Join(or, " OR ")
+	}
+	order := make([]string, len(primary))
+	for i, k := range primary {
+		order[i] = quoteIdent(k)
+	}
+	return query + " order by " + strings.Join(order, ", ") + fmt.Sprintf(" limit %d", chunkSize), args
+}
+
+// quoteIdent quotes a table or column name for use in a query.
+func quoteIdent(name string) string {
+	return "`" + strings.Replace(name, "`", "``", -1) + "`"
+}
+
+// column describes a table column as reported by `show columns`.
+type column struct {
+	name    string
+	colType string
+	primary bool
+}
+
+// describeTable gets the columns of a table in their ordinal position.
+func describeTable(db *sql.DB, table string) ([]column, error) {
+	log.With("table", table).Infoln("getting types...")
+	rows, err := db.Query("show columns from " + quoteIdent(table))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	fields, err := rows.Columns()
+	if err != nil {
+		log.With("table", table).Errorf("Error reading columns %s", err)
+		return nil, err
+	}
+	values := make([]sql.RawBytes, len(fields))
+	results := make([]interface{}, len(fields))
+	for i := range fields {
+		results[i] = &values[i]
+	}
 
+	var cols []column
 	for rows.Next() {
 		err = rows.Scan(results...)
 		if err != nil {
 			log.Errorln(err)
 			return nil, err
 		}
-		types[ct] = string(values[1])
-		ct = ct + 1
+		// Field, Type, Null, Key, Default, Extra
+		cols = append(cols, column{
+			name:    string(values[0]),
+			colType: string(values[1]),
+			primary: string(values[3]) == "PRI",
+		})
+	}
+	return cols, rows.Err()
+}
+
+// tableSchema returns the schema of a table with the columns returned by describeTable.
+func tableSchema(table string, cols []column) mapping.Schema {
+	s := mapping.Schema{Table: table}
+	for _, c := range cols {
+		s.Columns = append(s.Columns, mapping.Column{Name: c.name, Type: c.colType})
+	}
+	return s
+}
+
+// Describe returns the schema of the tables passing the filter.
+func (r *Reader) Describe(s client.Session, filterFn client.NsFilterFunc) ([]mapping.Schema, error) {
+	db := s.(*Session).db
+	tables, err := r.listTables(db, filterFn)
+	if err != nil {
+		return nil, err
+	}
+	var schemas []mapping.Schema
+	for t := range tables {
+		if err != nil {
+			continue
+		}
+		var cols []column
+		if cols, err = describeTable(db, t); err == nil {
+			schemas = append(schemas, tableSchema(t, cols))
+		}
+	}
+	return schemas, err
+}
+
+// idKeys returns the columns used as _id for a table, the configured columns of the table
+// if any or else its primary key.
+func idKeys(table string, cols []column, idColumns map[string][]string) []string {
+	if override, ok := idColumns[table]; ok && len(override) > 0 {
+		names := make(map[string]bool)
+		for _, c := range cols {
+			names[c.name] = true
+		}
+		valid := true
+		for _, k := range override {
+			if !names[k] {
+				log.With("table", table).Errorf("id column %s does not exist, using the primary key", k)
+				valid = false
+			}
+		}
+		if valid {
+			return override
+		}
+	}
+	var keys []string
+	for _, c := range cols {
+		if c.primary {
+			keys = append(keys, c.name)
+		}
 	}
-	// log.Infoln(types, len(types), count)
+	return keys
+}
 
-	return types, nil
+// setID uses the key columns of the row as _id, values of composite keys are joined with "_".
+// Rows that already carry an _id column or that miss a key column are left untouched.
+func setID(keys []string, data map[string]interface{}) {
+	if _, ok := data["_id"]; ok || len(keys) == 0 {
+		return
+	}
+	for _, k := range keys {
+		if _, ok := data[k]; !ok {
+			return
+		}
+	}
+	if len(keys) == 1 {
+		data["_id"] = data[keys[0]]
+		return
+	}
+	parts := make([]string, len(keys))
+	for i, k := range keys {
+		parts[i] = fmt.Sprintf("%v", data[k])
+	}
+	data["_id"] = strings.Join(parts, "_")
 }
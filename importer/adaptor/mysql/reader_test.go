@@ -0,0 +1,106 @@
+package mysql
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/appbaseio/abc/importer/client"
+	"github.com/appbaseio/abc/importer/commitlog"
+	"github.com/appbaseio/abc/importer/message"
+	"github.com/appbaseio/abc/importer/message/ops"
+)
+
+var chunkQueryTests = []struct {
+	name         string
+	primary      []string
+	last         []interface{}
+	expected     string
+	expectedArgs []interface{}
+}{
+	{
+		"no key",
+		nil,
+		nil,
+		"select * from `logs`",
+		nil,
+	},
+	{
+		"first chunk",
+		[]string{"id"},
+		nil,
+		"select * from `logs` order by `id` limit 100",
+		nil,
+	},
+	{
+		"next chunk",
+		[]string{"id"},
+		[]interface{}{10},
+		"select * from `logs` where (`id` > ?) order by `id` limit 100",
+		[]interface{}{10},
+	},
+	{
+		"composite key",
+		[]string{"host", "ts"},
+		[]interface{}{"a", 10},
+		"select * from `logs` where (`host` > ?) OR (`host` = ? AND `ts` > ?) order by `host`, `ts` limit 100",
+		[]interface{}{"a", "a", 10},
+	},
+}
+
+func TestChunkQuery(t *testing.T) {
+	for _, ct := range chunkQueryTests {
+		query, args := chunkQuery("logs", ct.primary, ct.last, 100)
+		if query != ct.expected {
+			t.Errorf("[%s] wrong query, expected\n%s\ngot\n%s", ct.name, ct.expected, query)
+		}
+		if !reflect.DeepEqual(args, ct.expectedArgs) {
+			t.Errorf("[%s] wrong args, expected %v, got %v", ct.name, ct.expectedArgs, args)
+		}
+	}
+}
+
+var resumeKeyTests = []struct {
+	name     string
+	primary  []string
+	resume   client.MessageSet
+	expected []interface{}
+}{
+	{
+		"no resume",
+		[]string{"id"},
+		client.MessageSet{},
+		nil,
+	},
+	{
+		"copy",
+		[]string{"host", "ts"},
+		client.MessageSet{Msg: message.From(ops.Insert, "logs", map[string]interface{}{"host": "a", "ts": 10.0})},
+		[]interface{}{"a", 10.0},
+	},
+	{
+		"interrupted copy",
+		[]string{"id"},
+		client.MessageSet{Msg: message.From(ops.Insert, "logs", map[string]interface{}{"id": 3.0}), Mode: commitlog.Complete},
+		[]interface{}{3.0},
+	},
+	{
+		"sync",
+		[]string{"id"},
+		client.MessageSet{Msg: message.From(ops.Insert, "logs", map[string]interface{}{"id": 3.0}), Mode: commitlog.Sync},
+		nil,
+	},
+	{
+		"missing key",
+		[]string{"id"},
+		client.MessageSet{Msg: message.From(ops.Insert, "logs", map[string]interface{}{"name": "a"})},
+		nil,
+	},
+}
+
+func TestResumeKey(t *testing.T) {
+	for _, rt := range resumeKeyTests {
+		if got := resumeKey(rt.primary, rt.resume); !reflect.DeepEqual(got, rt.expected) {
+			t.Errorf("[%s] wrong key, expected %v, got %v", rt.name, rt.expected, got)
+		}
+	}
+}
@@ -0,0 +1,610 @@
+package mysql
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/appbaseio/abc/importer/client"
+	"github.com/appbaseio/abc/importer/commitlog"
+	"github.com/appbaseio/abc/importer/message"
+	"github.com/appbaseio/abc/importer/message/ops"
+	"github.com/appbaseio/abc/log"
+)
+
+const (
+	heartbeatPeriod = 30 * time.Second
+	reconnectDelay  = 5 * time.Second
+)
+
+var (
+	_ client.Reader    = &Tailer{}
+	_ client.ErrReader = &Tailer{}
+
+	// ErrBinlogFormat is returned when the server does not write row based binlogs.
+	ErrBinlogFormat = errors.New("tailing requires binlog_format=ROW")
+
+	// ErrBinlogRowImage is returned when the rows of the binlog do not hold every column, the
+	// updates could not be indexed with their key nor as whole documents.
+	ErrBinlogRowImage = errors.New("tailing requires binlog_row_image=FULL")
+
+	// ErrTableChanged is returned when the rows of the binlog do not match the definition of
+	// their table, the events were written before the table was altered.
+	ErrTableChanged = errors.New("binlog rows do not match the table definition")
+)
+
+// Tailer copies the tables with a Reader and then follows the binlog of the server,
+// acting as a replica, to emit every change made afterwards.
+type Tailer struct {
+	reader    client.Reader
+	uri       string
+	serverID  uint32
+	idColumns map[string][]string
+
+	// err is the error that stopped the tailing
+	mu  sync.Mutex
+	err error
+}
+
+func newTailer(reader *Reader, uri string, serverID uint32) client.Reader {
+	return &Tailer{reader: reader, uri: uri, serverID: serverID, idColumns: reader.idColumns}
+}
+
+// Err returns the error that stopped the tailing, the pipeline fails with it.
+func (t *Tailer) Err() error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.err
+}
+
+// binlogInfo holds the server settings needed to follow the binlog.
+type binlogInfo struct {
+	base     string
+	current  binlogPosition
+	checksum bool
+	tz       *time.Location
+	// the binlog holds the column names, binlog_row_metadata=FULL
+	columnNames bool
+}
+
+// Read copies the tables and then tails the binlog, the binlog position of every message is
+// sent as its Timestamp so that a restart resumes from the last transaction processed.
+func (t *Tailer) Read(resumeMap map[string]client.MessageSet, filterFn client.NsFilterFunc) client.MessageChanFunc {
+	return func(s client.Session, done chan struct{}) (chan client.MessageSet, error) {
+		session := s.(*Session)
+		info, err := readBinlogInfo(session.db)
+		if err != nil {
+			return nil, err
+		}
+
+		start := info.current
+		var resumeTS int64
+		for _, m := range resumeMap {
+			if m.Timestamp > resumeTS {
+				resumeTS = m.Timestamp
+			}
+		}
+		if resumeTS > 0 {
+			start = decodePosition(info.base, resumeTS)
+		}
+
+		// tables that were tailed before are not copied again, the others resume their copy
+		// after the last row read
+		copyFilter := func(table string) bool {
+			if m, ok := resumeMap[table]; ok && m.Mode == commitlog.Sync {
+				log.With("db", session.dbName).With("table", table).Infoln("copy already complete, skipping...")
+				return false
+			}
+			return filterFn(table)
+		}
+		readFunc := t.reader.Read(resumeMap, copyFilter)
+		msgChan, err := readFunc(s, done)
+		if err != nil {
+			return nil, err
+		}
+
+		out := make(chan client.MessageSet)
+		go func() {
+			defer close(out)
+			ts := start.encode()
+			// read until reader done
+			for msg := range msgChan {
+				msg.Timestamp = ts
+				out <- msg
+			}
+			// start tailing
+			log.With("db", session.dbName).With("position", start).Infoln("Listening for changes...")
+			if !info.columnNames {
+				log.With("db", session.dbName).Infoln("binlog_row_metadata is not FULL, binlog columns are matched by position, renamed columns can not be detected")
+			}
+			st := &binlogStream{
+				tailer:   t,
+				session:  session,
+				info:     info,
+				position: start,
+				filterFn: filterFn,
+				columns:  make(map[string][]column),
+			}
+			for {
+				err := st.stream(out, done)
+				select {
+				case <-done:
+					log.With("db", session.dbName).Infoln("tailing stopping...")
+					return
+				default:
+				}
+				if fatalBinlogError(err) {
+					log.With("db", session.dbName).With("position", st.position).Errorf("unable to tail binlog, %s", err)
+					t.mu.Lock()
+					t.err = fmt.Errorf("unable to tail binlog at %s, %s", st.position, err)
+					t.mu.Unlock()
+					return
+				}
+				log.With("db", session.dbName).With("position", st.position).Errorf("error reading binlog, %s", err)
+				select {
+				case <-done:
+					log.With("db", session.dbName).Infoln("tailing stopping...")
+					return
+				case <-time.After(reconnectDelay):
+				}
+			}
+		}()
+
+		return out, nil
+	}
+}
+
+// readBinlogInfo checks that the server can be tailed and returns its current binlog position.
+func readBinlogInfo(db *sql.DB) (binlogInfo, error) {
+	info := binlogInfo{tz: time.UTC}
+
+	var format string
+	if err := db.QueryRow("SELECT @@global.binlog_format").Scan(&format); err != nil {
+		return info, err
+	}
+	if strings.ToUpper(format) != "ROW" {
+		return info, ErrBinlogFormat
+	}
+
+	// unknown before MySQL 5.6, which always logs full rows
+	var image string
+	if err := db.QueryRow("SELECT @@global.binlog_row_image").Scan(&image); err == nil && strings.ToUpper(image) != "FULL" {
+		return info, ErrBinlogRowImage
+	}
+
+	var checksum string
+	if err := db.QueryRow("SELECT @@global.binlog_checksum").Scan(&checksum); err == nil {
+		info.checksum = strings.ToUpper(checksum) != "NONE"
+	}
+
+	// only known to MySQL 8.0 and MariaDB 10.5 onwards
+	var metadata string
+	if err := db.QueryRow("SELECT @@global.binlog_row_metadata").Scan(&metadata); err == nil {
+		info.columnNames = strings.ToUpper(metadata) == "FULL"
+	}
+
+	// TIMESTAMP columns are stored in UTC and rendered in the server time zone
+	var offset string
+	if err := db.QueryRow("SELECT TIMEDIFF(NOW(), UTC_TIMESTAMP())").Scan(&offset); err == nil {
+		if d, err := parseTimeOffset(offset); err == nil {
+			info.tz = time.FixedZone(offset, int(d.Seconds()))
+		}
+	}
+
+	// SHOW MASTER STATUS was renamed in 8.4
+	rows, err := db.Query("SHOW MASTER STATUS")
+	if err != nil {
+		rows, err = db.Query("SHOW BINARY LOG STATUS")
+		if err != nil {
+			return info, err
+		}
+	}
+	defer rows.Close()
+	fields, err := rows.Columns()
+	if err != nil {
+		return info, err
+	}
+	if !rows.Next() {
+		return info, errors.New("binary logging is not enabled")
+	}
+	values := make([]sql.RawBytes, len(fields))
+	results := make([]interface{}, len(fields))
+	for i := range fields {
+		results[i] = &values[i]
+	}
+	if err := rows.Scan(results...); err != nil {
+		return info, err
+	}
+	var pos uint32
+	if _, err := fmt.Sscanf(string(values[1]), "%d", &pos); err != nil {
+		return info, err
+	}
+	info.current = binlogPosition{name: string(values[0]), pos: pos}
+	idx := strings.LastIndex(info.current.name, ".")
+	if idx < 0 {
+		return info, fmt.Errorf("unexpected binlog file name %s", info.current.name)
+	}
+	info.base = info.current.name[:idx]
+	return info, nil
+}
+
+func parseTimeOffset(offset string) (time.Duration, error) {
+	sign := time.Duration(1)
+	if strings.HasPrefix(offset, "-") {
+		sign = -1
+		offset = offset[1:]
+	}
+	var h, m, s int
+	if _, err := fmt.Sscanf(offset, "%d:%d:%d", &h, &m, &s); err != nil {
+		return 0, err
+	}
+	return sign * (time.Duration(h)*time.Hour + time.Duration(m)*time.Minute + time.Duration(s)*time.Second), nil
+}
+
+// fatalBinlogError tells whether reconnecting can not get past err.
+func fatalBinlogError(err error) bool {
+	if errors.Is(err, ErrTableChanged) || errors.Is(err, ErrMalformedPacket) {
+		return true
+	}
+	var serverErr ServerError
+	if errors.As(err, &serverErr) {
+		switch serverErr.Code {
+		case 1045, 1227, 1236:
+			// access denied, missing replication privilege and unreadable binlog position
+			return true
+		}
+	}
+	return false
+}
+
+// binlogStream follows the binlog from position, reconnecting from the last transaction boundary.
+type binlogStream struct {
+	tailer   *Tailer
+	session  *Session
+	info     binlogInfo
+	position binlogPosition
+	filterFn client.NsFilterFunc
+	columns  map[string][]column
+}
+
+func (st *binlogStream) stream(out chan<- client.MessageSet, done chan struct{}) error {
+	conn, err := dialBinlog(st.tailer.uri, 10*time.Second)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	// closing the connection unblocks the pending read once we are done
+	stop := make(chan struct{})
+	defer close(stop)
+	go func() {
+		select {
+		case <-done:
+			conn.Close()
+		case <-stop:
+		}
+	}()
+
+	// both variable names are set, newer servers look for the source_ prefix
+	if st.info.checksum {
+		for _, q := range []string{
+			"SET @master_binlog_checksum = @@global.binlog_checksum",
+			"SET @source_binlog_checksum = @@global.binlog_checksum",
+		} {
+			if err := conn.exec(q); err != nil {
+				return err
+			}
+		}
+	}
+	for _, q := range []string{
+		fmt.Sprintf("SET @master_heartbeat_period = %d", heartbeatPeriod.Nanoseconds()),
+		fmt.Sprintf("SET @source_heartbeat_period = %d", heartbeatPeriod.Nanoseconds()),
+	} {
+		if err := conn.exec(q); err != nil {
+			return err
+		}
+	}
+	if err := conn.dump(st.tailer.serverID, st.position); err != nil {
+		return err
+	}
+
+	tables := make(map[uint64]*tableMap)
+	current := st.position
+	for {
+		conn.conn.SetReadDeadline(time.Now().Add(2 * heartbeatPeriod))
+		ev, err := conn.readEvent()
+		if err != nil {
+			return err
+		}
+		if st.info.checksum {
+			if len(ev) < eventHeaderLen+binlogChecksumSize {
+				return ErrMalformedPacket
+			}
+			ev = ev[:len(ev)-binlogChecksumSize]
+		}
+		h, err := parseEventHeader(ev)
+		if err != nil {
+			return err
+		}
+		body := ev[eventHeaderLen:]
+
+		switch h.eventType {
+		case rotateEvent:
+			p, err := parseRotate(body)
+			if err != nil {
+				return err
+			}
+			current = p
+			st.position = p
+			continue
+		case tableMapEvent:
+			tm, err := parseTableMap(body)
+			if err != nil {
+				return err
+			}
+			tables[tm.id] = tm
+		case xidEvent:
+			st.position = binlogPosition{current.name, h.logPos}
+		case queryEvent:
+			schema, query, err := parseQuery(body)
+			if err != nil {
+				return err
+			}
+			if query != "BEGIN" {
+				// COMMIT of non transactional tables and DDL statements end a transaction
+				st.position = binlogPosition{current.name, h.logPos}
+				if query != "COMMIT" && schema == st.session.dbName {
+					st.columns = make(map[string][]column)
+				}
+			}
+		case writeRowsEventV1, writeRowsEventV2, updateRowsEventV1, updateRowsEventV2, deleteRowsEventV1, deleteRowsEventV2:
+			if err := st.handleRows(h.eventType, body, tables, out, done); err != nil {
+				return err
+			}
+		}
+		if h.logPos > 0 {
+			current.pos = h.logPos
+		}
+	}
+}
+
+func (st *binlogStream) handleRows(eventType byte, body []byte, tables map[uint64]*tableMap, out chan<- client.MessageSet, done chan struct{}) error {
+	if len(body) < 6 {
+		return ErrMalformedPacket
+	}
+	tm, ok := tables[readUint48(body[0:6])]
+	if !ok || tm.schema != st.session.dbName || !st.filterFn(tm.table) {
+		return nil
+	}
+	ev, err := parseRowsEvent(eventType, body, tables, st.info.tz)
+	if err != nil {
+		return err
+	}
+	cols, err := st.tableColumns(tm)
+	if err != nil {
+		return err
+	}
+
+	keys := idKeys(tm.table, cols, st.tailer.idColumns)
+	// rowData returns the document of a row of the event
+	rowData := func(row []interface{}) map[string]interface{} {
+		data := make(map[string]interface{})
+		for i, c := range cols {
+			if _, absent := row[i].(absentValue); absent {
+				continue
+			}
+			data[c.name] = castType(c.colType, textValue(c, row[i]))
+		}
+		setID(keys, data)
+		return data
+	}
+	send := func(op ops.Op, data map[string]interface{}) bool {
+		log.With("op", op).With("table", tm.table).Debugln("received")
+		select {
+		case out <- client.MessageSet{
+			Msg:       message.From(op, tm.table, data),
+			Timestamp: st.position.encode(),
+			Mode:      commitlog.Sync,
+		}:
+			return true
+		case <-done:
+			return false
+		}
+	}
+
+	switch eventType {
+	case writeRowsEventV1, writeRowsEventV2:
+		for _, row := range ev.rows {
+			if !send(ops.Insert, rowData(row)) {
+				return nil
+			}
+		}
+	case deleteRowsEventV1, deleteRowsEventV2:
+		for _, row := range ev.rows {
+			if !send(ops.Delete, rowData(row)) {
+				return nil
+			}
+		}
+	default:
+		// the rows come in pairs of the before and after image, a changed key moves the
+		// document to its new _id
+		for i := 1; i < len(ev.rows); i += 2 {
+			before, after := rowData(ev.rows[i-1]), rowData(ev.rows[i])
+			op := ops.Update
+			if id, ok := before["_id"]; ok && fmt.Sprint(id) != fmt.Sprint(after["_id"]) {
+				if !send(ops.Delete, map[string]interface{}{"_id": id}) {
+					return nil
+				}
+				op = ops.Insert
+			}
+			if !send(op, after) {
+				return nil
+			}
+		}
+	}
+	return nil
+}
+
+// tableColumns returns the definitions of the columns of the binlog rows, in their order. The
+// definitions are reloaded when they no longer match, ErrTableChanged is returned when the
+// binlog was written before the table was altered.
+func (st *binlogStream) tableColumns(tm *tableMap) ([]column, error) {
+	if cols, ok := st.columns[tm.table]; ok {
+		if matched, err := matchColumns(tm, cols); err == nil {
+			return matched, nil
+		}
+	}
+	cols, err := describeTable(st.session.db, tm.table)
+	if err != nil {
+		return nil, err
+	}
+	st.columns[tm.table] = cols
+	return matchColumns(tm, cols)
+}
+
+// matchColumns orders the columns of the table as the columns of the binlog rows, by name when
+// the binlog holds them and by position otherwise. Every column has to be of the binlog type.
+func matchColumns(tm *tableMap, cols []column) ([]column, error) {
+	matched := cols
+	if tm.columnNames != nil {
+		byName := make(map[string]column, len(cols))
+		for _, c := range cols {
+			byName[c.name] = c
+		}
+		matched = make([]column, len(tm.columnNames))
+		for i, name := range tm.columnNames {
+			c, ok := byName[name]
+			if !ok {
+				return nil, fmt.Errorf("%w, table %s has no column %s", ErrTableChanged, tm.table, name)
+			}
+			matched[i] = c
+		}
+	} else if len(cols) != len(tm.columnTypes) {
+		return nil, fmt.Errorf("%w, table %s has %d columns, binlog has %d", ErrTableChanged, tm.table, len(cols), len(tm.columnTypes))
+	}
+	for i, c := range matched {
+		if !columnOfType(c.colType, tm.columnTypes[i], tm.columnMeta[i]) {
+			return nil, fmt.Errorf("%w, column %s of table %s is %s, binlog has type %d", ErrTableChanged, c.name, tm.table, c.colType, tm.columnTypes[i])
+		}
+	}
+	return matched, nil
+}
+
+// binlogColumnTypes lists the column types stored as every binlog type.
+var binlogColumnTypes = map[byte][]string{
+	typeDecimal:    {"decimal", "numeric"},
+	typeNewDecimal: {"decimal", "numeric"},
+	typeTiny:       {"tinyint", "bool"},
+	typeShort:      {"smallint"},
+	typeInt24:      {"mediumint"},
+	typeLong:       {"int", "integer"},
+	typeLongLong:   {"bigint"},
+	typeFloat:      {"float"},
+	typeDouble:     {"double", "real"},
+	typeYear:       {"year"},
+	typeDate:       {"date"},
+	typeNewDate:    {"date"},
+	typeTime:       {"time"},
+	typeTime2:      {"time"},
+	typeDatetime:   {"datetime"},
+	typeDatetime2:  {"datetime"},
+	typeTimestamp:  {"timestamp"},
+	typeTimestamp2: {"timestamp"},
+	typeVarchar:    {"varchar", "varbinary"},
+	typeVarString:  {"varchar", "varbinary"},
+	typeString:     {"char", "binary"},
+	typeEnum:       {"enum"},
+	typeSet:        {"set"},
+	typeBit:        {"bit"},
+	typeBlob:       {"tinyblob", "blob", "mediumblob", "longblob", "tinytext", "text", "mediumtext", "longtext", "json"},
+	typeJSON:       {"json"},
+	typeGeometry:   {"geometry", "point", "linestring", "polygon", "multipoint", "multilinestring", "multipolygon", "geometrycollection", "geomcollection"},
+}
+
+// columnOfType tells whether a column of the table is stored as the binlog type, unknown
+// types match any column.
+func columnOfType(colType string, binlogType byte, meta uint16) bool {
+	// enum and set columns are written as strings, their real type is in the metadata
+	if realType := byte(meta >> 8); binlogType == typeString && (realType == typeEnum || realType == typeSet) {
+		binlogType = realType
+	}
+	names, ok := binlogColumnTypes[binlogType]
+	if !ok {
+		return true
+	}
+	name := strings.ToLower(colType)
+	if i := strings.IndexAny(name, "( "); i >= 0 {
+		name = name[:i]
+	}
+	for _, n := range names {
+		if name == n {
+			return true
+		}
+	}
+	return false
+}
+
+// textValue renders a decoded binlog value the way the text protocol would send it.
+func textValue(c column, v interface{}) sql.RawBytes {
+	switch v := v.(type) {
+	case nil:
+		return nil
+	case string:
+		return sql.RawBytes(v)
+	case rawInt:
+		colType := strings.ToLower(c.colType)
+		switch {
+		case strings.HasPrefix(colType, "enum("):
+			values := enumValues(c.colType)
+			if v.bits == 0 || int(v.bits) > len(values) {
+				return sql.RawBytes("")
+			}
+			return sql.RawBytes(values[v.bits-1])
+		case strings.HasPrefix(colType, "set("):
+			var members []string
+			for i, m := range enumValues(c.colType) {
+				if v.bits&(1<<uint(i)) != 0 {
+					members = append(members, m)
+				}
+			}
+			return sql.RawBytes(strings.Join(members, ","))
+		}
+		return sql.RawBytes(v.text(strings.Contains(colType, "unsigned")))
+	}
+	return sql.RawBytes(fmt.Sprintf("%v", v))
+}
+
+// enumValues parses the members of an enum('a','b') or set('a','b') column type.
+func enumValues(colType string) []string {
+	start := strings.Index(colType, "(")
+	end := strings.LastIndex(colType, ")")
+	if start < 0 || end < start {
+		return nil
+	}
+	var (
+		values  []string
+		current strings.Builder
+		inQuote bool
+	)
+	list := colType[start+1 : end]
+	for i := 0; i < len(list); i++ {
+		ch := list[i]
+		switch {
+		case ch == '\'' && inQuote && i+1 < len(list) && list[i+1] == '\'':
+			current.WriteByte('\'')
+			i++
+		case ch == '\'':
+			inQuote = !inQuote
+			if !inQuote {
+				values = append(values, current.String())
+				current.Reset()
+			}
+		case inQuote:
+			current.WriteByte(ch)
+		}
+	}
+	return values
+}
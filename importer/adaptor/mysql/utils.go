@@ -11,14 +11,22 @@ func castType(colType string, value sql.RawBytes) interface{} {
 	// https://dev.mysql.com/doc/refman/5.7/en/data-types.html
 	colType = strings.ToLower(colType)
 	val := string(value)
+	// NULL
+	if value == nil {
+		return nil
+	}
 
 	if strings.Contains(colType, "date") || strings.Contains(colType, "time") {
 		// TODO: parse to datetime object
+		// zero dates are no valid dates
+		if strings.HasPrefix(val, "0000-00-00") {
+			return nil
+		}
 		return val
 	} else if strings.Contains(colType, "int") {
 		i, _ := strconv.Atoi(val)
 		return i
-	} else if stringInSlice(colType, []string{"decimal", "numeric", "float", "double"}) {
+	} else if stringInSlice(baseType(colType), []string{"decimal", "numeric", "float", "double", "real"}) {
 		f, _ := strconv.ParseFloat(val, 64)
 		return f
 	} else if strings.Contains(colType, "json") {
@@ -29,6 +37,15 @@ func castType(colType string, value sql.RawBytes) interface{} {
 	return val
 }
 
+// baseType returns a column type without its parameters and modifiers, decimal for decimal(10,2) unsigned.
+func baseType(colType string) string {
+	fields := strings.Fields(strings.SplitN(colType, "(", 2)[0])
+	if len(fields) == 0 {
+		return ""
+	}
+	return fields[0]
+}
+
 // stringInSlice checks if string is in list or not
 func stringInSlice(a string, list []string) bool {
 	for _, b := range list {
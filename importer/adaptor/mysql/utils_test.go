@@ -0,0 +1,31 @@
+package mysql
+
+import (
+	"database/sql"
+	"reflect"
+	"testing"
+)
+
+var castTypeTests = []struct {
+	name     string
+	colType  string
+	value    sql.RawBytes
+	expected interface{}
+}{
+	{"int", "int(11)", sql.RawBytes("42"), 42},
+	{"null int", "int(11)", nil, nil},
+	{"empty string", "varchar(64)", sql.RawBytes(""), ""},
+	{"null string", "varchar(64)", nil, nil},
+	{"decimal", "decimal(10,2) unsigned", sql.RawBytes("1.50"), 1.5},
+	{"datetime", "datetime", sql.RawBytes("2020-01-02 03:04:05"), "2020-01-02 03:04:05"},
+	{"zero datetime", "datetime", sql.RawBytes("0000-00-00 00:00:00"), nil},
+	{"zero date", "date", sql.RawBytes("0000-00-00"), nil},
+}
+
+func TestCastType(t *testing.T) {
+	for _, ct := range castTypeTests {
+		if got := castType(ct.colType, ct.value); !reflect.DeepEqual(got, ct.expected) {
+			t.Errorf("[%s] wrong value, expected %#v, got %#v", ct.name, ct.expected, got)
+		}
+	}
+}
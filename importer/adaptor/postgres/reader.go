@@ -7,13 +7,17 @@ import (
 	"strings"
 
 	"github.com/appbaseio/abc/importer/client"
+	"github.com/appbaseio/abc/importer/function/mapping"
 	"github.com/appbaseio/abc/importer/message"
 	"github.com/appbaseio/abc/importer/message/data"
 	"github.com/appbaseio/abc/importer/message/ops"
 	"github.com/appbaseio/abc/log"
 )
 
-var _ client.Reader = &Reader{}
+var (
+	_ client.Reader     = &Reader{}
+	_ mapping.Describer = &Reader{}
+)
 
 // Reader implements the behavior defined by client.Reader for interfacing with MongoDB.
 type Reader struct{}
@@ -45,7 +49,7 @@ func (r *Reader) Read(resumeMap map[string]client.MessageSet, filterFn client.Ns
 						return
 					}
 					out <- client.MessageSet{
-						Msg: message.From(ops.Insert, result.table, result.data),
+						Msg: message.From(result.op, result.table, result.data),
 					}
 				}
 			}
@@ -94,6 +98,7 @@ func matchFunc(table string) bool {
 type doc struct {
 	table string
 	data  data.Data
+	op    ops.Op
 }
 
 func (r *Reader) iterateTable(db string, session *sql.DB, in <-chan string, done chan struct{}) <-chan doc {
@@ -107,52 +112,16 @@ func (r *Reader) iterateTable(db string, session *sql.DB, in <-chan string, done
 					return
 				}
 				log.With("db", db).With("table", c).With("table", c).Infoln("iterating...")
-				schemaTable := strings.Split(c, ".")
-				c = schemaTable[0] + ".\"" + schemaTable[1] + "\""
-				var typeIdentyfier string
-				err := session.QueryRow(`
-				    SELECT c.column_name
-				    FROM information_schema.columns c
-				    WHERE c.table_schema = 'information_schema' AND
-				          c.table_name = 'element_types' AND
-				          (c.column_name = 'collection_type_identifier' OR c.column_name = 'array_type_identifier')
-				`).Scan(&typeIdentyfier)
-				log.With("type", typeIdentyfier).Infoln("typeIdentyfier...")
-				if err != nil {
-					log.With("db", db).With("table", c).Errorf("error getting typeIdentyfier %v", err)
-				}
-				columnsResult, err := session.Query(fmt.Sprintf(`
-				    SELECT c.column_name, c.data_type, e.data_type AS element_type
-				    FROM information_schema.columns c LEFT JOIN information_schema.element_types e
-					 ON ((c.table_catalog, c.table_schema, c.table_name, 'TABLE', c.dtd_identifier)
-					   = (e.object_catalog, e.object_schema, e.object_name, e.object_type, e."%v"))
-				    WHERE c.table_schema = '%v' AND c.table_name = '%v'
-				    ORDER BY c.ordinal_position;
-				    `, typeIdentyfier, schemaTable[0], schemaTable[1]))
+				columns, err := describeTable(session, c)
 				if err != nil {
 					log.With("db", db).With("table", c).Errorf("error getting columns %v", err)
 					continue
 				}
-				var columns [][]string
-				for columnsResult.Next() {
-					var columnName string
-					var columnType string
-					var columnArrayType sql.NullString // this value may be nil
-
-					err = columnsResult.Scan(&columnName, &columnType, &columnArrayType)
-					recoveredRegex := regexp.MustCompile("recovered")
-					if err != nil && !recoveredRegex.MatchString(err.Error()) {
-						log.With("table", c).Errorf("error scanning columns %v", err)
-						continue
-					}
-
-					if columnType == "ARRAY" {
-						columnType = fmt.Sprintf("%v[]", columnArrayType.String) // append [] to columnType if array
-					}
-
-					column := []string{columnName, columnType}
-					columns = append(columns, column)
-				}
+				schemaTable := strings.Split(c, ".")
+				name := c
+				c = schemaTable[0] + ".\"" + schemaTable[1] + "\""
+				// the schema of the table goes first, for the writers to map its columns
+				out <- doc{table: c, data: tableSchema(name, columns).Data(), op: ops.Command}
 
 				// build docs for table
 				docsResult, err := session.Query(fmt.Sprintf("SELECT * FROM %v", c))
@@ -198,3 +167,83 @@ func (r *Reader) iterateTable(db string, session *sql.DB, in <-chan string, done
 	}()
 	return out
 }
+
+// describeTable returns the name and type of the columns of a schema.table in their ordinal
+// position, the type of array columns is the type of their elements followed by [].
+func describeTable(session *sql.DB, table string) ([][]string, error) {
+	schemaTable := strings.Split(table, ".")
+	var typeIdentyfier string
+	err := session.QueryRow(`
+	    SELECT c.column_name
+	    FROM information_schema.columns c
+	    WHERE c.table_schema = 'information_schema' AND
+	          c.table_name = 'element_types' AND
+	          (c.column_name = 'collection_type_identifier' OR c.column_name = 'array_type_identifier')
+	`).Scan(&typeIdentyfier)
+	log.With("type", typeIdentyfier).Infoln("typeIdentyfier...")
+	if err != nil {
+		log.With("table", table).Errorf("error getting typeIdentyfier %v", err)
+	}
+	columnsResult, err := session.Query(fmt.Sprintf(`
+	    SELECT c.column_name, c.data_type, e.data_type AS element_type
+	    FROM information_schema.columns c LEFT JOIN information_schema.element_types e
+		 ON ((c.table_catalog, c.table_schema, c.table_name, 'TABLE', c.dtd_identifier)
+		   = (e.object_catalog, e.object_schema, e.object_name, e.object_type, e."%v"))
+	    WHERE c.table_schema = '%v' AND c.table_name = '%v'
+	    ORDER BY c.ordinal_position;
+	    `, typeIdentyfier, schemaTable[0], schemaTable[1]))
+	if err != nil {
+		return nil, err
+	}
+	defer columnsResult.Close()
+	var columns [][]string
+	for columnsResult.Next() {
+		var columnName string
+		var columnType string
+		var columnArrayType sql.NullString // this value may be nil
+
+		err = columnsResult.Scan(&columnName, &columnType, &columnArrayType)
+		recoveredRegex := regexp.MustCompile("recovered")
+		if err != nil && !recoveredRegex.MatchString(err.Error()) {
+			log.With("table", table).Errorf("error scanning columns %v", err)
+			continue
+		}
+
+		if columnType == "ARRAY" {
+			columnType = fmt.Sprintf("%v[]", columnArrayType.String) // append [] to columnType if array
+		}
+
+		column := []string{columnName, columnType}
+		columns = append(columns, column)
+	}
+	return columns, nil
+}
+
+// tableSchema returns the schema of a table with the columns returned by describeTable.
+func tableSchema(table string, columns [][]string) mapping.Schema {
+	s := mapping.Schema{Table: table}
+	for _, c := range columns {
+		s.Columns = append(s.Columns, mapping.Column{Name: c[0], Type: c[1]})
+	}
+	return s
+}
+
+// Describe returns the schema of the tables passing the filter.
+func (r *Reader) Describe(s client.Session, filterFn client.NsFilterFunc) ([]mapping.Schema, error) {
+	session := s.(*Session)
+	tables, err := r.listTables(session.db, session.pqSession, filterFn)
+	if err != nil {
+		return nil, err
+	}
+	var schemas []mapping.Schema
+	for t := range tables {
+		if err != nil {
+			continue
+		}
+		var columns [][]string
+		if columns, err = describeTable(session.pqSession, t); err == nil {
+			schemas = append(schemas, tableSchema(t, columns))
+		}
+	}
+	return schemas, err
+}
@@ -8,6 +8,7 @@ import (
 
 	"github.com/appbaseio/abc/importer/client"
 	"github.com/appbaseio/abc/importer/message"
+	"github.com/appbaseio/abc/importer/message/ops"
 )
 
 var readerTestData = &TestData{"reader_test", "reader_test_table", basicSchema, 10}
@@ -39,8 +40,11 @@ func TestRead(t *testing.T) {
 		t.Fatalf("unexpected Read error, %s\n", err)
 	}
 	var numMsgs int
-	for range msgChan {
-		numMsgs++
+	for msg := range msgChan {
+		// skip the table schema
+		if msg.Msg.OP() != ops.Command {
+			numMsgs++
+		}
 	}
 	if numMsgs != readerTestData.InsertCount {
 		t.Errorf("bad message count, expected %d, got %d\n", readerTestData.InsertCount, numMsgs)
@@ -78,7 +82,9 @@ func TestReadComplex(t *testing.T) {
 	}
 	msgs := make([]message.Msg, 0)
 	for msg := range msgChan {
-		msgs = append(msgs, msg.Msg)
+		if msg.Msg.OP() != ops.Command {
+			msgs = append(msgs, msg.Msg)
+		}
 	}
 	if len(msgs) != readerComplexTestData.InsertCount {
 		t.Errorf("bad message count, expected %d, got %d\n", readerComplexTestData.InsertCount, len(msgs))
@@ -40,16 +40,16 @@ func (w *Writer) Write(msg message.Msg) func(client.Session) (message.Msg, error
 				ContentType:  "application/json",
 				Body:         b.Bytes(),
 			}
+			routingKey := w.RoutingKey
 			if w.KeyInField {
-				return msg,
-					s.(*Session).channel.Publish(
-						msg.Namespace(),
-						msg.Data().Get(w.RoutingKey).(string),
-						false,
-						false,
-						amqpMsg)
+				routingKey = msg.Data().Get(w.RoutingKey).(string)
 			}
-			return msg, s.(*Session).channel.Publish(msg.Namespace(), w.RoutingKey, false, false, amqpMsg)
+			if err := s.(*Session).channel.Publish(msg.Namespace(), routingKey, false, false, amqpMsg); err != nil {
+				return msg, err
+			}
+		}
+		if msg.Confirms() != nil {
+			close(msg.Confirms())
 		}
 		return msg, nil
 	}
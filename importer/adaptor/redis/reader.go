@@ -41,9 +41,9 @@ func (r *Reader) Read(_ map[string]client.MessageSet, filterFn client.NsFilterFu
 func (r *Reader) listCollections(redisSession *Session, filterFn func(name string) bool) (<-chan string, error) {
 	out := make(chan string)
 	go func() {
+		defer close(out)
 		var cursor uint64
 		for {
-			defer close(out)
 			var keys []string
 			var err error
 
@@ -54,6 +54,9 @@ func (r *Reader) listCollections(redisSession *Session, filterFn func(name strin
 			}
 
 			for _, k := range keys {
+				if !filterFn(k) {
+					continue
+				}
 				log.With("db", redisSession.conn.Options().DB).Infoln("sending for iteration...")
 				out <- k
 			}
@@ -81,6 +84,10 @@ func (r *Reader) iterateCollections(redisSession *Session, in <-chan string, out
 			if err != nil {
 				log.With("db", redisSession.conn.Options().DB).Errorf("error while fetching data, %s", err)
 			}
+			if result != nil {
+				// the key is the _id so that changes replace the document when tailing
+				result["_id"] = msg
+			}
 			out <- client.MessageSet{
 				Msg: message.From(ops.Insert, msg, result),
 			}
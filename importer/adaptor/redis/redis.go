@@ -26,6 +26,7 @@ type Redis struct {
 	adaptor.BaseConfig
 	SSL     bool     `json:"ssl"`
 	CACerts []string `json:"cacerts"`
+	Tail    bool     `json:"tail" doc:"if tail is set, keyspace notifications will be followed after the scan"`
 }
 
 func init() {
@@ -48,6 +49,9 @@ func (r *Redis) Client() (client.Client, error) {
 }
 
 func (r *Redis) Reader() (client.Reader, error) {
+	if r.Tail {
+		return newTailer(), nil
+	}
 	return newReader(), nil
 }
 
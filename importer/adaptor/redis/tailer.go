@@ -0,0 +1,206 @@
+package redis
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/appbaseio/abc/importer/client"
+	"github.com/appbaseio/abc/importer/commitlog"
+	"github.com/appbaseio/abc/importer/message"
+	"github.com/appbaseio/abc/importer/message/ops"
+	"github.com/appbaseio/abc/log"
+	"github.com/go-redis/redis"
+)
+
+var (
+	_ client.Reader = &Tailer{}
+
+	// ErrNotificationsDisabled is returned when the server does not publish keyspace notifications.
+	ErrNotificationsDisabled = errors.New("tailing requires keyspace notifications, set notify-keyspace-events to KA")
+)
+
+// Tailer copies the keys with a Reader and then subscribes to the keyspace notifications of
+// the database to emit every key changed afterwards.
+type Tailer struct {
+	reader *Reader
+}
+
+func newTailer() client.Reader {
+	return &Tailer{&Reader{}}
+}
+
+// Read subscribes to the keyspace notifications, copies the keys and then sends the keys changed since
+// the subscription. Changed keys are read again and sent whole, removed keys are sent as deletes.
+func (t *Tailer) Read(_ map[string]client.MessageSet, filterFn client.NsFilterFunc) client.MessageChanFunc {
+	return func(s client.Session, done chan struct{}) (chan client.MessageSet, error) {
+		session := s.(*Session)
+		db := session.conn.Options().DB
+		if err := checkNotifications(session.conn); err != nil {
+			return nil, err
+		}
+
+		// subscribe before the copy so that no change is missed
+		prefix := fmt.Sprintf("__keyspace@%d__:", db)
+		pubsub := session.conn.PSubscribe(prefix + "*")
+		if _, err := pubsub.Receive(); err != nil {
+			pubsub.Close()
+			return nil, err
+		}
+		events := pubsub.Channel()
+
+		// keys changed during the copy are collected and read again once it completes
+		var (
+			pending = make(map[string]string)
+			order   []string
+		)
+		stopCollect := make(chan struct{})
+		collected := make(chan struct{})
+		go func() {
+			defer close(collected)
+			for {
+				select {
+				case msg, ok := <-events:
+					if !ok {
+						return
+					}
+					key := strings.TrimPrefix(msg.Channel, prefix)
+					if _, ok := pending[key]; !ok {
+						order = append(order, key)
+					}
+					pending[key] = msg.Payload
+				case <-stopCollect:
+					return
+				}
+			}
+		}()
+
+		out := make(chan client.MessageSet)
+		go func() {
+			defer close(out)
+			defer pubsub.Close()
+
+			log.With("db", db).Infoln("starting Read func")
+			keys, err := t.reader.listCollections(session, filterFn)
+			if err != nil {
+				log.With("db", db).Errorf("unable to list collections, %s", err)
+				close(stopCollect)
+				return
+			}
+			t.reader.iterateCollections(session, keys, out, done)
+
+			close(stopCollect)
+			<-collected
+			for _, key := range order {
+				if !t.sendChange(session, key, pending[key], filterFn, out, done) {
+					return
+				}
+			}
+
+			// start tailing
+			log.With("db", db).Infoln("Listening for changes...")
+			for {
+				select {
+				case msg, ok := <-events:
+					if !ok {
+						log.With("db", db).Errorln("keyspace notifications subscription closed")
+						return
+					}
+					key := strings.TrimPrefix(msg.Channel, prefix)
+					if !t.sendChange(session, key, msg.Payload, filterFn, out, done) {
+						return
+					}
+				case <-done:
+					log.With("db", db).Infoln("tailing stopping...")
+					return
+				}
+			}
+		}()
+
+		return out, nil
+	}
+}
+
+// checkNotifications makes sure that the server publishes keyspace notifications, servers that
+// do not allow CONFIG commands are assumed to be configured.
+func checkNotifications(conn *redis.Client) error {
+	config, err := conn.ConfigGet("notify-keyspace-events").Result()
+	if err != nil {
+		log.With("db", conn.Options().DB).Infof("unable to read notify-keyspace-events, %s", err)
+		return nil
+	}
+	if len(config) != 2 {
+		return ErrNotificationsDisabled
+	}
+	flags, _ := config[1].(string)
+	if !notificationsEnabled(flags) {
+		return ErrNotificationsDisabled
+	}
+	return nil
+}
+
+// notificationsEnabled checks that the notify-keyspace-events flags publish keyspace
+// events for writes and for removed keys.
+func notificationsEnabled(flags string) bool {
+	if !strings.Contains(flags, "K") {
+		return false
+	}
+	if strings.Contains(flags, "A") {
+		return true
+	}
+	// generic, expired and evicted events, then one class per data type
+	for _, class := range "gx" {
+		if !strings.ContainsRune(flags, class) {
+			return false
+		}
+	}
+	return strings.ContainsAny(flags, "$lshz")
+}
+
+// removed checks whether a keyspace event means that the key no longer exists.
+func removed(event string) bool {
+	switch event {
+	case "del", "expired", "evicted", "rename_from":
+		return true
+	}
+	return false
+}
+
+// sendChange reads a changed key and sends it, returning false once done is closed.
+func (t *Tailer) sendChange(session *Session, key, event string, filterFn client.NsFilterFunc, out chan<- client.MessageSet, done chan struct{}) bool {
+	if !filterFn(key) {
+		return true
+	}
+	op := ops.Delete
+	data := make(map[string]interface{})
+	if !removed(event) {
+		keyType, err := session.conn.Type(key).Result()
+		if err != nil {
+			log.With("db", session.conn.Options().DB).With("key", key).Errorf("error reading key type, %s", err)
+			return true
+		}
+		// a key of type none was removed since the event
+		if keyType != "none" {
+			data, err = t.reader.getData(session, keyType, key)
+			if err != nil {
+				log.With("db", session.conn.Options().DB).With("key", key).Errorf("error while fetching data, %s", err)
+				return true
+			}
+			if data == nil {
+				return true
+			}
+			op = ops.Insert
+		}
+	}
+	data["_id"] = key
+
+	select {
+	case out <- client.MessageSet{
+		Msg:  message.From(op, key, data),
+		Mode: commitlog.Sync,
+	}:
+		return true
+	case <-done:
+		return false
+	}
+}
@@ -0,0 +1,41 @@
+package redis
+
+import "testing"
+
+var notificationsEnabledTests = []struct {
+	flags    string
+	expected bool
+}{
+	{"", false},
+	{"KA", true},
+	{"AKE", true},
+	{"EA", false},
+	{"Kg$x", true},
+	{"Kgxh", true},
+	{"Kgx", false},
+	{"K$h", false},
+}
+
+func TestNotificationsEnabled(t *testing.T) {
+	for _, nt := range notificationsEnabledTests {
+		if got := notificationsEnabled(nt.flags); got != nt.expected {
+			t.Errorf("[%s] expected %v, got %v", nt.flags, nt.expected, got)
+		}
+	}
+}
+
+func TestRemoved(t *testing.T) {
+	for event, expected := range map[string]bool{
+		"del":         true,
+		"expired":     true,
+		"evicted":     true,
+		"rename_from": true,
+		"rename_to":   false,
+		"set":         false,
+		"hset":        false,
+	} {
+		if got := removed(event); got != expected {
+			t.Errorf("[%s] expected %v, got %v", event, expected, got)
+		}
+	}
+}
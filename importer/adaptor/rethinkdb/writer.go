@@ -28,8 +28,9 @@ type Writer struct {
 }
 
 type bulkOperation struct {
-	s        *r.Session
-	confirms chan struct{}
+	s *r.Session
+	// confirms are the confirms of the messages of docs, closed once they are inserted
+	confirms []chan struct{}
 	docs     []map[string]interface{}
 }
 
@@ -66,7 +67,7 @@ func (w *Writer) Write(msg message.Msg) func(client.Session) (message.Msg, error
 				w.bulkMap[table] = bOp
 			}
 			if msg.Confirms() != nil {
-				bOp.confirms = msg.Confirms()
+				bOp.confirms = append(bOp.confirms, msg.Confirms())
 			}
 			bOp.docs = append(bOp.docs, prepareDocument(msg))
 			w.Unlock()
@@ -81,6 +82,10 @@ func (w *Writer) Write(msg message.Msg) func(client.Session) (message.Msg, error
 				rSession,
 				msg.Confirms(),
 			)
+		default:
+			if msg.Confirms() != nil {
+				close(msg.Confirms())
+			}
 		}
 		return msg, nil
 	}
@@ -128,7 +133,7 @@ func (w *Writer) flushAll() error {
 		if err != nil {
 			return err
 		}
-		if err := handleResponse(&resp, bOp.confirms); err != nil {
+		if err := handleResponse(&resp, bOp.confirms...); err != nil {
 			return err
 		}
 	}
@@ -145,14 +150,16 @@ func do(t r.Term, s *r.Session, confirms chan struct{}) error {
 }
 
 // handleresponse takes the rethink response and turn it into something we can consume elsewhere
-func handleResponse(resp *r.WriteResponse, confirms chan struct{}) error {
+func handleResponse(resp *r.WriteResponse, confirms ...chan struct{}) error {
 	if resp.Errors != 0 {
 		if !strings.Contains(resp.FirstError, "Duplicate primary key") { // we don't care about this error
 			return fmt.Errorf("%s\n%s", "problem inserting docs", resp.FirstError)
 		}
 	}
-	if confirms != nil {
-		close(confirms)
+	for _, c := range confirms {
+		if c != nil {
+			close(c)
+		}
 	}
 	return nil
 }
@@ -2,27 +2,51 @@ package sqlite
 
 import (
 	"database/sql"
+	"errors"
 	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
 
 	"github.com/appbaseio/abc/importer/client"
+	"github.com/appbaseio/abc/importer/commitlog"
 	"github.com/appbaseio/abc/importer/message"
 	"github.com/appbaseio/abc/importer/message/ops"
 	"github.com/appbaseio/abc/log"
 )
 
-var _ client.Reader = &Reader{}
+const (
+	// DefaultChunkSize is the number of rows read by each query when copying a table.
+	DefaultChunkSize = 10000
 
-// Reader fulfills the client.Reader interface for use with both copying and tailing a MSSQL database.
+	copyRetries = 5
+	retryDelay  = 5 * time.Second
+)
+
+var (
+	_ client.Reader = &Reader{}
+
+	errStopped = errors.New("read stopped")
+)
+
+// Reader fulfills the client.Reader interface for use with both copying and tailing a SQLite database.
+// It does not describe its tables as a mapping.Describer: the declared type of a column is only
+// an affinity, any column may hold values of any type and dates are text, real or integer
+// numbers, so a mapping generated from it would reject rows sent with their values as strings.
 type Reader struct {
-	tail   bool
-	dbName string
+	tail        bool
+	dbName      string
+	idColumns   map[string][]string
+	chunkSize   int
+	concurrency int
 }
 
-func newReader(tail bool) client.Reader {
-	return &Reader{tail, ""}
+func newReader(tail bool, idColumns map[string][]string, chunkSize, concurrency int) *Reader {
+	return &Reader{tail, "", idColumns, chunkSize, concurrency}
 }
 
-func (r *Reader) Read(_ map[string]client.MessageSet, filterFn client.NsFilterFunc) client.MessageChanFunc {
+func (r *Reader) Read(resumeMap map[string]client.MessageSet, filterFn client.NsFilterFunc) client.MessageChanFunc {
 	return func(s client.Session, done chan struct{}) (chan client.MessageSet, error) {
 		out := make(chan client.MessageSet)
 		r.dbName = s.(*Session).dbName // set database name
@@ -39,8 +63,20 @@ func (r *Reader) Read(_ map[string]client.MessageSet, filterFn client.NsFilterFu
 				log.With("db", r.dbName).Errorf("unable to list tables, %s", err)
 				return
 			}
-			// iterate tables
-			iterationComplete := r.iterateTable(db, tables, out, done)
+			// iterate tables, concurrency of them at a time
+			iterationComplete := make(chan string)
+			var wg sync.WaitGroup
+			for i := 0; i < r.concurrency; i++ {
+				wg.Add(1)
+				go func() {
+					defer wg.Done()
+					r.iterateTable(db, tables, resumeMap, out, iterationComplete, done)
+				}()
+			}
+			go func() {
+				wg.Wait()
+				close(iterationComplete)
+			}()
 			func() {
 				for {
 					select {
@@ -94,73 +130,316 @@ func (r *Reader) listTables(db *sql.DB, filterFn func(name string) bool) (<-chan
 	return out, nil
 }
 
-// iterateTable takes care of a table
-func (r *Reader) iterateTable(db *sql.DB, in <-chan string, out chan<- client.MessageSet, done chan struct{}) <-chan string {
-	tableDone := make(chan string)
-	go func() {
-		defer close(tableDone)
-		for {
+// iterateTable copies the tables received on in until it is closed
+func (r *Reader) iterateTable(db *sql.DB, in <-chan string, resumeMap map[string]client.MessageSet, out chan<- client.MessageSet, tableDone chan<- string, done chan struct{}) {
+	for {
+		select {
+		case t, ok := <-in:
+			if !ok {
+				return
+			}
+			log.With("db", r.dbName).With("table", t).Infoln("iterating...")
+			err := r.copyTable(db, t, resumeMap[t], out, done)
+			if err == errStopped {
+				log.With("db", r.dbName).Infoln("Reading table stopped midway")
+				return
+			}
+			if err != nil {
+				log.With("db", r.dbName).With("table", t).Errorf("Error reading rows %s", err)
+				continue
+			}
 			select {
-			case t, ok := <-in:
-				if !ok {
-					return
-				}
-				log.With("db", r.dbName).With("table", t).Infoln("iterating...")
-				// read table
-				rows, err := db.Query("select * from " + t)
-				if err != nil {
-					log.With("db", r.dbName).With("table", t).Errorf("Error reading rows %s", err)
-					return
-				}
-				// get columns
-				columns, err := rows.Columns()
-				if err != nil {
-					log.With("db", r.dbName).With("table", t).Errorf("Error reading columns %s", err)
-					return
-				}
-				colCount := len(columns)
-				// get data
-				for rows.Next() {
-					results := make([]interface{}, colCount)
-					for i := 0; i < colCount; i++ {
-						var temp interface{}
-						results[i] = &temp
-					}
-					err = rows.Scan(results...)
-					if err != nil {
-						log.With("db", r.dbName).With("table", t).Errorf("Error reading row %s", err)
-						return
-					}
-					data := make(map[string]interface{})
-					for i := 0; i < colCount; i++ {
-						res := fmt.Sprint(*(results[i].(*interface{})))
+			case tableDone <- t:
+			case <-done:
+				return
+			}
+		case <-done:
+			log.With("db", r.dbName).Infoln("iterating no more")
+			return
+		}
+	}
+}
 
-						var x interface{} = *(results[i].(*interface{}))
-						if value, ok := x.([]uint8); ok {
-							res = B2S(value)
-						}
-						data[columns[i]] = res
-					}
-					// send data
-					// log.Infoln(data)
-					out <- client.MessageSet{
-						Msg: message.From(ops.Insert, t, data),
-					}
-					// return early?
-					select {
-					default:
-					case <-done:
-						log.With("db", r.dbName).Infoln("Reading table stopped midway")
-						return
-					}
-				}
+// copyTable reads a table in chunks ordered by its primary key, or by rowid for tables without one,
+// starting after the row of the resume message if the table was being copied.
+func (r *Reader) copyTable(db *sql.DB, t string, resume client.MessageSet, out chan<- client.MessageSet, done chan struct{}) error {
+	// get primary key
+	info, err := describeTable(db, t, r.idColumns)
+	if err != nil {
+		log.With("db", r.dbName).With("table", t).Errorf("Error reading primary key %s", err)
+	}
+	last := info.resumeKey(resume)
+	if last != nil {
+		log.With("db", r.dbName).With("table", t).Infof("resuming copy after key %v", last)
+	}
 
-				tableDone <- t
+	failures := 0
+	for {
+		n, err := r.copyChunk(db, t, info, &last, out, done)
+		if err == errStopped {
+			return err
+		}
+		if err != nil {
+			// rows read before the error were sent, the chunk is read again from the last one
+			failures++
+			if failures > copyRetries {
+				return err
+			}
+			log.With("db", r.dbName).With("table", t).Errorf("error reading chunk, retrying, %s", err)
+			select {
+			case <-time.After(retryDelay):
 			case <-done:
-				log.With("db", r.dbName).Infoln("iterating no more")
-				return
+				return errStopped
 			}
+			continue
 		}
-	}()
-	return tableDone
+		failures = 0
+		if n < r.chunkSize {
+			return nil
+		}
+	}
+}
+
+// copyChunk sends the next chunk of rows of a table and updates last with the key of each row.
+func (r *Reader) copyChunk(db *sql.DB, t string, info tableInfo, last *[]interface{}, out chan<- client.MessageSet, done chan struct{}) (int, error) {
+	query, args := info.chunkQuery(t, *last, r.chunkSize)
+	// read table
+	rows, err := db.Query(query, args...)
+	if err != nil {
+		return 0, err
+	}
+	defer rows.Close()
+	// get columns
+	columns, err := rows.Columns()
+	if err != nil {
+		return 0, err
+	}
+	colCount := len(columns)
+	// tables without a primary key are ordered by the rowid selected first
+	skip := 0
+	if len(info.primary) == 0 {
+		skip = 1
+	}
+	n := 0
+	// get data
+	for rows.Next() {
+		results := make([]interface{}, colCount)
+		for i := 0; i < colCount; i++ {
+			var temp interface{}
+			results[i] = &temp
+		}
+		err = rows.Scan(results...)
+		if err != nil {
+			return n, err
+		}
+		data := rowData(columns[skip:], results[skip:])
+		if skip == 1 {
+			*last = []interface{}{*(results[0].(*interface{}))}
+		} else {
+			key := make([]interface{}, len(info.primary))
+			for i, k := range info.primary {
+				key[i] = data[k]
+			}
+			*last = key
+		}
+		setID(info.keys, data)
+		// send data
+		// log.Infoln(data)
+		select {
+		case out <- client.MessageSet{
+			Msg: message.From(ops.Insert, t, data),
+		}:
+		case <-done:
+			return n, errStopped
+		}
+		n++
+	}
+	return n, rows.Err()
+}
+
+// resumeKey returns the primary key, or the rowid, of the last row copied from a table before a restart.
+// The rowid is only known when it is used as _id.
+func (info tableInfo) resumeKey(resume client.MessageSet) []interface{} {
+	if resume.Msg == nil || resume.Mode == commitlog.Sync || resume.Msg.OP() != ops.Insert {
+		return nil
+	}
+	data := resume.Msg.Data()
+	if len(info.primary) == 0 {
+		if len(info.keys) > 0 {
+			return nil
+		}
+		rowid, err := strconv.ParseInt(fmt.Sprint(data["_id"]), 10, 64)
+		if err != nil {
+			return nil
+		}
+		return []interface{}{rowid}
+	}
+	key := make([]interface{}, len(info.primary))
+	for i, k := range info.primary {
+		v, ok := data[k]
+		if !ok {
+			return nil
+		}
+		key[i] = v
+	}
+	return key
+}
+
+// chunkQuery selects the next chunk of a table ordered by its primary key, or by rowid, after the last key read if any.
+func (info tableInfo) chunkQuery(table string, last []interface{}, chunkSize int) (string, []interface{}) {
+	order := []string{"rowid"}
+	query := "SELECT rowid, " + info.selectColumns() + " FROM " + quoteIdent(table)
+	if len(info.primary) > 0 {
+		order = make([]string, len(info.primary))
+		for i, k := range info.primary {
+			order[i] = quoteIdent(k)
+		}
+		query = "SELECT * FROM " + quoteIdent(table)
+	}
+	var args []interface{}
+	if last != nil {
+		// (a, b) > (x, y) expands to a > x OR (a = x AND b > y)
+		var or []string
+		for i := range order {
+			var and []string
+			for j := 0; j < i; j++ {
+				and = append(and, order[j]+" = ?")
+				args = append(args, last[j])
+			}
+			and = append(and, order[i]+" > ?")
+			args = append(args, last[i])
+			or = append(or, "("+strings.Join(and, " AND ")+")")
+		}
+		query += " WHERE " + strings.Join(or, " OR ")
+	}
+	return query + " ORDER BY " + strings.Join(order, ", ") + fmt.Sprintf(" LIMIT %d", chunkSize), args
+}
+
+// rowData converts the scanned values of a row to strings keyed by column name.
+func rowData(columns []string, results []interface{}) map[string]interface{} {
+	data := make(map[string]interface{})
+	for i := range columns {
+		res := fmt.Sprint(*(results[i].(*interface{})))
+
+		var x interface{} = *(results[i].(*interface{}))
+		if value, ok := x.([]uint8); ok {
+			res = B2S(value)
+		}
+		data[columns[i]] = res
+	}
+	return data
+}
+
+// tableInfo holds the columns of a table needed to key its rows.
+type tableInfo struct {
+	columns []string
+	// primary is the primary key, used to order the rows when copying
+	primary []string
+	keys    []string
+}
+
+// describeTable gets the columns and the key columns of a table, the configured id columns
+// of the table if any or else its primary key. Tables without either are keyed on their rowid.
+func describeTable(db *sql.DB, table string, idColumns map[string][]string) (tableInfo, error) {
+	var info tableInfo
+	rows, err := db.Query("PRAGMA table_info(" + quoteIdent(table) + ")")
+	if err != nil {
+		return info, err
+	}
+	defer rows.Close()
+
+	keys := make(map[int]string)
+	for rows.Next() {
+		var (
+			cid        int
+			name       string
+			colType    string
+			notNull    int
+			defaultVal interface{}
+			pk         int
+		)
+		if err := rows.Scan(&cid, &name, &colType, &notNull, &defaultVal, &pk); err != nil {
+			return info, err
+		}
+		info.columns = append(info.columns, name)
+		// pk is the 1-based position of the column in the primary key
+		if pk > 0 {
+			keys[pk] = name
+		}
+	}
+	for i := 1; i <= len(keys); i++ {
+		info.primary = append(info.primary, keys[i])
+	}
+	info.keys = info.primary
+	if override, ok := idColumns[table]; ok && len(override) > 0 {
+		for _, k := range override {
+			if !info.hasColumn(k) {
+				log.With("table", table).Errorf("id column %s does not exist, using the primary key", k)
+				return info, rows.Err()
+			}
+		}
+		info.keys = override
+	}
+	return info, rows.Err()
+}
+
+// selectColumns returns the columns to select for a row, the rowid is selected as _id
+// for tables without a primary key.
+func (info tableInfo) selectColumns() string {
+	if len(info.keys) == 0 {
+		return "rowid AS _id, *"
+	}
+	return "*"
+}
+
+// idColumns returns the columns needed to compute the _id of a row.
+func (info tableInfo) idColumns() string {
+	if len(info.keys) == 0 {
+		return "rowid AS _id"
+	}
+	cols := make([]string, len(info.keys))
+	for i, k := range info.keys {
+		cols[i] = quoteIdent(k)
+	}
+	return strings.Join(cols, ", ")
+}
+
+// hasColumn checks whether the table has a column, rowid is always available.
+func (info tableInfo) hasColumn(name string) bool {
+	if strings.EqualFold(name, "rowid") {
+		return true
+	}
+	for _, c := range info.columns {
+		if c == name {
+			return true
+		}
+	}
+	return false
+}
+
+// setID uses the key columns of the row as _id, values of composite keys are joined with "_".
+// Rows that already carry an _id column or that miss a key column are left untouched.
+func setID(keys []string, data map[string]interface{}) {
+	if _, ok := data["_id"]; ok || len(keys) == 0 {
+		return
+	}
+	for _, k := range keys {
+		if _, ok := data[k]; !ok {
+			return
+		}
+	}
+	if len(keys) == 1 {
+		data["_id"] = data[keys[0]]
+		return
+	}
+	parts := make([]string, len(keys))
+	for i, k := range keys {
+		parts[i] = fmt.Sprintf("%v", data[k])
+	}
+	data["_id"] = strings.Join(parts, "_")
+}
+
+// quoteIdent quotes a table or column name for use in a query.
+func quoteIdent(name string) string {
+	return `"` + strings.Replace(name, `"`, `""`, -1) + `"`
 }
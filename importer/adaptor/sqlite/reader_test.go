@@ -0,0 +1,83 @@
+package sqlite
+
+import (
+	"database/sql"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/appbaseio/abc/importer/client"
+	"github.com/appbaseio/abc/importer/commitlog"
+	"github.com/appbaseio/abc/importer/message"
+	"github.com/appbaseio/abc/importer/message/ops"
+)
+
+func TestReaderResume(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "copy.db")
+	db, err := sql.Open("sqlite3", path)
+	if err != nil {
+		t.Fatalf("unable to open database, %s", err)
+	}
+	defer db.Close()
+	for _, stmt := range []string{
+		"CREATE TABLE users (id INTEGER PRIMARY KEY, name TEXT)",
+		"CREATE TABLE logs (name TEXT)",
+		"INSERT INTO users VALUES (1, 'a'), (2, 'b'), (10, 'c')",
+		"INSERT INTO logs VALUES ('x'), ('y'), ('z')",
+	} {
+		if _, err := db.Exec(stmt); err != nil {
+			t.Fatalf("unable to setup database, %s", err)
+		}
+	}
+
+	c, err := NewClient(WithURI(path))
+	if err != nil {
+		t.Fatalf("unable to create client, %s", err)
+	}
+	s, err := c.Connect()
+	if err != nil {
+		t.Fatalf("unable to connect, %s", err)
+	}
+	defer c.Close()
+
+	resumeMap := map[string]client.MessageSet{
+		"users": {Msg: message.From(ops.Insert, "users", map[string]interface{}{"id": "2", "_id": "2"}), Mode: commitlog.Complete},
+		"logs":  {Msg: message.From(ops.Insert, "logs", map[string]interface{}{"name": "x", "_id": "1"})},
+	}
+	done := make(chan struct{})
+	defer close(done)
+	msgChan, err := newReader(false, nil, 2, 2).Read(resumeMap, func(string) bool { return true })(s, done)
+	if err != nil {
+		t.Fatalf("unexpected Read error, %s", err)
+	}
+
+	got := map[string][]interface{}{}
+	for m := range msgChan {
+		got[m.Msg.Namespace()] = append(got[m.Msg.Namespace()], m.Msg.Data()["_id"])
+	}
+	expected := map[string][]interface{}{
+		"users": {"10"},
+		"logs":  {"2", "3"},
+	}
+	if !reflect.DeepEqual(got, expected) {
+		t.Errorf("wrong rows, expected %v, got %v", expected, got)
+	}
+}
+
+func TestChunkQuery(t *testing.T) {
+	info := tableInfo{primary: []string{"host", "ts"}, keys: []string{"host", "ts"}}
+	query, args := info.chunkQuery("logs", []interface{}{"a", "10"}, 100)
+	expected := `SELECT * FROM "logs" WHERE ("host" > ?) OR ("host" = ? AND "ts" > ?) ORDER BY "host", "ts" LIMIT 100`
+	if query != expected {
+		t.Errorf("wrong query, expected\n%s\ngot\n%s", expected, query)
+	}
+	if expectedArgs := []interface{}{"a", "a", "10"}; !reflect.DeepEqual(args, expectedArgs) {
+		t.Errorf("wrong args, expected %v, got %v", expectedArgs, args)
+	}
+
+	query, _ = tableInfo{}.chunkQuery("logs", nil, 100)
+	expected = `SELECT rowid, rowid AS _id, * FROM "logs" ORDER BY rowid LIMIT 100`
+	if query != expected {
+		t.Errorf("wrong query, expected\n%s\ngot\n%s", expected, query)
+	}
+}
@@ -1,7 +1,9 @@
 package sqlite
 
 import (
+	"fmt"
 	"sync"
+	"time"
 
 	adaptor "github.com/appbaseio/abc/importer/adaptor"
 	"github.com/appbaseio/abc/importer/client"
@@ -15,7 +17,12 @@ const (
 	sampleConfig = `{
         "uri" : "${SQLITE_URI}"
         // "timeout": "30s", // default to 30s
-        // "tail": false // enable tailing
+        // "tail": false, // enable tailing
+        // "watermark": "updated_at", // column used to find changed rows when tailing, defaults to rowid which only finds new rows
+        // "poll_interval": "5s", // how often the database is checked for modifications, defaults to 5s
+        // "id_columns": {"logs": ["host", "ts"]}, // columns used as _id per table, defaults to the primary key or rowid
+        // "chunk_size": 10000, // rows read per query when copying a table, defaults to 10000
+        // "concurrency": 1 // number of tables copied at the same time, defaults to 1
     }`
 )
 
@@ -24,7 +31,12 @@ var _ adaptor.Adaptor = &SQLITE{}
 // SQLITE is an adaptor
 type SQLITE struct {
 	adaptor.BaseConfig
-	Tail bool `json:"tail" doc:"if tail is set, database will be watched for changes"`
+	Tail         bool                `json:"tail" doc:"if tail is set, database will be watched for changes"`
+	Watermark    string              `json:"watermark" doc:"column that increases whenever a row changes, such as updated_at, defaults to rowid which only finds inserted rows and misses the updates"`
+	PollInterval string              `json:"poll_interval" doc:"how often the database is checked for modifications when tailing, defaults to 5s"`
+	IDColumns    map[string][]string `json:"id_columns" doc:"columns used as _id per table, defaults to the primary key or the rowid"`
+	ChunkSize    int                 `json:"chunk_size" doc:"number of rows read per query when copying a table, defaults to 10000"`
+	Concurrency  int                 `json:"concurrency" doc:"number of tables copied at the same time, defaults to 1"`
 }
 
 func init() {
@@ -43,7 +55,34 @@ func (sl *SQLITE) Client() (client.Client, error) {
 
 // Reader ...
 func (sl *SQLITE) Reader() (client.Reader, error) {
-	return newReader(sl.Tail), nil
+	chunkSize := sl.ChunkSize
+	if chunkSize == 0 {
+		chunkSize = DefaultChunkSize
+	}
+	concurrency := sl.Concurrency
+	if concurrency == 0 {
+		concurrency = 1
+	}
+	if chunkSize < 0 || concurrency < 0 {
+		return nil, fmt.Errorf("chunk_size and concurrency must be positive")
+	}
+	reader := newReader(sl.Tail, sl.IDColumns, chunkSize, concurrency)
+	if sl.Tail {
+		watermark := sl.Watermark
+		if watermark == "" {
+			watermark = DefaultWatermark
+		}
+		interval := DefaultPollInterval
+		if sl.PollInterval != "" {
+			var err error
+			interval, err = time.ParseDuration(sl.PollInterval)
+			if err != nil || interval <= 0 {
+				return nil, fmt.Errorf("invalid poll_interval %q", sl.PollInterval)
+			}
+		}
+		return newTailer(reader, watermark, interval), nil
+	}
+	return reader, nil
 }
 
 // Writer ...
@@ -0,0 +1,410 @@
+package sqlite
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/appbaseio/abc/importer/client"
+	"github.com/appbaseio/abc/importer/commitlog"
+	"github.com/appbaseio/abc/importer/message"
+	"github.com/appbaseio/abc/importer/message/ops"
+	"github.com/appbaseio/abc/log"
+)
+
+const (
+	// DefaultPollInterval is the time waited between two checks of the database for modifications.
+	DefaultPollInterval = 5 * time.Second
+
+	// DefaultWatermark is the column used to find changed rows when none is configured.
+	DefaultWatermark = "rowid"
+
+	// nullWatermark is what quote() returns for the watermark of an empty table.
+	nullWatermark = "NULL"
+
+	// pollRetries is the number of checks in a row that may fail before the tailing stops.
+	pollRetries = 5
+)
+
+var (
+	_ client.Reader    = &Tailer{}
+	_ client.ErrReader = &Tailer{}
+)
+
+// Tailer copies the tables with a Reader and then polls the database for modifications,
+// reading again the rows whose watermark column advanced and detecting the deleted rows.
+type Tailer struct {
+	reader    client.Reader
+	watermark string
+	interval  time.Duration
+	idColumns map[string][]string
+
+	// err is the error that stopped the tailing
+	mu  sync.Mutex
+	err error
+}
+
+func newTailer(reader *Reader, watermark string, interval time.Duration) client.Reader {
+	return &Tailer{reader: reader, watermark: watermark, interval: interval, idColumns: reader.idColumns}
+}
+
+// Err returns the error that stopped the tailing, the pipeline fails with it.
+func (t *Tailer) Err() error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.err
+}
+
+// fail stops the tailing with err.
+func (t *Tailer) fail(err error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.err = err
+}
+
+// watchedTable holds the tailing state of a table.
+type watchedTable struct {
+	name string
+	info tableInfo
+	// last is the highest watermark read, as an SQL literal returned by quote()
+	last string
+	// ids holds the _id of every row sent, the table is only searched for deleted rows when it
+	// holds fewer or more rows
+	ids map[interface{}]struct{}
+}
+
+// Read copies the tables and then tails their changes. The watermark of every message is sent as its
+// Timestamp when it is an integer so that a restart resumes from the last row processed.
+func (t *Tailer) Read(resumeMap map[string]client.MessageSet, filterFn client.NsFilterFunc) client.MessageChanFunc {
+	return func(s client.Session, done chan struct{}) (chan client.MessageSet, error) {
+		session := s.(*Session)
+		db := session.db
+		if t.watermark == DefaultWatermark {
+			log.With("db", session.dbName).Infoln("the rowid watermark only finds new rows, updates will not be synced")
+		}
+
+		names, err := tableNames(db)
+		if err != nil {
+			return nil, err
+		}
+		var tables []*watchedTable
+		copyTables := make(map[string]bool)
+		readerResume := make(map[string]client.MessageSet)
+		for _, name := range names {
+			if !filterFn(name) {
+				continue
+			}
+			info, err := describeTable(db, name, t.idColumns)
+			if err != nil {
+				return nil, err
+			}
+			if !info.hasColumn(t.watermark) {
+				log.With("db", session.dbName).With("table", name).Infof("table has no column %s, changes will not be synced", t.watermark)
+				copyTables[name] = true
+				if m, ok := resumeMap[name]; ok {
+					readerResume[name] = m
+				}
+				continue
+			}
+			wt := &watchedTable{name: name, info: info}
+			// rows changed during the copy are read again once it completes
+			wt.last, err = t.maxWatermark(db, name)
+			if err != nil {
+				return nil, err
+			}
+			if m, ok := resumeMap[name]; ok && m.Timestamp > 0 {
+				wt.last = strconv.FormatInt(m.Timestamp, 10)
+				if m.Mode != commitlog.Sync {
+					// the copy continues after the last row read
+					copyTables[name] = true
+					readerResume[name] = m
+				}
+			} else {
+				copyTables[name] = true
+			}
+			// deletes are detected against the rows present before the copy
+			wt.ids, err = rowIDs(db, name, info)
+			if err != nil {
+				return nil, err
+			}
+			tables = append(tables, wt)
+		}
+
+		copyFilter := func(table string) bool {
+			if !copyTables[table] {
+				log.With("db", session.dbName).With("table", table).Infoln("copy already complete, skipping...")
+				return false
+			}
+			return filterFn(table)
+		}
+		readFunc := t.reader.Read(readerResume, copyFilter)
+		msgChan, err := readFunc(s, done)
+		if err != nil {
+			return nil, err
+		}
+
+		lastTS := make(map[string]int64)
+		for _, wt := range tables {
+			lastTS[wt.name] = watermarkTS(wt.last)
+		}
+
+		out := make(chan client.MessageSet)
+		go func() {
+			defer close(out)
+			// read until reader done
+			for msg := range msgChan {
+				msg.Timestamp = lastTS[msg.Msg.Namespace()]
+				out <- msg
+			}
+
+			// data_version changes when another connection modifies the database file,
+			// it has to be read on the same connection every time
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+			conn, err := db.Conn(ctx)
+			if err != nil {
+				log.With("db", session.dbName).Errorf("unable to open connection for tailing, %s", err)
+				t.fail(fmt.Errorf("unable to open connection for tailing, %s", err))
+				return
+			}
+			defer conn.Close()
+
+			// start tailing
+			log.With("db", session.dbName).Infoln("Listening for changes...")
+			var version int64 = -1
+			// failures counts the checks that failed in a row, the database may be locked
+			failures := 0
+			ticker := time.NewTicker(t.interval)
+			defer ticker.Stop()
+			for {
+				var current int64
+				if err := conn.QueryRowContext(ctx, "PRAGMA data_version").Scan(&current); err != nil {
+					log.With("db", session.dbName).Errorf("error reading data_version, %s", err)
+					failures++
+					if failures >= pollRetries {
+						t.fail(fmt.Errorf("unable to read data_version, %s", err))
+						return
+					}
+				} else if current != version {
+					var pollErr error
+					for _, wt := range tables {
+						if err := t.pollChanges(session, wt, out, done); err != nil {
+							log.With("db", session.dbName).With("table", wt.name).Errorf("error reading changes, %s", err)
+							pollErr = fmt.Errorf("unable to read the changes of table %s, %s", wt.name, err)
+						}
+					}
+					if pollErr == nil {
+						// the tables are checked again until every one was read
+						version = current
+						failures = 0
+					} else if failures++; failures >= pollRetries {
+						t.fail(pollErr)
+						return
+					}
+				} else {
+					failures = 0
+				}
+				select {
+				case <-done:
+					log.With("db", session.dbName).Infoln("tailing stopping...")
+					return
+				case <-ticker.C:
+				}
+			}
+		}()
+
+		return out, nil
+	}
+}
+
+func tableNames(db *sql.DB) ([]string, error) {
+	rows, err := db.Query("SELECT name FROM sqlite_master WHERE type='table'")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var names []string
+	for rows.Next() {
+		var name string
+		if err := rows.Scan(&name); err != nil {
+			return nil, err
+		}
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names, rows.Err()
+}
+
+// maxWatermark returns the highest watermark of a table as an SQL literal.
+func (t *Tailer) maxWatermark(db *sql.DB, table string) (string, error) {
+	var last string
+	err := db.QueryRow("SELECT quote(MAX(" + quoteIdent(t.watermark) + ")) FROM " + quoteIdent(table)).Scan(&last)
+	return last, err
+}
+
+// watermarkTS returns an integer watermark for use as the message Timestamp, other
+// watermarks cannot be resumed from and 0 is returned.
+func watermarkTS(literal string) int64 {
+	ts, err := strconv.ParseInt(literal, 10, 64)
+	if err != nil {
+		return 0
+	}
+	return ts
+}
+
+// changesQuery selects the rows whose watermark is at least the last one read, rows
+// sharing the last watermark are read again in case some were written after the last poll.
+func (t *Tailer) changesQuery(wt *watchedTable) string {
+	wm := quoteIdent(t.watermark)
+	query := "SELECT quote(" + wm + "), " + wt.info.selectColumns() + " FROM " + quoteIdent(wt.name)
+	if wt.last == nullWatermark {
+		query += " WHERE " + wm + " IS NOT NULL"
+	} else {
+		query += " WHERE " + wm + " >= " + wt.last
+	}
+	return query + " ORDER BY " + wm
+}
+
+// rowIDs reads the _id of every row of a table.
+func rowIDs(db *sql.DB, table string, info tableInfo) (map[interface{}]struct{}, error) {
+	rows, err := db.Query("SELECT " + info.idColumns() + " FROM " + quoteIdent(table))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	columns, err := rows.Columns()
+	if err != nil {
+		return nil, err
+	}
+	ids := make(map[interface{}]struct{})
+	for rows.Next() {
+		results := make([]interface{}, len(columns))
+		for i := range results {
+			var temp interface{}
+			results[i] = &temp
+		}
+		if err := rows.Scan(results...); err != nil {
+			return nil, err
+		}
+		data := rowData(columns, results)
+		setID(info.keys, data)
+		ids[data["_id"]] = struct{}{}
+	}
+	return ids, rows.Err()
+}
+
+// pollChanges sends the rows of a table changed or deleted since the last poll.
+func (t *Tailer) pollChanges(session *Session, wt *watchedTable, out chan<- client.MessageSet, done chan struct{}) error {
+	if err := t.readChanges(session, wt, out, done); err != nil {
+		return err
+	}
+	select {
+	case <-done:
+		return nil
+	default:
+	}
+	return readDeletes(session, wt, out, done)
+}
+
+// readChanges sends the rows of a table inserted or updated since the last poll.
+func (t *Tailer) readChanges(session *Session, wt *watchedTable, out chan<- client.MessageSet, done chan struct{}) error {
+	rows, err := session.db.Query(t.changesQuery(wt))
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	columns, err := rows.Columns()
+	if err != nil {
+		return err
+	}
+	for rows.Next() {
+		results := make([]interface{}, len(columns))
+		for i := range results {
+			var temp interface{}
+			results[i] = &temp
+		}
+		if err := rows.Scan(results...); err != nil {
+			return err
+		}
+		last := B2S(toBytes(*(results[0].(*interface{}))))
+		data := rowData(columns[1:], results[1:])
+		setID(wt.info.keys, data)
+
+		op := ops.Insert
+		if _, ok := wt.ids[data["_id"]]; ok {
+			op = ops.Update
+		}
+		wt.ids[data["_id"]] = struct{}{}
+		wt.last = last
+		if !send(out, done, client.MessageSet{
+			Msg:       message.From(op, wt.name, data),
+			Timestamp: watermarkTS(last),
+			Mode:      commitlog.Sync,
+		}) {
+			return nil
+		}
+	}
+	return rows.Err()
+}
+
+// readDeletes sends the rows of a table deleted since the last poll. The keys of the table are
+// only read when its number of rows differs from the number of rows sent.
+func readDeletes(session *Session, wt *watchedTable, out chan<- client.MessageSet, done chan struct{}) error {
+	var count int
+	if err := session.db.QueryRow("SELECT COUNT(*) FROM " + quoteIdent(wt.name)).Scan(&count); err != nil {
+		return err
+	}
+	if count == len(wt.ids) {
+		return nil
+	}
+	current, err := rowIDs(session.db, wt.name, wt.info)
+	if err != nil {
+		return err
+	}
+	for id := range wt.ids {
+		if _, ok := current[id]; ok {
+			continue
+		}
+		if !send(out, done, client.MessageSet{
+			Msg:       message.From(ops.Delete, wt.name, map[string]interface{}{"_id": id}),
+			Timestamp: watermarkTS(wt.last),
+			Mode:      commitlog.Sync,
+		}) {
+			return nil
+		}
+		delete(wt.ids, id)
+	}
+	// rows without a watermark are only known from the keys of the table
+	for id := range current {
+		wt.ids[id] = struct{}{}
+	}
+	return nil
+}
+
+// toBytes returns the text of a value returned by quote().
+func toBytes(v interface{}) []byte {
+	switch v := v.(type) {
+	case []byte:
+		return v
+	case string:
+		return []byte(v)
+	}
+	return []byte(nullWatermark)
+}
+
+// send sends a message unless done is closed first.
+func send(out chan<- client.MessageSet, done chan struct{}, msg client.MessageSet) bool {
+	select {
+	case out <- msg:
+		return true
+	case <-done:
+		return false
+	}
+}
@@ -0,0 +1,191 @@
+package sqlite
+
+import (
+	"database/sql"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/appbaseio/abc/importer/client"
+	"github.com/appbaseio/abc/importer/message/ops"
+)
+
+type tailedMsg struct {
+	op    ops.Op
+	table string
+	id    interface{}
+	name  interface{}
+}
+
+func readMsg(t *testing.T, msgChan chan client.MessageSet) tailedMsg {
+	select {
+	case m := <-msgChan:
+		data := m.Msg.Data()
+		return tailedMsg{m.Msg.OP(), m.Msg.Namespace(), data["_id"], data["name"]}
+	case <-time.After(5 * time.Second):
+		t.Fatal("timed out waiting for message")
+	}
+	return tailedMsg{}
+}
+
+func TestTailer(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "tail.db")
+	db, err := sql.Open("sqlite3", path)
+	if err != nil {
+		t.Fatalf("unable to open database, %s", err)
+	}
+	defer db.Close()
+	for _, stmt := range []string{
+		"CREATE TABLE users (id INTEGER PRIMARY KEY, name TEXT, updated_at INTEGER)",
+		"CREATE TABLE logs (name TEXT, updated_at INTEGER)",
+		"INSERT INTO users VALUES (1, 'a', 1), (2, 'b', 1)",
+		"INSERT INTO logs VALUES ('x', 1)",
+	} {
+		if _, err := db.Exec(stmt); err != nil {
+			t.Fatalf("unable to setup database, %s", err)
+		}
+	}
+
+	c, err := NewClient(WithURI(path))
+	if err != nil {
+		t.Fatalf("unable to create client, %s", err)
+	}
+	s, err := c.Connect()
+	if err != nil {
+		t.Fatalf("unable to connect, %s", err)
+	}
+	defer c.Close()
+
+	done := make(chan struct{})
+	defer close(done)
+	tailer := newTailer(newReader(true, map[string][]string{"logs": {"name"}}, 1, 2), "updated_at", 10*time.Millisecond)
+	msgChan, err := tailer.Read(map[string]client.MessageSet{}, func(string) bool { return true })(s, done)
+	if err != nil {
+		t.Fatalf("unexpected Read error, %s", err)
+	}
+
+	copied := map[tailedMsg]bool{}
+	for i := 0; i < 3; i++ {
+		copied[readMsg(t, msgChan)] = true
+	}
+	expectedCopy := map[tailedMsg]bool{
+		{ops.Insert, "users", "1", "a"}: true,
+		{ops.Insert, "users", "2", "b"}: true,
+		{ops.Insert, "logs", "x", "x"}:  true,
+	}
+	if !reflect.DeepEqual(copied, expectedCopy) {
+		t.Fatalf("wrong copy, expected %v, got %v", expectedCopy, copied)
+	}
+
+	// rows sharing the last watermark are read again after the copy
+	for i := 0; i < 3; i++ {
+		if m := readMsg(t, msgChan); m.op != ops.Update {
+			t.Fatalf("wrong op for %v, expected update", m)
+		}
+	}
+
+	for _, stmt := range []string{
+		"UPDATE users SET name = 'c', updated_at = 2 WHERE id = 2",
+		"DELETE FROM users WHERE id = 1",
+		"INSERT INTO users VALUES (3, 'd', 3)",
+	} {
+		if _, err := db.Exec(stmt); err != nil {
+			t.Fatalf("unable to change database, %s", err)
+		}
+	}
+
+	expected := []tailedMsg{
+		{ops.Update, "users", "2", "c"},
+		{ops.Insert, "users", "3", "d"},
+		{ops.Delete, "users", "1", nil},
+	}
+	var got []tailedMsg
+	for len(got) < len(expected) {
+		m := readMsg(t, msgChan)
+		if m.table == "logs" {
+			continue
+		}
+		got = append(got, m)
+	}
+	if !reflect.DeepEqual(got, expected) {
+		t.Errorf("wrong changes, expected %v, got %v", expected, got)
+	}
+}
+
+func TestTailerErr(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "tail.db")
+	db, err := sql.Open("sqlite3", path)
+	if err != nil {
+		t.Fatalf("unable to open database, %s", err)
+	}
+	defer db.Close()
+	for _, stmt := range []string{
+		"CREATE TABLE users (id INTEGER PRIMARY KEY, name TEXT)",
+		"INSERT INTO users VALUES (1, 'a')",
+	} {
+		if _, err := db.Exec(stmt); err != nil {
+			t.Fatalf("unable to setup database, %s", err)
+		}
+	}
+
+	c, err := NewClient(WithURI(path))
+	if err != nil {
+		t.Fatalf("unable to create client, %s", err)
+	}
+	s, err := c.Connect()
+	if err != nil {
+		t.Fatalf("unable to connect, %s", err)
+	}
+	defer c.Close()
+
+	done := make(chan struct{})
+	defer close(done)
+	tailer := newTailer(newReader(true, nil, 10, 1), DefaultWatermark, 10*time.Millisecond)
+	msgChan, err := tailer.Read(map[string]client.MessageSet{}, func(string) bool { return true })(s, done)
+	if err != nil {
+		t.Fatalf("unexpected Read error, %s", err)
+	}
+	readMsg(t, msgChan)
+	// the messages are read while the table is dropped, a reader blocked on sending one keeps its lock
+	dropped := make(chan error, 1)
+	go func() {
+		_, err := db.Exec("DROP TABLE users")
+		dropped <- err
+	}()
+
+	// the tailing stops once the table could not be read on pollRetries checks
+	timeout := time.After(5 * time.Second)
+	for {
+		select {
+		case _, ok := <-msgChan:
+			if ok {
+				continue
+			}
+		case <-timeout:
+			t.Fatal("timed out waiting for the tailing to stop")
+		}
+		break
+	}
+	if err := <-dropped; err != nil {
+		t.Fatalf("unable to drop table, %s", err)
+	}
+	if err := tailer.(client.ErrReader).Err(); err == nil {
+		t.Error("expected an error once the table was dropped")
+	}
+}
+
+func TestChangesQuery(t *testing.T) {
+	tailer := &Tailer{watermark: "updated_at"}
+	wt := &watchedTable{name: "users", info: tableInfo{keys: []string{"id"}}, last: nullWatermark}
+	expected := `SELECT quote("updated_at"), * FROM "users" WHERE "updated_at" IS NOT NULL ORDER BY "updated_at"`
+	if got := tailer.changesQuery(wt); got != expected {
+		t.Errorf("wrong query, expected %s, got %s", expected, got)
+	}
+
+	wt = &watchedTable{name: "logs", last: "'2021-01-01 10:00:00'"}
+	expected = `SELECT quote("updated_at"), rowid AS _id, * FROM "logs" WHERE "updated_at" >= '2021-01-01 10:00:00' ORDER BY "updated_at"`
+	if got := tailer.changesQuery(wt); got != expected {
+		t.Errorf("wrong query, expected %s, got %s", expected, got)
+	}
+}
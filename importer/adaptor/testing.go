@@ -53,6 +53,10 @@ func (m *MockClientErr) Writer(chan struct{}, *sync.WaitGroup) (client.Writer, e
 	return &client.MockWriter{}, nil
 }
 
+func (m *MockClientErr) Verify() error {
+	return nil
+}
+
 type MockWriterErr struct {
 	BaseConfig
 }
@@ -71,6 +75,10 @@ func (m *MockWriterErr) Writer(chan struct{}, *sync.WaitGroup) (client.Writer, e
 	return &client.MockErrWriter{}, nil
 }
 
+func (m *MockWriterErr) Verify() error {
+	return nil
+}
+
 // UnsupportedMock can be used for mocking tests that need no functional client interfaces.
 type UnsupportedMock struct {
 	BaseConfig
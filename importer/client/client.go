@@ -33,12 +33,30 @@ type Closer interface {
 	Close()
 }
 
+// Completer is implemented by the writers having work to do once every message was written,
+// Complete is called before Close when the source read everything without the pipeline failing.
+type Completer interface {
+	Complete() error
+}
+
+// Flusher is implemented by the writers buffering messages, Flush is called once the node received
+// its last message and an error sending them fails the pipeline.
+type Flusher interface {
+	Flush() error
+}
+
 // Reader represents the ability to send messages down the pipe and is only needed for
 // adaptors acting as a Source node.
 type Reader interface {
 	Read(map[string]MessageSet, NsFilterFunc) MessageChanFunc
 }
 
+// ErrReader is implemented by the readers failing after Read returned their channel, Err is
+// checked once the channel is closed and fails the pipeline.
+type ErrReader interface {
+	Err() error
+}
+
 // Writer represents all possible functions needing to be implemented to handle messages.
 type Writer interface {
 	Write(message.Msg) func(Session) (message.Msg, error)
@@ -0,0 +1,284 @@
+package mapping
+
+import (
+	"encoding/json"
+	"math"
+	"reflect"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// DefaultSampleSize is the number of documents a mapping is inferred from.
+const DefaultSampleSize = 1000
+
+// defaultDateFormat is the format of date fields without one
+const defaultDateFormat = "strict_date_optional_time"
+
+var (
+	// dateLayouts are the layouts of the strings inferred as dates, with their date format
+	dateLayouts = []struct {
+		layout string
+		format string
+	}{
+		{time.RFC3339, defaultDateFormat},
+		{"2006-01-02T15:04:05", defaultDateFormat},
+		{"2006-01-02", defaultDateFormat},
+		{"2006-01-02 15:04:05", sqlDateTimeFormat},
+		{"2006-01-02 15:04:05Z07:00", sqlDateTimeFormat},
+		{"2006/01/02", "yyyy/MM/dd"},
+		{"2006/01/02 15:04:05", "yyyy/MM/dd HH:mm:ss"},
+	}
+
+	// integers and decimals are the numbers read as strings, like the fields of a CSV file,
+	// numbers with leading zeros are codes kept as strings
+	integers = regexp.MustCompile(`^-?(0|[1-9][0-9]*)$`)
+	decimals = regexp.MustCompile(`^-?(0|[1-9][0-9]*)\.[0-9]+$`)
+
+	// geoJSONTypes are the types of GeoJSON geometries
+	geoJSONTypes = map[string]bool{
+		"Point":              true,
+		"MultiPoint":         true,
+		"LineString":         true,
+		"MultiLineString":    true,
+		"Polygon":            true,
+		"MultiPolygon":       true,
+		"GeometryCollection": true,
+	}
+
+	// metadataFields are not part of the mapping of a document
+	metadataFields = map[string]bool{"_id": true, "_index": true, "_type": true}
+)
+
+// latLng is implemented by the geo points of firestore documents.
+type latLng interface {
+	GetLatitude() float64
+	GetLongitude() float64
+}
+
+// Inferrer infers the mapping of documents from the values of their fields.
+type Inferrer struct {
+	props map[string]*inferred
+}
+
+// inferred is the type of a field inferred from its values.
+type inferred struct {
+	// kind is the field type, object for objects and string for keyword and text fields
+	kind string
+	// formats are the date formats of the values of a date
+	formats []string
+	// text is set when a string value is long or holds several words
+	text  bool
+	props map[string]*inferred
+}
+
+// NewInferrer returns an Inferrer without any document.
+func NewInferrer() *Inferrer {
+	return &Inferrer{props: make(map[string]*inferred)}
+}
+
+// Add infers the types of the fields of a document, they are merged with the types inferred
+// from the documents added before.
+func (in *Inferrer) Add(doc map[string]interface{}) {
+	for k, v := range doc {
+		if !metadataFields[k] {
+			observe(in.props, k, v)
+		}
+	}
+}
+
+// Mapping returns the mapping of the documents added. Fields whose values are all null are left
+// to dynamic mapping, fields having values of different types are strings, or objects when one of
+// their values is an object.
+func (in *Inferrer) Mapping() map[string]interface{} {
+	return map[string]interface{}{"properties": properties(in.props)}
+}
+
+func observe(props map[string]*inferred, k string, v interface{}) {
+	if f := infer(v); f != nil {
+		props[k] = merge(props[k], f)
+	}
+}
+
+// infer returns the type of a value, nil for null values.
+func infer(v interface{}) *inferred {
+	switch v := v.(type) {
+	case nil:
+		return nil
+	case time.Time:
+		return &inferred{kind: "date", formats: []string{defaultDateFormat}}
+	case *time.Time:
+		if v == nil {
+			return nil
+		}
+		return &inferred{kind: "date", formats: []string{defaultDateFormat}}
+	case latLng:
+		return &inferred{kind: "geo_point"}
+	case string:
+		return inferString(v)
+	case json.Number:
+		return inferString(v.String())
+	case []byte:
+		return nil
+	}
+	rv := reflect.ValueOf(v)
+	switch rv.Kind() {
+	case reflect.Ptr, reflect.Interface:
+		if rv.IsNil() {
+			return nil
+		}
+		return infer(rv.Elem().Interface())
+	case reflect.Bool:
+		return &inferred{kind: "boolean"}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return &inferred{kind: "long"}
+	case reflect.Float32, reflect.Float64:
+		f := rv.Float()
+		if f == math.Trunc(f) && math.Abs(f) < 1<<53 {
+			return &inferred{kind: "long"}
+		}
+		return &inferred{kind: "double"}
+	case reflect.String:
+		// named strings, like the ids of mongodb documents, are identifiers
+		return &inferred{kind: "string"}
+	case reflect.Slice, reflect.Array:
+		// arrays hold values of the type of the field
+		var f *inferred
+		for i := 0; i < rv.Len(); i++ {
+			if e := infer(rv.Index(i).Interface()); e != nil {
+				f = merge(f, e)
+			}
+		}
+		return f
+	case reflect.Map:
+		if rv.Type().Key().Kind() != reflect.String {
+			return nil
+		}
+		m := make(map[string]interface{}, rv.Len())
+		for _, k := range rv.MapKeys() {
+			m[k.String()] = rv.MapIndex(k).Interface()
+		}
+		return inferObject(m)
+	}
+	return nil
+}
+
+// inferString returns the type of a string, which may hold a date, a number or a boolean.
+func inferString(s string) *inferred {
+	if s == "" {
+		return nil
+	}
+	for _, l := range dateLayouts {
+		if _, err := time.Parse(l.layout, s); err == nil {
+			return &inferred{kind: "date", formats: []string{l.format}}
+		}
+	}
+	switch {
+	case integers.MatchString(s):
+		if _, err := strconv.ParseInt(s, 10, 64); err == nil {
+			return &inferred{kind: "long"}
+		}
+	case decimals.MatchString(s):
+		return &inferred{kind: "double"}
+	case s == "true" || s == "false":
+		return &inferred{kind: "boolean"}
+	}
+	return &inferred{kind: "string", text: len(s) > keywordLength || strings.ContainsAny(s, " \t\n")}
+}
+
+// inferObject returns the type of an object, a geo point when it holds a latitude and a longitude
+// and a geo shape when it is a GeoJSON geometry.
+func inferObject(m map[string]interface{}) *inferred {
+	if t, ok := m["type"].(string); ok && geoJSONTypes[t] {
+		if _, ok := m["coordinates"]; ok || t == "GeometryCollection" {
+			if t == "Point" {
+				return &inferred{kind: "geo_point"}
+			}
+			return &inferred{kind: "geo_shape"}
+		}
+	}
+	if len(m) == 2 {
+		lat, lon := infer(m["lat"]), infer(m["lon"])
+		if lat != nil && lon != nil && isNumber(lat) && isNumber(lon) {
+			return &inferred{kind: "geo_point"}
+		}
+	}
+	f := &inferred{kind: "object", props: make(map[string]*inferred)}
+	for k, v := range m {
+		observe(f.props, k, v)
+	}
+	return f
+}
+
+func isNumber(f *inferred) bool {
+	return f.kind == "long" || f.kind == "double"
+}
+
+// merge returns the type of a field having values of types a and b.
+func merge(a, b *inferred) *inferred {
+	if a == nil {
+		return b
+	}
+	switch {
+	case a.kind == b.kind:
+		for _, format := range b.formats {
+			if !contains(a.formats, format) {
+				a.formats = append(a.formats, format)
+			}
+		}
+		a.text = a.text || b.text
+		for k, f := range b.props {
+			a.props[k] = merge(a.props[k], f)
+		}
+		return a
+	case isNumber(a) && isNumber(b):
+		return &inferred{kind: "double"}
+	case a.kind == "object":
+		return a
+	case b.kind == "object":
+		return b
+	case strings.HasPrefix(a.kind, "geo_") && strings.HasPrefix(b.kind, "geo_"):
+		return &inferred{kind: "geo_shape"}
+	}
+	return &inferred{kind: "string", text: a.text || b.text}
+}
+
+// properties returns the mapping of the fields.
+func properties(props map[string]*inferred) map[string]interface{} {
+	m := make(map[string]interface{}, len(props))
+	for k, f := range props {
+		switch f.kind {
+		case "object":
+			m[k] = map[string]interface{}{"properties": properties(f.props)}
+		case "string":
+			if f.text {
+				m[k] = textField()
+			} else {
+				m[k] = fieldType("keyword")
+			}
+		case "date":
+			field := fieldType("date")
+			if len(f.formats) > 1 || f.formats[0] != defaultDateFormat {
+				formats := append([]string{}, f.formats...)
+				sort.Strings(formats)
+				field["format"] = strings.Join(formats, "||")
+			}
+			m[k] = field
+		default:
+			m[k] = fieldType(f.kind)
+		}
+	}
+	return m
+}
+
+func contains(values []string, v string) bool {
+	for _, value := range values {
+		if value == v {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,100 @@
+package mapping
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+)
+
+// point is a firestore like geo point
+type point struct{ lat, lng float64 }
+
+func (p *point) GetLatitude() float64  { return p.lat }
+func (p *point) GetLongitude() float64 { return p.lng }
+
+// objectID is a named string, like the ids of mongodb documents
+type objectID string
+
+var inferTests = []struct {
+	name     string
+	docs     []string
+	expected string
+}{
+	{
+		"json values",
+		[]string{
+			`{"_id":"1","name":"abc","count":1,"price":1.5,"active":true,"tags":["a","b"],"note":null}`,
+			`{"_id":"2","name":"a much longer name","count":2,"price":2,"active":false,"tags":[]}`,
+		},
+		`{"properties":{"active":{"type":"boolean"},"count":{"type":"long"},` +
+			`"name":{"fields":{"keyword":{"ignore_above":256,"type":"keyword"}},"type":"text"},` +
+			`"price":{"type":"double"},"tags":{"type":"keyword"}}}`,
+	},
+	{
+		"csv strings",
+		[]string{
+			`{"id":"1","zip":"02134","score":"1.25","paid":"true","day":"2021-03-04","at":"2021-03-04 10:00:00","empty":""}`,
+			`{"id":"2","zip":"10001","score":"3","paid":"false","day":"2021-03-05T10:00:00Z","at":"2021-03-05 11:30:00.5","empty":""}`,
+		},
+		`{"properties":{"at":{"format":"` + sqlDateTimeFormat + `","type":"date"},"day":{"type":"date"},"id":{"type":"long"},` +
+			`"paid":{"type":"boolean"},"score":{"type":"double"},"zip":{"type":"keyword"}}}`,
+	},
+	{
+		"dates of several formats",
+		[]string{`{"day":"2021/03/04"}`, `{"day":"2021-03-04"}`},
+		`{"properties":{"day":{"format":"strict_date_optional_time||yyyy/MM/dd","type":"date"}}}`,
+	},
+	{
+		"mixed types",
+		[]string{`{"a":1,"b":"x","c":true}`, `{"a":"x","b":{"d":1},"c":"2021-03-04"}`},
+		`{"properties":{"a":{"type":"keyword"},"b":{"properties":{"d":{"type":"long"}}},"c":{"type":"keyword"}}}`,
+	},
+	{
+		"nested objects and geo",
+		[]string{
+			`{"user":{"name":"abc","address":{"city":"Paris","pos":{"lat":48.85,"lon":2.35}}},"area":{"type":"Polygon","coordinates":[[[0,0],[1,0],[1,1],[0,0]]]},"at":{"type":"Point","coordinates":[2.35,48.85]}}`,
+			`{"user":{"age":30},"at":{"type":"LineString","coordinates":[[0,0],[1,1]]}}`,
+		},
+		`{"properties":{"area":{"type":"geo_shape"},"at":{"type":"geo_shape"},"user":{"properties":{"address":{"properties":{` +
+			`"city":{"type":"keyword"},"pos":{"type":"geo_point"}}},"age":{"type":"long"},"name":{"type":"keyword"}}}}}`,
+	},
+}
+
+func TestInferrer(t *testing.T) {
+	for _, it := range inferTests {
+		in := NewInferrer()
+		for _, doc := range it.docs {
+			var d map[string]interface{}
+			if err := json.Unmarshal([]byte(doc), &d); err != nil {
+				t.Fatalf("[%s] invalid document, %s", it.name, err)
+			}
+			in.Add(d)
+		}
+		b, _ := json.Marshal(in.Mapping())
+		if string(b) != it.expected {
+			t.Errorf("[%s] wrong mapping\nexpected: %s\ngot: %s", it.name, it.expected, b)
+		}
+	}
+}
+
+func TestInferrerGoValues(t *testing.T) {
+	now := time.Now()
+	in := NewInferrer()
+	in.Add(map[string]interface{}{
+		"_id":     objectID("5f1d"),
+		"owner":   objectID("5f1e"),
+		"created": now,
+		"updated": &now,
+		"where":   &point{48.85, 2.35},
+		"count":   int64(3),
+		"ratio":   float32(0.5),
+		"photo":   []byte("abc"),
+		"meta":    map[string]int{"views": 3},
+	})
+	b, _ := json.Marshal(in.Mapping())
+	expected := `{"properties":{"count":{"type":"long"},"created":{"type":"date"},"meta":{"properties":{"views":{"type":"long"}}},` +
+		`"owner":{"type":"keyword"},"ratio":{"type":"double"},"updated":{"type":"date"},"where":{"type":"geo_point"}}}`
+	if string(b) != expected {
+		t.Errorf("wrong mapping\nexpected: %s\ngot: %s", expected, b)
+	}
+}
@@ -1,8 +1,78 @@
 package mapping
 
-var (
-	// CurrentMapping contains the current mapping
-	CurrentMapping map[string]interface{}
-	// IsMappingSet contains true if a custom mapping is set
-	IsMappingSet = false
+import (
+	"fmt"
+	"path"
+	"strings"
 )
+
+// Mapper is implemented by the adaptors of sinks creating their indices with a mapping.
+type Mapper interface {
+	AddMapping(pattern string, mapping map[string]interface{}) error
+}
+
+// Mappings holds the mappings set for the indices of a sink, by index pattern.
+type Mappings struct {
+	indices []indexMapping
+	// fallback is the mapping of the indices no pattern matches
+	fallback map[string]interface{}
+}
+
+// indexMapping is the mapping of the indices matching any of its patterns.
+type indexMapping struct {
+	patterns []string
+	mapping  map[string]interface{}
+}
+
+// Add sets the mapping of the indices matching pattern, a comma separated list of index names
+// and wildcard expressions like logs-*. An empty pattern sets the mapping of the indices no
+// pattern matches. The mapping of a pattern added before is replaced.
+func (m *Mappings) Add(pattern string, mapping map[string]interface{}) error {
+	if mapping == nil {
+		return fmt.Errorf("no mapping for index pattern %q", pattern)
+	}
+	var patterns []string
+	for _, p := range strings.Split(pattern, ",") {
+		p = strings.TrimSpace(p)
+		if p == "" {
+			continue
+		}
+		if _, err := path.Match(p, ""); err != nil {
+			return fmt.Errorf("invalid index pattern %q, %s", p, err)
+		}
+		patterns = append(patterns, p)
+	}
+	if len(patterns) == 0 {
+		m.fallback = mapping
+		return nil
+	}
+	for i, im := range m.indices {
+		if strings.Join(im.patterns, ",") == strings.Join(patterns, ",") {
+			m.indices[i].mapping = mapping
+			return nil
+		}
+	}
+	m.indices = append(m.indices, indexMapping{patterns: patterns, mapping: mapping})
+	return nil
+}
+
+// For returns the mapping of an index, false when none is set for it. A pattern naming the index
+// wins over wildcard expressions, which are matched in the order they were added.
+func (m *Mappings) For(index string) (map[string]interface{}, bool) {
+	if m == nil {
+		return nil, false
+	}
+	for _, im := range m.indices {
+		if contains(im.patterns, index) {
+			return im.mapping, true
+		}
+	}
+	for _, im := range m.indices {
+		for _, p := range im.patterns {
+			if ok, _ := path.Match(p, index); ok {
+				return im.mapping, true
+			}
+		}
+	}
+	return m.fallback, m.fallback != nil
+}
@@ -0,0 +1,54 @@
+package mapping
+
+import (
+	"reflect"
+	"testing"
+)
+
+func keywordMapping(field string) map[string]interface{} {
+	return map[string]interface{}{"properties": map[string]interface{}{field: fieldType("keyword")}}
+}
+
+var mappingsTests = []struct {
+	index    string
+	expected map[string]interface{}
+}{
+	{"logs-2021", keywordMapping("logs")},
+	{"metrics-cpu", keywordMapping("metrics")},
+	{"users", keywordMapping("users")},
+	{"orders", keywordMapping("default")},
+}
+
+func TestMappings(t *testing.T) {
+	var m Mappings
+	if _, ok := m.For("users"); ok {
+		t.Fatalf("unexpected mapping without any set")
+	}
+	m.Add("", keywordMapping("default"))
+	m.Add("logs-*", keywordMapping("old"))
+	m.Add("metrics-*", keywordMapping("metrics"))
+	// users is named by the pattern, it wins over the wildcards added before
+	m.Add("other-*, users", keywordMapping("users"))
+	m.Add("logs-*", keywordMapping("logs"))
+	for _, mt := range mappingsTests {
+		got, ok := m.For(mt.index)
+		if !ok {
+			t.Errorf("[%s] no mapping", mt.index)
+			continue
+		}
+		if !reflect.DeepEqual(got, mt.expected) {
+			t.Errorf("[%s] wrong mapping, expected %v, got %v", mt.index, mt.expected, got)
+		}
+	}
+
+	if err := m.Add("logs-[", keywordMapping("logs")); err == nil {
+		t.Errorf("expected an error for an invalid pattern")
+	}
+	if err := m.Add("logs-*", nil); err == nil {
+		t.Errorf("expected an error without mapping")
+	}
+	var none *Mappings
+	if _, ok := none.For("users"); ok {
+		t.Errorf("unexpected mapping of nil mappings")
+	}
+}
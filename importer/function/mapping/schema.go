@@ -0,0 +1,321 @@
+package mapping
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+
+	"github.com/appbaseio/abc/importer/client"
+	"github.com/appbaseio/abc/importer/message/data"
+)
+
+// tableSchemaKey holds the schema in the data of the command message sent by the SQL readers.
+const tableSchemaKey = "_table_schema"
+
+const (
+	// keywordLength is the longest string column mapped as a keyword only, longer strings are
+	// text with a keyword subfield
+	keywordLength = 256
+
+	// sqlDateTimeFormat parses the dates and times of SQL databases, with or without a fraction
+	// of a second and a time zone
+	sqlDateTimeFormat = "yyyy-MM-dd HH:mm:ss[.SSSSSS][.SSSSS][.SSSS][.SSS][.SS][.S][XXX][X]"
+
+	dateFormat     = "yyyy-MM-dd||strict_date_optional_time||epoch_millis"
+	dateTimeFormat = sqlDateTimeFormat + "||strict_date_optional_time||epoch_millis"
+)
+
+var (
+	// latNames and lonNames are the suffixes of the columns of a latitude and longitude pair,
+	// the longest first
+	latNames = []string{"latitude", "lat"}
+	lonNames = []string{"longitude", "long", "lng", "lon"}
+
+	// typeModifiers are the words of a column type that do not change its mapping
+	typeModifiers = map[string]bool{"unsigned": true, "signed": true, "zerofill": true}
+)
+
+// Describer is implemented by the readers of SQL sources, Describe returns the schema of the
+// tables passing the filter.
+type Describer interface {
+	Describe(client.Session, client.NsFilterFunc) ([]Schema, error)
+}
+
+// Column is a column of a table, Type is its type as declared in the database, e.g. varchar(64).
+type Column struct {
+	Name string `json:"name"`
+	Type string `json:"type"`
+}
+
+// Schema holds the columns of a table, in their ordinal position.
+type Schema struct {
+	Table   string   `json:"table"`
+	Columns []Column `json:"columns"`
+}
+
+// GeoPoint is a geo_point field holding the values of a pair of latitude and longitude columns.
+type GeoPoint struct {
+	Field string
+	Lat   string
+	Lon   string
+}
+
+// FromSchema returns the mapping of the rows of the tables, the columns of the first table win
+// when several tables have a column of the same name. Columns of types without an equivalent
+// field type are left to dynamic mapping.
+func FromSchema(schemas ...Schema) map[string]interface{} {
+	props := map[string]interface{}{}
+	for _, s := range schemas {
+		for _, c := range s.Columns {
+			if _, ok := props[c.Name]; ok {
+				continue
+			}
+			if field := fieldMapping(c.Type); field != nil {
+				props[c.Name] = field
+			}
+		}
+		for _, g := range s.GeoPoints() {
+			if _, ok := props[g.Field]; !ok {
+				props[g.Field] = map[string]interface{}{"type": "geo_point"}
+			}
+		}
+	}
+	return map[string]interface{}{"properties": props}
+}
+
+// fieldMapping returns the mapping of a column type, nil for types without an equivalent.
+func fieldMapping(colType string) map[string]interface{} {
+	colType = strings.ToLower(strings.TrimSpace(colType))
+	// arrays hold values of their element type
+	if strings.HasSuffix(colType, "[]") {
+		return fieldMapping(strings.TrimSuffix(colType, "[]"))
+	}
+	base, params, unsigned := parseType(colType)
+	switch base {
+	case "tinyint", "smallint", "mediumint", "int2", "smallserial":
+		return fieldType("integer")
+	case "int", "integer", "int4", "serial":
+		if unsigned {
+			return fieldType("long")
+		}
+		return fieldType("integer")
+	case "bigint", "int8", "bigserial":
+		return fieldType("long")
+	case "decimal", "numeric", "dec", "fixed":
+		switch {
+		case len(params) == 2 && params[1] > 0:
+			return map[string]interface{}{"type": "scaled_float", "scaling_factor": math.Pow10(params[1])}
+		case len(params) > 0 && params[0] <= 18:
+			return fieldType("long")
+		}
+		return fieldType("double")
+	case "money", "smallmoney":
+		return map[string]interface{}{"type": "scaled_float", "scaling_factor": 100}
+	case "float", "real", "float4":
+		// float(p) is a double precision number above 24 bits of precision
+		if len(params) == 1 && params[0] > 24 {
+			return fieldType("double")
+		}
+		return fieldType("float")
+	case "double", "double precision", "float8":
+		return fieldType("double")
+	case "bool", "boolean":
+		return fieldType("boolean")
+	case "date":
+		return map[string]interface{}{"type": "date", "format": dateFormat}
+	case "datetime", "datetime2", "smalldatetime", "datetimeoffset", "timestamp", "timestamptz",
+		"timestamp without time zone", "timestamp with time zone":
+		return map[string]interface{}{"type": "date", "format": dateTimeFormat}
+	case "year":
+		return map[string]interface{}{"type": "date", "format": "yyyy"}
+	case "time", "timetz", "time without time zone", "time with time zone", "interval",
+		"char", "character", "nchar", "enum", "set", "uuid", "uniqueidentifier":
+		return fieldType("keyword")
+	case "varchar", "character varying", "nvarchar", "varchar2", "nvarchar2":
+		if len(params) == 1 && params[0] <= keywordLength {
+			return fieldType("keyword")
+		}
+		return textField()
+	case "text", "tinytext", "mediumtext", "longtext", "ntext", "clob", "citext":
+		return textField()
+	case "json", "jsonb":
+		return fieldType("object")
+	case "inet":
+		return fieldType("ip")
+	}
+	return nil
+}
+
+// parseType splits a column type like decimal(10,2) unsigned into its base type, its numeric
+// parameters and whether it is unsigned.
+func parseType(colType string) (string, []int, bool) {
+	var (
+		params []int
+		words  []string
+	)
+	if open := strings.Index(colType, "("); open >= 0 {
+		end := strings.Index(colType[open:], ")")
+		if end < 0 {
+			end = len(colType) - open
+		}
+		for _, p := range strings.Split(colType[open+1:open+end], ",") {
+			if n, err := strconv.Atoi(strings.TrimSpace(p)); err == nil {
+				params = append(params, n)
+			}
+		}
+		rest := ""
+		if open+end < len(colType) {
+			rest = colType[open+end+1:]
+		}
+		colType = colType[:open] + " " + rest
+	}
+	unsigned := false
+	for _, w := range strings.Fields(colType) {
+		if typeModifiers[w] {
+			unsigned = unsigned || w == "unsigned"
+			continue
+		}
+		words = append(words, w)
+	}
+	return strings.Join(words, " "), params, unsigned
+}
+
+func fieldType(t string) map[string]interface{} {
+	return map[string]interface{}{"type": t}
+}
+
+// textField is analyzed text with a keyword subfield, like strings mapped dynamically.
+func textField() map[string]interface{} {
+	return map[string]interface{}{
+		"type": "text",
+		"fields": map[string]interface{}{
+			"keyword": map[string]interface{}{"type": "keyword", "ignore_above": keywordLength},
+		},
+	}
+}
+
+// GeoPoints returns the geo_point fields of the pairs of latitude and longitude columns of the
+// table, like lat and lng or pickup_latitude and pickup_longitude. The field of a pair is named
+// location after the prefix of its columns, pairs whose field is a column are skipped.
+func (s Schema) GeoPoints() []GeoPoint {
+	numeric := map[string]string{}
+	for _, c := range s.Columns {
+		if field := fieldMapping(c.Type); field != nil {
+			switch field["type"] {
+			case "float", "double", "scaled_float":
+				numeric[strings.ToLower(c.Name)] = c.Name
+			}
+		}
+	}
+	var points []GeoPoint
+	for _, c := range s.Columns {
+		lat, ok := numeric[strings.ToLower(c.Name)]
+		if !ok {
+			continue
+		}
+		for _, latName := range latNames {
+			if !strings.HasSuffix(strings.ToLower(lat), latName) {
+				continue
+			}
+			prefix := lat[:len(lat)-len(latName)]
+			for _, lonName := range lonNames {
+				lon, ok := numeric[strings.ToLower(prefix)+lonName]
+				if !ok {
+					continue
+				}
+				g := GeoPoint{Field: locationField(prefix), Lat: lat, Lon: lon}
+				if !s.hasColumn(g.Field) {
+					points = append(points, g)
+				}
+				break
+			}
+			break
+		}
+	}
+	return points
+}
+
+func locationField(prefix string) string {
+	switch {
+	case prefix == "":
+		return "location"
+	case strings.HasSuffix(prefix, "_") || strings.HasSuffix(prefix, "-"):
+		return prefix + "location"
+	}
+	return prefix + "Location"
+}
+
+func (s Schema) hasColumn(name string) bool {
+	for _, c := range s.Columns {
+		if strings.EqualFold(c.Name, name) {
+			return true
+		}
+	}
+	return false
+}
+
+// Set sets the geo point field of a row holding both its latitude and longitude.
+func (g GeoPoint) Set(d data.Data) {
+	lat, ok := toFloat(d[g.Lat])
+	if !ok {
+		return
+	}
+	lon, ok := toFloat(d[g.Lon])
+	if !ok {
+		return
+	}
+	d[g.Field] = map[string]interface{}{"lat": lat, "lon": lon}
+}
+
+func toFloat(v interface{}) (float64, bool) {
+	switch v := v.(type) {
+	case float64:
+		return v, true
+	case float32:
+		return float64(v), true
+	case int:
+		return float64(v), true
+	case int64:
+		return float64(v), true
+	case string:
+		f, err := strconv.ParseFloat(v, 64)
+		return f, err == nil
+	case []byte:
+		f, err := strconv.ParseFloat(string(v), 64)
+		return f, err == nil
+	}
+	return 0, false
+}
+
+// Data returns the data of the command message carrying the schema to the writers, it only
+// holds maps and slices so that it is written to the commit log like documents.
+func (s Schema) Data() data.Data {
+	columns := make([]interface{}, len(s.Columns))
+	for i, c := range s.Columns {
+		columns[i] = map[string]interface{}{"name": c.Name, "type": c.Type}
+	}
+	return data.Data{tableSchemaKey: map[string]interface{}{
+		"table":   s.Table,
+		"columns": columns,
+	}}
+}
+
+// SchemaFrom returns the schema carried by the data of a command message, false when it holds
+// none.
+func SchemaFrom(d data.Data) (*Schema, bool, error) {
+	v, ok := d[tableSchemaKey]
+	if !ok {
+		return nil, false, nil
+	}
+	b, err := json.Marshal(v)
+	if err != nil {
+		return nil, true, err
+	}
+	s := &Schema{}
+	if err := json.Unmarshal(b, s); err != nil {
+		return nil, true, fmt.Errorf("invalid table schema, %s", err)
+	}
+	return s, true, nil
+}
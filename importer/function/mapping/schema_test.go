@@ -0,0 +1,130 @@
+package mapping
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+
+	"github.com/appbaseio/abc/importer/message/data"
+)
+
+var fieldMappingTests = []struct {
+	colType  string
+	expected string
+}{
+	{"int(11)", `{"type":"integer"}`},
+	{"int(10) unsigned", `{"type":"long"}`},
+	{"tinyint(1)", `{"type":"integer"}`},
+	{"bigint", `{"type":"long"}`},
+	{"decimal(10,2)", `{"scaling_factor":100,"type":"scaled_float"}`},
+	{"decimal(12,0)", `{"type":"long"}`},
+	{"numeric", `{"type":"double"}`},
+	{"money", `{"scaling_factor":100,"type":"scaled_float"}`},
+	{"double precision", `{"type":"double"}`},
+	{"float(7,4)", `{"type":"float"}`},
+	{"float(53)", `{"type":"double"}`},
+	{"nvarchar", `{"fields":{"keyword":{"ignore_above":256,"type":"keyword"}},"type":"text"}`},
+	{"boolean", `{"type":"boolean"}`},
+	{"date", `{"format":"` + dateFormat + `","type":"date"}`},
+	{"datetime(6)", `{"format":"` + dateTimeFormat + `","type":"date"}`},
+	{"timestamp with time zone", `{"format":"` + dateTimeFormat + `","type":"date"}`},
+	{"year(4)", `{"format":"yyyy","type":"date"}`},
+	{"time", `{"type":"keyword"}`},
+	{"varchar(64)", `{"type":"keyword"}`},
+	{"enum('a','b')", `{"type":"keyword"}`},
+	{"varchar(1024)", `{"fields":{"keyword":{"ignore_above":256,"type":"keyword"}},"type":"text"}`},
+	{"character varying", `{"fields":{"keyword":{"ignore_above":256,"type":"keyword"}},"type":"text"}`},
+	{"LONGTEXT", `{"fields":{"keyword":{"ignore_above":256,"type":"keyword"}},"type":"text"}`},
+	{"integer[]", `{"type":"integer"}`},
+	{"jsonb", `{"type":"object"}`},
+	{"inet", `{"type":"ip"}`},
+	{"blob", `null`},
+	{"geometry", `null`},
+}
+
+func TestFieldMapping(t *testing.T) {
+	for _, ft := range fieldMappingTests {
+		b, _ := json.Marshal(fieldMapping(ft.colType))
+		if string(b) != ft.expected {
+			t.Errorf("[%s] wrong mapping, expected %s, got %s", ft.colType, ft.expected, b)
+		}
+	}
+}
+
+var geoPointsTests = []struct {
+	name     string
+	columns  []Column
+	expected []GeoPoint
+}{
+	{
+		"lat and lng",
+		[]Column{{"id", "int"}, {"lat", "double"}, {"lng", "double"}},
+		[]GeoPoint{{"location", "lat", "lng"}},
+	},
+	{
+		"prefixed pairs",
+		[]Column{{"pickup_latitude", "decimal(9,6)"}, {"pickup_longitude", "decimal(9,6)"}, {"dropLat", "float"}, {"dropLon", "float"}},
+		[]GeoPoint{{"pickup_location", "pickup_latitude", "pickup_longitude"}, {"dropLocation", "dropLat", "dropLon"}},
+	},
+	{
+		"location column",
+		[]Column{{"lat", "double"}, {"lon", "double"}, {"location", "varchar(64)"}},
+		nil,
+	},
+	{
+		"not numeric",
+		[]Column{{"lat", "varchar(16)"}, {"lon", "double"}, {"flat", "int"}},
+		nil,
+	},
+}
+
+func TestGeoPoints(t *testing.T) {
+	for _, gt := range geoPointsTests {
+		points := Schema{Table: "t", Columns: gt.columns}.GeoPoints()
+		if !reflect.DeepEqual(points, gt.expected) {
+			t.Errorf("[%s] wrong geo points, expected %v, got %v", gt.name, gt.expected, points)
+		}
+	}
+}
+
+func TestFromSchema(t *testing.T) {
+	m := FromSchema(
+		Schema{Table: "stores", Columns: []Column{{"id", "int"}, {"lat", "double"}, {"lng", "double"}, {"photo", "blob"}}},
+		Schema{Table: "orders", Columns: []Column{{"id", "bigint"}, {"total", "decimal(10,2)"}}},
+	)
+	b, _ := json.Marshal(m)
+	expected := `{"properties":{"id":{"type":"integer"},"lat":{"type":"double"},"lng":{"type":"double"},` +
+		`"location":{"type":"geo_point"},"total":{"scaling_factor":100,"type":"scaled_float"}}}`
+	if string(b) != expected {
+		t.Errorf("wrong mapping\nexpected: %s\ngot: %s", expected, b)
+	}
+
+	d := data.Data{"lat": "48.8566", "lng": 2.3522}
+	GeoPoint{"location", "lat", "lng"}.Set(d)
+	if !reflect.DeepEqual(d["location"], map[string]interface{}{"lat": 48.8566, "lon": 2.3522}) {
+		t.Errorf("wrong geo point, got %v", d["location"])
+	}
+	d = data.Data{"lat": nil, "lng": 2.3522}
+	GeoPoint{"location", "lat", "lng"}.Set(d)
+	if _, ok := d["location"]; ok {
+		t.Errorf("unexpected geo point without latitude, got %v", d["location"])
+	}
+}
+
+func TestSchemaFrom(t *testing.T) {
+	s := Schema{Table: "orders", Columns: []Column{{"id", "bigint"}, {"total", "decimal(10,2)"}}}
+	// the schema goes through a command message
+	d := data.Data{}
+	b, _ := json.Marshal(s.Data())
+	json.Unmarshal(b, &d)
+	got, ok, err := SchemaFrom(d)
+	if !ok || err != nil {
+		t.Fatalf("no schema read back, %v", err)
+	}
+	if !reflect.DeepEqual(*got, s) {
+		t.Errorf("wrong schema read back, expected %+v, got %+v", s, *got)
+	}
+	if _, ok, _ := SchemaFrom(data.Data{"name": "abc"}); ok {
+		t.Errorf("unexpected schema in a row")
+	}
+}
@@ -8,6 +8,8 @@ package message
 
 import (
 	"fmt"
+	"reflect"
+	"sync/atomic"
 	"time"
 
 	"gopkg.in/mgo.v2/bson"
@@ -48,6 +50,110 @@ func WithConfirms(confirm chan struct{}, msg Msg) Msg {
 	return msg
 }
 
+// Copy returns a copy of a message holding its own data, acknowledged with confirm. The maps
+// and slices of the data are copied as well so that changing the copy leaves msg untouched.
+func Copy(msg Msg, confirm chan struct{}) Msg {
+	var d data.Data
+	if msg.Data() != nil {
+		d = copyValue(reflect.ValueOf(msg.Data())).Interface().(data.Data)
+	}
+	return &Base{
+		TS:        msg.Timestamp(),
+		NS:        msg.Namespace(),
+		Operation: msg.OP(),
+		MapData:   d,
+		confirm:   confirm,
+	}
+}
+
+// copyValue returns a deep copy of the maps and slices held by v, other values are shared.
+func copyValue(v reflect.Value) reflect.Value {
+	switch v.Kind() {
+	case reflect.Interface:
+		if v.IsNil() {
+			return v
+		}
+		c := reflect.New(v.Type()).Elem()
+		c.Set(copyValue(v.Elem()))
+		return c
+	case reflect.Map:
+		if v.IsNil() {
+			return v
+		}
+		c := reflect.MakeMapWithSize(v.Type(), v.Len())
+		iter := v.MapRange()
+		for iter.Next() {
+			c.SetMapIndex(iter.Key(), copyValue(iter.Value()))
+		}
+		return c
+	case reflect.Slice:
+		if v.IsNil() {
+			return v
+		}
+		c := reflect.MakeSlice(v.Type(), v.Len(), v.Len())
+		switch v.Type().Elem().Kind() {
+		case reflect.Interface, reflect.Map, reflect.Slice:
+			for i := 0; i < v.Len(); i++ {
+				c.Index(i).Set(copyValue(v.Index(i)))
+			}
+		default:
+			reflect.Copy(c, v)
+		}
+		return c
+	}
+	return v
+}
+
+// Split returns a copy of a message for each of the n nodes it is sent to, a single node gets
+// the message itself. When the message has a confirms channel, every copy gets its own and the
+// confirms of the message are closed once each copy was confirmed with its Confirmer.
+func Split(msg Msg, n int) []Msg {
+	if n == 1 {
+		return []Msg{msg}
+	}
+	source := msg.Confirms()
+	var s *split
+	if source != nil {
+		s = &split{remaining: int32(n), confirm: source}
+	}
+	msgs := make([]Msg, n)
+	for i := range msgs {
+		var confirm chan struct{}
+		if source != nil {
+			confirm = make(chan struct{})
+		}
+		c := Copy(msg, confirm).(*Base)
+		c.split = s
+		msgs[i] = c
+	}
+	return msgs
+}
+
+// split counts the copies of a message that are not confirmed yet.
+type split struct {
+	remaining int32
+	confirm   chan struct{}
+}
+
+// Confirmer returns the function confirming msg, nil when msg has no confirms channel. Confirming
+// the last copy of a split message confirms the message it was copied from.
+func Confirmer(msg Msg) func() {
+	confirm := msg.Confirms()
+	if confirm == nil {
+		return nil
+	}
+	var s *split
+	if m, ok := msg.(*Base); ok {
+		s = m.split
+	}
+	return func() {
+		close(confirm)
+		if s != nil && atomic.AddInt32(&s.remaining, -1) == 0 {
+			close(s.confirm)
+		}
+	}
+}
+
 // Base represents a standard message format for transporter data
 // if it does not meet your need, you can embed the struct and override whatever
 // methods needed to accurately represent the data structure.
@@ -57,6 +163,7 @@ type Base struct {
 	Operation ops.Op
 	MapData   data.Data
 	confirm   chan struct{}
+	split     *split
 }
 
 // Timestamp returns the time the object was created in transporter (i.e. it has no correlation
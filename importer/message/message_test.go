@@ -68,3 +68,92 @@ func TestID(t *testing.T) {
 		}
 	}
 }
+
+func TestCopy(t *testing.T) {
+	msg := From(ops.Update, "test", map[string]interface{}{
+		"_id":    "1",
+		"nested": map[string]interface{}{"name": "a"},
+		"list":   []interface{}{map[string]interface{}{"name": "a"}, "b"},
+		"bson":   bson.M{"name": "a"},
+		"bytes":  []byte("a"),
+	})
+	c := Copy(msg, nil)
+	if !reflect.DeepEqual(c.Data(), msg.Data()) {
+		t.Fatalf("wrong copy, expected %+v, got %+v", msg.Data(), c.Data())
+	}
+	if c.OP() != msg.OP() || c.Namespace() != msg.Namespace() || c.Timestamp() != msg.Timestamp() {
+		t.Errorf("wrong copy metadata, got %+v", c)
+	}
+	c.Data()["nested"].(map[string]interface{})["name"] = "b"
+	c.Data()["list"].([]interface{})[0].(map[string]interface{})["name"] = "b"
+	c.Data()["list"].([]interface{})[1] = "c"
+	c.Data()["bson"].(bson.M)["name"] = "b"
+	c.Data()["bytes"].([]byte)[0] = 'b'
+	expected := map[string]interface{}{
+		"_id":    "1",
+		"nested": map[string]interface{}{"name": "a"},
+		"list":   []interface{}{map[string]interface{}{"name": "a"}, "b"},
+		"bson":   bson.M{"name": "a"},
+		"bytes":  []byte("a"),
+	}
+	if !reflect.DeepEqual(msg.Data().AsMap(), expected) {
+		t.Errorf("copy shares its data, expected %+v, got %+v", expected, msg.Data())
+	}
+}
+
+func TestSplit(t *testing.T) {
+	source := make(chan struct{})
+	msg := WithConfirms(source, From(ops.Insert, "test", map[string]interface{}{"_id": "1"}))
+	msgs := Split(msg, 3)
+	if len(msgs) != 3 {
+		t.Fatalf("wrong number of copies, expected 3, got %d", len(msgs))
+	}
+	// a sink changing its copy leaves the other untouched
+	msgs[0].Data().Delete("_id")
+	if msgs[1].ID() != "1" || msg.ID() != "1" {
+		t.Errorf("copies share their data")
+	}
+	if msgs[0].Confirms() == msgs[1].Confirms() || msgs[0].Confirms() == source {
+		t.Fatalf("copies share their confirms")
+	}
+	for i, m := range msgs {
+		select {
+		case <-source:
+			t.Fatalf("source confirmed before every copy was")
+		default:
+		}
+		Confirmer(m)()
+		select {
+		case <-m.Confirms():
+		default:
+			t.Errorf("copy %d not confirmed", i)
+		}
+	}
+	select {
+	case <-source:
+	default:
+		t.Errorf("source not confirmed once every copy was")
+	}
+}
+
+func TestSplitSingle(t *testing.T) {
+	source := make(chan struct{})
+	msg := WithConfirms(source, From(ops.Insert, "test", map[string]interface{}{"_id": "1"}))
+	msgs := Split(msg, 1)
+	if len(msgs) != 1 || msgs[0] != msg {
+		t.Fatalf("a single node should get the message itself, got %+v", msgs)
+	}
+	Confirmer(msgs[0])()
+	select {
+	case <-source:
+	default:
+		t.Errorf("source not confirmed")
+	}
+
+	msgs = Split(From(ops.Insert, "test", nil), 2)
+	for _, m := range msgs {
+		if m.Confirms() != nil || m.Data() != nil || Confirmer(m) != nil {
+			t.Errorf("wrong copy of a message without confirms, got %+v", m)
+		}
+	}
+}
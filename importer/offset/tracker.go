@@ -0,0 +1,45 @@
+package offset
+
+import "sync"
+
+// Tracker commits the offsets of the messages sent to a writer in the order they were sent.
+// Writers acknowledge their messages out of order, e.g. when bulks are sent by several workers,
+// an offset is only committed once every message sent before it was acknowledged so that no
+// message is skipped on resume.
+type Tracker struct {
+	sync.Mutex
+	m       Manager
+	pending []*tracked
+}
+
+type tracked struct {
+	Offset
+	acked bool
+}
+
+// NewTracker returns a Tracker committing the offsets to m.
+func NewTracker(m Manager) *Tracker {
+	return &Tracker{m: m}
+}
+
+// Track adds the offset of a message sent to the writer, the func returned acknowledges it and
+// commits the offsets no longer waiting on an earlier one.
+func (t *Tracker) Track(o Offset) func() error {
+	t.Lock()
+	p := &tracked{Offset: o}
+	t.pending = append(t.pending, p)
+	t.Unlock()
+	return func() error {
+		t.Lock()
+		defer t.Unlock()
+		p.acked = true
+		for len(t.pending) > 0 && t.pending[0].acked {
+			if err := t.m.CommitOffset(t.pending[0].Offset, false); err != nil {
+				return err
+			}
+			t.pending[0] = nil
+			t.pending = t.pending[1:]
+		}
+		return nil
+	}
+}
@@ -0,0 +1,35 @@
+package offset_test
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/appbaseio/abc/importer/offset"
+)
+
+func TestTracker(t *testing.T) {
+	m := &offset.MockManager{MemoryMap: map[string]uint64{}}
+	tr := offset.NewTracker(m)
+	var acks []func() error
+	for i, ns := range []string{"a", "b", "a", "b"} {
+		acks = append(acks, tr.Track(offset.Offset{Namespace: ns, LogOffset: uint64(i)}))
+	}
+
+	// the later offsets wait on the first one
+	acks[3]()
+	acks[1]()
+	if len(m.OffsetMap()) != 0 {
+		t.Fatalf("offsets committed before the first was acknowledged, %v", m.OffsetMap())
+	}
+	acks[0]()
+	if expected := map[string]uint64{"a": 0, "b": 1}; !reflect.DeepEqual(m.OffsetMap(), expected) {
+		t.Errorf("wrong offsets, expected %v, got %v", expected, m.OffsetMap())
+	}
+	acks[2]()
+	if expected := map[string]uint64{"a": 2, "b": 3}; !reflect.DeepEqual(m.OffsetMap(), expected) {
+		t.Errorf("wrong offsets, expected %v, got %v", expected, m.OffsetMap())
+	}
+	if m.NewestOffset() != 3 {
+		t.Errorf("wrong newest offset, expected 3, got %d", m.NewestOffset())
+	}
+}
@@ -107,7 +107,9 @@ func (p *Pipe) Listen(fn func(message.Msg, offset.Offset) (message.Msg, error))
 				break
 			}
 			if len(p.Out) > 0 {
-				p.Send(outmsg, m.Off)
+				// the confirms of the message are closed by the writer of this node, the
+				// nodes below it are not waited on
+				p.Send(message.Copy(outmsg, nil), m.Off)
 			} else {
 				p.MessageCount++ // update the count anyway
 			}
@@ -154,13 +156,15 @@ func (p *Pipe) empty() bool {
 
 // Send emits the given message on the 'Out' channel.  the send Timesout after 100 ms in order to chaeck of the Pipe has stopped and we've been asked to exit.
 // If the Pipe has been stopped, the send will fail and there is no guarantee of either success or failure
+// Every Out channel gets its own copy of the message when there are several, see message.Split.
 func (p *Pipe) Send(msg message.Msg, off offset.Offset) {
 	p.MessageCount++
-	for _, ch := range p.Out {
+	msgs := message.Split(msg, len(p.Out))
+	for i, ch := range p.Out {
 	A:
 		for {
 			select {
-			case ch <- TrackedMessage{msg, off}:
+			case ch <- TrackedMessage{msgs[i], off}:
 				break A
 			}
 		}
@@ -7,7 +7,6 @@
 package pipeline
 
 import (
-	"context"
 	"encoding/json"
 	"errors"
 	"fmt"
@@ -65,7 +64,14 @@ type Node struct {
 	pipe          *pipe.Pipe
 	clog          *commitlog.CommitLog
 	om            offset.Manager
+	offsets       *offset.Tracker
 	resumeTimeout time.Duration
+	// err is the first error writing a message, the writers are not completed once set
+	errMu sync.Mutex
+	err   error
+	// closed is closed once the writer is, the confirmations of its last writes are awaited
+	// until then
+	closed chan struct{}
 }
 
 // Transform defines the struct for including a native function in the pipeline.
@@ -92,6 +98,7 @@ func NewNodeWithOptions(name, kind, ns string, options ...OptionFunc) (*Node, er
 		children:      make([]*Node, 0),
 		transforms:    make([]*Transform, 0),
 		done:          make(chan struct{}),
+		closed:        make(chan struct{}),
 		c:             &client.Mock{},
 		reader:        &client.MockReader{},
 		writer:        &client.MockWriter{},
@@ -179,6 +186,7 @@ func WithResumeTimeout(timeout time.Duration) OptionFunc {
 func WithOffsetManager(om offset.Manager) OptionFunc {
 	return func(n *Node) error {
 		n.om = om
+		n.offsets = offset.NewTracker(om)
 		return nil
 	}
 }
@@ -237,9 +245,9 @@ func (n *Node) Start() error {
 						if err != nil {
 							return err
 						}
-						go func(r io.Reader) {
+						go func(child *Node, r io.Reader) {
 							errc <- child.resume(n.clog.NewestOffset()-1, r)
-						}(r)
+						}(child, r)
 					} else {
 						errc <- nil
 					}
@@ -400,6 +408,11 @@ func (n *Node) start(nsMap map[string]client.MessageSet) error {
 			Timestamp: time.Now().Unix(),
 		})
 	}
+	if er, ok := n.reader.(client.ErrReader); ok {
+		if err := er.Err(); err != nil {
+			return err
+		}
+	}
 
 	n.l.Infoln("adaptor Start finished...")
 	return nil
@@ -409,61 +422,82 @@ func (n *Node) listen() (err error) {
 	n.l.Infoln("adaptor Listening...")
 	defer n.l.Infoln("adaptor Listen closed...")
 
-	return n.pipe.Listen(n.write)
+	return n.pipe.Listen(func(msg message.Msg, off offset.Offset) (message.Msg, error) {
+		m, err := n.write(msg, off)
+		if err != nil {
+			n.setErr(err)
+		}
+		return m, err
+	})
+}
+
+// setErr keeps the first error of the node.
+func (n *Node) setErr(err error) {
+	n.errMu.Lock()
+	defer n.errMu.Unlock()
+	if n.err == nil {
+		n.err = err
+	}
 }
 
 func (n *Node) write(msg message.Msg, off offset.Offset) (message.Msg, error) {
-	var writeErr error
+	// the source may be waiting on the confirmation of the message, msg is the copy of this node
+	confirm := message.Confirmer(msg)
 	if !n.nsFilter.MatchString(msg.Namespace()) {
 		n.l.With("ns", msg.Namespace()).Debugln("message skipped by namespace filter")
-		if n.om != nil {
-			n.om.CommitOffset(off, false)
-		}
+		n.skip(confirm, off)
 		return msg, nil
 	}
-	msg, writeErr = n.applyTransforms(msg)
-	if writeErr != nil {
-		return nil, writeErr
+	msg, err := n.applyTransforms(msg)
+	if err != nil {
+		return nil, err
 	} else if msg == nil {
+		n.skip(confirm, off)
+		return nil, nil
+	}
+	if n.om != nil || confirm != nil {
+		var ack func() error
 		if n.om != nil {
-			n.om.CommitOffset(off, false)
+			ack = n.offsets.Track(off)
 		}
-		return nil, nil
+		// transforms may return a new message
+		msg = message.WithConfirms(make(chan struct{}), msg)
+		go n.confirmWrite(msg.Confirms(), confirm, off, ack)
+	}
+	return client.Write(n.c, n.writer, msg)
+}
+
+// skip acknowledges a message that is not written by the node.
+func (n *Node) skip(confirm func(), off offset.Offset) {
+	if confirm != nil {
+		confirm()
 	}
 	if n.om != nil {
-		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
-		defer func() {
-			if writeErr != nil {
-				cancel()
-			}
-		}()
-		msg = message.WithConfirms(make(chan struct{}), msg)
-		go n.confirmWrite(ctx, msg.Confirms(), off)
+		n.offsets.Track(off)()
 	}
-	returnMsg, writeErr := client.Write(n.c, n.writer, msg)
-	return returnMsg, writeErr
 }
 
-func (n *Node) confirmWrite(ctx context.Context, confirmed chan struct{}, off offset.Offset) {
-	for {
-		select {
-		case <-confirmed:
-			if err := n.om.CommitOffset(off, false); err != nil {
-				n.l.Errorf("failed to commitoffset, %s", err)
-				return
-			}
-			n.l.Debugf("offset %d committed", off.LogOffset)
-			return
-		case <-ctx.Done():
-			if ctx.Err() == context.Canceled {
-				n.l.Debugln("offset commit canceled")
-				return
-			} else if ctx.Err() == context.DeadlineExceeded {
-				n.l.Debugln("time expired waiting for offset commit confirmation")
-				return
-			}
-		}
+// confirmWrite confirms a message to the source and acknowledges its offset once the writer
+// confirmed it. The messages still unconfirmed when the writer is closed are sent again on
+// resume.
+func (n *Node) confirmWrite(confirmed chan struct{}, confirm func(), off offset.Offset, ack func() error) {
+	select {
+	case <-confirmed:
+	case <-n.closed:
+		n.l.With("offset", off.LogOffset).Debugln("writer closed before confirming the offset")
+		return
+	}
+	if confirm != nil {
+		confirm()
 	}
+	if ack == nil {
+		return
+	}
+	if err := ack(); err != nil {
+		n.l.Errorf("failed to commitoffset, %s", err)
+		return
+	}
+	n.l.Debugf("offset %d acknowledged", off.LogOffset)
 }
 
 func (n *Node) applyTransforms(msg message.Msg) (message.Msg, error) {
@@ -500,12 +534,48 @@ func (n *Node) Stop() {
 }
 
 func (n *Node) stop() error {
+	err := n.drain()
+	n.close()
+	return err
+}
+
+// drain stops the node once it handled every message it received and flushed its writer, it
+// returns the first error writing them.
+func (n *Node) drain() error {
 	n.l.Infoln("adaptor Stopping...")
 	n.pipe.Stop()
 
 	close(n.done)
 	n.wg.Wait()
 
+	if flusher, ok := n.writer.(client.Flusher); ok {
+		n.l.Infoln("flushing writer...")
+		if err := flusher.Flush(); err != nil {
+			n.l.Errorf("unable to flush writer, %s", err)
+			n.setErr(err)
+		}
+	}
+
+	n.errMu.Lock()
+	defer n.errMu.Unlock()
+	return n.err
+}
+
+// complete completes the writer once every node of the pipeline drained without an error.
+func (n *Node) complete() error {
+	if completer, ok := n.writer.(client.Completer); ok {
+		n.l.Infoln("completing writer...")
+		if err := completer.Complete(); err != nil {
+			n.l.Errorf("unable to complete writer, %s", err)
+			return err
+		}
+	}
+	return nil
+}
+
+func (n *Node) close() {
+	// deferred first to run once the writer is closed
+	defer close(n.closed)
 	if closer, ok := n.writer.(client.Closer); ok {
 		defer func() {
 			n.l.Infoln("closing writer...")
@@ -522,7 +592,6 @@ func (n *Node) stop() error {
 	}
 
 	n.l.Infoln("adaptor Stopped")
-	return nil
 }
 
 // Validate ensures that the node tree conforms to a proper structure.
@@ -173,6 +173,10 @@ func (s *StopWriter) Close() {
 	s.Closed = true
 }
 
+func (s *StopWriter) Verify() error {
+	return nil
+}
+
 type SkipFunc struct {
 	UsingOp bool
 }
@@ -184,6 +188,62 @@ func (s *SkipFunc) Apply(msg message.Msg) (message.Msg, error) {
 	return nil, nil
 }
 
+// resumeDataDir holds the commit logs the resume tests start from, see writeResumeData.
+var resumeDataDir string
+
+// writeResumeData writes the commit logs of the resume tests to dir. restart_from_zero holds
+// 104016 messages, offsets 0 and 1 are in testC, up to 2998 in anotherCollection and the rest
+// in MyCollection. restart_from_middle is committed 2001 messages before its end in
+// copy_from_here, restart_from_end is committed up to its last message.
+func writeResumeData(dir string) error {
+	writeLog := func(path string, count int) error {
+		l, err := commitlog.New(commitlog.WithPath(path))
+		if err != nil {
+			return err
+		}
+		defer l.Close()
+		for i := 0; i < count; i++ {
+			ns := "MyCollection"
+			if i <= 1 {
+				ns = "testC"
+			} else if i <= 2998 {
+				ns = "anotherCollection"
+			}
+			if _, err := l.Append(commitlog.NewLogFromEntry(commitlog.LogEntry{
+				Key:   []byte(ns),
+				Mode:  commitlog.Copy,
+				Op:    ops.Insert,
+				Value: []byte(fmt.Sprintf(`{"_id":%d}`, i)),
+			})); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	writeOffset := func(path string, o offset.Offset) error {
+		l, err := commitlog.New(commitlog.WithPath(path))
+		if err != nil {
+			return err
+		}
+		defer l.Close()
+		_, err = l.Append(o.Bytes())
+		return err
+	}
+	if err := writeLog(filepath.Join(dir, "restart_from_zero"), 104016); err != nil {
+		return err
+	}
+	if err := writeLog(filepath.Join(dir, "restart_from_middle"), 4000); err != nil {
+		return err
+	}
+	if err := writeOffset(filepath.Join(dir, "restart_from_middle", "copy_from_here"), offset.Offset{Namespace: "MyCollection", LogOffset: 4000 - 2001}); err != nil {
+		return err
+	}
+	if err := writeLog(filepath.Join(dir, "restart_from_end"), 10); err != nil {
+		return err
+	}
+	return writeOffset(filepath.Join(dir, "restart_from_end", "__consumer_offsets-stopper"), offset.Offset{Namespace: "MyCollection", LogOffset: 9})
+}
+
 func scratchDataDir(suffix string) string {
 	rand.Seed(time.Now().Unix())
 	dataDir := filepath.Join(os.TempDir(), fmt.Sprintf("nodetest_%s_%d", suffix, rand.Int31()))
@@ -393,7 +453,7 @@ var stopTests = []struct {
 				WithClient(a),
 				WithReader(a),
 				WithCommitLog([]commitlog.OptionFunc{
-					commitlog.WithPath("testdata/restart_from_zero"),
+					commitlog.WithPath(filepath.Join(resumeDataDir, "restart_from_zero")),
 					commitlog.WithMaxSegmentBytes(1024),
 				}...),
 			)
@@ -412,15 +472,15 @@ var stopTests = []struct {
 	{
 		"resume_from_middle",
 		func() (*Node, *StopWriter, func()) {
-			os.Remove("testdata/restart_from_middle/__consumer_offsets-stopper/00000000000000000000.log")
-			in, _ := os.Open("testdata/restart_from_middle/copy_from_here/00000000000000000000.log")
-			os.MkdirAll("testdata/restart_from_middle/__consumer_offsets-stopper", 0777)
-			out, _ := os.Create("testdata/restart_from_middle/__consumer_offsets-stopper/00000000000000000000.log")
+			os.Remove(filepath.Join(resumeDataDir, "restart_from_middle/__consumer_offsets-stopper/00000000000000000000.log"))
+			in, _ := os.Open(filepath.Join(resumeDataDir, "restart_from_middle/copy_from_here/00000000000000000000.log"))
+			os.MkdirAll(filepath.Join(resumeDataDir, "restart_from_middle/__consumer_offsets-stopper"), 0777)
+			out, _ := os.Create(filepath.Join(resumeDataDir, "restart_from_middle/__consumer_offsets-stopper/00000000000000000000.log"))
 			io.Copy(out, in)
 			defer func() {
 				out.Close()
 				in.Close()
-				os.Remove("testdata/restart_from_middle/__consumer_offsets-stopper/00000000000000000000.log")
+				os.Remove(filepath.Join(resumeDataDir, "restart_from_middle/__consumer_offsets-stopper/00000000000000000000.log"))
 			}()
 
 			a := &StopWriter{}
@@ -429,11 +489,11 @@ var stopTests = []struct {
 				WithClient(a),
 				WithReader(a),
 				WithCommitLog([]commitlog.OptionFunc{
-					commitlog.WithPath("testdata/restart_from_middle"),
+					commitlog.WithPath(filepath.Join(resumeDataDir, "restart_from_middle")),
 					commitlog.WithMaxSegmentBytes(1024),
 				}...),
 			)
-			om, _ := offset.NewLogManager("testdata/restart_from_middle", "stopper")
+			om, _ := offset.NewLogManager(filepath.Join(resumeDataDir, "restart_from_middle"), "stopper")
 			NewNodeWithOptions(
 				"stopper", "stopWriter", defaultNsString,
 				WithClient(a),
@@ -454,11 +514,11 @@ var stopTests = []struct {
 				WithClient(a),
 				WithReader(a),
 				WithCommitLog([]commitlog.OptionFunc{
-					commitlog.WithPath("testdata/restart_from_end"),
+					commitlog.WithPath(filepath.Join(resumeDataDir, "restart_from_end")),
 					commitlog.WithMaxSegmentBytes(1024),
 				}...),
 			)
-			om, _ := offset.NewLogManager("testdata/restart_from_end", "stopper")
+			om, _ := offset.NewLogManager(filepath.Join(resumeDataDir, "restart_from_end"), "stopper")
 			NewNodeWithOptions(
 				"stopper", "stopWriter", defaultNsString,
 				WithClient(a),
@@ -479,7 +539,7 @@ var stopTests = []struct {
 				WithClient(a),
 				WithReader(a),
 				WithCommitLog([]commitlog.OptionFunc{
-					commitlog.WithPath("testdata/restart_from_zero"),
+					commitlog.WithPath(filepath.Join(resumeDataDir, "restart_from_zero")),
 					commitlog.WithMaxSegmentBytes(1024),
 				}...),
 			)
@@ -505,7 +565,7 @@ var stopTests = []struct {
 				WithClient(a),
 				WithReader(a),
 				WithCommitLog([]commitlog.OptionFunc{
-					commitlog.WithPath("testdata/restart_from_zero"),
+					commitlog.WithPath(filepath.Join(resumeDataDir, "restart_from_zero")),
 					commitlog.WithMaxSegmentBytes(1024),
 				}...),
 			)
@@ -535,7 +595,7 @@ var stopTests = []struct {
 				WithClient(a),
 				WithReader(a),
 				WithCommitLog([]commitlog.OptionFunc{
-					commitlog.WithPath("testdata/restart_from_zero"),
+					commitlog.WithPath(filepath.Join(resumeDataDir, "restart_from_zero")),
 					commitlog.WithMaxSegmentBytes(1024),
 				}...),
 			)
@@ -565,7 +625,7 @@ var stopTests = []struct {
 				WithClient(a),
 				WithReader(a),
 				WithCommitLog([]commitlog.OptionFunc{
-					commitlog.WithPath("testdata/restart_from_zero"),
+					commitlog.WithPath(filepath.Join(resumeDataDir, "restart_from_zero")),
 					commitlog.WithMaxSegmentBytes(1024),
 				}...),
 			)
@@ -650,7 +710,7 @@ var stopTests = []struct {
 				WithClient(a),
 				WithReader(a),
 				WithCommitLog([]commitlog.OptionFunc{
-					commitlog.WithPath("testdata/restart_from_zero"),
+					commitlog.WithPath(filepath.Join(resumeDataDir, "restart_from_zero")),
 					commitlog.WithMaxSegmentBytes(1024),
 				}...),
 			)
@@ -697,6 +757,10 @@ var stopTests = []struct {
 }
 
 func TestStop(t *testing.T) {
+	resumeDataDir = t.TempDir()
+	if err := writeResumeData(resumeDataDir); err != nil {
+		t.Fatalf("unable to write resume data, %s", err)
+	}
 	for _, st := range stopTests {
 		log.Infof("starting %s", st.name)
 		source, s, deferFunc := st.node()
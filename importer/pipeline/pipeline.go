@@ -1,6 +1,7 @@
 package pipeline
 
 import (
+	"sync"
 	"time"
 
 	"github.com/appbaseio/abc/importer/adaptor"
@@ -21,6 +22,13 @@ type Pipeline struct {
 	// the transporter is running
 	Err  error
 	done chan struct{}
+
+	// completed is set once the source read everything without an error, the writers are
+	// then completed when stopping if every node drained without an error
+	mu        sync.Mutex
+	stopping  bool
+	completed bool
+	stopOnce  sync.Once
 }
 
 // NewDefaultPipeline returns a new Transporter Pipeline with the given node tree, and
@@ -103,10 +111,42 @@ func (pipeline *Pipeline) String() string {
 
 // Stop sends a stop signal to the emitter and all the nodes, whether they are running or not.
 // the node's database adaptors are expected to clean up after themselves, and stop will block until
-// all nodes have stopped successfully
+// all nodes have stopped successfully. The writers are completed once every node wrote the
+// messages it received, an error doing so is set as the pipeline error.
 func (pipeline *Pipeline) Stop() {
+	pipeline.stopOnce.Do(pipeline.stop)
+}
+
+func (pipeline *Pipeline) stop() {
+	pipeline.mu.Lock()
+	pipeline.stopping = true
+	pipeline.mu.Unlock()
+
 	endpoints := pipeline.source.Endpoints()
-	pipeline.source.Stop()
+	var err error
+	pipeline.apply(func(node *Node) {
+		if nerr := node.drain(); nerr != nil && err == nil {
+			err = nerr
+		}
+	})
+	pipeline.mu.Lock()
+	completed := pipeline.completed && pipeline.Err == nil
+	pipeline.mu.Unlock()
+	if completed && err == nil {
+		pipeline.apply(func(node *Node) {
+			if err == nil {
+				err = node.complete()
+			}
+		})
+	}
+	pipeline.apply(func(node *Node) {
+		node.close()
+	})
+	pipeline.mu.Lock()
+	if err != nil && pipeline.Err == nil {
+		pipeline.Err = err
+	}
+	pipeline.mu.Unlock()
 
 	// pipeline has stopped, emit one last round of metrics and send the exit event
 	close(pipeline.done)
@@ -116,7 +156,8 @@ func (pipeline *Pipeline) Stop() {
 	close(pipeline.source.pipe.Err)
 }
 
-// Run the pipeline
+// Run the pipeline, the writers are only completed by Stop so its error is set in Err once
+// stopped.
 func (pipeline *Pipeline) Run() error {
 	endpoints := pipeline.source.Endpoints()
 	// send a boot event
@@ -124,15 +165,19 @@ func (pipeline *Pipeline) Run() error {
 
 	// start the source
 	err := pipeline.source.Start()
+	pipeline.mu.Lock()
+	defer pipeline.mu.Unlock()
 	if err != nil && pipeline.Err == nil {
 		pipeline.Err = err // only set it if it hasn't been set already.
 	}
+	// the pipeline was not stopped by an error or an interrupt while reading
+	pipeline.completed = pipeline.Err == nil && !pipeline.stopping
 
 	return pipeline.Err
 }
 
 // start error listener consumes all the events on the pipe's Err channel, and stops the pipeline
-// when it receives one
+// when it receives one. The nodes may still send errors while stopping so it keeps listening.
 func (pipeline *Pipeline) startErrorListener(cherr chan error) {
 	for {
 		select {
@@ -146,11 +191,13 @@ func (pipeline *Pipeline) startErrorListener(cherr chan error) {
 					log.With("path", aerr.Path).Errorln(aerr)
 				}
 			} else {
+				pipeline.mu.Lock()
 				if pipeline.Err == nil {
 					pipeline.Err = err
 				}
+				pipeline.mu.Unlock()
 			}
-			pipeline.Stop()
+			go pipeline.Stop()
 		case <-pipeline.done:
 			return
 		}
@@ -71,12 +71,12 @@ func TestEventsBroadcast(t *testing.T) {
 	defer os.RemoveAll(dataDir)
 
 	// set up the nodes
-	f, err := adaptor.GetAdaptor("file", adaptor.Config{"uri": "file://" + outFile})
+	f, err := adaptor.GetAdaptor("jsonl", adaptor.Config{"uri": "file://" + outFile, "typeName": "test"})
 	if err != nil {
 		t.Fatalf("can't create GetAdaptor, got %s", err)
 	}
 	dummyOutNode, err := NewNodeWithOptions(
-		"dummyFileOut", "file", "/.*",
+		"dummyFileOut", "jsonl", "/.*",
 		WithClient(f),
 		WithReader(f),
 		WithCommitLog([]commitlog.OptionFunc{
@@ -86,7 +86,7 @@ func TestEventsBroadcast(t *testing.T) {
 	if err != nil {
 		t.Fatalf("can't create NewNode, got %s", err)
 	}
-	f, err = adaptor.GetAdaptor("file", adaptor.Config{"uri": "file://" + inFile})
+	f, err = adaptor.GetAdaptor("json", adaptor.Config{"uri": "file://" + inFile, "typeName": "test"})
 	if err != nil {
 		t.Fatalf("can't create GetAdaptor, got %s", err)
 	}
@@ -95,7 +95,7 @@ func TestEventsBroadcast(t *testing.T) {
 		t.Fatalf("unexpected NewLogManager error, %s", err)
 	}
 	_, err = NewNodeWithOptions(
-		"dummyFileIn", "file", "/.*/",
+		"dummyFileIn", "json", "/.*/",
 		WithParent(dummyOutNode),
 		WithClient(f),
 		WithWriter(f),
@@ -22,6 +22,10 @@ func setupFiles(in, out string) {
 	os.Remove(out)
 	os.Remove(in)
 
+	// the sink only writes to an existing file
+	sink, _ := os.Create(in)
+	sink.Close()
+
 	fh, _ := os.Create(out)
 	defer fh.Close()
 	fh.WriteString("{\"_id\":\"546656989330a846dc7ce327\",\"test\":\"hello world\"}\n")
@@ -46,12 +50,12 @@ func TestFileToFile(t *testing.T) {
 
 	numgorosBefore := runtime.NumGoroutine()
 	// create the source node and attach our sink
-	f, err := adaptor.GetAdaptor("file", adaptor.Config{"uri": "file://" + outFile})
+	f, err := adaptor.GetAdaptor("jsonl", adaptor.Config{"uri": "file://" + outFile, "typeName": "test"})
 	if err != nil {
 		t.Fatalf("can't create GetAdaptor, got %s", err)
 	}
 	outNode, err := NewNodeWithOptions(
-		"localfileout", "file", "/.*",
+		"localfileout", "jsonl", "/.*",
 		WithClient(f),
 		WithReader(f),
 		WithCommitLog([]commitlog.OptionFunc{
@@ -61,7 +65,7 @@ func TestFileToFile(t *testing.T) {
 	if err != nil {
 		t.Fatalf("can't create newnode, got %s", err)
 	}
-	f, err = adaptor.GetAdaptor("file", adaptor.Config{"uri": "file://" + inFile})
+	f, err = adaptor.GetAdaptor("json", adaptor.Config{"uri": "file://" + inFile, "typeName": "test"})
 	if err != nil {
 		t.Fatalf("can't create GetAdaptor, got %s", err)
 	}
@@ -70,7 +74,7 @@ func TestFileToFile(t *testing.T) {
 		t.Fatalf("unexpected NewLogManager error, %s", err)
 	}
 	_, err = NewNodeWithOptions(
-		"localfilein", "file", "/.*/",
+		"localfilein", "json", "/.*/",
 		WithParent(outNode),
 		WithClient(f),
 		WithWriter(f),
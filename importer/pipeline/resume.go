@@ -1,8 +1,10 @@
 package pipeline
 
 import (
+	"bytes"
 	"encoding/json"
 	"io"
+	"strconv"
 
 	"github.com/appbaseio/abc/importer/client"
 	"github.com/appbaseio/abc/importer/commitlog"
@@ -25,10 +27,12 @@ func readResumeData(r io.Reader) (resumeData, error) {
 	rd.offset = logOffset
 	rd.ns = string(entry.Key)
 	d := make(map[string]interface{})
-	if err := json.Unmarshal(entry.Value, &d); err != nil {
+	dec := json.NewDecoder(bytes.NewReader(entry.Value))
+	dec.UseNumber()
+	if err := dec.Decode(&d); err != nil {
 		return resumeData{}, err
 	}
-	data, err := mejson.Unmarshal(d)
+	data, err := mejson.Unmarshal(numbers(d).(map[string]interface{}))
 	if err != nil {
 		return resumeData{}, err
 	}
@@ -39,3 +43,28 @@ func readResumeData(r io.Reader) (resumeData, error) {
 	}
 	return rd, nil
 }
+
+// numbers converts the json.Number values of a log entry, integers are kept as int64, or uint64
+// above it, so that the keys the SQL readers resume from keep their precision.
+func numbers(v interface{}) interface{} {
+	switch v := v.(type) {
+	case map[string]interface{}:
+		for k, e := range v {
+			v[k] = numbers(e)
+		}
+	case []interface{}:
+		for i, e := range v {
+			v[i] = numbers(e)
+		}
+	case json.Number:
+		if i, err := v.Int64(); err == nil {
+			return i
+		}
+		if u, err := strconv.ParseUint(string(v), 10, 64); err == nil {
+			return u
+		}
+		f, _ := v.Float64()
+		return f
+	}
+	return v
+}
@@ -0,0 +1,60 @@
+package pipeline
+
+import (
+	"bytes"
+	"encoding/json"
+	"reflect"
+	"testing"
+
+	"github.com/appbaseio/abc/importer/commitlog"
+	"github.com/appbaseio/abc/importer/message/ops"
+	"github.com/compose/mejson"
+)
+
+func TestReadResumeData(t *testing.T) {
+	data := map[string]interface{}{
+		"id":    int64(1<<53 + 1),
+		"big":   uint64(1<<64 - 1),
+		"price": 1.5,
+	}
+	d, _ := mejson.Marshal(data)
+	b, _ := json.Marshal(d)
+	l := commitlog.NewLogFromEntry(commitlog.LogEntry{
+		Key:   []byte("orders"),
+		Mode:  commitlog.Copy,
+		Op:    ops.Insert,
+		Value: b,
+	})
+	rd, err := readResumeData(bytes.NewReader(l))
+	if err != nil {
+		t.Fatalf("unexpected readResumeData error, %s", err)
+	}
+	if got := rd.msg.Msg.Data().AsMap(); !reflect.DeepEqual(got, data) {
+		t.Errorf("wrong data, expected %v, got %v", data, got)
+	}
+}
+
+var numbersTests = []struct {
+	name     string
+	in       interface{}
+	expected interface{}
+}{
+	{"int", json.Number("42"), int64(42)},
+	{"negative int", json.Number("-9007199254740993"), int64(-9007199254740993)},
+	{"uint", json.Number("18446744073709551615"), uint64(18446744073709551615)},
+	{"float", json.Number("1.5"), 1.5},
+	{"string", "42", "42"},
+	{
+		"nested",
+		map[string]interface{}{"a": []interface{}{json.Number("1"), map[string]interface{}{"b": json.Number("2.5")}}},
+		map[string]interface{}{"a": []interface{}{int64(1), map[string]interface{}{"b": 2.5}}},
+	},
+}
+
+func TestNumbers(t *testing.T) {
+	for _, nt := range numbersTests {
+		if got := numbers(nt.in); !reflect.DeepEqual(got, nt.expected) {
+			t.Errorf("[%s] wrong value, expected %#v, got %#v", nt.name, nt.expected, got)
+		}
+	}
+}